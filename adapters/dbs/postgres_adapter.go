@@ -3,65 +3,452 @@ package dbs
 import (
 	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"strconv"
+	"time"
 
 	sqlc_generated "github.com/Archisman-Mridha/outboxer/adapters/dbs/sql/generated"
 	"github.com/Archisman-Mridha/outboxer/domain/ports"
 	"github.com/Archisman-Mridha/outboxer/utils"
 )
 
+// defaultCleanBatchSize is the number of rows deleted at once, when no batch size is given.
+const defaultCleanBatchSize= 1000
+
 type PostgresAdapter struct {
 	connection *sql.DB
 	queries *sqlc_generated.Queries
+
+	logger *slog.Logger
+
+	// partitioning is set when the outbox table is partitioned (see EnablePartitioning).
+	partitioning *PartitioningOptions
+	// sharding is set when the outbox table is shared by several replicas (see EnableSharding).
+	sharding *sharding
+
+	// ownsConnection is false when the connection was handed over by the caller. In that case, the
+	// caller is responsible for closing it.
+	ownsConnection bool
 }
 
-func NewPostgresAdapter(uri string) *PostgresAdapter {
-	p := &PostgresAdapter{ }
+// NewPostgresAdapter connects to Postgres. If that fails, a *utils.ConnectionError is returned.
+func NewPostgresAdapter(uri string, logger *slog.Logger) (*PostgresAdapter, error) {
+	connection, err := utils.ConnectPostgres(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewPostgresAdapterFromConnection(connection, logger)
+	p.ownsConnection= true
+
+	p.logger.Info("Connected to Postgres")
+
+	return p, nil
+}
 
-	p.connection= utils.ConnectPostgres(uri)
-	p.queries= sqlc_generated.New(p.connection)
+// NewPostgresAdapterFromConnection creates a PostgresAdapter on top of an existing connection pool.
+// Use it when embedding outboxer inside a service which already talks to the database.
+// A nil logger is replaced by the default logger.
+func NewPostgresAdapterFromConnection(connection *sql.DB, logger *slog.Logger) *PostgresAdapter {
+	return &PostgresAdapter{
+		connection: connection,
+		queries: sqlc_generated.New(connection),
 
-	return p
+		logger: utils.LoggerOrDefault(logger).With("source", "postgres"),
+	}
 }
 
 func(p *PostgresAdapter) Disconnect( ) {
+	if p.sharding != nil {
+		p.leaveShards( )
+	}
+
+	if !p.ownsConnection {
+		return
+	}
+
 	if err := p.connection.Close( ); err != nil {
-		log.Printf("❌ Error closing connection to the database: %v", err)
+		p.logger.Error("Error closing connection to Postgres", "error", err)
+		return
 	}
-	log.Println("Closed connection to Postgres")
+	p.logger.Info("Closed connection to Postgres")
+}
+
+func(p *PostgresAdapter) Ping( ) error {
+	return p.connection.Ping( )
 }
 
 func(p *PostgresAdapter) GetMessages(args *ports.GetMessagesArgs) {
-	rows, err := p.queries.GetUnpublishedMessages(context.Background( ), int32(args.BatchSize))
+	var (
+		rows []sqlc_generated.GetUnpublishedMessagesRow
+		err error
+	)
+	if p.sharding == nil {
+		rows, err= p.queries.GetUnpublishedMessages(context.Background( ), int32(args.BatchSize))
+	} else {
+		rows, err= p.getUnpublishedMessagesInOwnedShards(context.Background( ), args.BatchSize)
+	}
 	if err != nil {
 		if err != sql.ErrNoRows {
-			log.Printf("❌ Error executing SQL query : %v", err)
+			p.logger.Error("Error fetching unpublished messages", "error", err)
 		}
 		return
 	}
 
 	for _, row := range rows {
-		args.ToBePublishedItemsChan <- &ports.ToBePublishedItem{
-			RowId: string(row.ID),
+		item := &ports.ToBePublishedItem{
+			RowId: strconv.Itoa(int(row.ID)),
+			MessageId: row.MessageID.String( ),
 			Message: row.Message,
+			CreatedAt: row.CreatedOn,
+			Attempt: int(row.Attempts),
+			Topic: row.Topic.String,
+			Key: row.AggregateKey.String,
+			ContentEncoding: row.ContentEncoding.String,
+			DeliverAfter: row.DeliverAfter.Time,
+			Headers: map[string]string{ },
+		}
+		if row.Traceparent.Valid {
+			item.Headers["traceparent"]= row.Traceparent.String
 		}
+
+		args.ToBePublishedItemsChan <- item
+	}
+}
+
+// UpdatePublishStatusBatch marks the published messages and unlocks the failed ones with a single
+// statement each.
+func(p *PostgresAdapter) UpdatePublishStatusBatch(args *ports.UpdatePublishStatusBatchArgs) []*ports.Acknowledgement {
+	acknowledgements := make([]*ports.Acknowledgement, 0, len(args.PublishResults))
+
+	var publishedIds, failedIds, rejectedIds []int32
+	for _, result := range args.PublishResults {
+		id, err := strconv.Atoi(result.RowId)
+		if err != nil {
+			acknowledgements= append(acknowledgements, &ports.Acknowledgement{
+				RowId: result.RowId,
+				Err: fmt.Errorf("invalid row id %s: %w", result.RowId, err),
+			})
+			continue
+		}
+
+		switch {
+			case result.IsPublished:
+				publishedIds= append(publishedIds, int32(id))
+
+			case result.IsRejected:
+				rejectedIds= append(rejectedIds, int32(id))
+
+			default:
+				failedIds= append(failedIds, int32(id))
+		}
+	}
+
+	acknowledge := func(ids []int32, err error) {
+		for _, id := range ids {
+			acknowledgements= append(acknowledgements, &ports.Acknowledgement{ RowId: strconv.Itoa(int(id)), Err: err })
+		}
+	}
+
+	if len(publishedIds) > 0 {
+		err := p.queries.MarkMessagesPublished(context.Background( ), publishedIds)
+		if err != nil {
+			p.logger.Error("Error marking messages as published", "messages", len(publishedIds), "error", err)
+		}
+		acknowledge(publishedIds, err)
+	}
+
+	if len(failedIds) > 0 {
+		err := p.queries.UnlockMessagesFailedTobePublishedBatch(context.Background( ), sqlc_generated.UnlockMessagesFailedTobePublishedBatchParams{
+			MaxAttempts: int32(args.MaxAttempts),
+			Ids: failedIds,
+		})
+		if err != nil {
+			p.logger.Error("Error unlocking messages which weren't published", "messages", len(failedIds), "error", err)
+		}
+		acknowledge(failedIds, err)
+	}
+
+	// Since the attempts are counted when fetching, a single attempt dead letters the messages.
+	if len(rejectedIds) > 0 {
+		err := p.queries.UnlockMessagesFailedTobePublishedBatch(context.Background( ), sqlc_generated.UnlockMessagesFailedTobePublishedBatchParams{
+			MaxAttempts: 1,
+			Ids: rejectedIds,
+		})
+		if err != nil {
+			p.logger.Error("Error dead lettering rejected messages", "messages", len(rejectedIds), "error", err)
+		}
+		acknowledge(rejectedIds, err)
+	}
+
+	return acknowledgements
+}
+
+func(p *PostgresAdapter) GetMessagesForReplay(args *ports.GetMessagesForReplayArgs) error {
+	params := sqlc_generated.GetPublishedMessagesForReplayParams{
+		CreatedAfter: args.Filter.CreatedAfter,
+		CreatedBefore: args.Filter.CreatedBefore,
+		ToID: math.MaxInt32,
+		Topic: args.Filter.Topic,
+		MaxRows: int32(args.BatchSize),
+	}
+	if params.CreatedBefore.IsZero( ) {
+		params.CreatedBefore= time.Now( )
+	}
+	if args.Filter.FromRowId != "" {
+		fromId, err := strconv.Atoi(args.Filter.FromRowId)
+		if err != nil {
+			return fmt.Errorf("invalid row id %s: %w", args.Filter.FromRowId, err)
+		}
+		params.AfterID= int32(fromId - 1)
+	}
+	if args.Filter.ToRowId != "" {
+		toId, err := strconv.Atoi(args.Filter.ToRowId)
+		if err != nil {
+			return fmt.Errorf("invalid row id %s: %w", args.Filter.ToRowId, err)
+		}
+		params.ToID= int32(toId)
+	}
+
+	// Messages are fetched batch by batch, using the id of the last fetched message as the cursor.
+	for {
+		rows, err := p.queries.GetPublishedMessagesForReplay(args.Context, params)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			item := &ports.ToBePublishedItem{
+				RowId: strconv.Itoa(int(row.ID)),
+				MessageId: row.MessageID.String( ),
+				Message: row.Message,
+				CreatedAt: row.CreatedOn,
+				Attempt: int(row.Attempts),
+				Topic: row.Topic.String,
+				ContentEncoding: row.ContentEncoding.String,
+				Headers: map[string]string{ },
+			}
+			if row.Traceparent.Valid {
+				item.Headers["traceparent"]= row.Traceparent.String
+			}
+
+			select {
+				case args.ToBePublishedItemsChan <- item:
+
+				case <- args.Context.Done( ):
+					return args.Context.Err( )
+			}
+		}
+
+		if len(rows) < args.BatchSize {
+			return nil
+		}
+		params.AfterID= rows[len(rows) - 1].ID
 	}
 }
 
 func(p *PostgresAdapter) UnlockMessagesAndUpdatePublishStatus(args *ports.UnlockMessagesAndUpdatePublishStatusArgs) {
 	for item := range args.PublishResultsChan {
-		if !item.IsPublished {
-			id, _ := strconv.Atoi(item.RowId)
-			if err := p.queries.UnlockMessagesFailedTobePublished(context.Background( ), int32(id)); err != nil {
-				log.Printf("❌ Error executing SQL query: %v", err)
-			}
+		id, _ := strconv.Atoi(item.RowId)
+
+		var err error
+		if item.IsPublished {
+			err= p.queries.MarkMessagePublished(context.Background( ), int32(id))
+		} else {
+			err= p.queries.UnlockMessagesFailedTobePublished(context.Background( ), sqlc_generated.UnlockMessagesFailedTobePublishedParams{
+				MaxAttempts: int32(maxAttempts(item, args.MaxAttempts)),
+				ID: int32(id),
+			})
+		}
+		if err != nil {
+			p.logger.Error("Error updating publish status", "row_id", item.RowId, "published", item.IsPublished, "error", err)
+		}
+
+		if args.AcknowledgementsChan != nil {
+			args.AcknowledgementsChan <- &ports.Acknowledgement{ RowId: item.RowId, Err: err }
 		}
 	}
 }
 
-func(p *PostgresAdapter) Clean( ) {
-	if err := p.queries.DeleteRowsWithPublishedMessages(context.Background( )); err != nil {
-		log.Printf("❌ Error executing SQL query : %v", err)
+// maxAttempts returns the number of attempts after which the message, which wasn't published, is
+// dead lettered. The rejected messages are dead lettered after the current attempt.
+func maxAttempts(result *ports.PublishResult, configured int) int {
+	if result.IsRejected {
+		return 1
 	}
-}
\ No newline at end of file
+	return configured
+}
+
+func(p *PostgresAdapter) Clean(args *ports.CleanArgs) (int64, error) {
+	if p.partitioning != nil {
+		if err := p.createPartitions(time.Now( )); err != nil {
+			return 0, err
+		}
+		return p.dropPublishedPartitions(args)
+	}
+
+	publishedBefore := time.Now( ).Add(-args.Retention)
+	if args.BatchSize <= 0 {
+		args.BatchSize= defaultCleanBatchSize
+	}
+
+	if !args.Archive {
+		return p.deletePublishedMessages(publishedBefore, args.BatchSize)
+	}
+
+	if err := p.createHistoryPartitions(publishedBefore); err != nil {
+		return 0, fmt.Errorf("error creating partitions of the outbox history table: %w", err)
+	}
+
+	var count int64
+	for {
+		archived, err := p.queries.ArchivePublishedMessagesBatch(context.Background( ), sqlc_generated.ArchivePublishedMessagesBatchParams{
+			PublishedBefore: publishedBefore,
+			BatchSize: int32(args.BatchSize),
+		})
+		count += archived
+		if err != nil || archived < int64(args.BatchSize) {
+			return count, err
+		}
+	}
+}
+
+// deletePublishedMessages deletes the messages published before the given time, batch by batch.
+func(p *PostgresAdapter) deletePublishedMessages(publishedBefore time.Time, batchSize int) (int64, error) {
+	var count int64
+	for {
+		deleted, err := p.queries.DeletePublishedMessagesBatch(context.Background( ), sqlc_generated.DeletePublishedMessagesBatchParams{
+			PublishedBefore: publishedBefore,
+			BatchSize: int32(batchSize),
+		})
+		count += deleted
+		if err != nil || deleted < int64(batchSize) {
+			return count, err
+		}
+	}
+}
+
+// createHistoryPartitions creates the monthly partitions of the outbox history table, which the
+// messages published before the given time will be archived to.
+func(p *PostgresAdapter) createHistoryPartitions(publishedBefore time.Time) error {
+	oldestPublishedOn, err := p.queries.GetOldestPublishedOn(context.Background( ), publishedBefore)
+	if err != nil {
+		return err
+	}
+
+	oldestPublishedOn= oldestPublishedOn.UTC( )
+	month := time.Date(oldestPublishedOn.Year( ), oldestPublishedOn.Month( ), 1, 0, 0, 0, 0, time.UTC)
+	for ; !month.After(publishedBefore); month= month.AddDate(0, 1, 0) {
+		statement := fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS outbox_history_%s PARTITION OF outbox_history FOR VALUES FROM ('%s') TO ('%s')",
+			month.Format("2006_01"), month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339),
+		)
+		if _, err := p.connection.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func(p *PostgresAdapter) GetStats( ) (*ports.OutboxStats, error) {
+	stats, err := p.queries.GetOutboxStats(context.Background( ))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.OutboxStats{
+		Backlog: stats.Backlog,
+		Locked: stats.Locked,
+	}, nil
+}
+
+func(p *PostgresAdapter) GetStatus( ) (*ports.OutboxStatus, error) {
+	status, err := p.queries.GetOutboxStatus(context.Background( ))
+	if err != nil {
+		return nil, err
+	}
+
+	outboxStatus := &ports.OutboxStatus{
+		Backlog: status.Backlog,
+		Locked: status.Locked,
+		Failed: status.Failed,
+		DeadLettered: status.DeadLettered,
+		Scheduled: status.Scheduled,
+	}
+	if status.Backlog > 0 {
+		outboxStatus.OldestUnpublishedAt= status.OldestUnpublishedOn
+	}
+
+	return outboxStatus, nil
+}
+
+func(p *PostgresAdapter) ListMessages(state ports.MessageState, limit int) ([]*ports.OutboxMessage, error) {
+	switch state {
+		case ports.MessageStateUnpublished, ports.MessageStateLocked, ports.MessageStateFailed,
+			ports.MessageStateDeadLetter, ports.MessageStatePublished, ports.MessageStateScheduled:
+
+		default:
+			return nil, ports.ErrUnsupportedMessageState
+	}
+
+	rows, err := p.queries.ListMessages(context.Background( ), sqlc_generated.ListMessagesParams{
+		State: string(state),
+		MaxRows: int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*ports.OutboxMessage, 0, len(rows))
+	for _, row := range rows {
+		messages= append(messages, &ports.OutboxMessage{
+			RowId: strconv.Itoa(int(row.ID)),
+			Size: int(row.Size),
+
+			CreatedAt: row.CreatedOn,
+			Attempts: int(row.Attempts),
+			DeliverAfter: row.DeliverAfter.Time,
+
+			Locked: row.Locked.Bool,
+			LockedAt: row.LockedOn.Time,
+
+			Published: row.Published.Bool,
+			PublishedAt: row.PublishedOn.Time,
+
+			DeadLettered: row.DeadLettered,
+		})
+	}
+
+	return messages, nil
+}
+
+func(p *PostgresAdapter) UnlockMessage(rowId string) (bool, error) {
+	id, err := strconv.Atoi(rowId)
+	if err != nil {
+		return false, fmt.Errorf("invalid row id %s: %w", rowId, err)
+	}
+
+	count, err := p.queries.UnlockMessage(context.Background( ), int32(id))
+	return count > 0, err
+}
+
+func(p *PostgresAdapter) CancelScheduledMessage(rowId string) (bool, error) {
+	id, err := strconv.Atoi(rowId)
+	if err != nil {
+		return false, fmt.Errorf("invalid row id %s: %w", rowId, err)
+	}
+
+	count, err := p.queries.CancelScheduledMessage(context.Background( ), int32(id))
+	return count > 0, err
+}
+
+func(p *PostgresAdapter) RequeueDeadLetteredMessages( ) (int64, error) {
+	return p.queries.RequeueDeadLetteredMessages(context.Background( ))
+}
+
+func(p *PostgresAdapter) PurgePublishedMessages(publishedBefore time.Time) (int64, error) {
+	return p.deletePublishedMessages(publishedBefore, defaultCleanBatchSize)
+}
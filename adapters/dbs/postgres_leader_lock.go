@@ -0,0 +1,101 @@
+package dbs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+// PostgresLeaderLock is a ports.LeaderLock backed by a Postgres session level advisory lock. The
+// lock is held by a dedicated connection, taken out of the pool : it's released as soon as that
+// connection is closed, including when the leader dies.
+type PostgresLeaderLock struct {
+	connection *sql.DB
+	key int64
+
+	logger *slog.Logger
+
+	mutex sync.Mutex
+	// session is the connection holding the advisory lock, while this replica is the leader.
+	session *sql.Conn
+}
+
+// NewPostgresLeaderLock creates a PostgresLeaderLock named name, on top of the given connection
+// pool. The replicas using the same name compete for the same lock.
+func NewPostgresLeaderLock(connection *sql.DB, name string, logger *slog.Logger) *PostgresLeaderLock {
+	hash := fnv.New64a( )
+	hash.Write([]byte(name))
+
+	return &PostgresLeaderLock{
+		connection: connection,
+		key: int64(hash.Sum64( )),
+
+		logger: utils.LoggerOrDefault(logger).With("leader_lock", name),
+	}
+}
+
+// LeaderLock returns a PostgresLeaderLock on top of the connection pool of the adapter.
+func(p *PostgresAdapter) LeaderLock(name string) *PostgresLeaderLock {
+	return NewPostgresLeaderLock(p.connection, name, p.logger)
+}
+
+func(p *PostgresLeaderLock) TryAcquire( ) (bool, error) {
+	p.mutex.Lock( )
+	defer p.mutex.Unlock( )
+
+	ctx := context.Background( )
+
+	// The lock lives as long as the session holding it. So, the leader only needs to make sure that
+	// the session is still alive.
+	if p.session != nil {
+		if err := p.session.PingContext(ctx); err != nil {
+			p.closeSession( )
+			return false, err
+		}
+		return true, nil
+	}
+
+	session, err := p.connection.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var isAcquired bool
+	if err := session.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", p.key).Scan(&isAcquired); err != nil {
+		session.Close( )
+		return false, err
+	}
+	if !isAcquired {
+		session.Close( )
+		return false, nil
+	}
+
+	p.session= session
+	return true, nil
+}
+
+func(p *PostgresLeaderLock) Release( ) error {
+	p.mutex.Lock( )
+	defer p.mutex.Unlock( )
+
+	if p.session == nil {
+		return nil
+	}
+	defer p.closeSession( )
+
+	_, err := p.session.ExecContext(context.Background( ), "SELECT pg_advisory_unlock($1)", p.key)
+	return err
+}
+
+// closeSession closes the session holding the lock, instead of returning it to the pool : that way,
+// the advisory lock can't outlive the leadership, even if unlocking it failed. Returning
+// driver.ErrBadConn from Raw makes database/sql discard the connection and close it.
+func(p *PostgresLeaderLock) closeSession( ) {
+	p.session.Raw(func(interface{ }) error { return driver.ErrBadConn })
+	p.session= nil
+}
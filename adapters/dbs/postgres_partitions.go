@@ -0,0 +1,286 @@
+package dbs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// PartitioningOptions configures how the PostgresAdapter manages the partitions of a partitioned
+// outbox table (see sql/partitioned_schema.sql).
+type PartitioningOptions struct {
+	// Interval is the range of creation times covered by each partition : either an hour or a day
+	// (default).
+	Interval time.Duration
+	// Premake is the number of upcoming partitions which are created ahead of time. Defaults to 3.
+	Premake int
+}
+
+const (
+	defaultPartitionPremake= 3
+
+	partitionNamePrefix= "outbox_p"
+
+	// defaultPartitionName is the name of the DEFAULT partition of the outbox table, which receives
+	// the messages created while no partition covers their creation time : when outboxer has been
+	// down for longer than the premake window.
+	defaultPartitionName= "outbox_default"
+)
+
+// EnablePartitioning makes the adapter manage the partitions of the outbox table. The upcoming
+// partitions are created right away, and then every time the outbox DB is cleaned. Cleaning drops
+// the old partitions, whose messages have all been published, instead of deleting rows.
+func(p *PostgresAdapter) EnablePartitioning(options PartitioningOptions) error {
+	switch options.Interval {
+		case 0:
+			options.Interval= 24 * time.Hour
+
+		case time.Hour, 24 * time.Hour:
+
+		default:
+			return fmt.Errorf("unsupported partition interval %s : use 1h or 24h", options.Interval)
+	}
+	if options.Premake <= 0 {
+		options.Premake= defaultPartitionPremake
+	}
+	p.partitioning= &options
+
+	return p.createPartitions(time.Now( ))
+}
+
+// createPartitions creates the partition covering the given time, along with the upcoming ones, and
+// the default partition. The ranges for which the default partition already holds messages can't be
+// covered by a partition anymore : they're skipped, their messages staying in the default partition.
+func(p *PostgresAdapter) createPartitions(now time.Time) error {
+	statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF outbox DEFAULT", defaultPartitionName)
+	if _, err := p.connection.Exec(statement); err != nil {
+		return fmt.Errorf("error creating partition %s: %w", defaultPartitionName, err)
+	}
+
+	for _, partition := range p.upcomingPartitions(now) {
+		to := partition.from.Add(p.partitioning.Interval)
+
+		var isCoveredByDefault bool
+		err := p.connection.QueryRow(
+			fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE created_on >= $1 AND created_on < $2)", defaultPartitionName),
+			partition.from, to,
+		).Scan(&isCoveredByDefault)
+		if err != nil {
+			return fmt.Errorf("error creating partition %s: %w", partition.name, err)
+		}
+		if isCoveredByDefault {
+			p.logger.Warn("Skipped creating partition, since the default partition holds messages of its range", "partition", partition.name)
+			continue
+		}
+
+		statement := fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s PARTITION OF outbox FOR VALUES FROM ('%s') TO ('%s')",
+			partition.name, partition.from.Format(time.RFC3339), to.Format(time.RFC3339),
+		)
+		if _, err := p.connection.Exec(statement); err != nil {
+			return fmt.Errorf("error creating partition %s: %w", partition.name, err)
+		}
+	}
+
+	return nil
+}
+
+// upcomingPartitions returns the partition covering the given time, followed by the premake
+// upcoming ones.
+func(p *PostgresAdapter) upcomingPartitions(now time.Time) []partition {
+	start := now.UTC( ).Truncate(p.partitioning.Interval)
+
+	partitions := make([]partition, 0, p.partitioning.Premake + 1)
+	for i := 0; i <= p.partitioning.Premake; i++ {
+		from := start.Add(time.Duration(i) * p.partitioning.Interval)
+		partitions= append(partitions, partition{ name: p.partitionName(from), from: from })
+	}
+	return partitions
+}
+
+// dropPublishedPartitions drops the partitions which only cover creation times older than the
+// retention, and whose messages have all been published more than the retention ago. With
+// args.Archive, the messages are copied to the outbox history table first. It returns the number of
+// dropped messages.
+func(p *PostgresAdapter) dropPublishedPartitions(args *ports.CleanArgs) (int64, error) {
+	publishedBefore := time.Now( ).Add(-args.Retention)
+
+	if args.Archive {
+		if err := p.createHistoryPartitions(publishedBefore); err != nil {
+			return 0, fmt.Errorf("error creating partitions of the outbox history table: %w", err)
+		}
+	}
+
+	partitions, err := p.listPartitions( )
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := p.cleanDefaultPartition(publishedBefore, args.Archive)
+	if err != nil {
+		return 0, fmt.Errorf("error cleaning partition %s: %w", defaultPartitionName, err)
+	}
+
+	for _, partition := range p.expiredPartitions(partitions, publishedBefore) {
+		dropped, err := p.dropPartitionIfPublished(partition.name, publishedBefore, args.Archive)
+		if err != nil {
+			return count, fmt.Errorf("error dropping partition %s: %w", partition.name, err)
+		}
+		count += dropped
+	}
+
+	return count, nil
+}
+
+// expiredPartitions returns the partitions (sorted oldest first) which only cover creation times
+// before the given time.
+func(p *PostgresAdapter) expiredPartitions(partitions []partition, publishedBefore time.Time) []partition {
+	for i, partition := range partitions {
+		if partition.from.Add(p.partitioning.Interval).After(publishedBefore) {
+			return partitions[:i]
+		}
+	}
+	return partitions
+}
+
+// cleanDefaultPartition deletes the messages of the default partition which were published before
+// the given time, archiving them first if needed. Unlike the other partitions, it's never dropped.
+func(p *PostgresAdapter) cleanDefaultPartition(publishedBefore time.Time, archive bool) (int64, error) {
+	statement := fmt.Sprintf("DELETE FROM %s WHERE published IS TRUE AND published_on < $1", defaultPartitionName)
+	if archive {
+		statement= fmt.Sprintf(
+			`WITH deleted AS (
+				DELETE FROM %s WHERE published IS TRUE AND published_on < $1
+					RETURNING id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on
+			)
+			INSERT INTO outbox_history (id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on)
+				SELECT * FROM deleted`,
+			defaultPartitionName,
+		)
+	}
+
+	result, err := p.connection.Exec(statement, publishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected( )
+}
+
+// dropPartitionIfPublished drops the given partition, if all of its messages were published before
+// the given time. The partition is locked first, so that no message gets inserted or updated in the
+// meantime.
+func(p *PostgresAdapter) dropPartitionIfPublished(name string, publishedBefore time.Time, archive bool) (int64, error) {
+	tx, err := p.connection.BeginTx(context.Background( ), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback( )
+
+	if _, err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN ACCESS EXCLUSIVE MODE", name)); err != nil {
+		return 0, err
+	}
+
+	var (
+		count int64
+		isPublished bool
+	)
+	err= tx.QueryRow(
+		fmt.Sprintf("SELECT COUNT(*), COALESCE(bool_and(published IS TRUE AND published_on < $1), TRUE) FROM %s", name),
+		publishedBefore,
+	).Scan(&count, &isPublished)
+	if err != nil || !isPublished {
+		return 0, err
+	}
+
+	if archive && count > 0 {
+		statement := fmt.Sprintf(
+			`INSERT INTO outbox_history (id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on)
+				SELECT id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on FROM %s`,
+			name,
+		)
+		if _, err := tx.Exec(statement); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("DROP TABLE %s", name)); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit( ); err != nil {
+		return 0, err
+	}
+
+	p.logger.Info("Dropped published partition", "partition", name, "messages", count)
+	return count, nil
+}
+
+type partition struct {
+	name string
+	from time.Time
+}
+
+// listPartitions returns the partitions of the outbox table, which were created by the adapter,
+// oldest first.
+func(p *PostgresAdapter) listPartitions( ) ([]partition, error) {
+	rows, err := p.connection.Query(
+		`SELECT child.relname FROM pg_inherits
+			JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+				WHERE pg_inherits.inhparent = 'outbox'::regclass`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close( )
+
+	var partitions []partition
+	for rows.Next( ) {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		// Partitions which weren't created by the adapter (including the default one) are left alone.
+		if from, ok := p.partitionStart(name); ok {
+			partitions= append(partitions, partition{ name: name, from: from })
+		}
+	}
+	if err := rows.Err( ); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].from.Before(partitions[j].from)
+	})
+	return partitions, nil
+}
+
+// partitionName returns the name of the partition starting at the given time, for example
+// outbox_p20240301 for daily partitions or outbox_p2024030114 for hourly ones.
+func(p *PostgresAdapter) partitionName(from time.Time) string {
+	return partitionNamePrefix + from.UTC( ).Format(p.partitionNameLayout( ))
+}
+
+// partitionStart parses the start time of the partition out of its name. It returns false for the
+// partitions which weren't named by partitionName.
+func(p *PostgresAdapter) partitionStart(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, partitionNamePrefix) {
+		return time.Time{ }, false
+	}
+	from, err := time.Parse(p.partitionNameLayout( ), strings.TrimPrefix(name, partitionNamePrefix))
+	if err != nil {
+		return time.Time{ }, false
+	}
+	return from, true
+}
+
+func(p *PostgresAdapter) partitionNameLayout( ) string {
+	if p.partitioning.Interval == time.Hour {
+		return "2006010215"
+	}
+	return "20060102"
+}
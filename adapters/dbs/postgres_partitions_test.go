@@ -0,0 +1,72 @@
+package dbs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionNames(t *testing.T) {
+	from := time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC)
+
+	for _, testCase := range []struct {
+		interval time.Duration
+		expected string
+	}{
+		{ 24 * time.Hour, "outbox_p20240301" },
+		{ time.Hour, "outbox_p2024030114" },
+	} {
+		p := &PostgresAdapter{ partitioning: &PartitioningOptions{ Interval: testCase.interval } }
+
+		name := p.partitionName(from)
+		assert.Equal(t, testCase.expected, name)
+
+		start, ok := p.partitionStart(name)
+		assert.True(t, ok)
+		assert.Equal(t, from.Truncate(testCase.interval), start)
+	}
+
+	// The partitions which weren't created by the adapter are ignored.
+	p := &PostgresAdapter{ partitioning: &PartitioningOptions{ Interval: 24 * time.Hour } }
+	for _, name := range []string{ defaultPartitionName, "outbox_p2024", "orders_p20240301" } {
+		_, ok := p.partitionStart(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestUpcomingPartitions(t *testing.T) {
+	p := &PostgresAdapter{ partitioning: &PartitioningOptions{ Interval: time.Hour, Premake: 2 } }
+
+	// The times are converted to UTC.
+	now := time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("UTC+1", 3600))
+
+	var names []string
+	for _, partition := range p.upcomingPartitions(now) {
+		names= append(names, partition.name)
+	}
+	assert.Equal(t, []string{ "outbox_p2024030122", "outbox_p2024030123", "outbox_p2024030200" }, names)
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	p := &PostgresAdapter{ partitioning: &PartitioningOptions{ Interval: 24 * time.Hour } }
+
+	var partitions []partition
+	for day := 1; day <= 4; day++ {
+		from := time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC)
+		partitions= append(partitions, partition{ name: p.partitionName(from), from: from })
+	}
+
+	for _, testCase := range []struct {
+		publishedBefore time.Time
+		expected []partition
+	}{
+		{ time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), partitions[:0] },
+		// A partition ending right at the cutoff only covers older creation times.
+		{ time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), partitions[:2] },
+		{ time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC), partitions[:2] },
+		{ time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), partitions },
+	} {
+		assert.Equal(t, testCase.expected, p.expiredPartitions(partitions, testCase.publishedBefore), testCase.publishedBefore)
+	}
+}
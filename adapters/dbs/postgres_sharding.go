@@ -0,0 +1,177 @@
+package dbs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	sqlc_generated "github.com/Archisman-Mridha/outboxer/adapters/dbs/sql/generated"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+// ShardingOptions configures how the replicas of the relay split the outbox table between them
+// (see PostgresAdapter.EnableSharding).
+type ShardingOptions struct {
+	// Shards is the number of buckets which the messages are hashed into, by aggregate key. It must
+	// be the same for every replica. Defaults to 64.
+	Shards int
+	// ReplicaId identifies this replica. Defaults to a random id.
+	ReplicaId string
+	// HeartbeatTTL is the time after which a replica, which hasn't refreshed its heartbeat, is
+	// considered gone and its shards are reassigned. Defaults to 30s.
+	HeartbeatTTL time.Duration
+}
+
+const (
+	defaultShards= 64
+	defaultHeartbeatTTL= 30 * time.Second
+)
+
+type sharding struct {
+	options ShardingOptions
+
+	// replicas are the ids of the live replicas, as of the last poll.
+	replicas []string
+	// ownedShards are the shards assigned to this replica, as of the last poll.
+	ownedShards []int32
+
+	// stopHeartbeat stops the goroutine refreshing the heartbeat, which closes heartbeatStopped
+	// once it has returned.
+	stopHeartbeat context.CancelFunc
+	heartbeatStopped chan struct{ }
+}
+
+// EnableSharding makes the replicas of the relay, sharing the outbox table, fetch disjoint sets of
+// messages instead of contending on the same rows. A message belongs to the shard
+// hash(aggregate key) mod Shards (hash(id) when it has no aggregate key).
+//
+// The replicas register themselves in the outbox_replicas table, refreshing their heartbeat every
+// time they poll, and on their own ticker (a third of HeartbeatTTL) : so, a replica which stops
+// polling for a while (like while the circuit breaker of the sink is open) keeps its shards. The
+// shards are dealt to the live replicas, in the order of their ids : so, they're rebalanced as soon
+// as a replica joins, leaves (see Disconnect) or misses its heartbeat.
+func(p *PostgresAdapter) EnableSharding(options ShardingOptions) error {
+	if options.Shards < 0 || options.HeartbeatTTL < 0 {
+		return errors.New("the number of shards and the heartbeat TTL can't be negative")
+	}
+	if options.Shards == 0 {
+		options.Shards= defaultShards
+	}
+	if options.ReplicaId == "" {
+		options.ReplicaId= uuid.NewString( )
+	}
+	if options.HeartbeatTTL == 0 {
+		options.HeartbeatTTL= defaultHeartbeatTTL
+	}
+	p.sharding= &sharding{ options: options }
+
+	if err := p.refreshShardAssignment(context.Background( )); err != nil {
+		return err
+	}
+
+	heartbeatInterval := options.HeartbeatTTL / 3
+	if heartbeatInterval <= 0 {
+		heartbeatInterval= options.HeartbeatTTL
+	}
+
+	ctx, cancel := context.WithCancel(context.Background( ))
+	p.sharding.stopHeartbeat= cancel
+	p.sharding.heartbeatStopped= make(chan struct{ })
+	go func( ) {
+		defer close(p.sharding.heartbeatStopped)
+		utils.RunFnPeriodically(ctx, p.heartbeat, ctx, heartbeatInterval)
+	}( )
+
+	return nil
+}
+
+// heartbeat refreshes the heartbeat of this replica, independently of polling.
+func(p *PostgresAdapter) heartbeat(ctx context.Context) {
+	if err := p.queries.HeartbeatReplica(ctx, p.sharding.options.ReplicaId); err != nil && ctx.Err( ) == nil {
+		p.logger.Warn("Error refreshing the heartbeat of the replica", "replica_id", p.sharding.options.ReplicaId, "error", err)
+	}
+}
+
+// refreshShardAssignment refreshes the heartbeat of this replica, removes the replicas whose
+// heartbeat has expired, and recomputes the shards owned by this replica.
+func(p *PostgresAdapter) refreshShardAssignment(ctx context.Context) error {
+	options := p.sharding.options
+
+	if err := p.queries.HeartbeatReplica(ctx, options.ReplicaId); err != nil {
+		return err
+	}
+	if err := p.queries.DeleteExpiredReplicas(ctx, options.HeartbeatTTL.Seconds( )); err != nil {
+		return err
+	}
+
+	replicas, err := p.queries.ListReplicas(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.Equal(replicas, p.sharding.replicas) {
+		return nil
+	}
+
+	p.sharding.replicas= replicas
+	p.sharding.ownedShards= ownedShards(options.Shards, replicas, options.ReplicaId)
+
+	p.logger.Info("Shards rebalanced",
+		"replica_id", options.ReplicaId, "replicas", len(replicas), "owned_shards", len(p.sharding.ownedShards))
+
+	return nil
+}
+
+// ownedShards deals the shards to the given replicas, round robin, and returns those dealt to the
+// replica with the given id.
+func ownedShards(shards int, replicas []string, replicaId string) []int32 {
+	index := slices.Index(replicas, replicaId)
+	if index < 0 {
+		return nil
+	}
+
+	owned := []int32{ }
+	for shard := index; shard < shards; shard += len(replicas) {
+		owned= append(owned, int32(shard))
+	}
+	return owned
+}
+
+// getUnpublishedMessagesInOwnedShards fetches the unpublished messages belonging to the shards
+// owned by this replica.
+func(p *PostgresAdapter) getUnpublishedMessagesInOwnedShards(ctx context.Context, batchSize int) ([]sqlc_generated.GetUnpublishedMessagesRow, error) {
+	if err := p.refreshShardAssignment(ctx); err != nil {
+		return nil, err
+	}
+	if len(p.sharding.ownedShards) == 0 {
+		return nil, nil
+	}
+
+	rows, err := p.queries.GetUnpublishedMessagesInShards(ctx, sqlc_generated.GetUnpublishedMessagesInShardsParams{
+		ShardCount: int32(p.sharding.options.Shards),
+		Shards: p.sharding.ownedShards,
+		BatchSize: int32(batchSize),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]sqlc_generated.GetUnpublishedMessagesRow, len(rows))
+	for i, row := range rows {
+		messages[i]= sqlc_generated.GetUnpublishedMessagesRow(row)
+	}
+	return messages, nil
+}
+
+// leaveShards stops refreshing the heartbeat, and unregisters this replica, so that its shards are
+// reassigned right away.
+func(p *PostgresAdapter) leaveShards( ) {
+	p.sharding.stopHeartbeat( )
+	<- p.sharding.heartbeatStopped
+
+	if err := p.queries.DeleteReplica(context.Background( ), p.sharding.options.ReplicaId); err != nil {
+		p.logger.Warn("Error unregistering replica, its shards will be reassigned once its heartbeat expires", "error", err)
+	}
+}
@@ -0,0 +1,27 @@
+package dbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnedShards(t *testing.T) {
+	replicas := []string{ "a", "b", "c" }
+
+	// Each shard is owned by exactly one of the replicas.
+	owners := map[int32]string{ }
+	for _, replica := range replicas {
+		for _, shard := range ownedShards(8, replicas, replica) {
+			assert.NotContains(t, owners, shard)
+			owners[shard]= replica
+		}
+	}
+	assert.Len(t, owners, 8)
+
+	assert.Equal(t, []int32{ 0, 3, 6 }, ownedShards(8, replicas, "a"))
+	assert.Equal(t, []int32{ 2, 5 }, ownedShards(8, replicas, "c"))
+
+	// A replica which isn't registered (yet) doesn't own any shard.
+	assert.Empty(t, ownedShards(8, replicas, "d"))
+}
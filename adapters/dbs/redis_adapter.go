@@ -1,7 +1,13 @@
 package dbs
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/google/uuid"
@@ -14,65 +20,865 @@ type (
 	RedisAdapter struct {
 		client *redis.Client
 		consumerName string
-	}
 
-	Record struct {
-		ID int32
-		Message []byte
-		Locked bool
-		Published bool
+		logger *slog.Logger
+
+		// ownsClient is false when the client was handed over by the caller. In that case, the caller
+		// is responsible for closing it.
+		ownsClient bool
+
+		// reclaimCursor is the id from which the pending entries of the consumer group are next scanned
+		// for entries to reclaim.
+		reclaimCursor string
 	}
+
 )
 
-func NewRedisAdapter(options *redis.Options) *RedisAdapter {
+const (
+	streamName= "outbox"
+	// deadLetterStreamName is the stream to which the messages, which failed to be published for the
+	// maximum number of attempts, are moved.
+	deadLetterStreamName= "outbox:dead-letter"
+	groupName= "outboxer"
+
+	scanBatchSize= 100
+
+	// reclaimIdleTime is the time after which an entry, which was delivered but not acknowledged, is
+	// considered abandoned by a relay which crashed : it's then reclaimed and published again.
+	reclaimIdleTime= 5 * time.Minute
+)
+
+// OutboxStreamName is the Redis stream which messages are enqueued into (see the producer package).
+const OutboxStreamName= streamName
+
+// NewRedisAdapter connects to Redis. If that fails, a *utils.ConnectionError is returned.
+func NewRedisAdapter(options *redis.Options, logger *slog.Logger) (*RedisAdapter, error) {
+	client, err := utils.ConnectRedis(options)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRedisAdapterFromClient(client, logger)
+	r.ownsClient= true
+
+	r.logger.Info("Connected to Redis")
+
+	return r, nil
+}
+
+// NewRedisAdapterFromClient creates a RedisAdapter on top of an existing Redis client. Use it when
+// embedding outboxer inside a service which already talks to Redis. A nil logger is replaced by the
+// default logger.
+func NewRedisAdapterFromClient(client *redis.Client, logger *slog.Logger) *RedisAdapter {
 	r := &RedisAdapter{
+		client: client,
 		consumerName: uuid.NewString( ),
+
+		logger: utils.LoggerOrDefault(logger).With("source", "redis"),
 	}
 
-	r.client= utils.ConnectRedis(options)
+	// Creating the consumer group fails if it already exists, which is expected when the relay
+	// restarts.
+	if _, err := client.XGroupCreateMkStream(streamName, groupName, "0").Result( ); err != nil {
+		r.logger.Debug("Couldn't create consumer group for the outbox Redis stream", "error", err)
+	}
 
 	return r
 }
 
 func (r *RedisAdapter) Disconnect( ) {
+	if !r.ownsClient {
+		return
+	}
+
 	if err := r.client.Close( ); err != nil {
-		log.Fatalf("Error closing connection to Redis: %v", err)
+		r.logger.Error("Error closing connection to Redis", "error", err)
+		return
 	}
-	log.Println("Closed connection to Redis")
+	r.logger.Info("Closed connection to Redis")
+}
+
+func (r *RedisAdapter) Ping( ) error {
+	return r.client.Ping( ).Err( )
 }
 
 func (r *RedisAdapter) GetMessages(args *ports.GetMessagesArgs) {
-	// Fetch a batch of records from the Redis stream
-	result, err := r.client.XReadGroup(&redis.XReadGroupArgs{
-		Group: "outboxer",
-		Consumer: r.consumerName,
-		Streams: []string{ "outbox", ">" },
-		Block: 1,
-		Count: int64(args.BatchSize),
-		NoAck: true,
-	}).Result( )
+	// Feed the scheduled messages, which are due, to the Redis stream
+	if _, err := r.promoteDueMessages(args.BatchSize); err != nil {
+		r.logger.Error("Error adding due scheduled messages to the outbox Redis stream", "error", err)
+	}
+
+	// Entries abandoned by crashed relays are published again first.
+	entries, err := r.reclaimAbandonedEntries(args.BatchSize)
 	if err != nil {
-		log.Printf("❌ Error retrieving messages from Redis stream: %v", err)
+		r.logger.Error("Error reclaiming abandoned messages from the outbox Redis stream", "error", err)
 	}
 
-	for _, item := range result {
-		for _, item := range item.Messages {
-			args.ToBePublishedItemsChan <- &ports.ToBePublishedItem{
-				RowId: item.ID,
-				Message: []byte(item.Values["message"].(string)),
-			}
+	// Fetch a batch of new records from the Redis stream
+	if count := args.BatchSize - len(entries); count > 0 {
+		result, err := r.client.XReadGroup(&redis.XReadGroupArgs{
+			Group: groupName,
+			Consumer: r.consumerName,
+			Streams: []string{ streamName, ">" },
+			// The outbox stream is polled, so XREADGROUP mustn't block : a zero block duration would
+			// block forever.
+			Block: -1,
+			Count: int64(count),
+		}).Result( )
+		if err != nil && err != redis.Nil {
+			r.logger.Error("Error retrieving messages from the outbox Redis stream", "error", err)
+		}
+		for _, stream := range result {
+			entries= append(entries, stream.Messages...)
 		}
 	}
+
+	for _, entry := range entries {
+		args.ToBePublishedItemsChan <- toBePublishedItem(entry)
+	}
+}
+
+// reclaimAbandonedEntries claims at most count entries, which were delivered to the consumer group
+// but haven't been acknowledged for reclaimIdleTime, with XAUTOCLAIM (requires Redis 6.2+). The
+// consumer of each relay gets a new name when it starts, so the entries which were in flight when a
+// relay crashed would otherwise stay pending forever.
+func (r *RedisAdapter) reclaimAbandonedEntries(count int) ([]redis.XMessage, error) {
+	if r.reclaimCursor == "" {
+		r.reclaimCursor= "0-0"
+	}
+
+	reply, err := r.client.Do("XAUTOCLAIM", streamName, groupName, r.consumerName,
+		reclaimIdleTime.Milliseconds( ), r.reclaimCursor, "COUNT", count,
+	).Result( )
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, entries, err := parseAutoClaimReply(reply)
+	if err != nil {
+		return nil, err
+	}
+	r.reclaimCursor= cursor
+
+	if len(entries) > 0 {
+		r.logger.Warn("Reclaimed abandoned messages", "messages", len(entries))
+	}
+	return entries, nil
 }
 
+// UnlockMessagesAndUpdatePublishStatus acknowledges the published entries. The entries which failed
+// to be published are added back to the outbox stream (or to the dead letter stream, once they've
+// been attempted args.MaxAttempts times), since a consumer group never redelivers an entry by
+// itself.
 func (r *RedisAdapter) UnlockMessagesAndUpdatePublishStatus(args *ports.UnlockMessagesAndUpdatePublishStatusArgs) {
 	for item := range args.PublishResultsChan {
+		var err error
 		if item.IsPublished {
-			if _, err := r.client.XAck("outbox", "default", item.RowId).Result( ); err != nil {
-				log.Printf("❌ Error executing XAck Redis command: %v", err)
+			if _, err= r.client.XAck(streamName, groupName, item.RowId).Result( ); err != nil {
+				r.logger.Error("Error acknowledging published message", "row_id", item.RowId, "error", err)
+			}
+		} else {
+			if err= r.retryEntry(item.RowId, maxAttempts(item, args.MaxAttempts)); err != nil {
+				r.logger.Error("Error adding back message which wasn't published", "row_id", item.RowId, "error", err)
+			}
+		}
+
+		if args.AcknowledgementsChan != nil {
+			args.AcknowledgementsChan <- &ports.Acknowledgement{ RowId: item.RowId, Err: err }
+		}
+	}
+}
+
+// UpdatePublishStatusBatch acknowledges all the published entries with a single XACK. The entries
+// which failed to be published are added back one by one, as in UnlockMessagesAndUpdatePublishStatus.
+func (r *RedisAdapter) UpdatePublishStatusBatch(args *ports.UpdatePublishStatusBatchArgs) []*ports.Acknowledgement {
+	acknowledgements := make([]*ports.Acknowledgement, 0, len(args.PublishResults))
+
+	var publishedIds []string
+	for _, result := range args.PublishResults {
+		if result.IsPublished {
+			publishedIds= append(publishedIds, result.RowId)
+			continue
+		}
+
+		err := r.retryEntry(result.RowId, maxAttempts(result, args.MaxAttempts))
+		if err != nil {
+			r.logger.Error("Error adding back message which wasn't published", "row_id", result.RowId, "error", err)
+		}
+		acknowledgements= append(acknowledgements, &ports.Acknowledgement{ RowId: result.RowId, Err: err })
+	}
+
+	if len(publishedIds) > 0 {
+		_, err := r.client.XAck(streamName, groupName, publishedIds...).Result( )
+		if err != nil {
+			r.logger.Error("Error acknowledging published messages", "messages", len(publishedIds), "error", err)
+		}
+		for _, id := range publishedIds {
+			acknowledgements= append(acknowledgements, &ports.Acknowledgement{ RowId: id, Err: err })
+		}
+	}
+
+	return acknowledgements
+}
+
+// retryEntry moves a pending entry, which failed to be published, to the end of the outbox stream,
+// or to the dead letter stream if it has been attempted maxAttempts times.
+func (r *RedisAdapter) retryEntry(id string, maxAttempts int) error {
+	entry, err := r.getEntry(streamName, id)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	attempts := entryAttempts(*entry) + 1
+	targetStreamName := streamName
+	if maxAttempts > 0 && attempts >= maxAttempts {
+		targetStreamName= deadLetterStreamName
+	}
+
+	return r.moveEntry(*entry, streamName, targetStreamName, attempts)
+}
+
+// moveEntry atomically adds a copy of the entry, with the given attempts, to the target stream, and
+// removes the original one (acknowledging it first, in case it's pending).
+func (r *RedisAdapter) moveEntry(entry redis.XMessage, fromStreamName, toStreamName string, attempts int) error {
+	values := make(map[string]interface{ }, len(entry.Values) + 2)
+	for field, value := range entry.Values {
+		values[field]= value
+	}
+	values["attempts"]= attempts
+	values["created_on"]= entryCreationTime(entry).Format(time.RFC3339Nano)
+	values["message_id"]= entryMessageId(entry)
+
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.XAdd(&redis.XAddArgs{ Stream: toStreamName, Values: values })
+		if fromStreamName == streamName {
+			pipe.XAck(fromStreamName, groupName, entry.ID)
+		}
+		pipe.XDel(fromStreamName, entry.ID)
+		return nil
+	})
+	return err
+}
+
+// getEntry returns the entry with the given id, or nil if it doesn't exist (anymore).
+func (r *RedisAdapter) getEntry(stream, id string) (*redis.XMessage, error) {
+	entries, err := r.client.XRangeN(stream, id, id, 1).Result( )
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// GetMessagesForReplay sends the acknowledged entries which are still in the outbox stream (see
+// Clean). Entries which were added back after failing to be published have a newer id than their
+// creation time, so the time range is checked against the creation time of each entry.
+func (r *RedisAdapter) GetMessagesForReplay(args *ports.GetMessagesForReplayArgs) error {
+	lastDeliveredId, err := r.lastDeliveredId( )
+	if err != nil {
+		return err
+	}
+
+	start, end := "-", lastDeliveredId
+	if args.Filter.FromRowId != "" {
+		start= args.Filter.FromRowId
+	} else if !args.Filter.CreatedAfter.IsZero( ) {
+		start= strconv.FormatInt(args.Filter.CreatedAfter.UnixMilli( ), 10)
+	}
+	if args.Filter.ToRowId != "" && compareStreamEntryIds(args.Filter.ToRowId, end) < 0 {
+		end= args.Filter.ToRowId
+	}
+
+	var replayErr error
+	err= r.scanStream(streamName, start, end, scanBatchSize, func(entries []redis.XMessage) bool {
+		pendingIds, err := r.pendingIds(entries)
+		if err != nil {
+			replayErr= err
+			return false
+		}
+
+		for _, entry := range entries {
+			createdAt := entryCreationTime(entry)
+			switch {
+				case pendingIds[entry.ID],
+					createdAt.Before(args.Filter.CreatedAfter),
+					!args.Filter.CreatedBefore.IsZero( ) && createdAt.After(args.Filter.CreatedBefore),
+					args.Filter.Topic != "" && stringValue(entry.Values, "topic") != args.Filter.Topic:
+					continue
+			}
+
+			item := &ports.ToBePublishedItem{
+				RowId: entry.ID,
+				MessageId: entryMessageId(entry),
+				Message: []byte(stringValue(entry.Values, "message")),
+				CreatedAt: createdAt,
+				Attempt: entryAttempts(entry) + 1,
+				Topic: stringValue(entry.Values, "topic"),
+				ContentEncoding: stringValue(entry.Values, "content_encoding"),
+				Headers: map[string]string{ },
+			}
+			if traceparent, isFound := entry.Values["traceparent"].(string); isFound {
+				item.Headers["traceparent"]= traceparent
+			}
+
+			select {
+				case args.ToBePublishedItemsChan <- item:
+
+				case <- args.Context.Done( ):
+					replayErr= args.Context.Err( )
+					return false
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err= replayErr
+	}
+
+	return err
+}
+
+// Clean trims the history of the outbox stream, by deleting the acknowledged entries older than the
+// retention. Archiving isn't supported.
+func (r *RedisAdapter) Clean(args *ports.CleanArgs) (int64, error) {
+	if args.BatchSize <= 0 {
+		args.BatchSize= scanBatchSize
+	}
+	return r.trimPublishedEntries(time.Now( ).Add(-args.Retention), args.BatchSize)
+}
+
+// GetStats reports the lag of the outboxer consumer group as the backlog (requires Redis 7+) and
+// the entries which have been delivered but not yet acknowledged as the locked messages.
+func (r *RedisAdapter) GetStats( ) (*ports.OutboxStats, error) {
+	stats := &ports.OutboxStats{ }
+
+	pending, err := r.client.XPending(streamName, groupName).Result( )
+	if err != nil {
+		return nil, err
+	}
+	stats.Locked= pending.Count
+
+	group, err := r.groupInfo( )
+	if err != nil {
+		return nil, err
+	}
+	if lag, isInt := fieldValue(group, "lag").(int64); isInt {
+		stats.Backlog= lag
+	}
+
+	return stats, nil
+}
+
+// GetStatus scans the entries which haven't been delivered yet, to find the failed ones (the
+// entries which were added back after failing to be published).
+func (r *RedisAdapter) GetStatus( ) (*ports.OutboxStatus, error) {
+	stats, err := r.GetStats( )
+	if err != nil {
+		return nil, err
+	}
+	status := &ports.OutboxStatus{
+		Backlog: stats.Backlog,
+		Locked: stats.Locked,
+	}
+
+	if status.DeadLettered, err= r.client.XLen(deadLetterStreamName).Result( ); err != nil {
+		return nil, err
+	}
+	if status.Scheduled, err= r.client.ZCard(scheduleKeyName).Result( ); err != nil {
+		return nil, err
+	}
+
+	pending, err := r.client.XPending(streamName, groupName).Result( )
+	if err != nil {
+		return nil, err
+	}
+	if pending.Count > 0 {
+		status.OldestUnpublishedAt= streamEntryCreationTime(pending.Lower)
+	}
+
+	lastDeliveredId, err := r.lastDeliveredId( )
+	if err != nil {
+		return nil, err
+	}
+	err= r.scanStream(streamName, "(" + lastDeliveredId, "+", scanBatchSize, func(entries []redis.XMessage) bool {
+		for _, entry := range entries {
+			if entryAttempts(entry) > 0 {
+				status.Failed++
+			}
+			if createdAt := entryCreationTime(entry); status.OldestUnpublishedAt.IsZero( ) || createdAt.Before(status.OldestUnpublishedAt) {
+				status.OldestUnpublishedAt= createdAt
+			}
+		}
+		return true
+	})
+
+	return status, err
+}
+
+// ListMessages lists the pending entries as locked, the entries which haven't been delivered yet as
+// unpublished (along with the locked ones), and the acknowledged entries, which are still in the
+// stream, as published. The scheduled messages, which aren't in the stream yet, are listed by their
+// message id.
+func (r *RedisAdapter) ListMessages(state ports.MessageState, limit int) ([]*ports.OutboxMessage, error) {
+	var messages []*ports.OutboxMessage
+
+	collect := func(entries []redis.XMessage, filter func(*ports.OutboxMessage) bool) bool {
+		for _, entry := range entries {
+			message := outboxMessage(entry)
+			if filter == nil || filter(message) {
+				messages= append(messages, message)
+			}
+			if len(messages) == limit {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch state {
+		case ports.MessageStateDeadLetter:
+			err := r.scanStream(deadLetterStreamName, "-", "+", scanBatchSize, func(entries []redis.XMessage) bool {
+				return collect(entries, func(message *ports.OutboxMessage) bool {
+					message.DeadLettered= true
+					return true
+				})
+			})
+			return messages, err
+
+		case ports.MessageStateScheduled:
+			return r.listScheduledMessages(limit)
+
+		case ports.MessageStateLocked, ports.MessageStateUnpublished, ports.MessageStateFailed, ports.MessageStatePublished:
+
+		default:
+			return nil, ports.ErrUnsupportedMessageState
+	}
+
+	lastDeliveredId, err := r.lastDeliveredId( )
+	if err != nil {
+		return nil, err
+	}
+
+	pendingIds := map[string]time.Duration{ }
+	if state != ports.MessageStateFailed {
+		pending, err := r.client.XPendingExt(&redis.XPendingExtArgs{
+			Stream: streamName,
+			Group: groupName,
+			Start: "-",
+			End: "+",
+			Count: int64(limit),
+		}).Result( )
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range pending {
+			pendingIds[entry.Id]= entry.Idle
+		}
+	}
+
+	switch state {
+		case ports.MessageStateLocked, ports.MessageStateUnpublished:
+			for id, idle := range pendingIds {
+				entry, err := r.getEntry(streamName, id)
+				if err != nil {
+					return nil, err
+				}
+				if entry == nil {
+					continue
+				}
+
+				message := outboxMessage(*entry)
+				message.Locked= true
+				message.LockedAt= time.Now( ).Add(-idle)
+				messages= append(messages, message)
+			}
+			sort.Slice(messages, func(i, j int) bool {
+				return compareStreamEntryIds(messages[i].RowId, messages[j].RowId) < 0
+			})
+			if state == ports.MessageStateLocked || len(messages) >= limit {
+				return messages, nil
+			}
+
+			err= r.scanStream(streamName, "(" + lastDeliveredId, "+", scanBatchSize, func(entries []redis.XMessage) bool {
+				return collect(entries, nil)
+			})
+
+		case ports.MessageStateFailed:
+			err= r.scanStream(streamName, "(" + lastDeliveredId, "+", scanBatchSize, func(entries []redis.XMessage) bool {
+				return collect(entries, func(message *ports.OutboxMessage) bool {
+					return message.Attempts > 0
+				})
+			})
+
+		case ports.MessageStatePublished:
+			err= r.scanStream(streamName, "-", lastDeliveredId, scanBatchSize, func(entries []redis.XMessage) bool {
+				return collect(entries, func(message *ports.OutboxMessage) bool {
+					if _, isPending := pendingIds[message.RowId]; isPending {
+						return false
+					}
+					message.Published= true
+					return true
+				})
+			})
+	}
+
+	return messages, err
+}
+
+// UnlockMessage adds a pending entry back to the outbox stream, so that it's delivered again.
+func (r *RedisAdapter) UnlockMessage(rowId string) (bool, error) {
+	pending, err := r.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: streamName,
+		Group: groupName,
+		Start: rowId,
+		End: rowId,
+		Count: 1,
+	}).Result( )
+	if err != nil || len(pending) == 0 {
+		return false, err
+	}
+
+	entry, err := r.getEntry(streamName, rowId)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	if err := r.moveEntry(*entry, streamName, streamName, entryAttempts(*entry)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RequeueDeadLetteredMessages moves the entries of the dead letter stream back to the outbox stream.
+func (r *RedisAdapter) RequeueDeadLetteredMessages( ) (int64, error) {
+	var count int64
+	err := r.scanStream(deadLetterStreamName, "-", "+", scanBatchSize, func(entries []redis.XMessage) bool {
+		for _, entry := range entries {
+			if err := r.moveEntry(entry, deadLetterStreamName, streamName, 0); err != nil {
+				r.logger.Error("Error requeueing dead lettered message", "row_id", entry.ID, "error", err)
+				return false
+			}
+			count++
+		}
+		return true
+	})
+	return count, err
+}
+
+// PurgePublishedMessages deletes the acknowledged entries which were added before the given time.
+// Redis doesn't record when an entry was acknowledged, so the time at which it was added to the
+// stream is used instead.
+func (r *RedisAdapter) PurgePublishedMessages(publishedBefore time.Time) (int64, error) {
+	return r.trimPublishedEntries(publishedBefore, scanBatchSize)
+}
+
+// trimPublishedEntries deletes the acknowledged entries which were added before the given time. The
+// entries older than both the oldest pending entry and the oldest undelivered one are all
+// acknowledged : they're trimmed at once with XTRIM MINID (requires Redis 6.2+). The acknowledged
+// entries which are interleaved with pending ones are then deleted with XDEL, batch by batch.
+func (r *RedisAdapter) trimPublishedEntries(publishedBefore time.Time, batchSize int) (int64, error) {
+	lastDeliveredId, err := r.lastDeliveredId( )
+	if err != nil {
+		return 0, err
+	}
+	pending, err := r.client.XPending(streamName, groupName).Result( )
+	if err != nil {
+		return 0, err
+	}
+	var oldestPendingId string
+	if pending.Count > 0 {
+		oldestPendingId= pending.Lower
+	}
+
+	minId, end := trimBounds(publishedBefore, lastDeliveredId, oldestPendingId)
+
+	count, err := r.client.Do("XTRIM", streamName, "MINID", minId).Int64( )
+	if err != nil {
+		return 0, err
+	}
+
+	var scanErr error
+	err= r.scanStream(streamName, minId, end, batchSize, func(entries []redis.XMessage) bool {
+		pendingIds, err := r.pendingIds(entries)
+		if err != nil {
+			scanErr= err
+			return false
+		}
+
+		var ids []string
+		for _, entry := range entries {
+			if !pendingIds[entry.ID] {
+				ids= append(ids, entry.ID)
 			}
 		}
+		if len(ids) == 0 {
+			return true
+		}
+
+		deleted, err := r.client.XDel(streamName, ids...).Result( )
+		if err != nil {
+			scanErr= err
+			return false
+		}
+		count += deleted
+		return true
+	})
+	if err == nil {
+		err= scanErr
+	}
+
+	return count, err
+}
+
+// trimBounds returns the ids between which trimPublishedEntries looks for the acknowledged entries
+// added before the given time : the entries before minId can all be trimmed, while the ones between
+// minId and end (both inclusive) may be interleaved with pending ones. oldestPendingId is empty when
+// no entry is pending.
+func trimBounds(publishedBefore time.Time, lastDeliveredId, oldestPendingId string) (minId, end string) {
+	// The last possible id of the previous millisecond. It's explicit, so that it compares greater
+	// than the other ids of that millisecond.
+	end= strconv.FormatInt(publishedBefore.UnixMilli( ) - 1, 10) + "-" + strconv.FormatUint(math.MaxUint64, 10)
+	if compareStreamEntryIds(lastDeliveredId, end) < 0 {
+		end= lastDeliveredId
+	}
+
+	minId= strconv.FormatInt(publishedBefore.UnixMilli( ), 10) + "-0"
+	if nextId := nextStreamEntryId(lastDeliveredId); compareStreamEntryIds(nextId, minId) < 0 {
+		minId= nextId
 	}
+	if oldestPendingId != "" && compareStreamEntryIds(oldestPendingId, minId) < 0 {
+		minId= oldestPendingId
+	}
+
+	return minId, end
 }
 
-func (r *RedisAdapter) Clean( ) { }
\ No newline at end of file
+// pendingIds returns the ids of the given (consecutive) entries which are pending.
+func (r *RedisAdapter) pendingIds(entries []redis.XMessage) (map[string]bool, error) {
+	pending, err := r.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: streamName,
+		Group: groupName,
+		Start: entries[0].ID,
+		End: entries[len(entries) - 1].ID,
+		Count: int64(len(entries)),
+	}).Result( )
+	if err != nil {
+		return nil, err
+	}
+
+	pendingIds := make(map[string]bool, len(pending))
+	for _, entry := range pending {
+		pendingIds[entry.Id]= true
+	}
+	return pendingIds, nil
+}
+
+// scanStream reads the entries of the stream between start and end (both inclusive, unless prefixed
+// with "(") in batches of batchSize, until fn returns false.
+func (r *RedisAdapter) scanStream(stream, start, end string, batchSize int, fn func(entries []redis.XMessage) bool) error {
+	for {
+		entries, err := r.client.XRangeN(stream, start, end, int64(batchSize)).Result( )
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 || !fn(entries) || len(entries) < batchSize {
+			return nil
+		}
+		start= "(" + entries[len(entries) - 1].ID
+	}
+}
+
+// groupInfo returns the fields reported by XINFO GROUPS for the outboxer consumer group.
+func (r *RedisAdapter) groupInfo( ) ([]interface{ }, error) {
+	groups, err := r.client.Do("XINFO", "GROUPS", streamName).Result( )
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups.([]interface{ }) {
+		fields := group.([]interface{ })
+		if fieldValue(fields, "name") == groupName {
+			return fields, nil
+		}
+	}
+	return nil, fmt.Errorf("consumer group %s not found", groupName)
+}
+
+// lastDeliveredId returns the id of the last entry delivered to the outboxer consumer group. The
+// entries after it haven't been fetched yet.
+func (r *RedisAdapter) lastDeliveredId( ) (string, error) {
+	group, err := r.groupInfo( )
+	if err != nil {
+		return "", err
+	}
+	lastDeliveredId, _ := fieldValue(group, "last-delivered-id").(string)
+	return lastDeliveredId, nil
+}
+
+// outboxMessage describes a stream entry.
+func outboxMessage(entry redis.XMessage) *ports.OutboxMessage {
+	return &ports.OutboxMessage{
+		RowId: entry.ID,
+		Size: len(stringValue(entry.Values, "message")),
+		CreatedAt: entryCreationTime(entry),
+		Attempts: entryAttempts(entry),
+		DeliverAfter: entryDeliveryTime(entry),
+	}
+}
+
+// entryAttempts returns the number of times the entry failed to be published.
+func entryAttempts(entry redis.XMessage) int {
+	attempts, _ := strconv.Atoi(stringValue(entry.Values, "attempts"))
+	return attempts
+}
+
+// entryCreationTime returns the time at which the message was first added to the outbox stream.
+func entryCreationTime(entry redis.XMessage) time.Time {
+	if createdOn, err := time.Parse(time.RFC3339Nano, stringValue(entry.Values, "created_on")); err == nil {
+		return createdOn
+	}
+	return streamEntryCreationTime(entry.ID)
+}
+
+// entryMessageId returns the stable id of the message. The entries which were added without one
+// get an id derived from their stream entry id, which is then kept when the entry is moved.
+func entryMessageId(entry redis.XMessage) string {
+	if messageId := stringValue(entry.Values, "message_id"); messageId != "" {
+		return messageId
+	}
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(streamName + "/" + entry.ID)).String( )
+}
+
+// toBePublishedItem converts an entry of the outbox stream into a message to be published.
+func toBePublishedItem(entry redis.XMessage) *ports.ToBePublishedItem {
+	item := &ports.ToBePublishedItem{
+		RowId: entry.ID,
+		MessageId: entryMessageId(entry),
+		Message: []byte(stringValue(entry.Values, "message")),
+		CreatedAt: entryCreationTime(entry),
+		DeliverAfter: entryDeliveryTime(entry),
+		// The attempts are only counted when an entry is added back after failing to be published, so
+		// a reclaimed entry is attempted again as if it was the same attempt.
+		Attempt: entryAttempts(entry) + 1,
+		Topic: stringValue(entry.Values, "topic"),
+		Key: stringValue(entry.Values, "aggregate_key"),
+		ContentEncoding: stringValue(entry.Values, "content_encoding"),
+		Headers: map[string]string{ },
+	}
+	if traceparent, isFound := entry.Values["traceparent"].(string); isFound {
+		item.Headers["traceparent"]= traceparent
+	}
+	return item
+}
+
+// parseAutoClaimReply parses the reply to XAUTOCLAIM : the cursor from which the next call scans the
+// pending entries, followed by the claimed entries. The claimed entries which were deleted in the
+// meantime are skipped.
+func parseAutoClaimReply(reply interface{ }) (string, []redis.XMessage, error) {
+	fields, isList := reply.([]interface{ })
+	if !isList || len(fields) < 2 {
+		return "", nil, fmt.Errorf("unexpected reply to XAUTOCLAIM: %v", reply)
+	}
+	cursor, isString := fields[0].(string)
+	if !isString {
+		return "", nil, fmt.Errorf("unexpected cursor in reply to XAUTOCLAIM: %v", fields[0])
+	}
+	claimed, isList := fields[1].([]interface{ })
+	if !isList {
+		return "", nil, fmt.Errorf("unexpected entries in reply to XAUTOCLAIM: %v", fields[1])
+	}
+
+	entries := make([]redis.XMessage, 0, len(claimed))
+	for _, claimedEntry := range claimed {
+		entryFields, isList := claimedEntry.([]interface{ })
+		if !isList || len(entryFields) != 2 {
+			continue
+		}
+		id, _ := entryFields[0].(string)
+		values, isList := entryFields[1].([]interface{ })
+		if id == "" || !isList {
+			continue
+		}
+
+		entry := redis.XMessage{ ID: id, Values: make(map[string]interface{ }, len(values) / 2) }
+		for i := 0; i+1 < len(values); i += 2 {
+			if field, isString := values[i].(string); isString {
+				entry.Values[field]= values[i+1]
+			}
+		}
+		entries= append(entries, entry)
+	}
+	return cursor, entries, nil
+}
+
+func stringValue(values map[string]interface{ }, field string) string {
+	value, _ := values[field].(string)
+	return value
+}
+
+// nextStreamEntryId returns the smallest possible id following the given one. Once the sequence
+// number overflows, it's the first id of the next millisecond.
+func nextStreamEntryId(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return id + "-1"
+	}
+	sequenceNumber, _ := strconv.ParseUint(parts[1], 10, 64)
+	if sequenceNumber == math.MaxUint64 {
+		milliseconds, _ := strconv.ParseUint(parts[0], 10, 64)
+		return strconv.FormatUint(milliseconds + 1, 10) + "-0"
+	}
+	return parts[0] + "-" + strconv.FormatUint(sequenceNumber + 1, 10)
+}
+
+// compareStreamEntryIds compares two ids of the form <milliseconds>-<sequence number>, the sequence
+// number being optional.
+func compareStreamEntryIds(a, b string) int {
+	parse := func(id string) (uint64, uint64) {
+		parts := strings.SplitN(id, "-", 2)
+		milliseconds, _ := strconv.ParseUint(parts[0], 10, 64)
+		var sequenceNumber uint64
+		if len(parts) == 2 {
+			sequenceNumber, _ = strconv.ParseUint(parts[1], 10, 64)
+		}
+		return milliseconds, sequenceNumber
+	}
+
+	aMilliseconds, aSequenceNumber := parse(a)
+	bMilliseconds, bSequenceNumber := parse(b)
+	switch {
+		case aMilliseconds != bMilliseconds:
+			if aMilliseconds < bMilliseconds {
+				return -1
+			}
+			return 1
+
+		case aSequenceNumber < bSequenceNumber:
+			return -1
+
+		case aSequenceNumber > bSequenceNumber:
+			return 1
+
+		default:
+			return 0
+	}
+}
+
+// fieldValue finds the value of the given field in a flat list of field-value pairs, as returned by
+// XINFO.
+func fieldValue(fields []interface{ }, name string) interface{ } {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == name {
+			return fields[i+1]
+		}
+	}
+	return nil
+}
+
+// streamEntryCreationTime extracts the creation time from the id of a Redis stream entry. The id is
+// of the form <milliseconds since epoch>-<sequence number>.
+func streamEntryCreationTime(id string) time.Time {
+	milliseconds, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{ }
+	}
+	return time.UnixMilli(milliseconds)
+}
\ No newline at end of file
@@ -0,0 +1,126 @@
+package dbs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareStreamEntryIds(t *testing.T) {
+	for _, testCase := range []struct {
+		a, b string
+		expected int
+	}{
+		{ "1-0", "1-0", 0 },
+		{ "1", "1-0", 0 },
+		{ "0-0", "0-1", -1 },
+		{ "2-0", "1-9", 1 },
+		// Ids of the same millisecond are ordered by sequence number.
+		{ "5-2", "5-10", -1 },
+		{ "5-10", "5-2", 1 },
+		{ "5-18446744073709551615", "5-18446744073709551614", 1 },
+		{ "5-18446744073709551615", "6-0", -1 },
+	} {
+		assert.Equal(t, testCase.expected, compareStreamEntryIds(testCase.a, testCase.b), "%s <=> %s", testCase.a, testCase.b)
+	}
+}
+
+func TestNextStreamEntryId(t *testing.T) {
+	for id, expected := range map[string]string{
+		"0-0": "0-1",
+		"5": "5-1",
+		"5-9": "5-10",
+		// The sequence number overflows into the next millisecond.
+		"5-18446744073709551615": "6-0",
+	} {
+		assert.Equal(t, expected, nextStreamEntryId(id), id)
+	}
+}
+
+func TestTrimBounds(t *testing.T) {
+	publishedBefore := time.UnixMilli(1000)
+
+	for _, testCase := range []struct {
+		name string
+		lastDeliveredId, oldestPendingId string
+		expectedMinId, expectedEnd string
+	}{
+		{
+			name: "Nothing delivered",
+			lastDeliveredId: "0-0",
+			expectedMinId: "0-1", expectedEnd: "0-0",
+		},
+		{
+			name: "Everything acknowledged",
+			lastDeliveredId: "2000-0",
+			expectedMinId: "1000-0", expectedEnd: "999-18446744073709551615",
+		},
+		{
+			name: "Undelivered entries",
+			lastDeliveredId: "500-3",
+			expectedMinId: "500-4", expectedEnd: "500-3",
+		},
+		{
+			// The undelivered entries of the same millisecond mustn't be deleted.
+			name: "Undelivered entries of the same millisecond",
+			lastDeliveredId: "999-0",
+			expectedMinId: "999-1", expectedEnd: "999-0",
+		},
+		{
+			name: "Last entry delivered during the overflowing sequence number",
+			lastDeliveredId: "999-18446744073709551615",
+			expectedMinId: "1000-0", expectedEnd: "999-18446744073709551615",
+		},
+		{
+			name: "Pending entries",
+			lastDeliveredId: "2000-0", oldestPendingId: "300-1",
+			expectedMinId: "300-1", expectedEnd: "999-18446744073709551615",
+		},
+		{
+			name: "Recent pending entries",
+			lastDeliveredId: "2000-0", oldestPendingId: "1500-0",
+			expectedMinId: "1000-0", expectedEnd: "999-18446744073709551615",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			minId, end := trimBounds(publishedBefore, testCase.lastDeliveredId, testCase.oldestPendingId)
+			assert.Equal(t, testCase.expectedMinId, minId)
+			assert.Equal(t, testCase.expectedEnd, end)
+		})
+	}
+}
+
+func TestParseAutoClaimReply(t *testing.T) {
+	// Redis 7 also replies with the ids of the deleted entries, which were removed from the pending
+	// entries list. Redis 6.2 replies with a nil entry instead.
+	cursor, entries, err := parseAutoClaimReply([]interface{ }{
+		"1700000000000-3",
+		[]interface{ }{
+			[]interface{ }{ "1700000000000-1", []interface{ }{ "message", "registered", "topic", "user.registered" } },
+			nil,
+			[]interface{ }{ "1700000000000-2", []interface{ }{ "message", "deleted" } },
+		},
+		[]interface{ }{ "1699999999999-0" },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1700000000000-3", cursor)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "1700000000000-1", entries[0].ID)
+		assert.Equal(t, map[string]interface{ }{ "message": "registered", "topic": "user.registered" }, entries[0].Values)
+
+		item := toBePublishedItem(entries[1])
+		assert.Equal(t, "1700000000000-2", item.RowId)
+		assert.Equal(t, []byte("deleted"), item.Message)
+		assert.Equal(t, 1, item.Attempt)
+	}
+
+	// Nothing left to reclaim : the next scan starts over.
+	cursor, entries, err= parseAutoClaimReply([]interface{ }{ "0-0", []interface{ }{ } })
+	assert.NoError(t, err)
+	assert.Equal(t, "0-0", cursor)
+	assert.Empty(t, entries)
+
+	_, _, err= parseAutoClaimReply("OK")
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package dbs
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+var (
+	// acquireLeaseScript extends the lease if it's held by this replica. Otherwise, it takes the
+	// lease if it's free.
+	acquireLeaseScript= redis.NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+		end
+		if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+			return 1
+		end
+		return 0
+	`)
+
+	// releaseLeaseScript deletes the lease, only if it's held by this replica.
+	releaseLeaseScript= redis.NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("DEL", KEYS[1])
+		end
+		return 0
+	`)
+)
+
+// RedisLeaderLock is a ports.LeaderLock backed by a Redis key, set with SET NX PX : the leader holds
+// a lease, which it renews every time TryAcquire is invoked. If the leader dies, the lease expires
+// and a standby replica takes it over.
+type RedisLeaderLock struct {
+	client *redis.Client
+	key string
+	lease time.Duration
+
+	// holderId identifies this replica, as the value of the key.
+	holderId string
+}
+
+// NewRedisLeaderLock creates a RedisLeaderLock stored under the key named name. The lease must be
+// longer than the interval at which TryAcquire is invoked, otherwise the leadership is lost between
+// two renewals.
+func NewRedisLeaderLock(client *redis.Client, name string, lease time.Duration) *RedisLeaderLock {
+	return &RedisLeaderLock{
+		client: client,
+		key: name,
+		lease: lease,
+
+		holderId: uuid.NewString( ),
+	}
+}
+
+// LeaderLock returns a RedisLeaderLock on top of the client of the adapter.
+func(r *RedisAdapter) LeaderLock(name string, lease time.Duration) *RedisLeaderLock {
+	return NewRedisLeaderLock(r.client, name, lease)
+}
+
+func(r *RedisLeaderLock) TryAcquire( ) (bool, error) {
+	isAcquired, err := acquireLeaseScript.Run(r.client, []string{ r.key }, r.holderId, r.lease.Milliseconds( )).Int( )
+	if err != nil {
+		return false, err
+	}
+	return isAcquired == 1, nil
+}
+
+func(r *RedisLeaderLock) Release( ) error {
+	return releaseLeaseScript.Run(r.client, []string{ r.key }, r.holderId).Err( )
+}
@@ -0,0 +1,151 @@
+package dbs
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+const (
+	// scheduleKeyName is the sorted set of the scheduled messages : its members are their message
+	// ids, scored by their delivery time (in Unix milliseconds).
+	scheduleKeyName= "outbox:schedule"
+	// scheduledMessageKeyPrefix prefixes the hashes holding the fields of the scheduled messages,
+	// which become the fields of their stream entry once they're due.
+	scheduledMessageKeyPrefix= "outbox:scheduled:"
+)
+
+var (
+	// scheduleMessageScript stores the fields of a message and adds it to the schedule.
+	scheduleMessageScript= redis.NewScript(`
+		redis.call("HSET", KEYS[2], unpack(ARGV, 3))
+		redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+		return 1
+	`)
+
+	// promoteMessagesScript adds the scheduled messages, whose ids are ARGV and whose hashes are
+	// KEYS[3] onwards, to the outbox stream in that order. The messages which were already removed
+	// from the schedule are skipped.
+	promoteMessagesScript= redis.NewScript(`
+		local count = 0
+		for i, id in ipairs(ARGV) do
+			if redis.call("ZREM", KEYS[1], id) == 1 then
+				local values = redis.call("HGETALL", KEYS[i + 2])
+				if #values > 0 then
+					redis.call("XADD", KEYS[2], "*", unpack(values))
+					count = count + 1
+				end
+			end
+			redis.call("DEL", KEYS[i + 2])
+		end
+		return count
+	`)
+)
+
+// ScheduleRedisMessage adds the message, with the given stream entry fields, to the schedule : it's
+// added to the outbox stream by the relay once deliverAfter has passed. Its creation and delivery
+// times are recorded along with its fields. To schedule it atomically along with other writes, pass
+// the pipeline of redis.Client.TxPipelined (see the producer package).
+func ScheduleRedisMessage(client redis.Cmdable, messageId string, values map[string]interface{ }, deliverAfter time.Time) error {
+	args := make([]interface{ }, 0, 6 + 2 * len(values))
+	args= append(args, messageId, deliverAfter.UnixMilli( ),
+		"created_on", time.Now( ).Format(time.RFC3339Nano),
+		"deliver_after", deliverAfter.UnixMilli( ),
+	)
+	for field, value := range values {
+		args= append(args, field, value)
+	}
+
+	// EVAL is used rather than EVALSHA, since the NOSCRIPT error can't be recovered from inside a
+	// pipeline.
+	keys := []string{ scheduleKeyName, scheduledMessageKeyPrefix + messageId }
+	return scheduleMessageScript.Eval(client, keys, args...).Err( )
+}
+
+// promoteDueMessages adds at most count scheduled messages, which are due, to the outbox stream, in
+// the order of their delivery time. Every key the promotion touches is passed to the script, which
+// runs atomically : each message is promoted once, even with several relays.
+func (r *RedisAdapter) promoteDueMessages(count int) (int64, error) {
+	ids, err := r.client.ZRangeByScore(scheduleKeyName, redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now( ).UnixMilli( ), 10),
+		Count: int64(count),
+	}).Result( )
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, 0, 2 + len(ids))
+	keys= append(keys, scheduleKeyName, streamName)
+	args := make([]interface{ }, 0, len(ids))
+	for _, id := range ids {
+		keys= append(keys, scheduledMessageKeyPrefix + id)
+		args= append(args, id)
+	}
+	return promoteMessagesScript.Run(r.client, keys, args...).Int64( )
+}
+
+// listScheduledMessages lists at most limit scheduled messages, the soonest due first. Since they
+// aren't in the outbox stream yet, they're identified by their message id.
+func (r *RedisAdapter) listScheduledMessages(limit int) ([]*ports.OutboxMessage, error) {
+	scheduled, err := r.client.ZRangeWithScores(scheduleKeyName, 0, int64(limit) - 1).Result( )
+	if err != nil || len(scheduled) == 0 {
+		return nil, err
+	}
+
+	fieldsCmds := make([]*redis.SliceCmd, len(scheduled))
+	_, err= r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, member := range scheduled {
+			fieldsCmds[i]= pipe.HMGet(scheduledMessageKeyPrefix + member.Member.(string), "message", "created_on")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*ports.OutboxMessage, 0, len(scheduled))
+	for i, member := range scheduled {
+		fields := fieldsCmds[i].Val( )
+
+		message := &ports.OutboxMessage{
+			RowId: member.Member.(string),
+			DeliverAfter: time.UnixMilli(int64(member.Score)),
+		}
+		if body, isString := fields[0].(string); isString {
+			message.Size= len(body)
+		}
+		if createdOn, isString := fields[1].(string); isString {
+			message.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdOn)
+		}
+		messages= append(messages, message)
+	}
+	return messages, nil
+}
+
+// CancelScheduledMessage removes the message, with the given message id, from the schedule.
+func (r *RedisAdapter) CancelScheduledMessage(rowId string) (bool, error) {
+	var removeCmd *redis.IntCmd
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		removeCmd= pipe.ZRem(scheduleKeyName, rowId)
+		pipe.Del(scheduledMessageKeyPrefix + rowId)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return removeCmd.Val( ) > 0, nil
+}
+
+// entryDeliveryTime returns the time before which the entry wasn't allowed to be published, if it
+// was scheduled.
+func entryDeliveryTime(entry redis.XMessage) time.Time {
+	deliverAfter, err := strconv.ParseInt(stringValue(entry.Values, "deliver_after"), 10, 64)
+	if err != nil {
+		return time.Time{ }
+	}
+	return time.UnixMilli(deliverAfter)
+}
@@ -0,0 +1,86 @@
+package dbs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+// newTestRedisAdapter connects to the Redis instance of the docker-compose project (see main_test.go)
+// and flushes a dedicated database. The test is skipped when Redis isn't running.
+func newTestRedisAdapter(t *testing.T) *RedisAdapter {
+	client, err := utils.ConnectRedis(&redis.Options{ Addr: "localhost:6379", Password: "password", DB: 15 })
+	if err != nil {
+		t.Skipf("Redis isn't reachable: %v", err)
+	}
+	t.Cleanup(func( ) { client.Close( ) })
+
+	if !assert.NoError(t, client.FlushDB( ).Err( )) {
+		t.FailNow( )
+	}
+	return NewRedisAdapterFromClient(client, nil)
+}
+
+func TestScheduledMessages(t *testing.T) {
+	r := newTestRedisAdapter(t)
+
+	now := time.Now( )
+	for messageId, deliverAfter := range map[string]time.Time{
+		"due": now.Add(-time.Minute),
+		"overdue": now.Add(-time.Hour),
+		"upcoming": now.Add(time.Hour),
+		"cancelled": now.Add(-time.Minute),
+	} {
+		assert.NoError(t, ScheduleRedisMessage(r.client, messageId, map[string]interface{ }{ "message_id": messageId, "message": messageId }, deliverAfter))
+	}
+
+	// The scheduled messages are listed by message id, the soonest due first.
+	scheduled, err := r.ListMessages(ports.MessageStateScheduled, 10)
+	assert.NoError(t, err)
+	var rowIds []string
+	for _, message := range scheduled {
+		rowIds= append(rowIds, message.RowId)
+	}
+	assert.Equal(t, "overdue", rowIds[0])
+	assert.ElementsMatch(t, []string{ "overdue", "due", "cancelled", "upcoming" }, rowIds)
+	assert.Equal(t, len("overdue"), scheduled[0].Size)
+	assert.Equal(t, now.Add(-time.Hour).UnixMilli( ), scheduled[0].DeliverAfter.UnixMilli( ))
+
+	isCancelled, err := r.CancelScheduledMessage("cancelled")
+	assert.NoError(t, err)
+	assert.True(t, isCancelled)
+	isCancelled, err= r.CancelScheduledMessage("cancelled")
+	assert.NoError(t, err)
+	assert.False(t, isCancelled)
+
+	// Only the due messages are promoted, in the order of their delivery time, and only once.
+	promoted, err := r.promoteDueMessages(10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), promoted)
+	promoted, err= r.promoteDueMessages(10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), promoted)
+
+	entries, err := r.client.XRange(streamName, "-", "+").Result( )
+	assert.NoError(t, err)
+	var messageIds []string
+	for _, entry := range entries {
+		messageIds= append(messageIds, entryMessageId(entry))
+		assert.NotZero(t, entryDeliveryTime(entry))
+	}
+	assert.Equal(t, []string{ "overdue", "due" }, messageIds)
+
+	scheduled, err= r.ListMessages(ports.MessageStateScheduled, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, scheduled, 1) {
+		assert.Equal(t, "upcoming", scheduled[0].RowId)
+	}
+	exists, err := r.client.Exists(scheduledMessageKeyPrefix + "due", scheduledMessageKeyPrefix + "cancelled").Result( )
+	assert.NoError(t, err)
+	assert.Zero(t, exists)
+}
@@ -6,12 +6,42 @@ package sqlc_generated
 
 import (
 	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Outbox struct {
-	ID        int32
-	Message   []byte
-	Locked    sql.NullBool
-	LockedOn  sql.NullTime
-	Published sql.NullBool
+	ID              int32
+	MessageID       uuid.UUID
+	Message         []byte
+	Topic           sql.NullString
+	AggregateKey    sql.NullString
+	CreatedOn       time.Time
+	Traceparent     sql.NullString
+	ContentEncoding sql.NullString
+	DeliverAfter    sql.NullTime
+	Attempts        int32
+	DeadLettered    bool
+	Locked          sql.NullBool
+	LockedOn        sql.NullTime
+	Published       sql.NullBool
+	PublishedOn     sql.NullTime
+}
+
+type OutboxHistory struct {
+	ID              int32
+	MessageID       uuid.UUID
+	Message         []byte
+	Topic           sql.NullString
+	CreatedOn       time.Time
+	Traceparent     sql.NullString
+	ContentEncoding sql.NullString
+	Attempts        int32
+	PublishedOn     time.Time
+}
+
+type OutboxReplica struct {
+	ReplicaID   string
+	HeartbeatOn time.Time
 }
@@ -6,13 +6,31 @@ package sqlc_generated
 
 import (
 	"context"
+	"time"
 )
 
 type Querier interface {
-	DeleteRowsWithPublishedMessages(ctx context.Context) error
+	ArchivePublishedMessagesBatch(ctx context.Context, arg ArchivePublishedMessagesBatchParams) (int64, error)
+	CancelScheduledMessage(ctx context.Context, id int32) (int64, error)
+	DeleteExpiredReplicas(ctx context.Context, heartbeatTtlSeconds float64) error
+	DeletePublishedMessagesBatch(ctx context.Context, arg DeletePublishedMessagesBatchParams) (int64, error)
+	DeleteReplica(ctx context.Context, replicaId string) error
+	GetOldestPublishedOn(ctx context.Context, publishedBefore time.Time) (time.Time, error)
+	GetOutboxStats(ctx context.Context) (GetOutboxStatsRow, error)
+	GetOutboxStatus(ctx context.Context) (GetOutboxStatusRow, error)
+	GetPublishedMessagesForReplay(ctx context.Context, arg GetPublishedMessagesForReplayParams) ([]GetPublishedMessagesForReplayRow, error)
 	GetUnpublishedMessages(ctx context.Context, batchSize int32) ([]GetUnpublishedMessagesRow, error)
-	InsertMessage(ctx context.Context, message []byte) error
-	UnlockMessagesFailedTobePublished(ctx context.Context, id int32) error
+	GetUnpublishedMessagesInShards(ctx context.Context, arg GetUnpublishedMessagesInShardsParams) ([]GetUnpublishedMessagesInShardsRow, error)
+	HeartbeatReplica(ctx context.Context, replicaId string) error
+	InsertMessage(ctx context.Context, arg InsertMessageParams) error
+	ListMessages(ctx context.Context, arg ListMessagesParams) ([]ListMessagesRow, error)
+	ListReplicas(ctx context.Context) ([]string, error)
+	MarkMessagePublished(ctx context.Context, id int32) error
+	MarkMessagesPublished(ctx context.Context, ids []int32) error
+	RequeueDeadLetteredMessages(ctx context.Context) (int64, error)
+	UnlockMessage(ctx context.Context, id int32) (int64, error)
+	UnlockMessagesFailedTobePublished(ctx context.Context, arg UnlockMessagesFailedTobePublishedParams) error
+	UnlockMessagesFailedTobePublishedBatch(ctx context.Context, arg UnlockMessagesFailedTobePublishedBatchParams) error
 }
 
 var _ Querier = (*Queries)(nil)
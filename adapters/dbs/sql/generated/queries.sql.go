@@ -7,34 +7,260 @@ package sqlc_generated
 
 import (
 	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const archivePublishedMessagesBatch = `-- name: ArchivePublishedMessagesBatch :execrows
+WITH batch AS (
+  SELECT id FROM outbox
+    WHERE published=TRUE AND published_on < $1
+      ORDER BY id
+        LIMIT $2
+          FOR UPDATE SKIP LOCKED
+), deleted AS (
+  DELETE FROM outbox
+    WHERE id IN (SELECT id FROM batch)
+      RETURNING id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on
 )
+  INSERT INTO outbox_history
+    (id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on)
+      SELECT id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on FROM deleted
+`
+
+type ArchivePublishedMessagesBatchParams struct {
+	PublishedBefore time.Time
+	BatchSize       int32
+}
 
-const deleteRowsWithPublishedMessages = `-- name: DeleteRowsWithPublishedMessages :exec
+func (q *Queries) ArchivePublishedMessagesBatch(ctx context.Context, arg ArchivePublishedMessagesBatchParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, archivePublishedMessagesBatch, arg.PublishedBefore, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const cancelScheduledMessage = `-- name: CancelScheduledMessage :execrows
 DELETE FROM outbox
-  WHERE published=TRUE
+  WHERE id = $1 AND published=FALSE AND locked=FALSE AND deliver_after > CURRENT_TIMESTAMP
 `
 
-func (q *Queries) DeleteRowsWithPublishedMessages(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteRowsWithPublishedMessages)
+func (q *Queries) CancelScheduledMessage(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelScheduledMessage, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteExpiredReplicas = `-- name: DeleteExpiredReplicas :exec
+DELETE FROM outbox_replicas
+  WHERE heartbeat_on < CURRENT_TIMESTAMP - make_interval(secs => $1::FLOAT8)
+`
+
+func (q *Queries) DeleteExpiredReplicas(ctx context.Context, heartbeatTtlSeconds float64) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredReplicas, heartbeatTtlSeconds)
 	return err
 }
 
+const deletePublishedMessagesBatch = `-- name: DeletePublishedMessagesBatch :execrows
+WITH batch AS (
+  SELECT id FROM outbox
+    WHERE published=TRUE AND published_on < $1
+      ORDER BY id
+        LIMIT $2
+          FOR UPDATE SKIP LOCKED
+)
+  DELETE FROM outbox
+    WHERE id IN (SELECT id FROM batch)
+`
+
+type DeletePublishedMessagesBatchParams struct {
+	PublishedBefore time.Time
+	BatchSize       int32
+}
+
+func (q *Queries) DeletePublishedMessagesBatch(ctx context.Context, arg DeletePublishedMessagesBatchParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePublishedMessagesBatch, arg.PublishedBefore, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteReplica = `-- name: DeleteReplica :exec
+DELETE FROM outbox_replicas WHERE replica_id = $1
+`
+
+func (q *Queries) DeleteReplica(ctx context.Context, replicaId string) error {
+	_, err := q.db.ExecContext(ctx, deleteReplica, replicaId)
+	return err
+}
+
+const getOldestPublishedOn = `-- name: GetOldestPublishedOn :one
+SELECT COALESCE(MIN(published_on), CURRENT_TIMESTAMP)::TIMESTAMPTZ AS oldest_published_on
+  FROM outbox
+    WHERE published=TRUE AND published_on < $1
+`
+
+func (q *Queries) GetOldestPublishedOn(ctx context.Context, publishedBefore time.Time) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, getOldestPublishedOn, publishedBefore)
+	var oldestPublishedOn time.Time
+	err := row.Scan(&oldestPublishedOn)
+	return oldestPublishedOn, err
+}
+
+const getOutboxStats = `-- name: GetOutboxStats :one
+SELECT
+  COUNT(*) FILTER (WHERE dead_lettered=FALSE
+    AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)) AS backlog,
+  COUNT(*) FILTER (WHERE locked=TRUE) AS locked
+    FROM outbox
+      WHERE published=FALSE
+`
+
+type GetOutboxStatsRow struct {
+	Backlog int64
+	Locked  int64
+}
+
+// Locked messages are unpublished as well : only the unpublished rows are counted, through the
+// outbox_unpublished_idx partial index, rather than scanning the whole table.
+func (q *Queries) GetOutboxStats(ctx context.Context) (GetOutboxStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getOutboxStats)
+	var i GetOutboxStatsRow
+	err := row.Scan(&i.Backlog, &i.Locked)
+	return i, err
+}
+
+const getOutboxStatus = `-- name: GetOutboxStatus :one
+SELECT
+  COUNT(*) FILTER (WHERE published=FALSE AND dead_lettered=FALSE
+    AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)) AS backlog,
+  COUNT(*) FILTER (WHERE locked=TRUE) AS locked,
+  COUNT(*) FILTER (WHERE published=FALSE AND locked=FALSE AND dead_lettered=FALSE AND attempts > 0) AS failed,
+  COUNT(*) FILTER (WHERE dead_lettered=TRUE) AS dead_lettered,
+  COUNT(*) FILTER (WHERE published=FALSE AND dead_lettered=FALSE AND deliver_after > CURRENT_TIMESTAMP) AS scheduled,
+  COALESCE(MIN(GREATEST(created_on, deliver_after)) FILTER (WHERE published=FALSE AND dead_lettered=FALSE
+    AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)), CURRENT_TIMESTAMP)::TIMESTAMPTZ AS oldest_unpublished_on
+    FROM outbox
+`
+
+type GetOutboxStatusRow struct {
+	Backlog             int64
+	Locked              int64
+	Failed              int64
+	DeadLettered        int64
+	Scheduled           int64
+	OldestUnpublishedOn time.Time
+}
+
+func (q *Queries) GetOutboxStatus(ctx context.Context) (GetOutboxStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, getOutboxStatus)
+	var i GetOutboxStatusRow
+	err := row.Scan(
+		&i.Backlog,
+		&i.Locked,
+		&i.Failed,
+		&i.DeadLettered,
+		&i.Scheduled,
+		&i.OldestUnpublishedOn,
+	)
+	return i, err
+}
+
+const getPublishedMessagesForReplay = `-- name: GetPublishedMessagesForReplay :many
+SELECT id, message_id, message, created_on, traceparent, attempts, topic, content_encoding FROM outbox
+  WHERE published=TRUE
+    AND created_on >= $1 AND created_on <= $2
+    AND id > $3 AND id <= $4
+    AND ($5::TEXT = '' OR topic = $5::TEXT)
+      ORDER BY id
+        LIMIT $6
+`
+
+type GetPublishedMessagesForReplayParams struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	AfterID       int32
+	ToID          int32
+	Topic         string
+	MaxRows       int32
+}
+
+type GetPublishedMessagesForReplayRow struct {
+	ID              int32
+	MessageID       uuid.UUID
+	Message         []byte
+	CreatedOn       time.Time
+	Traceparent     sql.NullString
+	Attempts        int32
+	Topic           sql.NullString
+	ContentEncoding sql.NullString
+}
+
+func (q *Queries) GetPublishedMessagesForReplay(ctx context.Context, arg GetPublishedMessagesForReplayParams) ([]GetPublishedMessagesForReplayRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPublishedMessagesForReplay, arg.CreatedAfter, arg.CreatedBefore, arg.AfterID, arg.ToID, arg.Topic, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPublishedMessagesForReplayRow
+	for rows.Next() {
+		var i GetPublishedMessagesForReplayRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Message,
+			&i.CreatedOn,
+			&i.Traceparent,
+			&i.Attempts,
+			&i.Topic,
+			&i.ContentEncoding,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUnpublishedMessages = `-- name: GetUnpublishedMessages :many
 WITH selected_rows AS (
   SELECT id FROM outbox
-    WHERE locked=FALSE AND published=FALSE
+    WHERE locked=FALSE AND published=FALSE AND dead_lettered=FALSE
+      AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)
+    ORDER BY id
     LIMIT $1
       FOR UPDATE SKIP LOCKED
 )
   UPDATE outbox
-    SET locked=TRUE, locked_on=CURRENT_TIMESTAMP
+    SET locked=TRUE, locked_on=CURRENT_TIMESTAMP, attempts=attempts+1
       WHERE (id) IN (SELECT id from selected_rows)
-        RETURNING id, message
+        RETURNING id, message_id, message, created_on, traceparent, attempts, topic, aggregate_key, content_encoding, deliver_after
 `
 
 type GetUnpublishedMessagesRow struct {
-	ID      int32
-	Message []byte
+	ID              int32
+	MessageID       uuid.UUID
+	Message         []byte
+	CreatedOn       time.Time
+	Traceparent     sql.NullString
+	Attempts        int32
+	Topic           sql.NullString
+	AggregateKey    sql.NullString
+	ContentEncoding sql.NullString
+	DeliverAfter    sql.NullTime
 }
 
 func (q *Queries) GetUnpublishedMessages(ctx context.Context, batchSize int32) ([]GetUnpublishedMessagesRow, error) {
@@ -46,7 +272,87 @@ func (q *Queries) GetUnpublishedMessages(ctx context.Context, batchSize int32) (
 	var items []GetUnpublishedMessagesRow
 	for rows.Next() {
 		var i GetUnpublishedMessagesRow
-		if err := rows.Scan(&i.ID, &i.Message); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Message,
+			&i.CreatedOn,
+			&i.Traceparent,
+			&i.Attempts,
+			&i.Topic,
+			&i.AggregateKey,
+			&i.ContentEncoding,
+			&i.DeliverAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnpublishedMessagesInShards = `-- name: GetUnpublishedMessagesInShards :many
+WITH selected_rows AS (
+  SELECT id FROM outbox
+    WHERE locked=FALSE AND published=FALSE AND dead_lettered=FALSE
+      AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)
+      AND MOD(hashtext(COALESCE(aggregate_key, id::TEXT)) & 2147483647, $1::INT) = ANY($2::INT[])
+    ORDER BY id
+    LIMIT $3
+      FOR UPDATE SKIP LOCKED
+)
+  UPDATE outbox
+    SET locked=TRUE, locked_on=CURRENT_TIMESTAMP, attempts=attempts+1
+      WHERE (id) IN (SELECT id from selected_rows)
+        RETURNING id, message_id, message, created_on, traceparent, attempts, topic, aggregate_key, content_encoding, deliver_after
+`
+
+type GetUnpublishedMessagesInShardsParams struct {
+	ShardCount int32
+	Shards     []int32
+	BatchSize  int32
+}
+
+type GetUnpublishedMessagesInShardsRow struct {
+	ID              int32
+	MessageID       uuid.UUID
+	Message         []byte
+	CreatedOn       time.Time
+	Traceparent     sql.NullString
+	Attempts        int32
+	Topic           sql.NullString
+	AggregateKey    sql.NullString
+	ContentEncoding sql.NullString
+	DeliverAfter    sql.NullTime
+}
+
+func (q *Queries) GetUnpublishedMessagesInShards(ctx context.Context, arg GetUnpublishedMessagesInShardsParams) ([]GetUnpublishedMessagesInShardsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnpublishedMessagesInShards, arg.ShardCount, pq.Array(arg.Shards), arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnpublishedMessagesInShardsRow
+	for rows.Next() {
+		var i GetUnpublishedMessagesInShardsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Message,
+			&i.CreatedOn,
+			&i.Traceparent,
+			&i.Attempts,
+			&i.Topic,
+			&i.AggregateKey,
+			&i.ContentEncoding,
+			&i.DeliverAfter,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -60,24 +366,212 @@ func (q *Queries) GetUnpublishedMessages(ctx context.Context, batchSize int32) (
 	return items, nil
 }
 
+const heartbeatReplica = `-- name: HeartbeatReplica :exec
+INSERT INTO outbox_replicas (replica_id) VALUES ($1)
+  ON CONFLICT (replica_id) DO UPDATE SET heartbeat_on=CURRENT_TIMESTAMP
+`
+
+func (q *Queries) HeartbeatReplica(ctx context.Context, replicaId string) error {
+	_, err := q.db.ExecContext(ctx, heartbeatReplica, replicaId)
+	return err
+}
+
 const insertMessage = `-- name: InsertMessage :exec
 INSERT INTO outbox
-  (message)
-    VALUES ($1)
+  (message_id, message, traceparent, topic, aggregate_key, content_encoding, deliver_after)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
 `
 
-func (q *Queries) InsertMessage(ctx context.Context, message []byte) error {
-	_, err := q.db.ExecContext(ctx, insertMessage, message)
+type InsertMessageParams struct {
+	MessageID       uuid.UUID
+	Message         []byte
+	Traceparent     sql.NullString
+	Topic           sql.NullString
+	AggregateKey    sql.NullString
+	ContentEncoding sql.NullString
+	DeliverAfter    sql.NullTime
+}
+
+func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) error {
+	_, err := q.db.ExecContext(ctx, insertMessage, arg.MessageID, arg.Message, arg.Traceparent, arg.Topic, arg.AggregateKey, arg.ContentEncoding, arg.DeliverAfter)
 	return err
 }
 
-const unlockMessagesFailedTobePublished = `-- name: UnlockMessagesFailedTobePublished :exec
+const listMessages = `-- name: ListMessages :many
+SELECT id, created_on, attempts, dead_lettered, locked, locked_on, published, published_on,
+  deliver_after, octet_length(message) AS size
+    FROM outbox
+      WHERE CASE $1::TEXT
+        WHEN 'unpublished' THEN published=FALSE AND dead_lettered=FALSE
+        WHEN 'locked' THEN locked=TRUE
+        WHEN 'failed' THEN published=FALSE AND locked=FALSE AND dead_lettered=FALSE AND attempts > 0
+        WHEN 'dead-letter' THEN dead_lettered=TRUE
+        WHEN 'published' THEN published=TRUE
+        WHEN 'scheduled' THEN published=FALSE AND dead_lettered=FALSE AND deliver_after > CURRENT_TIMESTAMP
+      END
+        ORDER BY id
+          LIMIT $2
+`
+
+type ListMessagesParams struct {
+	State   string
+	MaxRows int32
+}
+
+type ListMessagesRow struct {
+	ID           int32
+	CreatedOn    time.Time
+	Attempts     int32
+	DeadLettered bool
+	Locked       sql.NullBool
+	LockedOn     sql.NullTime
+	Published    sql.NullBool
+	PublishedOn  sql.NullTime
+	DeliverAfter sql.NullTime
+	Size         int32
+}
+
+func (q *Queries) ListMessages(ctx context.Context, arg ListMessagesParams) ([]ListMessagesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listMessages, arg.State, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListMessagesRow
+	for rows.Next() {
+		var i ListMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedOn,
+			&i.Attempts,
+			&i.DeadLettered,
+			&i.Locked,
+			&i.LockedOn,
+			&i.Published,
+			&i.PublishedOn,
+			&i.DeliverAfter,
+			&i.Size,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReplicas = `-- name: ListReplicas :many
+SELECT replica_id FROM outbox_replicas ORDER BY replica_id
+`
+
+func (q *Queries) ListReplicas(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listReplicas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var replicaId string
+		if err := rows.Scan(&replicaId); err != nil {
+			return nil, err
+		}
+		items = append(items, replicaId)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markMessagePublished = `-- name: MarkMessagePublished :exec
 UPDATE outbox
-  SET locked=FALSE, locked_on=NULL
+  SET locked=FALSE, locked_on=NULL, published=TRUE, published_on=CURRENT_TIMESTAMP
     WHERE id = $1
 `
 
-func (q *Queries) UnlockMessagesFailedTobePublished(ctx context.Context, id int32) error {
-	_, err := q.db.ExecContext(ctx, unlockMessagesFailedTobePublished, id)
+func (q *Queries) MarkMessagePublished(ctx context.Context, id int32) error {
+	_, err := q.db.ExecContext(ctx, markMessagePublished, id)
+	return err
+}
+
+const markMessagesPublished = `-- name: MarkMessagesPublished :exec
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL, published=TRUE, published_on=CURRENT_TIMESTAMP
+    WHERE id = ANY($1::INT[])
+`
+
+func (q *Queries) MarkMessagesPublished(ctx context.Context, ids []int32) error {
+	_, err := q.db.ExecContext(ctx, markMessagesPublished, pq.Array(ids))
+	return err
+}
+
+const requeueDeadLetteredMessages = `-- name: RequeueDeadLetteredMessages :execrows
+UPDATE outbox
+  SET dead_lettered=FALSE, attempts=0
+    WHERE dead_lettered=TRUE
+`
+
+func (q *Queries) RequeueDeadLetteredMessages(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requeueDeadLetteredMessages)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unlockMessage = `-- name: UnlockMessage :execrows
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL
+    WHERE id = $1 AND locked=TRUE
+`
+
+func (q *Queries) UnlockMessage(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unlockMessage, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unlockMessagesFailedTobePublished = `-- name: UnlockMessagesFailedTobePublished :exec
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL,
+    dead_lettered=($1::INT > 0 AND attempts >= $1::INT)
+      WHERE id = $2
+`
+
+type UnlockMessagesFailedTobePublishedParams struct {
+	MaxAttempts int32
+	ID          int32
+}
+
+func (q *Queries) UnlockMessagesFailedTobePublished(ctx context.Context, arg UnlockMessagesFailedTobePublishedParams) error {
+	_, err := q.db.ExecContext(ctx, unlockMessagesFailedTobePublished, arg.MaxAttempts, arg.ID)
+	return err
+}
+
+const unlockMessagesFailedTobePublishedBatch = `-- name: UnlockMessagesFailedTobePublishedBatch :exec
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL,
+    dead_lettered=($1::INT > 0 AND attempts >= $1::INT)
+      WHERE id = ANY($2::INT[])
+`
+
+type UnlockMessagesFailedTobePublishedBatchParams struct {
+	MaxAttempts int32
+	Ids         []int32
+}
+
+func (q *Queries) UnlockMessagesFailedTobePublishedBatch(ctx context.Context, arg UnlockMessagesFailedTobePublishedBatchParams) error {
+	_, err := q.db.ExecContext(ctx, unlockMessagesFailedTobePublishedBatch, arg.MaxAttempts, pq.Array(arg.Ids))
 	return err
 }
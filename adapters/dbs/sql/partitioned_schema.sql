@@ -0,0 +1,56 @@
+-- Alternative to the outbox table of schema.sql, partitioned by creation time. Use it instead of
+-- schema.sql for write heavy outboxes : the partitions are created ahead of time by outboxer, and
+-- the old ones are dropped once all of their messages have been published (see the partitioning
+-- option of the Postgres source), instead of deleting rows. The queries in queries.sql work with
+-- both tables. outboxer also creates the outbox_default partition, receiving the messages created
+-- while no partition covers them (when it has been down for longer than the premake window).
+CREATE TABLE outbox (
+  id SERIAL NOT NULL,
+
+  message_id UUID NOT NULL DEFAULT gen_random_uuid( ),
+  message BYTEA NOT NULL,
+  topic TEXT DEFAULT NULL,
+  aggregate_key TEXT DEFAULT NULL,
+  created_on TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  traceparent TEXT DEFAULT NULL,
+  content_encoding TEXT DEFAULT NULL,
+  deliver_after TIMESTAMPTZ DEFAULT NULL,
+
+  attempts INT NOT NULL DEFAULT 0,
+  dead_lettered BOOLEAN NOT NULL DEFAULT FALSE,
+
+  locked BOOLEAN DEFAULT FALSE,
+  locked_on TIMESTAMP DEFAULT NULL,
+
+  published BOOLEAN DEFAULT FALSE,
+  published_on TIMESTAMPTZ DEFAULT NULL,
+
+  -- The partition key has to be part of the primary key. Rows are still looked up by id alone, using
+  -- the index of each partition.
+  PRIMARY KEY (id, created_on)
+) PARTITION BY RANGE (created_on);
+
+-- Keeps fetching the unpublished messages cheap, since most of the rows are published.
+CREATE INDEX outbox_unpublished_idx ON outbox (id) WHERE published=FALSE;
+
+-- Same as in schema.sql.
+CREATE TABLE outbox_history (
+  id INT NOT NULL,
+
+  message_id UUID NOT NULL,
+  message BYTEA NOT NULL,
+  topic TEXT DEFAULT NULL,
+  created_on TIMESTAMPTZ NOT NULL,
+  traceparent TEXT DEFAULT NULL,
+  content_encoding TEXT DEFAULT NULL,
+
+  attempts INT NOT NULL,
+
+  published_on TIMESTAMPTZ NOT NULL
+) PARTITION BY RANGE (published_on);
+
+-- Same as in schema.sql.
+CREATE TABLE outbox_replicas (
+  replica_id TEXT PRIMARY KEY,
+  heartbeat_on TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
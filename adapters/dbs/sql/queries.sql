@@ -1,25 +1,161 @@
 -- name: GetUnpublishedMessages :many
 WITH selected_rows AS (
   SELECT id FROM outbox
-    WHERE locked=FALSE AND published=FALSE
+    WHERE locked=FALSE AND published=FALSE AND dead_lettered=FALSE
+      AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)
+    ORDER BY id
     LIMIT @batch_size
       FOR UPDATE SKIP LOCKED
 )
   UPDATE outbox
-    SET locked=TRUE, locked_on=CURRENT_TIMESTAMP
+    SET locked=TRUE, locked_on=CURRENT_TIMESTAMP, attempts=attempts+1
       WHERE (id) IN (SELECT id from selected_rows)
-        RETURNING id, message;
+        RETURNING id, message_id, message, created_on, traceparent, attempts, topic, aggregate_key, content_encoding, deliver_after;
+
+-- name: GetUnpublishedMessagesInShards :many
+WITH selected_rows AS (
+  SELECT id FROM outbox
+    WHERE locked=FALSE AND published=FALSE AND dead_lettered=FALSE
+      AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)
+      AND MOD(hashtext(COALESCE(aggregate_key, id::TEXT)) & 2147483647, @shard_count::INT) = ANY(@shards::INT[])
+    ORDER BY id
+    LIMIT @batch_size
+      FOR UPDATE SKIP LOCKED
+)
+  UPDATE outbox
+    SET locked=TRUE, locked_on=CURRENT_TIMESTAMP, attempts=attempts+1
+      WHERE (id) IN (SELECT id from selected_rows)
+        RETURNING id, message_id, message, created_on, traceparent, attempts, topic, aggregate_key, content_encoding, deliver_after;
 
 -- name: UnlockMessagesFailedTobePublished :exec
 UPDATE outbox
-  SET locked=FALSE, locked_on=NULL
+  SET locked=FALSE, locked_on=NULL,
+    dead_lettered=(@max_attempts::INT > 0 AND attempts >= @max_attempts::INT)
+      WHERE id = @id;
+
+-- name: MarkMessagePublished :exec
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL, published=TRUE, published_on=CURRENT_TIMESTAMP
     WHERE id = @id;
 
--- name: DeleteRowsWithPublishedMessages :exec
+-- name: MarkMessagesPublished :exec
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL, published=TRUE, published_on=CURRENT_TIMESTAMP
+    WHERE id = ANY(@ids::INT[]);
+
+-- name: UnlockMessagesFailedTobePublishedBatch :exec
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL,
+    dead_lettered=(@max_attempts::INT > 0 AND attempts >= @max_attempts::INT)
+      WHERE id = ANY(@ids::INT[]);
+
+-- name: GetPublishedMessagesForReplay :many
+SELECT id, message_id, message, created_on, traceparent, attempts, topic, content_encoding FROM outbox
+  WHERE published=TRUE
+    AND created_on >= @created_after AND created_on <= @created_before
+    AND id > @after_id AND id <= @to_id
+    AND (@topic::TEXT = '' OR topic = @topic::TEXT)
+      ORDER BY id
+        LIMIT @max_rows;
+
+-- name: DeletePublishedMessagesBatch :execrows
+WITH batch AS (
+  SELECT id FROM outbox
+    WHERE published=TRUE AND published_on < @published_before
+      ORDER BY id
+        LIMIT @batch_size
+          FOR UPDATE SKIP LOCKED
+)
+  DELETE FROM outbox
+    WHERE id IN (SELECT id FROM batch);
+
+-- name: ArchivePublishedMessagesBatch :execrows
+WITH batch AS (
+  SELECT id FROM outbox
+    WHERE published=TRUE AND published_on < @published_before
+      ORDER BY id
+        LIMIT @batch_size
+          FOR UPDATE SKIP LOCKED
+), deleted AS (
+  DELETE FROM outbox
+    WHERE id IN (SELECT id FROM batch)
+      RETURNING id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on
+)
+  INSERT INTO outbox_history
+    (id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on)
+      SELECT id, message_id, message, topic, created_on, traceparent, content_encoding, attempts, published_on FROM deleted;
+
+-- name: GetOldestPublishedOn :one
+SELECT COALESCE(MIN(published_on), CURRENT_TIMESTAMP)::TIMESTAMPTZ AS oldest_published_on
+  FROM outbox
+    WHERE published=TRUE AND published_on < @published_before;
+
+-- name: GetOutboxStats :one
+-- Locked messages are unpublished as well : only the unpublished rows are counted, through the
+-- outbox_unpublished_idx partial index, rather than scanning the whole table.
+SELECT
+  COUNT(*) FILTER (WHERE dead_lettered=FALSE
+    AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)) AS backlog,
+  COUNT(*) FILTER (WHERE locked=TRUE) AS locked
+    FROM outbox
+      WHERE published=FALSE;
+
+-- name: GetOutboxStatus :one
+SELECT
+  COUNT(*) FILTER (WHERE published=FALSE AND dead_lettered=FALSE
+    AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)) AS backlog,
+  COUNT(*) FILTER (WHERE locked=TRUE) AS locked,
+  COUNT(*) FILTER (WHERE published=FALSE AND locked=FALSE AND dead_lettered=FALSE AND attempts > 0) AS failed,
+  COUNT(*) FILTER (WHERE dead_lettered=TRUE) AS dead_lettered,
+  COUNT(*) FILTER (WHERE published=FALSE AND dead_lettered=FALSE AND deliver_after > CURRENT_TIMESTAMP) AS scheduled,
+  COALESCE(MIN(GREATEST(created_on, deliver_after)) FILTER (WHERE published=FALSE AND dead_lettered=FALSE
+    AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)), CURRENT_TIMESTAMP)::TIMESTAMPTZ AS oldest_unpublished_on
+    FROM outbox;
+
+-- name: ListMessages :many
+SELECT id, created_on, attempts, dead_lettered, locked, locked_on, published, published_on,
+  deliver_after, octet_length(message) AS size
+    FROM outbox
+      WHERE CASE @state::TEXT
+        WHEN 'unpublished' THEN published=FALSE AND dead_lettered=FALSE
+        WHEN 'locked' THEN locked=TRUE
+        WHEN 'failed' THEN published=FALSE AND locked=FALSE AND dead_lettered=FALSE AND attempts > 0
+        WHEN 'dead-letter' THEN dead_lettered=TRUE
+        WHEN 'published' THEN published=TRUE
+        WHEN 'scheduled' THEN published=FALSE AND dead_lettered=FALSE AND deliver_after > CURRENT_TIMESTAMP
+      END
+        ORDER BY id
+          LIMIT @max_rows;
+
+-- name: UnlockMessage :execrows
+UPDATE outbox
+  SET locked=FALSE, locked_on=NULL
+    WHERE id = @id AND locked=TRUE;
+
+-- name: CancelScheduledMessage :execrows
 DELETE FROM outbox
-  WHERE published=TRUE;
+  WHERE id = @id AND published=FALSE AND locked=FALSE AND deliver_after > CURRENT_TIMESTAMP;
+
+-- name: RequeueDeadLetteredMessages :execrows
+UPDATE outbox
+  SET dead_lettered=FALSE, attempts=0
+    WHERE dead_lettered=TRUE;
 
 -- name: InsertMessage :exec
 INSERT INTO outbox
-  (message)
-    VALUES (@message);
\ No newline at end of file
+  (message_id, message, traceparent, topic, aggregate_key, content_encoding, deliver_after)
+    VALUES (@message_id, @message, @traceparent, @topic, @aggregate_key, @content_encoding, @deliver_after);
+
+-- name: HeartbeatReplica :exec
+INSERT INTO outbox_replicas (replica_id) VALUES (@replica_id)
+  ON CONFLICT (replica_id) DO UPDATE SET heartbeat_on=CURRENT_TIMESTAMP;
+
+-- name: DeleteExpiredReplicas :exec
+DELETE FROM outbox_replicas
+  WHERE heartbeat_on < CURRENT_TIMESTAMP - make_interval(secs => @heartbeat_ttl_seconds::FLOAT8);
+
+-- name: ListReplicas :many
+SELECT replica_id FROM outbox_replicas ORDER BY replica_id;
+
+-- name: DeleteReplica :exec
+DELETE FROM outbox_replicas WHERE replica_id = @replica_id;
@@ -1,10 +1,62 @@
 CREATE TABLE outbox (
   id SERIAL PRIMARY KEY,
 
+  -- Stable id of the message, sent along with it (as the AMQP message id), which consumers can
+  -- deduplicate messages by. Producers are expected to set a UUIDv7 (see the producer package).
+  message_id UUID NOT NULL DEFAULT gen_random_uuid( ),
   message BYTEA NOT NULL,
+  -- Optional topic of the message, which replays can be filtered by. It's published as the AMQP
+  -- type of the message.
+  topic TEXT DEFAULT NULL,
+  -- Optional key of the aggregate (entity) which the message is about. Messages sharing a key are
+  -- published in order, when key ordering is enabled.
+  aggregate_key TEXT DEFAULT NULL,
+  created_on TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  -- W3C trace context of the request which inserted the message.
+  traceparent TEXT DEFAULT NULL,
+  -- Encoding of the message, when it was compressed by the producer (see the compression package).
+  content_encoding TEXT DEFAULT NULL,
+  -- Optional time before which the message mustn't be published.
+  deliver_after TIMESTAMPTZ DEFAULT NULL,
+
+  -- Number of times the message has been fetched by a relay.
+  attempts INT NOT NULL DEFAULT 0,
+  -- Set once the message fails to be published for the maximum number of attempts. Dead lettered
+  -- messages aren't fetched anymore, until they're requeued.
+  dead_lettered BOOLEAN NOT NULL DEFAULT FALSE,
 
   locked BOOLEAN DEFAULT FALSE,
   locked_on TIMESTAMP DEFAULT NULL,
 
-  published BOOLEAN DEFAULT FALSE
-);
\ No newline at end of file
+  published BOOLEAN DEFAULT FALSE,
+  published_on TIMESTAMPTZ DEFAULT NULL
+);
+
+-- Keeps fetching and counting the unpublished messages cheap, since most of the rows are published.
+CREATE INDEX outbox_unpublished_idx ON outbox (id) WHERE published=FALSE;
+
+-- Published messages are moved here by the cleanup job, when archiving is enabled. The table is
+-- partitioned by month of publishing : the partitions are created by outboxer as needed, and can be
+-- detached or dropped once they're not needed anymore.
+CREATE TABLE outbox_history (
+  id INT NOT NULL,
+
+  message_id UUID NOT NULL,
+  message BYTEA NOT NULL,
+  topic TEXT DEFAULT NULL,
+  created_on TIMESTAMPTZ NOT NULL,
+  traceparent TEXT DEFAULT NULL,
+  content_encoding TEXT DEFAULT NULL,
+
+  attempts INT NOT NULL,
+
+  published_on TIMESTAMPTZ NOT NULL
+) PARTITION BY RANGE (published_on);
+
+-- Relay replicas sharing the outbox, when sharding is enabled. Each replica refreshes its heartbeat
+-- every time it polls the outbox : the replicas whose heartbeat has expired are removed, and their
+-- shards are reassigned to the remaining ones.
+CREATE TABLE outbox_replicas (
+  replica_id TEXT PRIMARY KEY,
+  heartbeat_on TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
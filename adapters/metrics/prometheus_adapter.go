@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/domain/usecases"
+)
+
+const namespace= "outboxer"
+
+// PrometheusAdapter records metrics about the pipelines, in Prometheus format. Plug it into the
+// dispatcher using the hooks returned by PrometheusAdapter.Hooks.
+type PrometheusAdapter struct {
+	messagesFetched *prometheus.CounterVec
+	messagesPublished *prometheus.CounterVec
+	messagesFailed *prometheus.CounterVec
+	messagesRejected *prometheus.CounterVec
+	messagesDropped *prometheus.CounterVec
+	messagesOffloadFailed *prometheus.CounterVec
+	messagesCleaned *prometheus.CounterVec
+
+	publishLatency *prometheus.HistogramVec
+	endToEndLag *prometheus.HistogramVec
+	pollDuration *prometheus.HistogramVec
+
+	backlog *prometheus.GaugeVec
+	lockedMessages *prometheus.GaugeVec
+}
+
+// NewPrometheusAdapter creates the metrics and registers them with the given registerer.
+func NewPrometheusAdapter(registerer prometheus.Registerer) (*PrometheusAdapter, error) {
+	pipelineLabels := []string{ "source", "sink" }
+
+	p := &PrometheusAdapter{
+		messagesFetched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "messages_fetched_total",
+			Help: "Number of messages fetched from the outbox DB.",
+		}, pipelineLabels),
+		messagesPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "messages_published_total",
+			Help: "Number of messages published to the MQ.",
+		}, pipelineLabels),
+		messagesFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "messages_failed_total",
+			Help: "Number of messages which failed to be published to the MQ.",
+		}, pipelineLabels),
+		messagesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "messages_rejected_total",
+			Help: "Number of messages rejected before being published, since they're invalid.",
+		}, pipelineLabels),
+		messagesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "messages_dropped_total",
+			Help: "Number of messages dropped by the transforms, instead of being published.",
+		}, pipelineLabels),
+		messagesOffloadFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "messages_offload_failed_total",
+			Help: "Number of messages which failed to be offloaded to the blob store of the claim check.",
+		}, pipelineLabels),
+		messagesCleaned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "messages_cleaned_total",
+			Help: "Number of published messages deleted from the outbox DB.",
+		}, pipelineLabels),
+
+		publishLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name: "publish_latency_seconds",
+			Help: "Time taken by the MQ to publish a message.",
+			Buckets: prometheus.DefBuckets,
+		}, pipelineLabels),
+		endToEndLag: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name: "end_to_end_lag_seconds",
+			Help: "Time between a message being inserted in the outbox DB and being published to the MQ.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+		}, pipelineLabels),
+		pollDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name: "poll_duration_seconds",
+			Help: "Time taken by a single poll of the outbox DB.",
+			Buckets: prometheus.DefBuckets,
+		}, pipelineLabels),
+
+		backlog: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name: "backlog_messages",
+			Help: "Number of messages in the outbox DB which are yet to be published.",
+		}, pipelineLabels),
+		lockedMessages: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name: "locked_messages",
+			Help: "Number of messages in the outbox DB which are locked by a relay.",
+		}, pipelineLabels),
+	}
+
+	collectors := []prometheus.Collector{
+		p.messagesFetched, p.messagesPublished, p.messagesFailed, p.messagesRejected, p.messagesDropped, p.messagesOffloadFailed,
+		p.messagesCleaned,
+		p.publishLatency, p.endToEndLag, p.pollDuration,
+		p.backlog, p.lockedMessages,
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Hooks returns the dispatcher hooks which record the metrics.
+func(p *PrometheusAdapter) Hooks( ) usecases.Hooks {
+	return usecases.Hooks{
+		OnPoll: func(pipeline usecases.Pipeline, duration time.Duration) {
+			p.pollDuration.WithLabelValues(pipeline.Source, pipeline.Sink).Observe(duration.Seconds( ))
+		},
+
+		OnStats: func(pipeline usecases.Pipeline, stats *ports.OutboxStats) {
+			p.backlog.WithLabelValues(pipeline.Source, pipeline.Sink).Set(float64(stats.Backlog))
+			p.lockedMessages.WithLabelValues(pipeline.Source, pipeline.Sink).Set(float64(stats.Locked))
+		},
+
+		OnFetched: func(pipeline usecases.Pipeline, item *ports.ToBePublishedItem) {
+			p.messagesFetched.WithLabelValues(pipeline.Source, pipeline.Sink).Inc( )
+		},
+
+		OnPublishResult: func(pipeline usecases.Pipeline, item *ports.ToBePublishedItem, result *ports.PublishResult, latency time.Duration) {
+			if result.IsRejected {
+				p.messagesRejected.WithLabelValues(pipeline.Source, pipeline.Sink).Inc( )
+				return
+			}
+			if result.IsDropped {
+				p.messagesDropped.WithLabelValues(pipeline.Source, pipeline.Sink).Inc( )
+				return
+			}
+			if result.IsOffloadFailed {
+				p.messagesOffloadFailed.WithLabelValues(pipeline.Source, pipeline.Sink).Inc( )
+				return
+			}
+			if !result.IsPublished {
+				p.messagesFailed.WithLabelValues(pipeline.Source, pipeline.Sink).Inc( )
+				return
+			}
+
+			p.messagesPublished.WithLabelValues(pipeline.Source, pipeline.Sink).Inc( )
+			p.publishLatency.WithLabelValues(pipeline.Source, pipeline.Sink).Observe(latency.Seconds( ))
+			// A scheduled message is only late once its delivery time has come.
+			dueAt := item.CreatedAt
+			if item.DeliverAfter.After(dueAt) {
+				dueAt= item.DeliverAfter
+			}
+			if !dueAt.IsZero( ) {
+				p.endToEndLag.WithLabelValues(pipeline.Source, pipeline.Sink).Observe(time.Since(dueAt).Seconds( ))
+			}
+		},
+
+		OnCleaned: func(pipeline usecases.Pipeline, count int64) {
+			p.messagesCleaned.WithLabelValues(pipeline.Source, pipeline.Sink).Add(float64(count))
+		},
+	}
+}
\ No newline at end of file
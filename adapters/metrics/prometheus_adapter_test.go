@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/domain/usecases"
+)
+
+var pipeline= usecases.Pipeline{ Source: "postgres", Sink: "rabbitmq" }
+
+// histogram returns the samples observed by the histogram for the pipeline.
+func histogram(t *testing.T, vec *prometheus.HistogramVec) *dto.Histogram {
+	metric := &dto.Metric{ }
+	assert.NoError(t, vec.WithLabelValues(pipeline.Source, pipeline.Sink).(prometheus.Metric).Write(metric))
+	return metric.GetHistogram( )
+}
+
+func TestPrometheusAdapter(t *testing.T) {
+	registry := prometheus.NewRegistry( )
+
+	p, err := NewPrometheusAdapter(registry)
+	assert.NoError(t, err)
+
+	// The metrics can't be registered twice.
+	_, err= NewPrometheusAdapter(registry)
+	assert.Error(t, err)
+
+	hooks := p.Hooks( )
+
+	hooks.OnPoll(pipeline, 20 * time.Millisecond)
+	hooks.OnStats(pipeline, &ports.OutboxStats{ Backlog: 12, Locked: 3 })
+	hooks.OnCleaned(pipeline, 7)
+
+	now := time.Now( )
+	for _, publish := range []struct {
+		item *ports.ToBePublishedItem
+		result *ports.PublishResult
+	}{
+		{ &ports.ToBePublishedItem{ RowId: "1", CreatedAt: now.Add(-time.Minute) }, &ports.PublishResult{ RowId: "1", IsPublished: true } },
+		{ &ports.ToBePublishedItem{ RowId: "2" }, &ports.PublishResult{ RowId: "2" } },
+		{ &ports.ToBePublishedItem{ RowId: "3" }, &ports.PublishResult{ RowId: "3", IsRejected: true } },
+		{ &ports.ToBePublishedItem{ RowId: "4" }, &ports.PublishResult{ RowId: "4", IsPublished: true, IsDropped: true } },
+		// A scheduled message is late from its delivery time, not from its creation time.
+		{
+			&ports.ToBePublishedItem{ RowId: "5", CreatedAt: now.Add(-time.Hour), DeliverAfter: now.Add(-time.Minute) },
+			&ports.PublishResult{ RowId: "5", IsPublished: true },
+		},
+	} {
+		hooks.OnFetched(pipeline, publish.item)
+		hooks.OnPublishResult(pipeline, publish.item, publish.result, 100 * time.Millisecond)
+	}
+
+	labels := []string{ pipeline.Source, pipeline.Sink }
+	assert.Equal(t, 5.0, testutil.ToFloat64(p.messagesFetched.WithLabelValues(labels...)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(p.messagesPublished.WithLabelValues(labels...)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.messagesFailed.WithLabelValues(labels...)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.messagesRejected.WithLabelValues(labels...)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.messagesDropped.WithLabelValues(labels...)))
+	assert.Equal(t, 7.0, testutil.ToFloat64(p.messagesCleaned.WithLabelValues(labels...)))
+
+	assert.Equal(t, 12.0, testutil.ToFloat64(p.backlog.WithLabelValues(labels...)))
+	assert.Equal(t, 3.0, testutil.ToFloat64(p.lockedMessages.WithLabelValues(labels...)))
+
+	pollDuration := histogram(t, p.pollDuration)
+	assert.Equal(t, uint64(1), pollDuration.GetSampleCount( ))
+	assert.InDelta(t, 0.02, pollDuration.GetSampleSum( ), 1e-9)
+
+	// Only the published messages are observed.
+	publishLatency := histogram(t, p.publishLatency)
+	assert.Equal(t, uint64(2), publishLatency.GetSampleCount( ))
+	assert.InDelta(t, 0.2, publishLatency.GetSampleSum( ), 1e-9)
+
+	endToEndLag := histogram(t, p.endToEndLag)
+	assert.Equal(t, uint64(2), endToEndLag.GetSampleCount( ))
+	assert.InDelta(t, 120, endToEndLag.GetSampleSum( ), 1)
+}
@@ -1,42 +1,298 @@
 package mqs
 
 import (
-	"log"
+	"log/slog"
+	"sync"
 
 	"github.com/streadway/amqp"
 
+	"github.com/Archisman-Mridha/outboxer/cloudevents"
 	"github.com/Archisman-Mridha/outboxer/domain/ports"
 	"github.com/Archisman-Mridha/outboxer/utils"
 )
 
-type RabbitMQAdapter struct {
-	connection *amqp.Connection
-	channel *amqp.Channel
-	queueName string
+// confirmationsBufferSize is the number of publisher confirms which RabbitMQ can send before
+// PublishBatch starts waiting for them.
+const confirmationsBufferSize= 256
+
+type (
+	RabbitMQAdapter struct {
+		connection *amqp.Connection
+		channel *amqp.Channel
+		queueName string
+
+		// publishMutex serializes publishing and waiting for the publisher confirms, since the adapter
+		// can be shared by several pipelines : the delivery tags and returned messages of the confirm
+		// channel mustn't get mixed up between them.
+		publishMutex sync.Mutex
+		// confirmChannel is opened, in confirm mode, on the first call to PublishBatch.
+		confirmChannel confirmPublisher
+		confirmations chan amqp.Confirmation
+		// returns receives the messages which RabbitMQ couldn't route to any queue.
+		returns chan amqp.Return
+		nextDeliveryTag uint64
+
+		logger *slog.Logger
+
+		// ownsConnection is false when the connection was handed over by the caller. In that case,
+		// only the channel opened by the adapter is closed on Disconnect.
+		ownsConnection bool
+	}
+
+	// confirmPublisher is the AMQP channel, in confirm mode, which PublishBatch publishes through.
+	confirmPublisher interface {
+		Publish(exchange, key string, mandatory, immediate bool, message amqp.Publishing) error
+		Close( ) error
+	}
+)
+
+// NewRabbitMQAdapter connects to RabbitMQ and declares the queue. If that fails, a
+// *utils.ConnectionError is returned.
+func NewRabbitMQAdapter(uri, queueName string, logger *slog.Logger) (*RabbitMQAdapter, error) {
+	r := &RabbitMQAdapter{
+		queueName: queueName,
+		logger: utils.LoggerOrDefault(logger).With("sink", "rabbitmq", "queue", queueName),
+		ownsConnection: true,
+	}
+
+	var err error
+	if r.connection, r.channel, err= utils.ConnectRabbitMQ(uri, queueName); err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("Connected to RabbitMQ")
+
+	return r, nil
 }
 
-func NewRabbitMQAdapter(uri, queueName string) *RabbitMQAdapter {
-	r := &RabbitMQAdapter{ queueName: queueName }
-	r.connection, r.channel= utils.ConnectRabbitMQ(uri, queueName)
+// NewRabbitMQAdapterFromConnection creates a RabbitMQAdapter on top of an existing AMQP connection.
+// The adapter opens its own channel on that connection and declares the queue. A nil logger is
+// replaced by the default logger.
+func NewRabbitMQAdapterFromConnection(connection *amqp.Connection, queueName string, logger *slog.Logger) (*RabbitMQAdapter, error) {
+	channel, err := connection.Channel( )
+	if err != nil {
+		return nil, err
+	}
+	if _, err := channel.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
+		channel.Close( )
+		return nil, err
+	}
+
+	return &RabbitMQAdapter{
+		connection: connection,
+		channel: channel,
+		queueName: queueName,
 
-	return r
+		logger: utils.LoggerOrDefault(logger).With("sink", "rabbitmq", "queue", queueName),
+	}, nil
+}
+
+// NewWorker returns an adapter publishing through its own channel, on the same connection.
+func(r *RabbitMQAdapter) NewWorker( ) (ports.MQ, error) {
+	channel, err := r.connection.Channel( )
+	if err != nil {
+		return nil, err
+	}
+
+	return &RabbitMQAdapter{
+		connection: r.connection,
+		channel: channel,
+		queueName: r.queueName,
+
+		logger: r.logger,
+	}, nil
 }
 
 func(r *RabbitMQAdapter) Disconnect( ) {
+	if !r.ownsConnection {
+		if err := r.channel.Close( ); err != nil {
+			r.logger.Error("Error closing RabbitMQ channel", "error", err)
+		}
+		if r.confirmChannel != nil {
+			if err := r.confirmChannel.Close( ); err != nil {
+				r.logger.Error("Error closing RabbitMQ channel", "error", err)
+			}
+		}
+		return
+	}
+
 	if err := r.connection.Close( ); err != nil {
-		log.Printf("❌ Error closing connection to the database: %v", err)
+		r.logger.Error("Error closing connection to RabbitMQ", "error", err)
+		return
+	}
+	r.logger.Info("Closed connection to RabbitMQ")
+}
+
+// Ping inspects the queue, which requires a round trip to RabbitMQ through the channel used for
+// publishing messages.
+func(r *RabbitMQAdapter) Ping( ) error {
+	if r.connection.IsClosed( ) {
+		return amqp.ErrClosed
 	}
+
+	_, err := r.channel.QueueInspect(r.queueName)
+	return err
 }
 
+// PublishMessages waits for the publisher confirm of each message, so that the messages which
+// RabbitMQ can't route to any queue (see the route transform) aren't reported as published.
 func(r *RabbitMQAdapter) PublishMessages(args *ports.PublishMessagesArgs) {
 	for item := range args.ToBePublishedItemsChan {
-		err := r.channel.Publish("", r.queueName, true, false, amqp.Publishing{ Body: item.Message })
-		if err != nil {
-			log.Printf("❌ Error trying to publish message to rabbitMQ: %v", err)
+		args.PublishResultsChan <- r.PublishBatch([]*ports.ToBePublishedItem{ item })[0]
+	}
+}
+
+// PublishBatch publishes all the messages before waiting for their publisher confirms, instead of
+// doing a round trip per message. A message is considered published once RabbitMQ acks it, unless
+// it was returned since it couldn't be routed to any queue.
+func(r *RabbitMQAdapter) PublishBatch(items []*ports.ToBePublishedItem) []*ports.PublishResult {
+	results := make([]*ports.PublishResult, len(items))
+	for i, item := range items {
+		results[i]= &ports.PublishResult{ RowId: item.RowId }
+	}
+
+	r.publishMutex.Lock( )
+	defer r.publishMutex.Unlock( )
+
+	if r.confirmChannel == nil {
+		if err := r.openConfirmChannel( ); err != nil {
+			r.logger.Warn("Error opening RabbitMQ channel in confirm mode", "error", err)
+			return results
 		}
-		args.PublishResultsChan <- &ports.PublishResult{
-			RowId: item.RowId,
-			IsPublished: err == nil,
+	}
+
+	// Delivery tags are assigned sequentially by the channel, to the messages which were sent.
+	// Returned messages carry no delivery tag : they're identified by their message id.
+	var (
+		pending= make(map[uint64]*ports.PublishResult, len(items))
+		byMessageId= make(map[string]*ports.PublishResult, len(items))
+	)
+	for i, item := range items {
+		if err := r.confirmChannel.Publish("", r.routingKey(item), true, false, publishing(item)); err != nil {
+			r.logger.Warn("Error publishing message", "row_id", item.RowId, "attempt", item.Attempt, "error", err)
+			continue
+		}
+		r.nextDeliveryTag++
+		pending[r.nextDeliveryTag]= results[i]
+		if item.MessageId != "" {
+			byMessageId[item.MessageId]= results[i]
+		}
+	}
+
+	if !r.awaitConfirms(pending, byMessageId) {
+		r.logger.Warn("RabbitMQ channel closed while waiting for publisher confirms", "unconfirmed", len(pending))
+		r.confirmChannel= nil
+	}
+
+	return results
+}
+
+// awaitConfirms waits for the publisher confirms of the pending messages, which are removed once
+// they're confirmed. It returns false if the channel was closed in the meantime.
+//
+// RabbitMQ sends the basic.return of an unroutable message before its basic.ack : the returned
+// messages are thus collected before each confirmation is applied.
+func(r *RabbitMQAdapter) awaitConfirms(pending map[uint64]*ports.PublishResult, byMessageId map[string]*ports.PublishResult) bool {
+	returned := map[*ports.PublishResult]bool{ }
+
+	collectReturn := func(message amqp.Return) {
+		result, isFound := byMessageId[message.MessageId]
+		if !isFound {
+			r.logger.Warn("Unroutable message couldn't be matched with a published message", "message_id", message.MessageId)
+			return
+		}
+		r.logger.Warn("Message returned by RabbitMQ", "row_id", result.RowId, "routing_key", message.RoutingKey, "reason", message.ReplyText)
+		returned[result]= true
+	}
+
+	// drainReturns collects the returned messages which have already been received.
+	drainReturns := func( ) {
+		for {
+			select {
+				case message, isOpen := <- r.returns:
+					if !isOpen {
+						r.returns= nil
+						return
+					}
+					collectReturn(message)
+
+				default:
+					return
+			}
+		}
+	}
+
+	for len(pending) > 0 {
+		select {
+			case message, isOpen := <- r.returns:
+				if !isOpen {
+					r.returns= nil
+					continue
+				}
+				collectReturn(message)
+
+			case confirmation, isOpen := <- r.confirmations:
+				if !isOpen {
+					return false
+				}
+				drainReturns( )
+
+				if result, isFound := pending[confirmation.DeliveryTag]; isFound {
+					result.IsPublished= confirmation.Ack && !returned[result]
+					delete(pending, confirmation.DeliveryTag)
+				}
 		}
 	}
-}
\ No newline at end of file
+	return true
+}
+
+func(r *RabbitMQAdapter) openConfirmChannel( ) error {
+	channel, err := r.connection.Channel( )
+	if err != nil {
+		return err
+	}
+	if err := channel.Confirm(false); err != nil {
+		channel.Close( )
+		return err
+	}
+
+	r.confirmChannel= channel
+	r.confirmations= channel.NotifyPublish(make(chan amqp.Confirmation, confirmationsBufferSize))
+	r.returns= channel.NotifyReturn(make(chan amqp.Return, confirmationsBufferSize))
+	r.nextDeliveryTag= 0
+
+	return nil
+}
+
+// CloudEventsHeaderPrefix returns the prefix of the AMQP application properties carrying the
+// CloudEvents attributes, as defined by the AMQP protocol binding.
+func(r *RabbitMQAdapter) CloudEventsHeaderPrefix( ) string {
+	return cloudevents.AMQPHeaderPrefix
+}
+
+// routingKey returns the routing key of the message : the name of the queue, unless it has been
+// overridden (see the route transform). Messages are published to the default exchange, which routes
+// them to the queue named after the routing key.
+func(r *RabbitMQAdapter) routingKey(item *ports.ToBePublishedItem) string {
+	if item.RoutingKey != "" {
+		return item.RoutingKey
+	}
+	return r.queueName
+}
+
+// publishing converts the item into an AMQP message.
+func publishing(item *ports.ToBePublishedItem) amqp.Publishing {
+	headers := amqp.Table{ }
+	for key, value := range item.Headers {
+		headers[key]= value
+	}
+
+	return amqp.Publishing{
+		Headers: headers,
+		MessageId: item.MessageId,
+		Type: item.Topic,
+		ContentType: item.ContentType,
+		ContentEncoding: item.ContentEncoding,
+		Body: item.Message,
+	}
+}
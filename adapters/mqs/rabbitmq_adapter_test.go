@@ -0,0 +1,122 @@
+package mqs
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+func TestAwaitConfirms(t *testing.T) {
+	r := &RabbitMQAdapter{
+		confirmations: make(chan amqp.Confirmation, 4),
+		returns: make(chan amqp.Return, 4),
+
+		logger: utils.LoggerOrDefault(nil),
+	}
+
+	results := []*ports.PublishResult{ { RowId: "1" }, { RowId: "2" }, { RowId: "3" } }
+	pending := map[uint64]*ports.PublishResult{ 1: results[0], 2: results[1], 3: results[2] }
+	byMessageId := map[string]*ports.PublishResult{ "a": results[0], "b": results[1], "c": results[2] }
+
+	// The second message can't be routed : it's returned before being acked. The third one is nacked.
+	r.confirmations <- amqp.Confirmation{ DeliveryTag: 1, Ack: true }
+	r.returns <- amqp.Return{ MessageId: "b", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE", RoutingKey: "unknown" }
+	r.confirmations <- amqp.Confirmation{ DeliveryTag: 2, Ack: true }
+	r.confirmations <- amqp.Confirmation{ DeliveryTag: 3, Ack: false }
+
+	assert.True(t, r.awaitConfirms(pending, byMessageId))
+	assert.Empty(t, pending)
+	assert.True(t, results[0].IsPublished)
+	assert.False(t, results[1].IsPublished)
+	assert.False(t, results[2].IsPublished)
+
+	// The unconfirmed messages are reported when the channel gets closed.
+	result := &ports.PublishResult{ RowId: "4" }
+	pending= map[uint64]*ports.PublishResult{ 4: result }
+	close(r.confirmations)
+
+	assert.False(t, r.awaitConfirms(pending, map[string]*ports.PublishResult{ "d": result }))
+	assert.Len(t, pending, 1)
+	assert.False(t, result.IsPublished)
+}
+
+// fakeConfirmChannel acks every message it's given, after returning the ones published to the
+// unknown queue, like RabbitMQ does.
+type fakeConfirmChannel struct {
+	adapter *RabbitMQAdapter
+	deliveryTag uint64
+}
+
+func(f *fakeConfirmChannel) Publish(exchange, key string, mandatory, immediate bool, message amqp.Publishing) error {
+	f.deliveryTag++
+	if key == "unknown" {
+		f.adapter.returns <- amqp.Return{ MessageId: message.MessageId, ReplyCode: amqp.NoRoute, RoutingKey: key }
+	}
+	f.adapter.confirmations <- amqp.Confirmation{ DeliveryTag: f.deliveryTag, Ack: true }
+	return nil
+}
+
+func(*fakeConfirmChannel) Close( ) error { return nil }
+
+// Several pipelines can publish through the same adapter at once.
+func TestConcurrentPublishBatch(t *testing.T) {
+	r := &RabbitMQAdapter{
+		queueName: "events",
+
+		confirmations: make(chan amqp.Confirmation, confirmationsBufferSize),
+		returns: make(chan amqp.Return, confirmationsBufferSize),
+
+		logger: utils.LoggerOrDefault(nil),
+	}
+	r.confirmChannel= &fakeConfirmChannel{ adapter: r }
+
+	const (
+		pipelines= 2
+		batches= 50
+		batchSize= 4
+	)
+
+	var waitGroup sync.WaitGroup
+	for pipeline := 0; pipeline < pipelines; pipeline++ {
+		waitGroup.Add(1)
+		go func(pipeline int) {
+			defer waitGroup.Done( )
+
+			for batch := 0; batch < batches; batch++ {
+				items := make([]*ports.ToBePublishedItem, batchSize)
+				for i := range items {
+					rowId := fmt.Sprintf("%d-%d-%d", pipeline, batch, i)
+					items[i]= &ports.ToBePublishedItem{ RowId: rowId, MessageId: rowId }
+					// Every other message of the second pipeline can't be routed.
+					if pipeline == 1 && i % 2 == 1 {
+						items[i].RoutingKey= "unknown"
+					}
+				}
+
+				for i, result := range r.PublishBatch(items) {
+					assert.Equal(t, items[i].RowId, result.RowId)
+					assert.Equal(t, items[i].RoutingKey == "", result.IsPublished, result.RowId)
+				}
+			}
+		}(pipeline)
+	}
+
+	publishedChan := make(chan struct{ })
+	go func( ) {
+		waitGroup.Wait( )
+		close(publishedChan)
+	}( )
+	select {
+		case <- publishedChan:
+
+		case <- time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the publisher confirms")
+	}
+}
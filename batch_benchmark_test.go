@@ -0,0 +1,132 @@
+package outboxer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// roundTrip simulates the latency of a call to the outbox DB or to the message queue.
+const roundTrip= 100 * time.Microsecond
+
+type (
+	// remoteOutboxDB is an outbox DB holding an unlimited number of messages, which takes a round
+	// trip per call.
+	remoteOutboxDB struct {
+		nextRowId atomic.Int64
+	}
+
+	// remoteMQ is a message queue which takes a round trip per call.
+	remoteMQ struct { }
+)
+
+func(r *remoteOutboxDB) Disconnect( ) { }
+
+func(r *remoteOutboxDB) Ping( ) error { return nil }
+
+func(r *remoteOutboxDB) GetMessages(args *ports.GetMessagesArgs) {
+	time.Sleep(roundTrip)
+
+	for i := 0; i < args.BatchSize; i++ {
+		args.ToBePublishedItemsChan <- &ports.ToBePublishedItem{
+			RowId: strconv.FormatInt(r.nextRowId.Add(1), 10),
+			Message: []byte("message"),
+		}
+	}
+}
+
+func(r *remoteOutboxDB) UnlockMessagesAndUpdatePublishStatus(args *ports.UnlockMessagesAndUpdatePublishStatusArgs) {
+	for result := range args.PublishResultsChan {
+		time.Sleep(roundTrip)
+		args.AcknowledgementsChan <- &ports.Acknowledgement{ RowId: result.RowId }
+	}
+}
+
+func(r *remoteOutboxDB) UpdatePublishStatusBatch(args *ports.UpdatePublishStatusBatchArgs) []*ports.Acknowledgement {
+	time.Sleep(roundTrip)
+
+	acknowledgements := make([]*ports.Acknowledgement, len(args.PublishResults))
+	for i, result := range args.PublishResults {
+		acknowledgements[i]= &ports.Acknowledgement{ RowId: result.RowId }
+	}
+	return acknowledgements
+}
+
+func(r *remoteOutboxDB) Clean(*ports.CleanArgs) (int64, error) { return 0, nil }
+
+func(r *remoteOutboxDB) GetStats( ) (*ports.OutboxStats, error) { return &ports.OutboxStats{ }, nil }
+
+func(r *remoteMQ) Disconnect( ) { }
+
+func(r *remoteMQ) Ping( ) error { return nil }
+
+func(r *remoteMQ) PublishMessages(args *ports.PublishMessagesArgs) {
+	for item := range args.ToBePublishedItemsChan {
+		time.Sleep(roundTrip)
+		args.PublishResultsChan <- &ports.PublishResult{ RowId: item.RowId, IsPublished: true }
+	}
+}
+
+func(r *remoteMQ) PublishBatch(items []*ports.ToBePublishedItem) []*ports.PublishResult {
+	time.Sleep(roundTrip)
+
+	results := make([]*ports.PublishResult, len(items))
+	for i, item := range items {
+		results[i]= &ports.PublishResult{ RowId: item.RowId, IsPublished: true }
+	}
+	return results
+}
+
+// BenchmarkThroughput measures the time taken to relay a message, with and without batch mode.
+func BenchmarkThroughput(b *testing.B) {
+	for _, batchMode := range []bool{ false, true } {
+		name := "PerItem"
+		if batchMode {
+			name= "Batch"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			var (
+				acknowledged atomic.Int64
+				doneChan= make(chan struct{ })
+				doneOnce sync.Once
+			)
+
+			dispatcher, err := New(
+				WithSource("remote", &remoteOutboxDB{ }, 100),
+				WithSink("remote", &remoteMQ{ }),
+				WithPollInterval(time.Millisecond),
+				WithBatchMode(batchMode),
+				WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				WithHooks(Hooks{
+					OnAcknowledged: func(Pipeline, *ports.ToBePublishedItem, *ports.Acknowledgement) {
+						if acknowledged.Add(1) >= int64(b.N) {
+							doneOnce.Do(func( ) { close(doneChan) })
+						}
+					},
+				}),
+			)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer( )
+			if err := dispatcher.Start(context.Background( )); err != nil {
+				b.Fatal(err)
+			}
+			<- doneChan
+			b.StopTimer( )
+
+			if err := dispatcher.Shutdown(context.Background( )); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
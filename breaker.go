@@ -0,0 +1,46 @@
+package outboxer
+
+import (
+	"github.com/Archisman-Mridha/outboxer/domain/usecases"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+type (
+	// CircuitBreakerOptions configures the circuit breaker of the sink (see WithCircuitBreaker).
+	CircuitBreakerOptions= usecases.CircuitBreakerOptions
+
+	CircuitBreakerState= usecases.CircuitBreakerState
+)
+
+const (
+	CircuitBreakerClosed= usecases.CircuitBreakerClosed
+	CircuitBreakerOpen= usecases.CircuitBreakerOpen
+	CircuitBreakerHalfOpen= usecases.CircuitBreakerHalfOpen
+)
+
+// CircuitBreakerState returns the state of the circuit breaker of the sink. It's always closed, if
+// the circuit breaker is disabled.
+func(d *Dispatcher) CircuitBreakerState( ) CircuitBreakerState {
+	if d.circuitBreaker == nil {
+		return CircuitBreakerClosed
+	}
+	return d.circuitBreaker.State( )
+}
+
+func(d *Dispatcher) onCircuitBreakerStateChange(from, to CircuitBreakerState) {
+	logger := utils.LoggerOrDefault(d.logger).With("sink", d.sinkName, "from", from, "to", to)
+
+	switch to {
+		case CircuitBreakerOpen:
+			logger.Warn("Circuit breaker of the sink opened, stopped fetching messages")
+
+		case CircuitBreakerHalfOpen:
+			logger.Info("Circuit breaker of the sink half-opened, fetching probe messages")
+
+		case CircuitBreakerClosed:
+			logger.Info("Circuit breaker of the sink closed, resumed fetching messages")
+
+			// The sources haven't been polled while the circuit breaker was open.
+			d.markPolled( )
+	}
+}
@@ -0,0 +1,150 @@
+package outboxer
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+type (
+	// endlessOutboxDB is an outbox DB which hands over a full batch of new messages at every poll.
+	endlessOutboxDB struct {
+		inMemoryOutboxDB
+
+		polls atomic.Int64
+		lastRowId atomic.Int64
+	}
+
+	// togglableMQ is an MQ which fails to publish messages while isFailing is set.
+	togglableMQ struct {
+		inMemoryMQ
+
+		isFailing atomic.Bool
+	}
+)
+
+func(e *endlessOutboxDB) GetMessages(args *ports.GetMessagesArgs) {
+	e.polls.Add(1)
+
+	for i := 0; i < args.BatchSize; i++ {
+		rowId := strconv.FormatInt(e.lastRowId.Add(1), 10)
+		args.ToBePublishedItemsChan <- &ports.ToBePublishedItem{ RowId: rowId, Message: []byte(rowId) }
+	}
+}
+
+func(t *togglableMQ) PublishMessages(args *ports.PublishMessagesArgs) {
+	for item := range args.ToBePublishedItemsChan {
+		if t.isFailing.Load( ) {
+			args.PublishResultsChan <- &ports.PublishResult{ RowId: item.RowId }
+			continue
+		}
+
+		t.mutex.Lock( )
+		t.published= append(t.published, item)
+		t.mutex.Unlock( )
+
+		args.PublishResultsChan <- &ports.PublishResult{ RowId: item.RowId, IsPublished: true }
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		outboxDB= &endlessOutboxDB{ }
+		mq= &togglableMQ{ }
+
+		stateChanges []CircuitBreakerState
+	)
+	mq.isFailing.Store(true)
+
+	dispatcher, err := New(
+		WithSource("in-memory", outboxDB, 2),
+		WithSink("in-memory", mq),
+		WithPollInterval(10 * time.Millisecond),
+		WithCircuitBreaker(CircuitBreakerOptions{
+			FailureThreshold: 3,
+			OpenTimeout: 200 * time.Millisecond,
+			Probes: 2,
+			OnStateChange: func(from, to CircuitBreakerState) {
+				stateChanges= append(stateChanges, to)
+			},
+		}),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dispatcher.Start(context.Background( )))
+	defer dispatcher.Shutdown(context.Background( ))
+
+	// The circuit breaker opens after consecutive failures, and fetching is paused.
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitBreakerOpen, dispatcher.CircuitBreakerState( ))
+	assert.Error(t, dispatcher.CheckReadiness( ))
+	assert.NoError(t, dispatcher.CheckLiveness( ))
+
+	polls := outboxDB.polls.Load( )
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, polls, outboxDB.polls.Load( ))
+
+	// Once the sink recovers, the probe messages get published and the circuit breaker closes.
+	mq.isFailing.Store(false)
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, CircuitBreakerClosed, dispatcher.CircuitBreakerState( ))
+	assert.NoError(t, dispatcher.CheckReadiness( ))
+	assert.NotEmpty(t, publishedItems(&mq.inMemoryMQ))
+
+	assert.Equal(t, []CircuitBreakerState{ CircuitBreakerOpen, CircuitBreakerHalfOpen, CircuitBreakerClosed }, stateChanges)
+}
+
+func TestRateLimit(t *testing.T) {
+	var (
+		outboxDB= &endlessOutboxDB{ }
+		mq= &inMemoryMQ{ }
+	)
+
+	dispatcher, err := New(
+		WithSource("in-memory", outboxDB, 10),
+		WithSink("in-memory", mq),
+		WithPollInterval(time.Millisecond),
+		WithMaxInFlight(10),
+		WithRateLimit(50, 0),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dispatcher.Start(context.Background( )))
+	time.Sleep(500 * time.Millisecond)
+
+	// A second worth of messages is let through at once, and then 50 messages per second.
+	published := len(publishedItems(mq))
+	assert.GreaterOrEqual(t, published, 60)
+	assert.LessOrEqual(t, published, 85)
+
+	shutdownContext, cancel := context.WithTimeout(context.Background( ), time.Second)
+	defer cancel( )
+	assert.NoError(t, dispatcher.Shutdown(shutdownContext))
+}
+
+// A shutdown doesn't wait for the throttled messages to be let through.
+func TestRateLimitShutdown(t *testing.T) {
+	for _, batchMode := range []bool{ false, true } {
+		dispatcher, err := New(
+			WithSource("remote", &remoteOutboxDB{ }, 10),
+			WithSink("remote", &remoteMQ{ }),
+			WithPollInterval(time.Millisecond),
+			WithBatchMode(batchMode),
+			WithRateLimit(1, 0),
+		)
+		assert.NoError(t, err)
+
+		assert.NoError(t, dispatcher.Start(context.Background( )))
+		time.Sleep(50 * time.Millisecond)
+
+		shutdownContext, cancel := context.WithTimeout(context.Background( ), 500 * time.Millisecond)
+		assert.NoError(t, dispatcher.Shutdown(shutdownContext), "batch mode: %t", batchMode)
+		cancel( )
+	}
+}
@@ -0,0 +1,95 @@
+// Package claimcheck implements the claim check pattern : the messages larger than a threshold are
+// stored in a blob store by the relay, and only a reference to them (along with their checksum) is
+// published. Consumers resolve the references with a Resolver.
+package claimcheck
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	// ContentType is the content type of the published references.
+	ContentType= "application/vnd.outboxer.claim-check+json"
+
+	// DefaultThreshold is the size (in bytes) from which messages are offloaded, unless configured
+	// otherwise.
+	DefaultThreshold= 256 * 1024
+)
+
+var (
+	ErrBlobNotFound= errors.New("claimcheck: blob not found")
+	ErrChecksumMismatch= errors.New("claimcheck: the checksum of the blob doesn't match the reference")
+)
+
+type (
+	// BlobStore stores the offloaded messages, like a local directory (see FileStore) or an
+	// S3-compatible object storage (see S3Store).
+	BlobStore interface {
+		// Put stores the blob under the given key, replacing the existing one if any.
+		Put(ctx context.Context, key string, blob []byte) error
+		// Get returns the blob stored under the given key, or an error wrapping ErrBlobNotFound.
+		Get(ctx context.Context, key string) ([]byte, error)
+	}
+
+	// Reference is published instead of an offloaded message, encoded as JSON.
+	Reference struct {
+		// Key is the key of the message in the blob store.
+		Key string `json:"key"`
+		Size int `json:"size"`
+		// SHA256 is the hex encoded SHA-256 checksum of the message.
+		SHA256 string `json:"sha256"`
+
+		// ContentType and ContentEncoding are the ones of the message, which are replaced by the ones
+		// of the reference.
+		ContentType string `json:"content_type,omitempty"`
+		ContentEncoding string `json:"content_encoding,omitempty"`
+	}
+
+	// Resolver fetches the messages referred to by the references.
+	Resolver struct {
+		Store BlobStore
+	}
+)
+
+// NewReference returns the reference of the message, stored under the given key.
+func NewReference(key string, message []byte) *Reference {
+	checksum := sha256.Sum256(message)
+	return &Reference{ Key: key, Size: len(message), SHA256: hex.EncodeToString(checksum[:]) }
+}
+
+// Verify checks that the message matches the size and the checksum of the reference.
+func(r *Reference) Verify(message []byte) error {
+	checksum := sha256.Sum256(message)
+	if len(message) != r.Size || hex.EncodeToString(checksum[:]) != r.SHA256 {
+		return fmt.Errorf("%w %s", ErrChecksumMismatch, r.Key)
+	}
+	return nil
+}
+
+// Resolve returns the message referred to by the body, if its content type is ContentType, after
+// checking its checksum, along with the reference (carrying the content type and encoding of the
+// message). Other bodies are returned as they are, with a nil reference.
+func(r *Resolver) Resolve(ctx context.Context, contentType string, body []byte) ([]byte, *Reference, error) {
+	if contentType != ContentType {
+		return body, nil, nil
+	}
+
+	var reference Reference
+	if err := json.Unmarshal(body, &reference); err != nil {
+		return nil, nil, fmt.Errorf("claimcheck: invalid reference: %w", err)
+	}
+
+	message, err := r.Store.Get(ctx, reference.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := reference.Verify(message); err != nil {
+		return nil, nil, err
+	}
+	return message, &reference, nil
+}
@@ -0,0 +1,84 @@
+package claimcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// inMemoryS3 stands in for an S3-compatible object storage.
+type inMemoryS3 struct {
+	mutex sync.Mutex
+	objects map[string][]byte
+}
+
+func(i *inMemoryS3) PutObject(ctx context.Context, bucket, key string, body []byte) error {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	if i.objects == nil {
+		i.objects= map[string][]byte{ }
+	}
+	i.objects[bucket + "/" + key]= body
+	return nil
+}
+
+func(i *inMemoryS3) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	object, isFound := i.objects[bucket + "/" + key]
+	if !isFound {
+		return nil, fmt.Errorf("%w %s", ErrBlobNotFound, key)
+	}
+	return object, nil
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background( )
+
+	fileStore, err := NewFileStore(t.TempDir( ))
+	assert.NoError(t, err)
+
+	stores := map[string]BlobStore{
+		"file": fileStore,
+		"s3": &S3Store{ Client: &inMemoryS3{ }, Bucket: "outboxer", Prefix: "blobs/" },
+	}
+	for name, store := range stores {
+		message := []byte("a large document")
+		reference := NewReference("2024/01/02/0190c2d4-9a0e-7b3e-8f4e-3f2a1b0c9d8e", message)
+		reference.ContentType= "application/json"
+		assert.NoError(t, store.Put(ctx, reference.Key, message), name)
+
+		body, err := json.Marshal(reference)
+		assert.NoError(t, err)
+
+		resolver := &Resolver{ Store: store }
+		resolved, resolvedReference, err := resolver.Resolve(ctx, ContentType, body)
+		assert.NoError(t, err, name)
+		assert.Equal(t, message, resolved, name)
+		assert.Equal(t, "application/json", resolvedReference.ContentType, name)
+
+		// Other messages are returned as they are.
+		resolved, resolvedReference, err= resolver.Resolve(ctx, "application/json", message)
+		assert.NoError(t, err, name)
+		assert.Equal(t, message, resolved, name)
+		assert.Nil(t, resolvedReference, name)
+
+		// Blobs which don't match their reference are detected.
+		assert.NoError(t, store.Put(ctx, reference.Key, []byte("a tampered document")), name)
+		_, _, err= resolver.Resolve(ctx, ContentType, body)
+		assert.ErrorIs(t, err, ErrChecksumMismatch, name)
+
+		_, err= store.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrBlobNotFound, name)
+	}
+
+	for _, invalidKey := range []string{ "", "../outside", "/absolute", "a/./b", ".hidden" } {
+		assert.Error(t, fileStore.Put(ctx, invalidKey, nil), invalidKey)
+	}
+}
@@ -0,0 +1,97 @@
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// FileStore stores the blobs as files of a local directory, the keys being their relative paths.
+	FileStore struct {
+		dir string
+	}
+
+	// S3API is the subset of an S3-compatible object storage client (AWS S3, MinIO, ...) used by
+	// S3Store, to be implemented on top of the client of choice.
+	S3API interface {
+		PutObject(ctx context.Context, bucket, key string, body []byte) error
+		// GetObject returns an error wrapping ErrBlobNotFound if the object doesn't exist.
+		GetObject(ctx context.Context, bucket, key string) ([]byte, error)
+	}
+
+	// S3Store stores the blobs as objects of a bucket, under an optional prefix.
+	S3Store struct {
+		Client S3API
+		Bucket string
+		Prefix string
+	}
+)
+
+// NewFileStore returns a store writing to the given directory, which is created if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating blob store directory %s: %w", dir, err)
+	}
+	return &FileStore{ dir: dir }, nil
+}
+
+func(f *FileStore) Put(ctx context.Context, key string, blob []byte) error {
+	filePath, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+
+	// The blob is written atomically, so that it's never read half written.
+	temporaryFile, err := os.CreateTemp(filepath.Dir(filePath), ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFile.Name( ))
+
+	if _, err := temporaryFile.Write(blob); err != nil {
+		temporaryFile.Close( )
+		return err
+	}
+	if err := temporaryFile.Close( ); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile.Name( ), filePath)
+}
+
+func(f *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	filePath, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w %s", ErrBlobNotFound, key)
+	}
+	return blob, err
+}
+
+// path returns the path of the file of the blob, making sure that it's inside the directory.
+func(f *FileStore) path(key string) (string, error) {
+	cleanKey := path.Clean("/" + key)[1:]
+	if cleanKey == "" || cleanKey != key || strings.HasPrefix(path.Base(cleanKey), ".") {
+		return "", fmt.Errorf("claimcheck: invalid key %q", key)
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(cleanKey)), nil
+}
+
+func(s *S3Store) Put(ctx context.Context, key string, blob []byte) error {
+	return s.Client.PutObject(ctx, s.Bucket, s.Prefix + key, blob)
+}
+
+func(s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.Client.GetObject(ctx, s.Bucket, s.Prefix + key)
+}
@@ -0,0 +1,191 @@
+// Package cloudevents implements the CloudEvents (v1.0) envelope which outboxer can wrap the
+// published messages in : the binary content mode, where the attributes travel as headers (whose
+// prefix depends on the protocol binding), and the structured content mode, where the whole event
+// is encoded as JSON. Consumers can use it to decode the events.
+package cloudevents
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SpecVersion= "1.0"
+
+	// StructuredContentType is the content type of the events encoded in the structured content mode.
+	StructuredContentType= "application/cloudevents+json"
+
+	// Prefixes of the headers carrying the attributes in the binary content mode, for each protocol
+	// binding. The datacontenttype attribute is carried by the content type of the protocol instead.
+	AMQPHeaderPrefix= "cloudEvents:"
+	KafkaHeaderPrefix= "ce_"
+	HTTPHeaderPrefix= "ce-"
+)
+
+// Mode is the content mode of the envelope.
+type Mode string
+
+const (
+	ModeBinary Mode= "binary"
+	ModeStructured Mode= "structured"
+)
+
+// Event is a CloudEvent.
+type Event struct {
+	Id string
+	Source string
+	SpecVersion string
+	Type string
+
+	Subject string
+	Time time.Time
+	DataContentType string
+	DataSchema string
+
+	// Extensions are the extension attributes, in their canonical string representation.
+	Extensions map[string]string
+
+	Data []byte
+}
+
+var ErrMissingAttribute= errors.New("cloudevents: missing required attribute")
+
+// Validate checks that the required attributes are set, and that the extension attribute names are
+// valid.
+func(e *Event) Validate( ) error {
+	for name, value := range map[string]string{ "id": e.Id, "source": e.Source, "specversion": e.SpecVersion, "type": e.Type } {
+		if value == "" {
+			return fmt.Errorf("%w %s", ErrMissingAttribute, name)
+		}
+	}
+	if e.SpecVersion != SpecVersion {
+		return fmt.Errorf("cloudevents: unsupported spec version %s", e.SpecVersion)
+	}
+
+	for name := range e.Extensions {
+		if !isValidAttributeName(name) {
+			return fmt.Errorf("cloudevents: invalid extension attribute name %q", name)
+		}
+		if _, isContextAttribute := contextAttributes[name]; isContextAttribute {
+			return fmt.Errorf("cloudevents: extension attribute %q shadows a context attribute", name)
+		}
+	}
+	return nil
+}
+
+// contextAttributes are the attributes defined by the specification (data aside).
+var contextAttributes= map[string]struct{ }{
+	"id": { }, "source": { }, "specversion": { }, "type": { },
+	"subject": { }, "time": { }, "datacontenttype": { }, "dataschema": { },
+}
+
+// isValidAttributeName checks that the attribute name is only made of lower-case ASCII letters and
+// digits.
+func isValidAttributeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, character := range name {
+		if !(character >= 'a' && character <= 'z' || character >= '0' && character <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// attributes returns the attributes of the event, other than datacontenttype, in their canonical
+// string representation.
+func(e *Event) attributes( ) map[string]string {
+	attributes := map[string]string{
+		"id": e.Id,
+		"source": e.Source,
+		"specversion": e.SpecVersion,
+		"type": e.Type,
+	}
+	if e.Subject != "" {
+		attributes["subject"]= e.Subject
+	}
+	if !e.Time.IsZero( ) {
+		attributes["time"]= e.Time.UTC( ).Format(time.RFC3339Nano)
+	}
+	if e.DataSchema != "" {
+		attributes["dataschema"]= e.DataSchema
+	}
+	for name, value := range e.Extensions {
+		attributes[name]= value
+	}
+	return attributes
+}
+
+// setAttribute sets the attribute with the given name, from its canonical string representation.
+func(e *Event) setAttribute(name, value string) error {
+	switch name {
+		case "id":
+			e.Id= value
+
+		case "source":
+			e.Source= value
+
+		case "specversion":
+			e.SpecVersion= value
+
+		case "type":
+			e.Type= value
+
+		case "subject":
+			e.Subject= value
+
+		case "time":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return fmt.Errorf("cloudevents: invalid time %q: %w", value, err)
+			}
+			e.Time= t
+
+		case "datacontenttype":
+			e.DataContentType= value
+
+		case "dataschema":
+			e.DataSchema= value
+
+		default:
+			if e.Extensions == nil {
+				e.Extensions= map[string]string{ }
+			}
+			e.Extensions[name]= value
+	}
+	return nil
+}
+
+// BinaryHeaders returns the headers carrying the attributes of the event in the binary content mode,
+// using the given prefix (AMQPHeaderPrefix, KafkaHeaderPrefix or HTTPHeaderPrefix). The data is sent
+// as is, with datacontenttype as the content type.
+func(e *Event) BinaryHeaders(prefix string) map[string]string {
+	attributes := e.attributes( )
+
+	headers := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		headers[prefix + name]= value
+	}
+	return headers
+}
+
+// FromBinary decodes an event received in the binary content mode, from the headers carrying its
+// attributes (see BinaryHeaders), the content type and the data. Headers without the prefix are
+// ignored. The header names are matched case insensitively, as HTTP requires.
+func FromBinary(prefix string, headers map[string]string, contentType string, data []byte) (*Event, error) {
+	event := &Event{ DataContentType: contentType, Data: data }
+	for name, value := range headers {
+		if len(name) <= len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+			continue
+		}
+
+		if err := event.setAttribute(strings.ToLower(name[len(prefix):]), value); err != nil {
+			return nil, err
+		}
+	}
+
+	return event, event.Validate( )
+}
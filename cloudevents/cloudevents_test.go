@@ -0,0 +1,183 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The examples below come from the CloudEvents specification (v1.0.2) : the JSON event format and
+// the AMQP, Kafka and HTTP protocol bindings.
+
+func TestStructuredConformance(t *testing.T) {
+	t.Run("Text data", func(t *testing.T) {
+		event, err := UnmarshalStructured([]byte(`{
+			"specversion" : "1.0",
+			"type" : "com.github.pull_request.opened",
+			"source" : "https://github.com/cloudevents/spec/pull",
+			"subject" : "123",
+			"id" : "A234-1234-1234",
+			"time" : "2018-04-05T17:31:00Z",
+			"comexampleextension1" : "value",
+			"comexampleothervalue" : 5,
+			"datacontenttype" : "text/xml",
+			"data" : "<much wow=\"xml\"/>"
+		}`))
+		assert.Nil(t, err)
+
+		assert.Equal(t, "A234-1234-1234", event.Id)
+		assert.Equal(t, "https://github.com/cloudevents/spec/pull", event.Source)
+		assert.Equal(t, "com.github.pull_request.opened", event.Type)
+		assert.Equal(t, "123", event.Subject)
+		assert.Equal(t, time.Date(2018, 4, 5, 17, 31, 0, 0, time.UTC), event.Time)
+		assert.Equal(t, "text/xml", event.DataContentType)
+		assert.Equal(t, map[string]string{ "comexampleextension1": "value", "comexampleothervalue": "5" }, event.Extensions)
+		assert.Equal(t, `<much wow="xml"/>`, string(event.Data))
+
+		assertStructuredRoundTrip(t, event)
+	})
+
+	t.Run("Binary data", func(t *testing.T) {
+		event, err := UnmarshalStructured([]byte(`{
+			"specversion" : "1.0",
+			"type" : "com.example.someevent",
+			"source" : "/mycontext",
+			"id" : "A234-1234-1234",
+			"time" : "2018-04-05T17:31:00Z",
+			"comexampleextension1" : "value",
+			"comexampleothervalue" : 5,
+			"datacontenttype" : "application/vnd.apache.thrift.binary",
+			"data_base64" : "AQID"
+		}`))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{ 1, 2, 3 }, event.Data)
+
+		encoded, err := event.MarshalStructured( )
+		assert.Nil(t, err)
+		assert.Contains(t, string(encoded), `"data_base64":"AQID"`)
+
+		assertStructuredRoundTrip(t, event)
+	})
+
+	t.Run("JSON data", func(t *testing.T) {
+		event, err := UnmarshalStructured([]byte(`{
+			"specversion" : "1.0",
+			"type" : "com.example.someevent",
+			"source" : "/mycontext",
+			"id" : "C234-1234-1234",
+			"time" : "2018-04-05T17:31:00Z",
+			"comexampleextension1" : "value",
+			"comexampleothervalue" : 5,
+			"unsetextension": null,
+			"datacontenttype" : "application/json",
+			"data" : {
+				"appinfoA" : "abc",
+				"appinfoB" : 123,
+				"appinfoC" : true
+			}
+		}`))
+		assert.Nil(t, err)
+		assert.NotContains(t, event.Extensions, "unsetextension")
+		assert.JSONEq(t, `{ "appinfoA": "abc", "appinfoB": 123, "appinfoC": true }`, string(event.Data))
+
+		encoded, err := event.MarshalStructured( )
+		assert.Nil(t, err)
+
+		var fields map[string]interface{ }
+		assert.Nil(t, json.Unmarshal(encoded, &fields))
+		assert.IsType(t, map[string]interface{ }{ }, fields["data"], "JSON data is embedded as is")
+
+		// The embedded JSON gets compacted.
+		event.Data= []byte(`{"appinfoA":"abc","appinfoB":123,"appinfoC":true}`)
+		assertStructuredRoundTrip(t, event)
+	})
+
+	t.Run("Missing required attributes", func(t *testing.T) {
+		_, err := UnmarshalStructured([]byte(`{ "specversion": "1.0", "source": "/mycontext", "id": "1" }`))
+		assert.ErrorIs(t, err, ErrMissingAttribute)
+	})
+}
+
+func assertStructuredRoundTrip(t *testing.T, event *Event) {
+	encoded, err := event.MarshalStructured( )
+	assert.Nil(t, err)
+
+	decoded, err := UnmarshalStructured(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, event, decoded)
+}
+
+func TestBinaryConformance(t *testing.T) {
+	event := &Event{
+		Id: "1234-1234-1234",
+		Source: "/mycontext/subcontext",
+		SpecVersion: SpecVersion,
+		Type: "com.example.someevent",
+		Time: time.Date(2018, 4, 5, 3, 56, 24, 0, time.UTC),
+		DataContentType: "application/json; charset=utf-8",
+		Data: []byte(`{ "much": "wow" }`),
+	}
+
+	for _, testCase := range []struct {
+		binding string
+		prefix string
+		headers map[string]string
+	}{
+		{
+			binding: "AMQP",
+			prefix: AMQPHeaderPrefix,
+			headers: map[string]string{
+				"cloudEvents:specversion": "1.0",
+				"cloudEvents:type": "com.example.someevent",
+				"cloudEvents:time": "2018-04-05T03:56:24Z",
+				"cloudEvents:id": "1234-1234-1234",
+				"cloudEvents:source": "/mycontext/subcontext",
+			},
+		},
+		{
+			binding: "Kafka",
+			prefix: KafkaHeaderPrefix,
+			headers: map[string]string{
+				"ce_specversion": "1.0",
+				"ce_type": "com.example.someevent",
+				"ce_time": "2018-04-05T03:56:24Z",
+				"ce_id": "1234-1234-1234",
+				"ce_source": "/mycontext/subcontext",
+			},
+		},
+		{
+			binding: "HTTP",
+			prefix: HTTPHeaderPrefix,
+			headers: map[string]string{
+				"ce-specversion": "1.0",
+				"ce-type": "com.example.someevent",
+				"ce-time": "2018-04-05T03:56:24Z",
+				"ce-id": "1234-1234-1234",
+				"ce-source": "/mycontext/subcontext",
+			},
+		},
+	} {
+		t.Run(testCase.binding, func(t *testing.T) {
+			assert.Equal(t, testCase.headers, event.BinaryHeaders(testCase.prefix))
+
+			decoded, err := FromBinary(testCase.prefix, testCase.headers, event.DataContentType, event.Data)
+			assert.Nil(t, err)
+			assert.Equal(t, event, decoded)
+		})
+	}
+
+	t.Run("HTTP headers are case insensitive", func(t *testing.T) {
+		decoded, err := FromBinary(HTTPHeaderPrefix, map[string]string{
+			"Ce-Specversion": "1.0",
+			"Ce-Type": "com.example.someevent",
+			"Ce-Id": "1234-1234-1234",
+			"Ce-Source": "/mycontext/subcontext",
+			"Content-Length": "17",
+		}, "application/json", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "com.example.someevent", decoded.Type)
+		assert.Nil(t, decoded.Extensions)
+	})
+}
@@ -0,0 +1,139 @@
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// MarshalStructured encodes the event in the structured content mode, as JSON. The data is embedded
+// as JSON when datacontenttype is a JSON media type, as a string when it's a textual one, and as
+// base64 (data_base64) otherwise.
+func(e *Event) MarshalStructured( ) ([]byte, error) {
+	if err := e.Validate( ); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{ }, len(e.Extensions) + 9)
+	for name, value := range e.attributes( ) {
+		fields[name]= value
+	}
+	if e.DataContentType != "" {
+		fields["datacontenttype"]= e.DataContentType
+	}
+
+	if e.Data != nil {
+		switch {
+			case isJSONContentType(e.DataContentType) && json.Valid(e.Data):
+				fields["data"]= json.RawMessage(e.Data)
+
+			case isTextContentType(e.DataContentType):
+				fields["data"]= string(e.Data)
+
+			default:
+				fields["data_base64"]= base64.StdEncoding.EncodeToString(e.Data)
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// UnmarshalStructured decodes an event encoded in the structured content mode. Extension attributes
+// of other types than string (numbers, booleans) are converted to their canonical string
+// representation.
+func UnmarshalStructured(encoded []byte) (*Event, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, fmt.Errorf("cloudevents: invalid structured event: %w", err)
+	}
+
+	event := &Event{ }
+	for name, value := range fields {
+		switch name {
+			case "data", "data_base64":
+				continue
+		}
+
+		canonicalValue, isSet, err := canonicalString(value)
+		if err != nil {
+			return nil, fmt.Errorf("cloudevents: invalid attribute %s: %w", name, err)
+		}
+		if !isSet {
+			continue
+		}
+		if err := event.setAttribute(name, canonicalValue); err != nil {
+			return nil, err
+		}
+	}
+
+	if encodedData, isFound := fields["data_base64"]; isFound {
+		var data string
+		if err := json.Unmarshal(encodedData, &data); err != nil {
+			return nil, fmt.Errorf("cloudevents: invalid data_base64: %w", err)
+		}
+
+		var err error
+		if event.Data, err= base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, fmt.Errorf("cloudevents: invalid data_base64: %w", err)
+		}
+	} else if data, isFound := fields["data"]; isFound {
+		// Data which isn't JSON is embedded as a string.
+		var text string
+		if !isJSONContentType(event.DataContentType) && json.Unmarshal(data, &text) == nil {
+			event.Data= []byte(text)
+		} else {
+			event.Data= []byte(data)
+		}
+	}
+
+	return event, event.Validate( )
+}
+
+// canonicalString returns the canonical string representation of a JSON attribute value. A null
+// value means that the attribute is unset.
+func canonicalString(value json.RawMessage) (string, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber( )
+
+	var decoded interface{ }
+	if err := decoder.Decode(&decoded); err != nil {
+		return "", false, err
+	}
+
+	switch decoded := decoded.(type) {
+		case nil:
+			return "", false, nil
+
+		case string:
+			return decoded, true, nil
+
+		case json.Number:
+			return decoded.String( ), true, nil
+
+		case bool:
+			return strconv.FormatBool(decoded), true, nil
+
+		default:
+			return "", false, fmt.Errorf("unsupported value %s", value)
+	}
+}
+
+// isJSONContentType returns true for application/json and the media types with the +json suffix.
+// Data without a content type is assumed to be JSON, as the specification requires.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+func isTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (strings.HasPrefix(mediaType, "text/") || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml"))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Archisman-Mridha/outboxer"
+)
+
+// adminServer is the HTTP server through which outboxer exposes its metrics and health checks.
+type adminServer struct {
+	server *http.Server
+	logger *slog.Logger
+}
+
+func newAdminServer(address string, gatherer prometheus.Gatherer, dispatcher *outboxer.Dispatcher, logger *slog.Logger) *adminServer {
+	mux := http.NewServeMux( )
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{ }))
+
+	// The process is up.
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	// Every source and the sink are reachable.
+	mux.Handle("/readyz", healthCheckHandler(dispatcher.CheckReadiness))
+	// None of the pipelines is stuck.
+	mux.Handle("/livez", healthCheckHandler(dispatcher.CheckLiveness))
+	// This replica is relaying messages (always true, unless leader election is enabled).
+	mux.Handle("/leaderz", healthCheckHandler(dispatcher.CheckLeadership))
+
+	return &adminServer{
+		server: &http.Server{
+			Addr: address,
+			Handler: mux,
+		},
+		logger: logger,
+	}
+}
+
+// start starts serving requests in a separate go-routine.
+func(a *adminServer) start( ) {
+	go func( ) {
+		a.logger.Info("Admin server listening", "address", a.server.Addr)
+
+		if err := a.server.ListenAndServe( ); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Error("Error serving admin HTTP server", "error", err)
+		}
+	}( )
+}
+
+// healthCheckHandler responds with 503 Service Unavailable, along with the error, when the given
+// health check fails.
+func healthCheckHandler(check func( ) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := check( ); err != nil {
+			http.Error(w, err.Error( ), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+func(a *adminServer) shutdown(ctx context.Context) {
+	if err := a.server.Shutdown(ctx); err != nil {
+		a.logger.Error("Error shutting down admin HTTP server", "error", err)
+	}
+}
\ No newline at end of file
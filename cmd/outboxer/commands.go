@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/Archisman-Mridha/outboxer"
+	"github.com/Archisman-Mridha/outboxer/adapters/dbs"
+	"github.com/Archisman-Mridha/outboxer/adapters/mqs"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+	"github.com/Archisman-Mridha/outboxer/events"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+)
+
+type (
+	command struct {
+		description string
+		run func(args []string) error
+	}
+
+	// adminSource is a source, configured in the config file, which the admin commands operate on.
+	adminSource struct {
+		name string
+		outboxAdmin adminOutboxDB
+		disconnect func( )
+	}
+
+	adminOutboxDB interface {
+		ports.OutboxAdmin
+		ports.OutboxReplayer
+	}
+)
+
+// commands are the subcommands of the outboxer binary. The admin commands (all except run) read the
+// same config file as the relay, and operate on each of the configured sources unless --source is
+// given.
+var commands= map[string]command{
+	"run": { "Relay messages from the sources to the sink (default)", runRelay },
+	"status": { "Show the backlog, locked, failed, dead lettered and scheduled messages of each source", runStatus },
+	"list": { "List the messages in a given state", runList },
+	"unlock": { "Unlock a message held by a crashed relay", runUnlock },
+	"cancel": { "Cancel a scheduled message before it's published", runCancel },
+	"requeue": { "Requeue the dead lettered messages", runRequeue },
+	"purge": { "Delete the published messages", runPurge },
+	"replay": { "Re-publish the retained published messages", runReplay },
+	"schema": { "Check or register the schemas of the messages in the schema registry", runSchema },
+	"keys": { "List or rotate the keys of the key file encrypting the messages", runKeys },
+}
+
+func printUsage( ) {
+	fmt.Fprintln(os.Stderr, "Usage : outboxer [command] [flags]\n\nCommands :")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names= append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(writer, "  %s\t%s\n", name, commands[name].description)
+	}
+	writer.Flush( )
+}
+
+// adminLogger is used by the admin commands. Only warnings and errors are logged, so that they
+// don't get mixed up with the output.
+var adminLogger= slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{ Level: slog.LevelWarn }))
+
+// newFlagSet creates the flag set of a command, along with the -config flag which all the commands
+// share.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := flags.String("config", "./config.yaml", "path to the config file")
+	return flags, configPath
+}
+
+func runStatus(args []string) error {
+	flags, configPath := newFlagSet("status")
+	sourceName := flags.String("source", "", "only show the given source (postgres or redis)")
+	flags.Parse(args)
+
+	sources, err := connectAdminSources(*configPath, *sourceName)
+	if err != nil {
+		return err
+	}
+	defer disconnectAdminSources(sources)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SOURCE\tBACKLOG\tLOCKED\tFAILED\tDEAD LETTERED\tSCHEDULED\tOLDEST UNPUBLISHED")
+	for _, source := range sources {
+		status, err := source.outboxAdmin.GetStatus( )
+		if err != nil {
+			return fmt.Errorf("error getting status of source %s: %w", source.name, err)
+		}
+
+		oldestAge := "-"
+		if !status.OldestUnpublishedAt.IsZero( ) {
+			oldestAge= time.Since(status.OldestUnpublishedAt).Round(time.Second).String( )
+		}
+
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			source.name, status.Backlog, status.Locked, status.Failed, status.DeadLettered, status.Scheduled, oldestAge,
+		)
+	}
+	return writer.Flush( )
+}
+
+func runList(args []string) error {
+	flags, configPath := newFlagSet("list")
+	sourceName := flags.String("source", "", "only list the messages of the given source (postgres or redis)")
+	state := flags.String("state", string(ports.MessageStateUnpublished),
+		"one of unpublished, locked, failed, dead-letter, published or scheduled")
+	limit := flags.Int("limit", 50, "maximum number of messages listed per source")
+	flags.Parse(args)
+
+	sources, err := connectAdminSources(*configPath, *sourceName)
+	if err != nil {
+		return err
+	}
+	defer disconnectAdminSources(sources)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SOURCE\tID\tCREATED\tDELIVER AFTER\tATTEMPTS\tSIZE\tLOCKED\tPUBLISHED")
+	for _, source := range sources {
+		messages, err := source.outboxAdmin.ListMessages(ports.MessageState(*state), *limit)
+		if err != nil {
+			return fmt.Errorf("error listing messages of source %s: %w", source.name, err)
+		}
+
+		for _, message := range messages {
+			deliverAfter, lockedAt, publishedAt := "-", "-", "-"
+			if !message.DeliverAfter.IsZero( ) {
+				deliverAfter= formatTime(message.DeliverAfter)
+			}
+			if message.Locked {
+				lockedAt= formatTime(message.LockedAt)
+			}
+			if message.Published {
+				publishedAt= formatTime(message.PublishedAt)
+			}
+
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+				source.name, message.RowId, formatTime(message.CreatedAt), deliverAfter, message.Attempts, message.Size,
+				lockedAt, publishedAt,
+			)
+		}
+	}
+	return writer.Flush( )
+}
+
+func runUnlock(args []string) error {
+	flags, configPath := newFlagSet("unlock")
+	sourceName := flags.String("source", "", "source of the message (required if multiple sources are configured)")
+	flags.Usage= func( ) {
+		fmt.Fprintln(flags.Output( ), "Usage : outboxer unlock [flags] <id>")
+		flags.PrintDefaults( )
+	}
+	flags.Parse(args)
+
+	if flags.NArg( ) != 1 {
+		flags.Usage( )
+		os.Exit(2)
+	}
+	rowId := flags.Arg(0)
+
+	sources, err := connectAdminSources(*configPath, *sourceName)
+	if err != nil {
+		return err
+	}
+	defer disconnectAdminSources(sources)
+
+	if len(sources) > 1 {
+		return errors.New("multiple sources are configured : use --source to pick one")
+	}
+
+	isUnlocked, err := sources[0].outboxAdmin.UnlockMessage(rowId)
+	if err != nil {
+		return fmt.Errorf("error unlocking message %s: %w", rowId, err)
+	}
+	if !isUnlocked {
+		return fmt.Errorf("message %s is not locked", rowId)
+	}
+
+	fmt.Printf("Unlocked message %s\n", rowId)
+	return nil
+}
+
+// runCancel deletes a scheduled message before its delivery time. The messages of the Redis source
+// are identified by their message id, since they aren't in the outbox stream yet.
+func runCancel(args []string) error {
+	flags, configPath := newFlagSet("cancel")
+	sourceName := flags.String("source", "", "source of the message (required if multiple sources are configured)")
+	flags.Usage= func( ) {
+		fmt.Fprintln(flags.Output( ), "Usage : outboxer cancel [flags] <id>")
+		flags.PrintDefaults( )
+	}
+	flags.Parse(args)
+
+	if flags.NArg( ) != 1 {
+		flags.Usage( )
+		os.Exit(2)
+	}
+	rowId := flags.Arg(0)
+
+	sources, err := connectAdminSources(*configPath, *sourceName)
+	if err != nil {
+		return err
+	}
+	defer disconnectAdminSources(sources)
+
+	if len(sources) > 1 {
+		return errors.New("multiple sources are configured : use --source to pick one")
+	}
+
+	isCancelled, err := sources[0].outboxAdmin.CancelScheduledMessage(rowId)
+	if err != nil {
+		return fmt.Errorf("error cancelling message %s: %w", rowId, err)
+	}
+	if !isCancelled {
+		return fmt.Errorf("message %s is not scheduled", rowId)
+	}
+
+	fmt.Printf("Cancelled message %s\n", rowId)
+	return nil
+}
+
+func runRequeue(args []string) error {
+	flags, configPath := newFlagSet("requeue")
+	sourceName := flags.String("source", "", "only requeue the messages of the given source (postgres or redis)")
+	deadLetter := flags.Bool("dead-letter", false, "requeue the dead lettered messages")
+	flags.Parse(args)
+
+	if !*deadLetter {
+		return errors.New("nothing to requeue : use --dead-letter")
+	}
+
+	sources, err := connectAdminSources(*configPath, *sourceName)
+	if err != nil {
+		return err
+	}
+	defer disconnectAdminSources(sources)
+
+	for _, source := range sources {
+		count, err := source.outboxAdmin.RequeueDeadLetteredMessages( )
+		if err != nil {
+			return fmt.Errorf("error requeueing messages of source %s: %w", source.name, err)
+		}
+		fmt.Printf("Requeued %d dead lettered messages of source %s\n", count, source.name)
+	}
+	return nil
+}
+
+func runPurge(args []string) error {
+	flags, configPath := newFlagSet("purge")
+	sourceName := flags.String("source", "", "only purge the messages of the given source (postgres or redis)")
+	publishedBefore := flags.String("published-before", "",
+		"delete the messages published before this time (RFC 3339) or this long ago (e.g. 168h)")
+	flags.Parse(args)
+
+	if *publishedBefore == "" {
+		return errors.New("--published-before is required")
+	}
+	before, err := parseTimeOrAge(*publishedBefore)
+	if err != nil {
+		return fmt.Errorf("invalid --published-before: %w", err)
+	}
+
+	sources, err := connectAdminSources(*configPath, *sourceName)
+	if err != nil {
+		return err
+	}
+	defer disconnectAdminSources(sources)
+
+	for _, source := range sources {
+		count, err := source.outboxAdmin.PurgePublishedMessages(before)
+		if err != nil {
+			return fmt.Errorf("error purging messages of source %s: %w", source.name, err)
+		}
+		fmt.Printf("Deleted %d published messages of source %s\n", count, source.name)
+	}
+	return nil
+}
+
+func runReplay(args []string) error {
+	flags, configPath := newFlagSet("replay")
+	sourceName := flags.String("source", "", "source of the messages (required if multiple sources are configured)")
+	from := flags.String("from", "", "replay the messages created at or after this time (RFC 3339) or this long ago (e.g. 24h)")
+	to := flags.String("to", "", "replay the messages created at or before this time (RFC 3339) or this long ago")
+	fromId := flags.String("from-id", "", "replay the messages starting from this id")
+	toId := flags.String("to-id", "", "replay the messages up to this id")
+	topic := flags.String("topic", "", "only replay the messages with this topic")
+	sinkUri := flags.String("sink-uri", "", "publish to this RabbitMQ server instead of the configured sink")
+	queue := flags.String("queue", "", "publish to this queue instead of the configured one")
+	flags.Parse(args)
+
+	filter := outboxer.ReplayFilter{
+		FromRowId: *fromId,
+		ToRowId: *toId,
+		Topic: *topic,
+	}
+	var err error
+	if *from != "" {
+		if filter.CreatedAfter, err= parseTimeOrAge(*from); err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+	}
+	if *to != "" {
+		if filter.CreatedBefore, err= parseTimeOrAge(*to); err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if config.Sink != nil {
+		if *sinkUri == "" {
+			*sinkUri= config.Sink.Uri
+		}
+		if *queue == "" {
+			*queue= config.Sink.Queue
+		}
+	}
+	if *sinkUri == "" || *queue == "" {
+		return errors.New("no sink is configured : use --sink-uri and --queue")
+	}
+
+	sources, err := connectAdminSources(*configPath, *sourceName)
+	if err != nil {
+		return err
+	}
+	defer disconnectAdminSources(sources)
+
+	if len(sources) > 1 {
+		return errors.New("multiple sources are configured : use --source to pick one")
+	}
+
+	mq, err := mqs.NewRabbitMQAdapter(*sinkUri, *queue, adminLogger)
+	if err != nil {
+		return err
+	}
+	defer mq.Disconnect( )
+
+	// Stop replaying on Ctrl+C.
+	ctx, cancel := signal.NotifyContext(context.Background( ), os.Interrupt, syscall.SIGTERM)
+	defer cancel( )
+
+	// Replayed messages are validated and wrapped like the relayed ones.
+	replayOptions := &outboxer.ReplayOptions{ SourceName: sources[0].name }
+	if config.SchemaRegistry != nil {
+		if replayOptions.SchemaRegistry, err= schemas.Open(config.SchemaRegistry.path( )); err != nil {
+			return err
+		}
+	}
+	if config.Events != nil {
+		if replayOptions.EventValidation, err= config.Events.validation( ); err != nil {
+			return err
+		}
+	}
+	if len(config.Transforms) > 0 {
+		var eventsRegistry *events.Registry
+		if replayOptions.EventValidation != nil {
+			eventsRegistry= replayOptions.EventValidation.Registry
+		}
+		if replayOptions.Transforms, err= newTransforms(config.Transforms, eventsRegistry); err != nil {
+			return err
+		}
+	}
+	if config.CloudEvents != nil {
+		replayOptions.CloudEvents= config.CloudEvents.envelope( )
+	}
+
+	if config.Encryption != nil {
+		decryptionKeys, err := config.Encryption.decryptionKeys( )
+		if err != nil {
+			return err
+		}
+		if decryptionKeys != nil {
+			replayOptions.Decryptor= &encryption.Encryptor{ Provider: decryptionKeys }
+		}
+	}
+	if config.Compression != nil {
+		if replayOptions.Compressor, err= config.Compression.compressor( ); err != nil {
+			return err
+		}
+	}
+
+	if config.ClaimCheck != nil {
+		if replayOptions.ClaimCheck, err= config.ClaimCheck.claimCheck( ); err != nil {
+			return err
+		}
+	}
+
+	result, err := outboxer.Replay(ctx, sources[0].outboxAdmin, mq, filter, replayOptions, adminLogger)
+	if result != nil {
+		fmt.Printf("Replayed %d messages of source %s to queue %s (%d dropped, %d failed)\n",
+			result.Published, sources[0].name, *queue, result.Dropped, result.Failed,
+		)
+	}
+	return err
+}
+
+// connectAdminSources connects to the sources configured in the config file (or only to the given
+// one). Unlike the relay, connections are attempted only once.
+func connectAdminSources(configPath, sourceName string) ([]*adminSource, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if config.Sources == nil {
+		return nil, errors.New("no sources are configured")
+	}
+
+	var sources []*adminSource
+
+	if config.Sources.Postgres != nil && (sourceName == "" || sourceName == "postgres") {
+		outboxDB, err := dbs.NewPostgresAdapter(config.Sources.Postgres.Uri, adminLogger)
+		if err != nil {
+			disconnectAdminSources(sources)
+			return nil, err
+		}
+		sources= append(sources, &adminSource{ "postgres", outboxDB, outboxDB.Disconnect })
+	}
+
+	if config.Sources.Redis != nil && (sourceName == "" || sourceName == "redis") {
+		outboxDB, err := dbs.NewRedisAdapter(&redis.Options{
+			Addr: config.Sources.Redis.Uri,
+			Password: config.Sources.Redis.Password,
+			DB: config.Sources.Redis.Db,
+		}, adminLogger)
+		if err != nil {
+			disconnectAdminSources(sources)
+			return nil, err
+		}
+		sources= append(sources, &adminSource{ "redis", outboxDB, outboxDB.Disconnect })
+	}
+
+	if len(sources) == 0 {
+		if sourceName != "" {
+			return nil, fmt.Errorf("source %s is not configured", sourceName)
+		}
+		return nil, errors.New("no sources are configured")
+	}
+
+	return sources, nil
+}
+
+func disconnectAdminSources(sources []*adminSource) {
+	for _, source := range sources {
+		source.disconnect( )
+	}
+}
+
+// parseTimeOrAge parses either an RFC 3339 timestamp, or a duration which is subtracted from the
+// current time.
+func parseTimeOrAge(value string) (time.Time, error) {
+	if age, err := time.ParseDuration(value); err == nil {
+		return time.Now( ).Add(-age), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func formatTime(t time.Time) string {
+	return t.Local( ).Format(time.DateTime)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfig writes the given YAML config to a temporary file, and returns its path.
+func writeConfig(t *testing.T, config string) string {
+	t.Helper( )
+
+	path := filepath.Join(t.TempDir( ), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseTimeOrAge(t *testing.T) {
+	before := time.Now( )
+	parsed, err := parseTimeOrAge("24h")
+	assert.NoError(t, err)
+	assert.WithinRange(t, parsed, before.Add(-24 * time.Hour), time.Now( ).Add(-24 * time.Hour))
+
+	parsed, err= parseTimeOrAge("2024-03-01T12:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), parsed.UTC( ))
+
+	_, err= parseTimeOrAge("yesterday")
+	assert.Error(t, err)
+}
+
+// The arguments are checked before connecting to the sources.
+func TestAdminCommandArguments(t *testing.T) {
+	configPath := writeConfig(t, "sources:\n  postgres:\n    uri: postgresql://localhost:1/outboxer\n")
+
+	for _, testCase := range []struct {
+		name string
+		run func(args []string) error
+		args []string
+		expectedError string
+	}{
+		{ "requeue without --dead-letter", runRequeue, []string{ "-config", configPath }, "nothing to requeue : use --dead-letter" },
+		{ "purge without --published-before", runPurge, []string{ "-config", configPath }, "--published-before is required" },
+		{ "purge with an invalid time", runPurge, []string{ "-config", configPath, "-published-before", "last week" }, "invalid --published-before" },
+		{ "replay with an invalid --from", runReplay, []string{ "-config", configPath, "-from", "last week" }, "invalid --from" },
+		{ "replay with an invalid --to", runReplay, []string{ "-config", configPath, "-to", "last week" }, "invalid --to" },
+		{ "replay without sink", runReplay, []string{ "-config", configPath }, "no sink is configured : use --sink-uri and --queue" },
+		{ "replay without queue", runReplay, []string{ "-config", configPath, "-sink-uri", "amqp://localhost:1" }, "no sink is configured" },
+		{ "missing config file", runStatus, []string{ "-config", filepath.Join(t.TempDir( ), "missing.yaml") }, "error reading file" },
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.ErrorContains(t, testCase.run(testCase.args), testCase.expectedError)
+		})
+	}
+}
+
+func TestConnectAdminSources(t *testing.T) {
+	_, err := connectAdminSources(writeConfig(t, "sink:\n  uri: amqp://localhost:1\n"), "")
+	assert.EqualError(t, err, "no sources are configured")
+
+	_, err= connectAdminSources(writeConfig(t, "sources: {}\n"), "")
+	assert.EqualError(t, err, "no sources are configured")
+
+	// Only the picked source is connected to.
+	_, err= connectAdminSources(writeConfig(t, "sources:\n  postgres:\n    uri: postgresql://localhost:1/outboxer\n"), "redis")
+	assert.EqualError(t, err, "source redis is not configured")
+
+	_, err= connectAdminSources(writeConfig(t, "sources: [\n"), "")
+	assert.ErrorContains(t, err, "error unmarshalling config")
+}
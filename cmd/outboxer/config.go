@@ -0,0 +1,377 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Archisman-Mridha/outboxer"
+	"github.com/Archisman-Mridha/outboxer/claimcheck"
+	"github.com/Archisman-Mridha/outboxer/cloudevents"
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+	"github.com/Archisman-Mridha/outboxer/events"
+	_ "github.com/Archisman-Mridha/outboxer/proto/generated"
+	"github.com/Archisman-Mridha/outboxer/transforms"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+type (
+	Config struct {
+		Sources *Sources `yaml:"sources"`
+		Sink *Sink `yaml:"sink"` // Currently only RabbitMQ is supported.
+
+		// MaxAttempts is the number of attempts after which a message, which fails to be published, is
+		// dead lettered. Defaults to 0, meaning that messages are retried forever.
+		MaxAttempts int `yaml:"max_attempts"`
+		// Retention is how long the published messages are kept, so that they can be replayed.
+		// Defaults to 0, meaning that they're deleted as soon as the cleanup job runs.
+		Retention time.Duration `yaml:"retention"`
+		Cleanup *Cleanup `yaml:"cleanup"`
+
+		// BatchMode publishes and acknowledges each fetched batch of messages at once.
+		BatchMode bool `yaml:"batch_mode"`
+
+		// Workers is the number of concurrent publishers per source, each with its own AMQP channel.
+		Workers int `yaml:"workers"`
+		// KeyOrdering preserves the order of the messages sharing the same aggregate key.
+		KeyOrdering bool `yaml:"key_ordering"`
+		// MaxInFlight bounds the number of fetched but not yet acknowledged messages per source.
+		MaxInFlight int `yaml:"max_in_flight"`
+
+		// RateLimit bounds the rate at which messages are published to the sink.
+		RateLimit *RateLimit `yaml:"rate_limit"`
+		// CircuitBreaker pauses fetching messages while publishing to the sink keeps failing.
+		CircuitBreaker *CircuitBreaker `yaml:"circuit_breaker"`
+
+		// Transforms alter, route or drop the messages, in order, before they're published.
+		Transforms []Transform `yaml:"transforms"`
+		// SchemaRegistry attaches the id of their schema to the published messages.
+		SchemaRegistry *SchemaRegistry `yaml:"schema_registry"`
+		// Events validates the published messages against the protobuf types of their topics.
+		Events *Events `yaml:"events"`
+		// CloudEvents wraps the published messages in CloudEvents.
+		CloudEvents *CloudEvents `yaml:"cloud_events"`
+		// Encryption decrypts the messages encrypted by the producers, or publishes them as they are.
+		Encryption *Encryption `yaml:"encryption"`
+		// Compression compresses the large messages before they're published.
+		Compression *Compression `yaml:"compression"`
+		// ClaimCheck offloads the messages which are too large for the sink to a blob store.
+		ClaimCheck *ClaimCheck `yaml:"claim_check"`
+
+		// LeaderElection makes a single replica relay messages at a time, the others standing by.
+		LeaderElection *LeaderElection `yaml:"leader_election"`
+
+		Admin *Admin `yaml:"admin"`
+
+		Log *Log `yaml:"log"`
+
+		Startup *Startup `yaml:"startup"`
+	}
+
+	Sources struct {
+		Postgres *Postgres `yaml:"postgres"`
+		Redis *Redis `yaml:"redis"`
+	}
+
+	Postgres struct {
+		Uri string `yaml:"uri"`
+		BatchSize int `yaml:"batch_size"`
+
+		// Partitioning must be set when the outbox table is partitioned (see
+		// adapters/dbs/sql/partitioned_schema.sql).
+		Partitioning *Partitioning `yaml:"partitioning"`
+		// Sharding splits the outbox table between the replicas of outboxer.
+		Sharding *Sharding `yaml:"sharding"`
+	}
+
+	Partitioning struct {
+		// Interval covered by each partition : either 1h or 24h (default).
+		Interval time.Duration `yaml:"interval"`
+		// Premake is the number of upcoming partitions created ahead of time.
+		Premake int `yaml:"premake"`
+	}
+
+	Sharding struct {
+		// Shards is the number of buckets which messages are hashed into, by aggregate key. It must be
+		// the same for every replica. Defaults to 64.
+		Shards int `yaml:"shards"`
+		// ReplicaId identifies this replica. Defaults to a random id.
+		ReplicaId string `yaml:"replica_id"`
+		// HeartbeatTTL is the time after which the shards of a replica, which hasn't refreshed its
+		// heartbeat, are reassigned. Defaults to 30s.
+		HeartbeatTTL time.Duration `yaml:"heartbeat_ttl"`
+	}
+
+	Redis struct {
+		Uri string `yaml:"uri"`
+		Password string `yaml:"password"`
+		Db int `yaml:"db"`
+
+		BatchSize int `yaml:"batch_size"`
+	}
+
+	Sink struct {
+		Uri string `yaml:"uri"`
+		Queue string `yaml:"queue"`
+	}
+
+	RateLimit struct {
+		// MessagesPerSecond defaults to 0, meaning no limit.
+		MessagesPerSecond float64 `yaml:"messages_per_second"`
+		// BytesPerSecond (of message body) defaults to 0, meaning no limit.
+		BytesPerSecond float64 `yaml:"bytes_per_second"`
+	}
+
+	CircuitBreaker struct {
+		// FailureThreshold is the number of consecutive publish failures which open the circuit breaker.
+		// Defaults to 5.
+		FailureThreshold int `yaml:"failure_threshold"`
+		// OpenTimeout is how long fetching stays paused, before probe messages are fetched. Defaults to
+		// 30s.
+		OpenTimeout time.Duration `yaml:"open_timeout"`
+		// Probes is the number of probe messages which must be published to resume fetching. Defaults
+		// to 1.
+		Probes int `yaml:"probes"`
+	}
+
+	Transform struct {
+		// Type is either drop, route, map_headers or redact.
+		Type string `yaml:"type"`
+		// When restricts the transform to the messages matching the expression (see
+		// transforms.Expression), like topic == "user.registered".
+		When string `yaml:"when"`
+
+		// RoutingKey and Topic are the templates of the route transform, like user.${header.tenant}.
+		RoutingKey string `yaml:"routing_key"`
+		Topic string `yaml:"topic"`
+
+		// Set, Rename and Remove are the header mappings of the map_headers transform.
+		Set map[string]string `yaml:"set"`
+		Rename map[string]string `yaml:"rename"`
+		Remove []string `yaml:"remove"`
+
+		// Fields are the dotted paths of the fields of the redact transform, whose values are replaced
+		// by Replacement (defaults to [REDACTED]).
+		Fields []string `yaml:"fields"`
+		Replacement string `yaml:"replacement"`
+	}
+
+	SchemaRegistry struct {
+		// Path of the directory holding the schema registry. Defaults to ./proto/registry.
+		Path string `yaml:"path"`
+	}
+
+	Events struct {
+		// Types maps the topics to the full names of the protobuf messages of their payloads (like
+		// outboxer.events.v1.RegistrationStartedEvent). Only the messages compiled into outboxer (see
+		// proto/) are available.
+		Types map[string]string `yaml:"types"`
+		// RejectUnknownTypes rejects the messages whose topic isn't listed in Types.
+		RejectUnknownTypes bool `yaml:"reject_unknown_types"`
+		// Envelope wraps the valid messages in an outboxer.v1.EventEnvelope.
+		Envelope bool `yaml:"envelope"`
+	}
+
+	CloudEvents struct {
+		// Mode is the content mode of the events : either binary (attributes as AMQP application
+		// properties) or structured (the event encoded as JSON).
+		Mode string `yaml:"mode"`
+		// Source is the source attribute of the events. Defaults to /outboxer/<name of the source>.
+		Source string `yaml:"source"`
+		// DataContentType is the content type of the messages. Defaults to application/octet-stream.
+		DataContentType string `yaml:"data_content_type"`
+	}
+
+	Encryption struct {
+		// Mode is either passthrough (default), publishing the encrypted messages as they are, or
+		// decrypt.
+		Mode string `yaml:"mode"`
+		// KeyFile is the path of the key file (see encryption.LocalKeys), required to decrypt the
+		// messages.
+		KeyFile string `yaml:"key_file"`
+	}
+
+	Compression struct {
+		// Encoding is either gzip, zstd or snappy.
+		Encoding string `yaml:"encoding"`
+		// Threshold is the size (in bytes) from which messages are compressed. Defaults to 1024.
+		Threshold int `yaml:"threshold"`
+	}
+
+	ClaimCheck struct {
+		// Threshold is the size (in bytes) from which messages are offloaded. Defaults to 256 KiB.
+		Threshold int `yaml:"threshold"`
+		// Path is the directory of the blob store.
+		Path string `yaml:"path"`
+	}
+
+	LeaderElection struct {
+		// Backend holding the leader lock : either postgres (an advisory lock) or redis (a lease). It
+		// must be one of the configured sources.
+		Backend string `yaml:"backend"`
+		// Name of the lock, shared by the replicas. Defaults to outboxer.
+		Name string `yaml:"name"`
+
+		// Interval at which the leader renews the lock, and the standby replicas try to acquire it.
+		Interval time.Duration `yaml:"interval"`
+		// Lease after which the lock of a dead leader expires (only used by Redis). Defaults to 3
+		// intervals.
+		Lease time.Duration `yaml:"lease"`
+	}
+
+	// Admin configures the HTTP server exposing the /metrics, /healthz, /readyz, /livez and
+	// /leaderz endpoints.
+	Admin struct {
+		Address string `yaml:"address"`
+
+		// MaxMissedPolls is the number of poll intervals after which a pipeline, which hasn't completed
+		// a poll, makes /livez fail.
+		MaxMissedPolls int `yaml:"max_missed_polls"`
+		// StatsInterval is how often the backlog and locked messages metrics are refreshed. Defaults to
+		// 15 seconds.
+		StatsInterval time.Duration `yaml:"stats_interval"`
+	}
+
+	// Cleanup configures the job which periodically deletes the published messages older than the
+	// retention.
+	Cleanup struct {
+		Interval time.Duration `yaml:"interval"`
+		BatchSize int `yaml:"batch_size"`
+
+		// Archive moves the deleted messages to the outbox_history table (only supported by Postgres).
+		Archive bool `yaml:"archive"`
+	}
+
+	Log struct {
+		// Level is one of debug, info (default), warn or error.
+		Level string `yaml:"level"`
+		// Format is either json (default) or text.
+		Format string `yaml:"format"`
+	}
+
+	// Startup configures how long outboxer waits for its dependencies to be reachable, when it starts.
+	Startup struct {
+		// Timeout after which outboxer gives up and exits. Defaults to 0, meaning a single attempt.
+		Timeout time.Duration `yaml:"timeout"`
+
+		InitialBackoff time.Duration `yaml:"initial_backoff"`
+		MaxBackoff time.Duration `yaml:"max_backoff"`
+	}
+)
+
+func(s *Startup) retryOptions( ) utils.RetryOptions {
+	if s == nil {
+		return utils.RetryOptions{ }
+	}
+
+	return utils.RetryOptions{
+		Timeout: s.Timeout,
+		InitialBackoff: s.InitialBackoff,
+		MaxBackoff: s.MaxBackoff,
+	}
+}
+
+func(s *SchemaRegistry) path( ) string {
+	if s.Path == "" {
+		return DefaultSchemaRegistryPath
+	}
+	return s.Path
+}
+
+// validation returns the event validation configured by e.
+func(e *Events) validation( ) (*outboxer.EventValidation, error) {
+	registry := events.NewRegistry( )
+	for topic, messageName := range e.Types {
+		if err := registry.RegisterByName(topic, messageName); err != nil {
+			return nil, err
+		}
+	}
+
+	return &outboxer.EventValidation{
+		Registry: registry,
+		RejectUnknownTypes: e.RejectUnknownTypes,
+		Envelope: e.Envelope,
+	}, nil
+}
+
+// envelope returns the CloudEvents envelope configured by c.
+func(c *CloudEvents) envelope( ) *outboxer.CloudEventsEnvelope {
+	return &outboxer.CloudEventsEnvelope{
+		Mode: cloudevents.Mode(c.Mode),
+		Source: c.Source,
+		DataContentType: c.DataContentType,
+	}
+}
+
+// decryptionKeys returns the key provider decrypting the messages, or nil if they're published encrypted.
+func(e *Encryption) decryptionKeys( ) (encryption.KeyProvider, error) {
+	switch e.Mode {
+		case "", "passthrough":
+			return nil, nil
+
+		case "decrypt":
+			if e.KeyFile == "" {
+				return nil, errors.New("the key file is required to decrypt messages")
+			}
+			return encryption.LoadKeyFile(e.KeyFile)
+
+		default:
+			return nil, fmt.Errorf("unsupported encryption mode %q", e.Mode)
+	}
+}
+
+// compressor returns the compressor configured by c.
+func(c *Compression) compressor( ) (*compression.Compressor, error) {
+	return compression.NewCompressor(c.Encoding, c.Threshold)
+}
+
+// claimCheck returns the claim check configured by c.
+func(c *ClaimCheck) claimCheck( ) (*outboxer.ClaimCheck, error) {
+	if c.Path == "" {
+		return nil, errors.New("the path of the blob store of the claim check is required")
+	}
+
+	store, err := claimcheck.NewFileStore(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &outboxer.ClaimCheck{ Store: store, Threshold: c.Threshold }, nil
+}
+
+// newTransforms creates the configured transforms. The redact transforms decode the messages whose
+// topic is registered in the events registry (which can be nil) as protobuf messages.
+func newTransforms(configs []Transform, registry *events.Registry) ([]ports.Transform, error) {
+	var configured []ports.Transform
+	for i, config := range configs {
+		var transform ports.Transform
+		switch config.Type {
+			case "drop":
+				transform= transforms.Drop( )
+
+			case "route":
+				transform= &transforms.Route{ RoutingKey: config.RoutingKey, Topic: config.Topic }
+
+			case "map_headers":
+				transform= &transforms.MapHeaders{ Set: config.Set, Rename: config.Rename, Remove: config.Remove }
+
+			case "redact":
+				transform= &transforms.Redact{ Fields: config.Fields, Replacement: config.Replacement, Registry: registry }
+
+			default:
+				return nil, fmt.Errorf("unsupported type %q of transform %d", config.Type, i)
+		}
+
+		if config.When != "" {
+			when, err := transforms.Compile(config.When)
+			if err != nil {
+				return nil, fmt.Errorf("error creating transform %d: %w", i, err)
+			}
+			transform= transforms.When(when, transform)
+		}
+
+		configured= append(configured, transform)
+	}
+	return configured, nil
+}
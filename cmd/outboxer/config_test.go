@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	config, err := loadConfig(writeConfig(t, `
+sources:
+  redis:
+    uri: localhost:6379
+    db: 2
+sink:
+  uri: amqp://localhost:5672
+  queue: events
+retention: 168h
+encryption:
+  mode: passthrough
+transforms:
+  - type: drop
+    when: topic == "user.internal"
+`))
+	assert.NoError(t, err)
+	assert.Nil(t, config.Sources.Postgres)
+	assert.Equal(t, 2, config.Sources.Redis.Db)
+	assert.Equal(t, "events", config.Sink.Queue)
+	assert.Equal(t, 168 * time.Hour, config.Retention)
+	assert.Len(t, config.Transforms, 1)
+
+	// Unknown fields are ignored, but mistyped ones aren't.
+	_, err= loadConfig(writeConfig(t, "retention: forever\n"))
+	assert.ErrorContains(t, err, "error unmarshalling config")
+}
+
+func TestConfigValidation(t *testing.T) {
+	_, err := (&Encryption{ Mode: "decrypt" }).decryptionKeys( )
+	assert.EqualError(t, err, "the key file is required to decrypt messages")
+	_, err= (&Encryption{ Mode: "rot13" }).decryptionKeys( )
+	assert.EqualError(t, err, `unsupported encryption mode "rot13"`)
+	decryptionKeys, err := (&Encryption{ Mode: "passthrough" }).decryptionKeys( )
+	assert.NoError(t, err)
+	assert.Nil(t, decryptionKeys)
+
+	_, err= (&ClaimCheck{ }).claimCheck( )
+	assert.EqualError(t, err, "the path of the blob store of the claim check is required")
+
+	_, err= newTransforms([]Transform{ { Type: "drop" }, { Type: "uppercase" } }, nil)
+	assert.EqualError(t, err, `unsupported type "uppercase" of transform 1`)
+	_, err= newTransforms([]Transform{ { Type: "drop", When: "topic ==" } }, nil)
+	assert.ErrorContains(t, err, "error creating transform 0")
+
+	_, err= newLogger(&Log{ Level: "verbose" })
+	assert.Error(t, err)
+	_, err= newLogger(&Log{ Format: "xml" })
+	assert.EqualError(t, err, "unsupported log format xml")
+
+	_, err= newLeaderLock(&LeaderElection{ Backend: "postgres" }, nil, nil)
+	assert.EqualError(t, err, "leader election backend postgres is not a configured source")
+	_, err= newLeaderLock(&LeaderElection{ Backend: "redis" }, nil, nil)
+	assert.EqualError(t, err, "leader election backend redis is not a configured source")
+	_, err= newLeaderLock(&LeaderElection{ Backend: "etcd" }, nil, nil)
+	assert.EqualError(t, err, `unsupported leader election backend "etcd"`)
+}
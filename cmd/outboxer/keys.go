@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Archisman-Mridha/outboxer/encryption"
+)
+
+// runKeys lists the keys of the key file, or rotates them : a new key is added and made active, the
+// previous ones being kept so that the messages they encrypted remain readable.
+func runKeys(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		printKeysUsage( )
+		return errors.New("missing keys command")
+	}
+	subcommand := args[0]
+	if subcommand != "list" && subcommand != "rotate" {
+		printKeysUsage( )
+		return fmt.Errorf("unknown keys command %s", subcommand)
+	}
+
+	flags, configPath := newFlagSet("keys " + subcommand)
+	keyFilePath := flags.String("key-file", "", "path of the key file (defaults to encryption.key_file)")
+	flags.Parse(args[1:])
+
+	// The config file is optional.
+	if *keyFilePath == "" {
+		if _, err := os.Stat(*configPath); err == nil {
+			config, err := loadConfig(*configPath)
+			if err != nil {
+				return err
+			}
+			if config.Encryption != nil {
+				*keyFilePath= config.Encryption.KeyFile
+			}
+		}
+		if *keyFilePath == "" {
+			return errors.New("the key file is neither given with -key-file, nor configured")
+		}
+	}
+
+	if subcommand == "rotate" {
+		keyId, err := encryption.RotateKeyFile(*keyFilePath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added key %s to %s, which is now the active key\n", keyId, *keyFilePath)
+		return nil
+	}
+
+	keys, err := encryption.LoadKeyFile(*keyFilePath)
+	if err != nil {
+		return err
+	}
+	activeKeyId, _ := keys.ActiveKeyId(context.Background( ))
+	for _, keyId := range keys.KeyIds( ) {
+		if keyId == activeKeyId {
+			fmt.Println(keyId, "(active)")
+			continue
+		}
+		fmt.Println(keyId)
+	}
+	return nil
+}
+
+func printKeysUsage( ) {
+	fmt.Fprintln(os.Stderr, "Usage : outboxer keys [command] [flags]\n\nCommands :")
+
+	writer := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "  list\tList the keys of the key file")
+	fmt.Fprintln(writer, "  rotate\tAdd a new key to the key file, and make it the active key")
+	writer.Flush( )
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis"
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Archisman-Mridha/outboxer"
+	"github.com/Archisman-Mridha/outboxer/adapters/dbs"
+	"github.com/Archisman-Mridha/outboxer/adapters/metrics"
+	"github.com/Archisman-Mridha/outboxer/adapters/mqs"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/events"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+// shutdownTimeout is the time given to the in-flight messages to be published, after a shutdown
+// signal is received.
+const shutdownTimeout= 10 * time.Second
+
+func main( ) {
+	commandName, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		commandName, args= args[0], args[1:]
+	}
+
+	command, isFound := commands[commandName]
+	if !isFound {
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n\n", commandName)
+		printUsage( )
+		os.Exit(2)
+	}
+
+	if err := command.run(args); err != nil {
+		slog.Error("Exiting", "error", err)
+		os.Exit(1)
+	}
+}
+
+// runRelay is the default command. It relays messages until a shutdown signal is received.
+func runRelay(args []string) error {
+	flags, configPath := newFlagSet("run")
+	flags.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	logger, err := newLogger(config.Log)
+	if err != nil {
+		return fmt.Errorf("error creating logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	return run(config, logger)
+}
+
+// loadConfig reads the YAML config file at the given path.
+func loadConfig(path string) (*Config, error) {
+	configFileData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+
+	var config Config
+	if err= yaml.Unmarshal(configFileData, &config); err != nil {
+		return nil, fmt.Errorf("error unmarshalling config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// run starts relaying messages as per the given config, and blocks until a shutdown signal is
+// received.
+func run(config *Config, logger *slog.Logger) error {
+	retryOptions := config.Startup.retryOptions( )
+
+	mq, err := utils.ConnectWithRetries(context.Background( ), retryOptions, logger, func( ) (*mqs.RabbitMQAdapter, error) {
+		return mqs.NewRabbitMQAdapter(config.Sink.Uri, config.Sink.Queue, logger)
+	})
+	if err != nil {
+		return err
+	}
+	defer mq.Disconnect( )
+
+	options := []outboxer.Option{
+		outboxer.WithSink("rabbitmq", mq),
+		outboxer.WithLogger(logger),
+		outboxer.WithMaxAttempts(config.MaxAttempts),
+		outboxer.WithRetention(config.Retention),
+		outboxer.WithBatchMode(config.BatchMode),
+		outboxer.WithWorkers(config.Workers),
+		outboxer.WithKeyOrdering(config.KeyOrdering),
+		outboxer.WithMaxInFlight(config.MaxInFlight),
+	}
+	if config.RateLimit != nil {
+		options= append(options, outboxer.WithRateLimit(config.RateLimit.MessagesPerSecond, config.RateLimit.BytesPerSecond))
+	}
+	if config.CircuitBreaker != nil {
+		options= append(options, outboxer.WithCircuitBreaker(outboxer.CircuitBreakerOptions{
+			FailureThreshold: config.CircuitBreaker.FailureThreshold,
+			OpenTimeout: config.CircuitBreaker.OpenTimeout,
+			Probes: config.CircuitBreaker.Probes,
+		}))
+	}
+	if config.SchemaRegistry != nil {
+		schemaRegistry, err := schemas.Open(config.SchemaRegistry.path( ))
+		if err != nil {
+			return err
+		}
+		options= append(options, outboxer.WithSchemaRegistry(schemaRegistry))
+	}
+	var eventsRegistry *events.Registry
+	if config.Events != nil {
+		eventValidation, err := config.Events.validation( )
+		if err != nil {
+			return err
+		}
+		options= append(options, outboxer.WithEventValidation(*eventValidation))
+		eventsRegistry= eventValidation.Registry
+	}
+	if len(config.Transforms) > 0 {
+		transforms, err := newTransforms(config.Transforms, eventsRegistry)
+		if err != nil {
+			return err
+		}
+		options= append(options, outboxer.WithTransforms(transforms...))
+	}
+	if config.CloudEvents != nil {
+		options= append(options, outboxer.WithCloudEvents(*config.CloudEvents.envelope( )))
+	}
+	if config.Encryption != nil {
+		decryptionKeys, err := config.Encryption.decryptionKeys( )
+		if err != nil {
+			return err
+		}
+		if decryptionKeys != nil {
+			options= append(options, outboxer.WithDecryption(decryptionKeys))
+		}
+	}
+	if config.Compression != nil {
+		compressor, err := config.Compression.compressor( )
+		if err != nil {
+			return err
+		}
+		options= append(options, outboxer.WithCompression(*compressor))
+	}
+	if config.ClaimCheck != nil {
+		claimCheck, err := config.ClaimCheck.claimCheck( )
+		if err != nil {
+			return err
+		}
+		options= append(options, outboxer.WithClaimCheck(*claimCheck))
+	}
+	if config.Cleanup != nil {
+		options= append(options,
+			outboxer.WithCleanInterval(config.Cleanup.Interval),
+			outboxer.WithCleanBatchSize(config.Cleanup.BatchSize),
+			outboxer.WithArchive(config.Cleanup.Archive),
+		)
+	}
+
+	registry := prometheus.NewRegistry( )
+	if config.Admin != nil {
+		registry.MustRegister(collectors.NewGoCollector( ), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{ }))
+
+		metricsAdapter, err := metrics.NewPrometheusAdapter(registry)
+		if err != nil {
+			return fmt.Errorf("error registering metrics: %w", err)
+		}
+		options= append(options, outboxer.WithHooks(metricsAdapter.Hooks( )))
+
+		if config.Admin.MaxMissedPolls > 0 {
+			options= append(options, outboxer.WithMaxMissedPolls(config.Admin.MaxMissedPolls))
+		}
+		options= append(options, outboxer.WithStatsInterval(config.Admin.StatsInterval))
+	}
+
+	var (
+		postgresOutboxDB *dbs.PostgresAdapter
+		redisOutboxDB *dbs.RedisAdapter
+	)
+
+	if config.Sources.Postgres != nil {
+		outboxDB, err := utils.ConnectWithRetries(context.Background( ), retryOptions, logger, func( ) (*dbs.PostgresAdapter, error) {
+			return dbs.NewPostgresAdapter(config.Sources.Postgres.Uri, logger)
+		})
+		if err != nil {
+			return err
+		}
+		defer outboxDB.Disconnect( )
+
+		if partitioning := config.Sources.Postgres.Partitioning; partitioning != nil {
+			err := outboxDB.EnablePartitioning(dbs.PartitioningOptions{
+				Interval: partitioning.Interval,
+				Premake: partitioning.Premake,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if sharding := config.Sources.Postgres.Sharding; sharding != nil {
+			err := outboxDB.EnableSharding(dbs.ShardingOptions{
+				Shards: sharding.Shards,
+				ReplicaId: sharding.ReplicaId,
+				HeartbeatTTL: sharding.HeartbeatTTL,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		options= append(options, outboxer.WithSource("postgres", outboxDB, config.Sources.Postgres.BatchSize))
+		postgresOutboxDB= outboxDB
+	}
+
+	if config.Sources.Redis != nil {
+		outboxDB, err := utils.ConnectWithRetries(context.Background( ), retryOptions, logger, func( ) (*dbs.RedisAdapter, error) {
+			return dbs.NewRedisAdapter(&redis.Options{
+				Addr: config.Sources.Redis.Uri,
+				Password: config.Sources.Redis.Password,
+				DB: config.Sources.Redis.Db,
+			}, logger)
+		})
+		if err != nil {
+			return err
+		}
+		defer outboxDB.Disconnect( )
+
+		options= append(options, outboxer.WithSource("redis", outboxDB, config.Sources.Redis.BatchSize))
+		redisOutboxDB= outboxDB
+	}
+
+	if leaderElection := config.LeaderElection; leaderElection != nil {
+		lock, err := newLeaderLock(leaderElection, postgresOutboxDB, redisOutboxDB)
+		if err != nil {
+			return err
+		}
+		options= append(options, outboxer.WithLeaderElection(lock, leaderElection.Interval))
+	}
+
+	dispatcher, err := outboxer.New(options...)
+	if err != nil {
+		return fmt.Errorf("error creating dispatcher: %w", err)
+	}
+	if err := dispatcher.Start(context.Background( )); err != nil {
+		return fmt.Errorf("error starting dispatcher: %w", err)
+	}
+
+	var admin *adminServer
+	if config.Admin != nil {
+		admin= newAdminServer(config.Admin.Address, registry, dispatcher, logger)
+		admin.start( )
+	}
+
+	// Listen for system interruption signals to gracefully shut down
+	shutdownSignalChan := make(chan os.Signal, 1)
+	signal.Notify(shutdownSignalChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(shutdownSignalChan)
+
+	shutdownSignal := <- shutdownSignalChan
+	logger.Info("Received program shutdown signal", "signal", shutdownSignal.String( ))
+
+	shutdownContext, cancel := context.WithTimeout(context.Background( ), shutdownTimeout)
+	defer cancel( )
+
+	if err := dispatcher.Shutdown(shutdownContext); err != nil {
+		logger.Error("Error shutting down dispatcher", "error", err)
+	}
+	if admin != nil {
+		admin.shutdown(shutdownContext)
+	}
+
+	return nil
+}
+
+// newLeaderLock creates the leader lock on top of the source chosen as the backend.
+func newLeaderLock(config *LeaderElection, postgresOutboxDB *dbs.PostgresAdapter, redisOutboxDB *dbs.RedisAdapter) (ports.LeaderLock, error) {
+	name := config.Name
+	if name == "" {
+		name= "outboxer"
+	}
+
+	switch config.Backend {
+		case "postgres":
+			if postgresOutboxDB == nil {
+				return nil, errors.New("leader election backend postgres is not a configured source")
+			}
+			return postgresOutboxDB.LeaderLock(name), nil
+
+		case "redis":
+			if redisOutboxDB == nil {
+				return nil, errors.New("leader election backend redis is not a configured source")
+			}
+
+			lease := config.Lease
+			if lease == 0 {
+				interval := config.Interval
+				if interval == 0 {
+					interval= outboxer.DefaultLeaderElectionInterval
+				}
+				lease= 3 * interval
+			}
+			return redisOutboxDB.LeaderLock(name, lease), nil
+
+		default:
+			return nil, fmt.Errorf("unsupported leader election backend %q", config.Backend)
+	}
+}
+
+// newLogger creates a logger writing to stdout, in JSON (default) or text format.
+func newLogger(config *Log) (*slog.Logger, error) {
+	handlerOptions := &slog.HandlerOptions{ Level: slog.LevelInfo }
+	if config == nil {
+		return slog.New(slog.NewJSONHandler(os.Stdout, handlerOptions)), nil
+	}
+
+	if config.Level != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return nil, err
+		}
+		handlerOptions.Level= level
+	}
+
+	switch config.Format {
+		case "", "json":
+			return slog.New(slog.NewJSONHandler(os.Stdout, handlerOptions)), nil
+
+		case "text":
+			return slog.New(slog.NewTextHandler(os.Stdout, handlerOptions)), nil
+
+		default:
+			return nil, fmt.Errorf("unsupported log format %s", config.Format)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Archisman-Mridha/outboxer/schemas"
+)
+
+// DefaultSchemaRegistryPath is the directory of the schema registry, unless configured.
+const DefaultSchemaRegistryPath= "./proto/registry"
+
+type (
+	// schemaCommand is a subcommand of the schema command.
+	schemaCommand struct {
+		description string
+		// register registers the compatible schemas which changed, after checking them.
+		register bool
+	}
+
+	// localSchema is a schema found in the proto or JSON schema directory.
+	localSchema struct {
+		subject string
+		format schemas.Format
+		content []byte
+	}
+)
+
+var schemaCommands= map[string]schemaCommand{
+	"check": { "Check that the local schemas are compatible with the registered ones", false },
+	"register": { "Check the local schemas, and register the compatible ones which changed", true },
+}
+
+// runSchema checks the compatibility of the schemas of the messages (the protobuf messages declared
+// in proto/*.proto, and optionally JSON schemas), against the versions stored in the schema
+// registry.
+func runSchema(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		printSchemaUsage( )
+		return errors.New("missing schema command")
+	}
+	subcommand, isFound := schemaCommands[args[0]]
+	if !isFound {
+		printSchemaUsage( )
+		return fmt.Errorf("unknown schema command %s", args[0])
+	}
+
+	flags, configPath := newFlagSet("schema " + args[0])
+	registryPath := flags.String("registry", "", "directory of the schema registry (defaults to schema_registry.path, or "+ DefaultSchemaRegistryPath +")")
+	protoPath := flags.String("proto", "./proto", "directory of the .proto files, whose top-level messages are the subjects")
+	jsonPath := flags.String("json", "", "optional directory of JSON schemas, each <subject>.json file being the schema of a subject")
+	flags.Parse(args[1:])
+
+	// The config file is optional.
+	if *registryPath == "" {
+		*registryPath= DefaultSchemaRegistryPath
+		if _, err := os.Stat(*configPath); err == nil {
+			config, err := loadConfig(*configPath)
+			if err != nil {
+				return err
+			}
+			if config.SchemaRegistry != nil && config.SchemaRegistry.Path != "" {
+				*registryPath= config.SchemaRegistry.Path
+			}
+		}
+	}
+
+	registry, err := schemas.Open(*registryPath)
+	if err != nil {
+		return err
+	}
+
+	localSchemas, err := loadProtobufSchemas(*protoPath)
+	if err != nil {
+		return err
+	}
+	if *jsonPath != "" {
+		jsonSchemas, err := loadJSONSchemas(*jsonPath)
+		if err != nil {
+			return err
+		}
+		localSchemas= append(localSchemas, jsonSchemas...)
+	}
+
+	var (
+		writer= tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		incompatibleSubjects int
+		details []string
+	)
+	fmt.Fprintln(writer, "SUBJECT\tFORMAT\tCOMPATIBILITY\tVERSION\tSTATUS")
+	for _, localSchema := range localSchemas {
+		version, status := "-", "new"
+
+		latest, isRegistered := registry.Latest(localSchema.subject)
+		if isRegistered {
+			version= fmt.Sprint(latest.Version)
+
+			fingerprint, err := schemas.Fingerprint(localSchema.format, localSchema.content)
+			if err != nil {
+				return err
+			}
+			status= "changed"
+			if latest.Format == localSchema.format && latest.Fingerprint == fingerprint {
+				status= "unchanged"
+			}
+		}
+
+		if status != "unchanged" {
+			incompatibilities, err := registry.Check(localSchema.subject, localSchema.format, localSchema.content)
+			if err != nil {
+				return fmt.Errorf("error checking %s: %w", localSchema.subject, err)
+			}
+
+			if len(incompatibilities) > 0 {
+				status= "incompatible"
+				incompatibleSubjects++
+				for _, incompatibility := range incompatibilities {
+					details= append(details, fmt.Sprintf("%s: %s", localSchema.subject, incompatibility))
+				}
+			} else if subcommand.register {
+				schema, err := registry.Register(localSchema.subject, localSchema.format, localSchema.content)
+				if err != nil {
+					return fmt.Errorf("error registering %s: %w", localSchema.subject, err)
+				}
+				version, status= fmt.Sprint(schema.Version), fmt.Sprintf("registered (id %d)", schema.Id)
+			}
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+			localSchema.subject, localSchema.format, registry.Compatibility(localSchema.subject), version, status,
+		)
+	}
+	if err := writer.Flush( ); err != nil {
+		return err
+	}
+
+	if incompatibleSubjects > 0 {
+		fmt.Println( )
+		for _, detail := range details {
+			fmt.Println(detail)
+		}
+		return fmt.Errorf("%d incompatible schemas", incompatibleSubjects)
+	}
+	return nil
+}
+
+func printSchemaUsage( ) {
+	fmt.Fprintln(os.Stderr, "Usage : outboxer schema [command] [flags]\n\nCommands :")
+
+	names := make([]string, 0, len(schemaCommands))
+	for name := range schemaCommands {
+		names= append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(writer, "  %s\t%s\n", name, schemaCommands[name].description)
+	}
+	writer.Flush( )
+}
+
+// loadProtobufSchemas compiles the .proto files of the directory, and returns the schemas of their
+// top-level messages.
+func loadProtobufSchemas(dir string) ([]*localSchema, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.proto"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .proto file found in %s", dir)
+	}
+
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		files= append(files, filepath.Base(path))
+	}
+
+	fileDescriptors, err := schemas.CompileProtoFiles(context.Background( ), dir, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	var localSchemas []*localSchema
+	for _, fileDescriptor := range fileDescriptors {
+		messages := fileDescriptor.Messages( )
+		for i := 0; i < messages.Len( ); i++ {
+			content, err := schemas.ProtobufSchema(messages.Get(i))
+			if err != nil {
+				return nil, err
+			}
+
+			localSchemas= append(localSchemas, &localSchema{
+				subject: string(messages.Get(i).FullName( )),
+				format: schemas.FormatProtobuf,
+				content: content,
+			})
+		}
+	}
+	return localSchemas, nil
+}
+
+// loadJSONSchemas returns the JSON schemas of the directory, named after their subject.
+func loadJSONSchemas(dir string) ([]*localSchema, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	localSchemas := make([]*localSchema, 0, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		localSchemas= append(localSchemas, &localSchema{
+			subject: strings.TrimSuffix(filepath.Base(path), ".json"),
+			format: schemas.FormatJSON,
+			content: content,
+		})
+	}
+	return localSchemas, nil
+}
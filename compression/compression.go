@@ -0,0 +1,165 @@
+// Package compression compresses the outbox messages, either when they're enqueued (see the
+// producer package) or when they're published by the relay. The encoding of a compressed message is
+// sent along with it (as the AMQP content encoding), so that consumers can decode it with Decode.
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip= "gzip"
+	EncodingZstd= "zstd"
+	EncodingSnappy= "snappy"
+	// EncodingIdentity is the encoding of uncompressed messages, like the empty encoding.
+	EncodingIdentity= "identity"
+
+	// DefaultThreshold is the size (in bytes) below which messages aren't compressed, unless
+	// configured otherwise : compressing small messages isn't worth it.
+	DefaultThreshold= 1024
+)
+
+var ErrUnsupportedEncoding= errors.New("compression: unsupported encoding")
+
+var (
+	// The zstd encoder and decoder are expensive to create, and safe for concurrent use when used
+	// with EncodeAll and DecodeAll.
+	zstdEncoder, zstdDecoder= newZstd( )
+)
+
+func newZstd( ) (*zstd.Encoder, *zstd.Decoder) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+	return encoder, decoder
+}
+
+var gzipWriters= sync.Pool{
+	New: func( ) interface{ } { return gzip.NewWriter(nil) },
+}
+
+// Compressor compresses the messages larger than its threshold.
+type Compressor struct {
+	// Encoding is either EncodingGzip, EncodingZstd or EncodingSnappy.
+	Encoding string
+	// Threshold is the size (in bytes) from which messages are compressed. Defaults to
+	// DefaultThreshold when 0 : set it to 1 to compress all the messages.
+	Threshold int
+}
+
+// NewCompressor returns a compressor using the given encoding, if supported.
+func NewCompressor(encoding string, threshold int) (*Compressor, error) {
+	switch encoding {
+		case EncodingGzip, EncodingZstd, EncodingSnappy:
+			return &Compressor{ Encoding: encoding, Threshold: threshold }, nil
+
+		default:
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Compress compresses the data, and returns it along with its encoding. The data is returned as is,
+// with an empty encoding, if it's smaller than the threshold, or if compressing it doesn't make it
+// smaller.
+func(c *Compressor) Compress(data []byte) ([]byte, string, error) {
+	threshold := c.Threshold
+	if threshold <= 0 {
+		threshold= DefaultThreshold
+	}
+	if len(data) < threshold {
+		return data, "", nil
+	}
+
+	compressed, err := Encode(c.Encoding, data)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(compressed) >= len(data) {
+		return data, "", nil
+	}
+	return compressed, c.Encoding, nil
+}
+
+// Encode compresses the data with the given encoding.
+func Encode(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+		case EncodingGzip:
+			var buffer bytes.Buffer
+
+			writer := gzipWriters.Get( ).(*gzip.Writer)
+			defer gzipWriters.Put(writer)
+
+			writer.Reset(&buffer)
+			if _, err := writer.Write(data); err != nil {
+				return nil, err
+			}
+			if err := writer.Close( ); err != nil {
+				return nil, err
+			}
+			return buffer.Bytes( ), nil
+
+		case EncodingZstd:
+			return zstdEncoder.EncodeAll(data, nil), nil
+
+		case EncodingSnappy:
+			return snappy.Encode(nil, data), nil
+
+		case "", EncodingIdentity:
+			return data, nil
+
+		default:
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Decode decompresses the data, given its encoding (typically the content encoding of the AMQP
+// message). Uncompressed data (with an empty or identity encoding) is returned as is.
+func Decode(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+		case EncodingGzip:
+			reader, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("compression: invalid gzip data: %w", err)
+			}
+			defer reader.Close( )
+
+			decompressed, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, fmt.Errorf("compression: invalid gzip data: %w", err)
+			}
+			return decompressed, nil
+
+		case EncodingZstd:
+			decompressed, err := zstdDecoder.DecodeAll(data, nil)
+			if err != nil {
+				return nil, fmt.Errorf("compression: invalid zstd data: %w", err)
+			}
+			return decompressed, nil
+
+		case EncodingSnappy:
+			decompressed, err := snappy.Decode(nil, data)
+			if err != nil {
+				return nil, fmt.Errorf("compression: invalid snappy data: %w", err)
+			}
+			return decompressed, nil
+
+		case "", EncodingIdentity:
+			return data, nil
+
+		default:
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+}
@@ -0,0 +1,49 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+	message := bytes.Repeat([]byte(`{"email":"archi@example.com","username":"archi"}`), 100)
+
+	for _, encoding := range []string{ EncodingGzip, EncodingZstd, EncodingSnappy } {
+		compressor, err := NewCompressor(encoding, 0)
+		assert.NoError(t, err)
+
+		compressed, contentEncoding, err := compressor.Compress(message)
+		assert.NoError(t, err)
+		assert.Equal(t, encoding, contentEncoding)
+		assert.Less(t, len(compressed), len(message))
+
+		decompressed, err := Decode(contentEncoding, compressed)
+		assert.NoError(t, err, encoding)
+		assert.Equal(t, message, decompressed, encoding)
+
+		_, err= Decode(encoding, []byte("not compressed"))
+		assert.Error(t, err, encoding)
+	}
+
+	// Messages smaller than the threshold aren't compressed.
+	compressed, contentEncoding, err := (&Compressor{ Encoding: EncodingZstd, Threshold: 10 * len(message) }).Compress(message)
+	assert.NoError(t, err)
+	assert.Equal(t, "", contentEncoding)
+	assert.Equal(t, message, compressed)
+
+	// Neither are the ones which compressing doesn't make smaller.
+	_, contentEncoding, err= (&Compressor{ Encoding: EncodingGzip, Threshold: 1 }).Compress([]byte("x"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", contentEncoding)
+
+	decompressed, err := Decode("", message)
+	assert.NoError(t, err)
+	assert.Equal(t, message, decompressed)
+
+	_, err= NewCompressor("brotli", 0)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+	_, err= Decode("brotli", message)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
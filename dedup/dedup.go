@@ -0,0 +1,86 @@
+// Package dedup helps consumers process each message relayed by outboxer once, even though the relay
+// delivers them at least once. Messages are deduplicated by their message id (the AMQP message id,
+// see the producer package), which is recorded in a Store for a while once processed.
+package dedup
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+type (
+	// Store records the ids of the processed messages.
+	Store interface {
+		// MarkProcessed records the message id for the given TTL. It returns false if the message id
+		// was already recorded, and hasn't expired yet.
+		MarkProcessed(ctx context.Context, messageId string, ttl time.Duration) (bool, error)
+
+		// Forget removes the message id, so that the message gets processed again when redelivered.
+		Forget(ctx context.Context, messageId string) error
+	}
+
+	// Deduplicator invokes message handlers, skipping the messages which have already been processed.
+	Deduplicator struct {
+		store Store
+		ttl time.Duration
+	}
+)
+
+// DefaultTTL is how long processed message ids are remembered by default. It must exceed the time
+// within which duplicates can be delivered (redeliveries, replays).
+const DefaultTTL= 7 * 24 * time.Hour
+
+// New creates a Deduplicator, remembering the processed message ids for the given TTL (DefaultTTL if
+// 0).
+func New(store Store, ttl time.Duration) *Deduplicator {
+	if ttl <= 0 {
+		ttl= DefaultTTL
+	}
+	return &Deduplicator{ store: store, ttl: ttl }
+}
+
+// Process invokes handler, unless the message with the given id has already been processed, in
+// which case it returns true. If handler fails, the message id is forgotten so that the message is
+// processed when redelivered. Messages without an id are always processed.
+//
+// A duplicate delivered while the original is still being processed is skipped too. Should the
+// original then fail, the message would only be processed again on its next redelivery.
+func(d *Deduplicator) Process(ctx context.Context, messageId string, handler func(ctx context.Context) error) (bool, error) {
+	if messageId == "" {
+		return false, handler(ctx)
+	}
+
+	isNew, err := d.store.MarkProcessed(ctx, messageId, d.ttl)
+	if err != nil {
+		return false, err
+	}
+	if !isNew {
+		return true, nil
+	}
+
+	if err := handler(ctx); err != nil {
+		if forgetErr := d.store.Forget(ctx, messageId); forgetErr != nil {
+			return false, errors.Join(err, forgetErr)
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// ProcessDelivery processes an AMQP delivery (see Process), deduplicating it by its message id. The
+// delivery is acknowledged once processed or found to be a duplicate, and requeued otherwise.
+func(d *Deduplicator) ProcessDelivery(ctx context.Context, delivery amqp.Delivery, handler func(ctx context.Context, delivery amqp.Delivery) error) error {
+	_, err := d.Process(ctx, delivery.MessageId, func(ctx context.Context) error {
+		return handler(ctx, delivery)
+	})
+	if err != nil {
+		if nackErr := delivery.Nack(false, true); nackErr != nil {
+			return errors.Join(err, nackErr)
+		}
+		return err
+	}
+	return delivery.Ack(false)
+}
@@ -0,0 +1,73 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// inMemoryStore is a Store whose message ids never expire.
+type inMemoryStore struct {
+	mutex sync.Mutex
+	messageIds map[string]bool
+}
+
+func(i *inMemoryStore) MarkProcessed(ctx context.Context, messageId string, ttl time.Duration) (bool, error) {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	if i.messageIds[messageId] {
+		return false, nil
+	}
+	i.messageIds[messageId]= true
+	return true, nil
+}
+
+func(i *inMemoryStore) Forget(ctx context.Context, messageId string) error {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	delete(i.messageIds, messageId)
+	return nil
+}
+
+func TestProcess(t *testing.T) {
+	var (
+		deduplicator= New(&inMemoryStore{ messageIds: map[string]bool{ } }, time.Hour)
+
+		processed []string
+		errHandler= errors.New("handler failed")
+	)
+	process := func(messageId string, err error) (bool, error) {
+		return deduplicator.Process(context.Background( ), messageId, func(ctx context.Context) error {
+			processed= append(processed, messageId)
+			return err
+		})
+	}
+
+	isDuplicate, err := process("a", nil)
+	assert.False(t, isDuplicate)
+	assert.NoError(t, err)
+
+	// A redelivered message is skipped.
+	isDuplicate, err= process("a", nil)
+	assert.True(t, isDuplicate)
+	assert.NoError(t, err)
+
+	// A message whose processing failed is processed again when redelivered.
+	_, err= process("b", errHandler)
+	assert.ErrorIs(t, err, errHandler)
+	isDuplicate, err= process("b", nil)
+	assert.False(t, isDuplicate)
+	assert.NoError(t, err)
+
+	// Messages without an id can't be deduplicated.
+	process("", nil)
+	process("", nil)
+
+	assert.Equal(t, []string{ "a", "b", "b", "", "" }, processed)
+}
@@ -0,0 +1,55 @@
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type (
+	// DBTX is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+	DBTX interface {
+		ExecContext(ctx context.Context, query string, args ...interface{ }) (sql.Result, error)
+	}
+
+	// PostgresStore records the processed message ids in the processed_messages table (see
+	// schema.sql). Create it on top of the transaction of the handler, and call MarkProcessed
+	// directly, to record the message id atomically with the changes made by the handler.
+	PostgresStore struct {
+		connection DBTX
+	}
+)
+
+func NewPostgresStore(connection DBTX) *PostgresStore {
+	return &PostgresStore{ connection: connection }
+}
+
+func(p *PostgresStore) MarkProcessed(ctx context.Context, messageId string, ttl time.Duration) (bool, error) {
+	result, err := p.connection.ExecContext(ctx, `
+		INSERT INTO processed_messages (message_id, expires_on)
+			VALUES ($1, CURRENT_TIMESTAMP + make_interval(secs => $2))
+				ON CONFLICT (message_id) DO UPDATE SET expires_on=EXCLUDED.expires_on
+					WHERE processed_messages.expires_on < CURRENT_TIMESTAMP
+	`, messageId, ttl.Seconds( ))
+	if err != nil {
+		return false, err
+	}
+
+	insertedRows, err := result.RowsAffected( )
+	return insertedRows == 1, err
+}
+
+func(p *PostgresStore) Forget(ctx context.Context, messageId string) error {
+	_, err := p.connection.ExecContext(ctx, "DELETE FROM processed_messages WHERE message_id = $1", messageId)
+	return err
+}
+
+// DeleteExpired deletes the expired message ids, and returns how many of them were deleted. Run it
+// periodically, to keep the table small.
+func(p *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := p.connection.ExecContext(ctx, "DELETE FROM processed_messages WHERE expires_on < CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected( )
+}
@@ -0,0 +1,34 @@
+package dedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// defaultKeyPrefix is prepended to the message ids, to build the Redis keys.
+const defaultKeyPrefix= "outboxer:processed:"
+
+// RedisStore records each processed message id as a Redis key, which expires along with the TTL.
+type RedisStore struct {
+	client redis.Cmdable
+	keyPrefix string
+}
+
+// NewRedisStore creates a RedisStore whose keys are prefixed with keyPrefix (defaultKeyPrefix if
+// empty).
+func NewRedisStore(client redis.Cmdable, keyPrefix string) *RedisStore {
+	if keyPrefix == "" {
+		keyPrefix= defaultKeyPrefix
+	}
+	return &RedisStore{ client: client, keyPrefix: keyPrefix }
+}
+
+func(r *RedisStore) MarkProcessed(ctx context.Context, messageId string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(r.keyPrefix + messageId, 1, ttl).Result( )
+}
+
+func(r *RedisStore) Forget(ctx context.Context, messageId string) error {
+	return r.client.Del(r.keyPrefix + messageId).Err( )
+}
@@ -0,0 +1,7 @@
+-- Ids of the messages processed by a consumer (see PostgresStore).
+CREATE TABLE processed_messages (
+  message_id TEXT PRIMARY KEY,
+  expires_on TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX processed_messages_expires_on_idx ON processed_messages (expires_on);
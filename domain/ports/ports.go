@@ -1,5 +1,11 @@
 package ports
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
 type (
 	OutboxDB interface {
 		// connect establishes a connection with the outbox DB.
@@ -8,6 +14,9 @@ type (
 		// Disconnect closes connection to the outbox DB.
 		Disconnect( )
 
+		// Ping checks whether the connection to the outbox DB is alive.
+		Ping( ) error
+
 		// GetMessages queries the outbox database. This query searches for a batch of messages which are
 		// unlocked and not yet published to the message queue. It then extracts the event payload from
 		// each of those queried items. The event payloads are then sent inside the channel
@@ -15,36 +24,274 @@ type (
 		GetMessages(args *GetMessagesArgs)
 
 		// UnlockMessagesAndUpdatePublishStatus takes PublishResultsChan as an input. Transaction lock
-		// is removed and the publish status is updated for each message.
+		// is removed and the publish status is updated for each message. If AcknowledgementsChan is
+		// not nil, an Acknowledgement is sent to it after each message is processed.
 		UnlockMessagesAndUpdatePublishStatus(args *UnlockMessagesAndUpdatePublishStatusArgs)
 	
-		// Clean cleans the database by deleting all the rows whichy correspond to those messages, which
-		// have been published to the message queue.
-		Clean( )
+		// Clean cleans the database by deleting the rows which correspond to those messages, which have
+		// been published to the message queue more than args.Retention ago. Rows are deleted in batches
+		// of args.BatchSize, so that the outbox DB isn't locked for long. It returns the number of
+		// deleted rows.
+		Clean(args *CleanArgs) (int64, error)
+
+		// GetStats returns the number of messages which are yet to be published and the number of
+		// messages which are currently locked by a relay.
+		GetStats( ) (*OutboxStats, error)
 	}
 
 	MQ interface {
 		// Disconnect cleans up connection with the message queue.
 		Disconnect( )
 
+		// Ping checks whether the connection to the message queue is alive.
+		Ping( ) error
+
 		// PublishMessages waits for messages in the toBePublishedItemsChan. It gets those messages and
 		// publishes them to message queue.
 		PublishMessages(args *PublishMessagesArgs)
 	}
+
+	// BatchOutboxDB is implemented by the outbox DBs which can update the publish status of a whole
+	// batch of messages at once (see the batch mode of the dispatcher).
+	BatchOutboxDB interface {
+		// UpdatePublishStatusBatch does the same as UnlockMessagesAndUpdatePublishStatus, for the given
+		// publish results, using as few round trips as possible. It returns an Acknowledgement for each
+		// of them.
+		UpdatePublishStatusBatch(args *UpdatePublishStatusBatchArgs) []*Acknowledgement
+	}
+
+	// BatchMQ is implemented by the message queues which can publish a whole batch of messages at
+	// once (see the batch mode of the dispatcher).
+	BatchMQ interface {
+		// PublishBatch publishes the given messages, waiting for the message queue to confirm them all.
+		// It returns a PublishResult for each of them.
+		PublishBatch(items []*ToBePublishedItem) []*PublishResult
+	}
+
+	// WorkerMQ is implemented by the message queues which need a separate resource (like an AMQP
+	// channel) for each concurrent publisher. The message queues which don't implement it are shared
+	// by the publisher workers, and must be safe for concurrent use.
+	WorkerMQ interface {
+		// NewWorker returns a message queue publishing through its own resource, on top of the same
+		// connection. Disconnecting it only releases that resource.
+		NewWorker( ) (MQ, error)
+	}
+
+	// OutboxAdmin is implemented by the outbox DBs which can be inspected and repaired by an operator
+	// (see the outboxer CLI).
+	OutboxAdmin interface {
+		// GetStatus returns a detailed snapshot of the state of the outbox DB.
+		GetStatus( ) (*OutboxStatus, error)
+
+		// ListMessages returns at most limit messages in the given state, oldest first.
+		ListMessages(state MessageState, limit int) ([]*OutboxMessage, error)
+
+		// UnlockMessage releases the lock held on a message (for example by a relay which crashed), so
+		// that it gets fetched again. It returns false if the message wasn't locked.
+		UnlockMessage(rowId string) (bool, error)
+
+		// RequeueDeadLetteredMessages makes the dead lettered messages eligible for publishing again,
+		// with their attempts reset. It returns the number of requeued messages.
+		RequeueDeadLetteredMessages( ) (int64, error)
+
+		// PurgePublishedMessages deletes the messages which were published before the given time. It
+		// returns the number of deleted messages.
+		PurgePublishedMessages(publishedBefore time.Time) (int64, error)
+
+		// CancelScheduledMessage deletes a message which is scheduled for a later delivery, before it
+		// gets published. It returns false if no such message is scheduled.
+		CancelScheduledMessage(rowId string) (bool, error)
+	}
+
+	// OutboxReplayer is implemented by the outbox DBs which can re-publish the messages they've
+	// already published (see the retention of published messages).
+	OutboxReplayer interface {
+		// GetMessagesForReplay sends the published messages matching args.Filter, oldest first, inside
+		// the channel args.ToBePublishedItemsChan. Their publish status is left untouched.
+		GetMessagesForReplay(args *GetMessagesForReplayArgs) error
+	}
+
+	// CloudEventsMQ is implemented by the message queues which have a CloudEvents protocol binding,
+	// and can thus carry CloudEvents in binary content mode.
+	CloudEventsMQ interface {
+		// CloudEventsHeaderPrefix returns the prefix of the headers carrying the CloudEvents
+		// attributes, like "cloudEvents:" for AMQP.
+		CloudEventsHeaderPrefix( ) string
+	}
+
+	// Transform alters the messages between the outbox DB and the message queue, or drops them (see
+	// the transforms package for the built-in ones).
+	Transform interface {
+		// Transform alters the item in place. It returns false if the message must be dropped : it's
+		// then marked as published, without being published. An error rejects the message : it's dead
+		// lettered.
+		Transform(item *ToBePublishedItem) (bool, error)
+	}
+
+	// LeaderLock is a lock shared by the replicas of the relay, which only one of them can hold at a
+	// time. The holder (the leader) is the only replica relaying messages.
+	LeaderLock interface {
+		// TryAcquire acquires the lock, or extends it if it's already held by this replica. It returns
+		// whether this replica holds the lock. It's invoked periodically, by the leader and the
+		// standby replicas alike.
+		TryAcquire( ) (bool, error)
+
+		// Release gives up the lock, if it's held by this replica, letting a standby replica take over
+		// right away.
+		Release( ) error
+	}
+)
+
+// MessageState is used to filter the messages listed by OutboxAdmin.ListMessages.
+type MessageState string
+
+const (
+	// MessageStateUnpublished matches the messages which are yet to be published, including the
+	// locked and failed ones.
+	MessageStateUnpublished MessageState= "unpublished"
+	// MessageStateLocked matches the messages which are currently being published by a relay.
+	MessageStateLocked MessageState= "locked"
+	// MessageStateFailed matches the messages which failed to be published at least once, and are
+	// waiting to be retried.
+	MessageStateFailed MessageState= "failed"
+	// MessageStateDeadLetter matches the messages which failed to be published for the maximum number
+	// of attempts.
+	MessageStateDeadLetter MessageState= "dead-letter"
+	// MessageStatePublished matches the messages which have been published but not cleaned yet.
+	MessageStatePublished MessageState= "published"
+	// MessageStateScheduled matches the messages which mustn't be published before their delivery
+	// time, which is yet to come.
+	MessageStateScheduled MessageState= "scheduled"
 )
 
+// ErrUnsupportedMessageState is returned by OutboxAdmin.ListMessages when the outbox DB can't list
+// the messages in the requested state.
+var ErrUnsupportedMessageState= errors.New("unsupported message state")
+
 type (
 	// ToBePublishedItem is a data structure which holds the message which needs to be published along
 	// with the id of the corresponding DB row.
 	ToBePublishedItem struct {
 		RowId string
+		// MessageId identifies the message stably, across retries and replays, unlike RowId. It's
+		// published as the AMQP message id in case of RabbitMQ, so that consumers can deduplicate
+		// messages.
+		MessageId string
 		Message []byte
+
+		// CreatedAt is the time at which the message was inserted in the outbox DB.
+		CreatedAt time.Time
+		// DeliverAfter is the time before which the message wasn't allowed to be published, if it was
+		// scheduled. It's the zero time otherwise.
+		DeliverAfter time.Time
+		// Attempt is the number of times the message has been fetched from the outbox DB, including
+		// this one.
+		Attempt int
+
+		// Topic optionally categorizes the message. It's published as the AMQP type in case of
+		// RabbitMQ.
+		Topic string
+		// Key optionally identifies the aggregate (entity) which the message is about. Messages sharing
+		// a key are published in order, when key ordering is enabled.
+		Key string
+
+		// Headers are published along with the message (as AMQP headers in case of RabbitMQ). They
+		// carry, for example, the W3C trace context of the message.
+		Headers map[string]string
+		// ContentType optionally describes the format of the message, like the content type of the
+		// CloudEvents envelope. It's published as the AMQP content type in case of RabbitMQ.
+		ContentType string
+		// ContentEncoding is the encoding of the message, when it's compressed (see the compression
+		// package). It's published as the AMQP content encoding in case of RabbitMQ.
+		ContentEncoding string
+		// RoutingKey optionally overrides the destination of the message. It's the routing key in case
+		// of RabbitMQ, which defaults to the name of the queue.
+		RoutingKey string
 	}
 	// PublishResult is a data structure which represents whether the message with self.RowId was
 	// successfully published or not.
 	PublishResult struct  {
 		RowId string
 		IsPublished bool
+		// IsRejected reports that the message wasn't even handed over to the message queue, since it's
+		// invalid. Retrying it is pointless : it's dead lettered right away.
+		IsRejected bool
+		// IsDropped reports that the message was deliberately not handed over to the message queue
+		// (see Transform). IsPublished is then true as well, so that it isn't fetched again.
+		IsDropped bool
+		// IsOffloadFailed reports that the message couldn't be offloaded to the blob store of the claim
+		// check, and so wasn't handed over to the message queue. It's retried.
+		IsOffloadFailed bool
+	}
+
+	// Acknowledgement reports whether the publish status of the message with self.RowId was
+	// successfully updated in the outbox DB.
+	Acknowledgement struct {
+		RowId string
+		Err error
+	}
+
+	// OutboxStats is a snapshot of the state of an outbox DB.
+	OutboxStats struct {
+		Backlog int64
+		Locked int64
+	}
+
+	// OutboxStatus is a detailed snapshot of the state of an outbox DB, as reported by the outboxer
+	// CLI.
+	OutboxStatus struct {
+		Backlog int64
+		Locked int64
+		Failed int64
+		DeadLettered int64
+		// Scheduled is the number of messages whose delivery time is yet to come. They aren't part of
+		// the backlog.
+		Scheduled int64
+
+		// OldestUnpublishedAt is the creation time (or the delivery time, if it's later) of the oldest
+		// message which is yet to be published. It's the zero time if there is none.
+		OldestUnpublishedAt time.Time
+	}
+
+	// OutboxMessage describes a message stored in an outbox DB, without its payload.
+	OutboxMessage struct {
+		RowId string
+		Size int
+
+		CreatedAt time.Time
+		Attempts int
+		// DeliverAfter is the time before which the message mustn't be published. It's the zero time
+		// if the message isn't scheduled.
+		DeliverAfter time.Time
+
+		Locked bool
+		LockedAt time.Time
+
+		Published bool
+		PublishedAt time.Time
+
+		DeadLettered bool
+	}
+
+	// ReplayFilter selects the published messages to be replayed. Zero values are ignored, and the
+	// bounds are inclusive.
+	ReplayFilter struct {
+		CreatedAfter time.Time
+		CreatedBefore time.Time
+
+		FromRowId string
+		ToRowId string
+
+		Topic string
+	}
+
+	GetMessagesForReplayArgs struct {
+		// Context stops the replay once it's cancelled.
+		Context context.Context
+
+		Filter *ReplayFilter
+		BatchSize int
+		ToBePublishedItemsChan chan *ToBePublishedItem
 	}
 
 	GetMessagesArgs struct {
@@ -54,6 +301,27 @@ type (
 
 	UnlockMessagesAndUpdatePublishStatusArgs struct {
 		PublishResultsChan chan *PublishResult
+		AcknowledgementsChan chan *Acknowledgement
+
+		// MaxAttempts is the number of attempts after which a message, which fails to be published, is
+		// dead lettered. 0 means that it's retried forever.
+		MaxAttempts int
+	}
+
+	CleanArgs struct {
+		Retention time.Duration
+		BatchSize int
+
+		// Archive moves the deleted rows to a history table, instead of dropping them. It's only
+		// supported by Postgres.
+		Archive bool
+	}
+
+	UpdatePublishStatusBatchArgs struct {
+		PublishResults []*PublishResult
+
+		// MaxAttempts has the same meaning as in UnlockMessagesAndUpdatePublishStatusArgs.
+		MaxAttempts int
 	}
 
 	PublishMessagesArgs struct {
@@ -0,0 +1,158 @@
+package usecases
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFailureThreshold= 5
+	DefaultOpenTimeout= 30 * time.Second
+	DefaultProbes= 1
+)
+
+const (
+	// CircuitBreakerClosed lets messages be fetched and published normally.
+	CircuitBreakerClosed CircuitBreakerState= "closed"
+	// CircuitBreakerOpen pauses fetching messages, after too many consecutive publish failures.
+	CircuitBreakerOpen CircuitBreakerState= "open"
+	// CircuitBreakerHalfOpen only lets a few probe messages be fetched, to find out whether the sink
+	// has recovered.
+	CircuitBreakerHalfOpen CircuitBreakerState= "half-open"
+)
+
+type (
+	CircuitBreakerState string
+
+	CircuitBreakerOptions struct {
+		// FailureThreshold is the number of consecutive publish failures which open the circuit breaker.
+		// Defaults to DefaultFailureThreshold.
+		FailureThreshold int
+		// OpenTimeout is how long the circuit breaker stays open, before half-opening. Defaults to
+		// DefaultOpenTimeout.
+		OpenTimeout time.Duration
+		// Probes is the number of messages fetched by each poll while the circuit breaker is half-open,
+		// and the number of consecutive successful publishes which close it. Defaults to DefaultProbes.
+		Probes int
+
+		// OnStateChange is invoked every time the circuit breaker changes state.
+		OnStateChange func(from, to CircuitBreakerState)
+	}
+
+	// CircuitBreaker stops fetching messages for a sink which keeps failing to publish them, so that
+	// they aren't locked and failed over and over again. It's shared by all the pipelines publishing
+	// to that sink.
+	CircuitBreaker struct {
+		options CircuitBreakerOptions
+
+		mutex sync.Mutex
+		state CircuitBreakerState
+		// consecutiveResults counts the consecutive failures while closed, and the consecutive
+		// successes while half-open.
+		consecutiveResults int
+		openedAt time.Time
+	}
+)
+
+func NewCircuitBreaker(options CircuitBreakerOptions) *CircuitBreaker {
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold= DefaultFailureThreshold
+	}
+	if options.OpenTimeout <= 0 {
+		options.OpenTimeout= DefaultOpenTimeout
+	}
+	if options.Probes <= 0 {
+		options.Probes= DefaultProbes
+	}
+
+	return &CircuitBreaker{
+		options: options,
+		state: CircuitBreakerClosed,
+	}
+}
+
+func(c *CircuitBreaker) State( ) CircuitBreakerState {
+	c.mutex.Lock( )
+	defer c.mutex.Unlock( )
+
+	return c.state
+}
+
+// Allow returns whether messages can be fetched, and how many of them : batchSize while closed, the
+// number of probes while half-open. Once the open timeout has elapsed, it half-opens the circuit
+// breaker.
+func(c *CircuitBreaker) Allow(batchSize int) (int, bool) {
+	c.mutex.Lock( )
+
+	from := c.state
+	if c.state == CircuitBreakerOpen && time.Since(c.openedAt) >= c.options.OpenTimeout {
+		c.transition(CircuitBreakerHalfOpen)
+	}
+	to := c.state
+
+	c.mutex.Unlock( )
+	c.notify(from, to)
+
+	switch to {
+		case CircuitBreakerClosed:
+			return batchSize, true
+
+		case CircuitBreakerHalfOpen:
+			return min(batchSize, c.options.Probes), true
+
+		default:
+			return 0, false
+	}
+}
+
+// Record records the result of publishing a message.
+func(c *CircuitBreaker) Record(isPublished bool) {
+	c.mutex.Lock( )
+
+	from := c.state
+	switch c.state {
+		case CircuitBreakerClosed:
+			if isPublished {
+				c.consecutiveResults= 0
+				break
+			}
+
+			c.consecutiveResults++
+			if c.consecutiveResults >= c.options.FailureThreshold {
+				c.transition(CircuitBreakerOpen)
+			}
+
+		case CircuitBreakerHalfOpen:
+			if !isPublished {
+				c.transition(CircuitBreakerOpen)
+				break
+			}
+
+			c.consecutiveResults++
+			if c.consecutiveResults >= c.options.Probes {
+				c.transition(CircuitBreakerClosed)
+			}
+
+		// The results of the messages fetched before the circuit breaker opened are ignored.
+		case CircuitBreakerOpen:
+	}
+	to := c.state
+
+	c.mutex.Unlock( )
+	c.notify(from, to)
+}
+
+// transition must be invoked with the mutex held.
+func(c *CircuitBreaker) transition(to CircuitBreakerState) {
+	c.state= to
+	c.consecutiveResults= 0
+	if to == CircuitBreakerOpen {
+		c.openedAt= time.Now( )
+	}
+}
+
+func(c *CircuitBreaker) notify(from, to CircuitBreakerState) {
+	if from != to && c.options.OnStateChange != nil {
+		c.options.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,57 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/Archisman-Mridha/outboxer/claimcheck"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// ClaimCheck offloads the messages larger than the threshold to the blob store, and replaces them
+// by a claimcheck.Reference.
+type ClaimCheck struct {
+	Store claimcheck.BlobStore
+	// Threshold is the size (in bytes) from which messages are offloaded. Defaults to
+	// claimcheck.DefaultThreshold.
+	Threshold int
+}
+
+// Offload stores the message of the item in the blob store, if it's too large, and replaces it by
+// its reference. The blobs are keyed by the creation date and the id of their message (or their
+// checksum), so that offloading the same message again overwrites its blob.
+func(c *ClaimCheck) Offload(ctx context.Context, item *ports.ToBePublishedItem) error {
+	threshold := c.Threshold
+	if threshold <= 0 {
+		threshold= claimcheck.DefaultThreshold
+	}
+	if len(item.Message) < threshold {
+		return nil
+	}
+
+	createdAt := item.CreatedAt
+	if createdAt.IsZero( ) {
+		createdAt= time.Now( )
+	}
+
+	reference := claimcheck.NewReference("", item.Message)
+	id := item.MessageId
+	if id == "" {
+		id= reference.SHA256
+	}
+	reference.Key= path.Join(createdAt.UTC( ).Format("2006/01/02"), id)
+	reference.ContentType, reference.ContentEncoding= item.ContentType, item.ContentEncoding
+
+	encodedReference, err := json.Marshal(reference)
+	if err != nil {
+		return err
+	}
+	if err := c.Store.Put(ctx, reference.Key, item.Message); err != nil {
+		return err
+	}
+
+	item.Message, item.ContentType, item.ContentEncoding= encodedReference, claimcheck.ContentType, ""
+	return nil
+}
@@ -0,0 +1,100 @@
+package usecases
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/Archisman-Mridha/outboxer/cloudevents"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+const (
+	// DefaultCloudEventsType is the type of the events wrapping the messages without a topic.
+	DefaultCloudEventsType= "outboxer.message"
+	// DefaultCloudEventsDataContentType is the content type of the messages, unless configured.
+	DefaultCloudEventsDataContentType= "application/octet-stream"
+
+	// traceparentHeader carries the W3C trace context of the message. It's also set as the
+	// traceparent extension attribute (see the distributed tracing extension of CloudEvents).
+	traceparentHeader= "traceparent"
+)
+
+// CloudEventsEnvelope wraps the published messages in CloudEvents, populated from the outbox
+// metadata : the message id becomes the id, the topic the type, the key the subject and the creation
+// time the time.
+type CloudEventsEnvelope struct {
+	// Mode is either cloudevents.ModeBinary, where the attributes are sent as headers along with the
+	// untouched message, or cloudevents.ModeStructured, where the message is replaced by the JSON
+	// encoded event.
+	Mode cloudevents.Mode
+
+	// Source is the source attribute of the events. Defaults to /outboxer/<name of the source>.
+	Source string
+	// DataContentType is the content type of the messages. Defaults to
+	// DefaultCloudEventsDataContentType.
+	DataContentType string
+
+	// HeaderPrefix is the prefix of the headers carrying the attributes in binary mode. It depends on
+	// the protocol binding of the sink (see ports.CloudEventsMQ).
+	HeaderPrefix string
+}
+
+// Wrap wraps the message of the item in a CloudEvent, in place. sourceName is the name of the outbox
+// DB which the message was fetched from, if known.
+func(e *CloudEventsEnvelope) Wrap(sourceName string, item *ports.ToBePublishedItem) error {
+	event := &cloudevents.Event{
+		Id: item.MessageId,
+		Source: e.Source,
+		SpecVersion: cloudevents.SpecVersion,
+		Type: item.Topic,
+
+		Subject: item.Key,
+		Time: item.CreatedAt,
+		DataContentType: e.DataContentType,
+
+		Data: item.Message,
+	}
+	if event.Id == "" {
+		event.Id= item.RowId
+	}
+	if event.Source == "" {
+		event.Source= path.Join("/outboxer", sourceName)
+	}
+	if event.Type == "" {
+		event.Type= DefaultCloudEventsType
+	}
+	if event.DataContentType == "" {
+		event.DataContentType= DefaultCloudEventsDataContentType
+	}
+	if traceparent, isFound := item.Headers[traceparentHeader]; isFound {
+		event.Extensions= map[string]string{ traceparentHeader: traceparent }
+	}
+
+	switch e.Mode {
+		case cloudevents.ModeBinary:
+			if err := event.Validate( ); err != nil {
+				return err
+			}
+
+			if item.Headers == nil {
+				item.Headers= map[string]string{ }
+			}
+			for name, value := range event.BinaryHeaders(e.HeaderPrefix) {
+				item.Headers[name]= value
+			}
+			item.ContentType= event.DataContentType
+
+		case cloudevents.ModeStructured:
+			encoded, err := event.MarshalStructured( )
+			if err != nil {
+				return err
+			}
+
+			item.Message= encoded
+			item.ContentType= cloudevents.StructuredContentType
+
+		default:
+			return fmt.Errorf("unknown CloudEvents content mode %q", e.Mode)
+	}
+	return nil
+}
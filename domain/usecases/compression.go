@@ -0,0 +1,42 @@
+package usecases
+
+import (
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// decompress decodes the message of the item, if it was compressed by the producer, so that the
+// steps inspecting or rewriting the message see the original one. It's compressed again by
+// compress, if the relay compresses messages.
+func decompress(item *ports.ToBePublishedItem) error {
+	if item.ContentEncoding == "" {
+		return nil
+	}
+
+	message, err := compression.Decode(item.ContentEncoding, item.Message)
+	if err != nil {
+		return err
+	}
+	item.Message, item.ContentEncoding= message, ""
+	return nil
+}
+
+// compress compresses the message of the item with the compressor, unless it's already compressed.
+func compress(compressor *compression.Compressor, item *ports.ToBePublishedItem) error {
+	if compressor == nil || item.ContentEncoding != "" {
+		return nil
+	}
+
+	message, contentEncoding, err := compressor.Compress(item.Message)
+	if err != nil {
+		return err
+	}
+	item.Message, item.ContentEncoding= message, contentEncoding
+	return nil
+}
+
+// inspectsMessages reports whether any of the steps inspect or rewrite the messages, which then
+// need to be decompressed beforehand.
+func inspectsMessages(transforms []ports.Transform, eventValidation *EventValidation, cloudEvents *CloudEventsEnvelope) bool {
+	return len(transforms) > 0 || eventValidation != nil || cloudEvents != nil
+}
@@ -0,0 +1,33 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+)
+
+// decrypt decrypts the message of the item, if it was encrypted by the producer, with the decryptor.
+// Without decryptor, encrypted messages are published as they are, the id of their key being set as
+// the encryption.KeyIdHeader header.
+func decrypt(ctx context.Context, decryptor *encryption.Encryptor, item *ports.ToBePublishedItem) error {
+	if !encryption.IsEncrypted(item.Message) {
+		return nil
+	}
+
+	if decryptor == nil {
+		keyId, err := encryption.KeyId(item.Message)
+		if err != nil {
+			return err
+		}
+		item.Headers[encryption.KeyIdHeader]= keyId
+		return nil
+	}
+
+	message, err := decryptor.Decrypt(ctx, item.Message)
+	if err != nil {
+		return err
+	}
+	item.Message= message
+	return nil
+}
@@ -0,0 +1,45 @@
+package usecases
+
+import (
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/events"
+)
+
+// EventValidation validates the messages against the protobuf types registered for their topics,
+// before they're published. The invalid messages are rejected : they're dead lettered right away,
+// instead of being retried.
+type EventValidation struct {
+	Registry *events.Registry
+
+	// RejectUnknownTypes rejects the messages whose topic has no registered type. Otherwise, they're
+	// published as is.
+	RejectUnknownTypes bool
+	// Envelope wraps the valid messages in an EventEnvelope, so that consumers can tell their type.
+	Envelope bool
+}
+
+// Apply validates the message of the item, and wraps it in an EventEnvelope if enabled. It returns
+// an error if the item must be rejected.
+func(v *EventValidation) Apply(item *ports.ToBePublishedItem) error {
+	if _, isRegistered := v.Registry.MessageType(item.Topic); !isRegistered && !v.RejectUnknownTypes {
+		return nil
+	}
+
+	if !v.Envelope {
+		return v.Registry.Validate(item.Topic, item.Message)
+	}
+
+	encoded, err := v.Registry.Wrap(events.Metadata{
+		Id: item.MessageId,
+		Type: item.Topic,
+		CreatedAt: item.CreatedAt,
+		Headers: item.Headers,
+	}, item.Message)
+	if err != nil {
+		return err
+	}
+
+	item.Message= encoded
+	item.ContentType= events.EnvelopeContentType
+	return nil
+}
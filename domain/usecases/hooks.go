@@ -0,0 +1,104 @@
+package usecases
+
+import (
+	"time"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// Hooks are optional callbacks invoked by a pipeline. They can be used to plug in logging and
+// metrics. Hooks are invoked synchronously, so they must not block.
+type Hooks struct {
+	// OnPoll is invoked after every poll of the outbox DB, with the time the poll took.
+	OnPoll func(pipeline Pipeline, duration time.Duration)
+
+	// OnStats is invoked periodically (see WithStatsInterval), with a snapshot of the state of the
+	// outbox DB. The snapshot is only taken when this hook is set.
+	OnStats func(pipeline Pipeline, stats *ports.OutboxStats)
+
+	// OnFetched is invoked for every message fetched from the outbox DB, before it's handed over to
+	// the MQ.
+	OnFetched func(pipeline Pipeline, item *ports.ToBePublishedItem)
+
+	// OnPublishResult is invoked for every publish result reported by the MQ, before it's handed
+	// over to the outbox DB. latency is the time taken by the MQ to publish the message, from the
+	// moment it was handed over to it. It's 0 for the messages which skipped the MQ.
+	OnPublishResult func(pipeline Pipeline, item *ports.ToBePublishedItem, result *ports.PublishResult, latency time.Duration)
+
+	// OnAcknowledged is invoked after the publish status of a message is updated in the outbox DB.
+	OnAcknowledged func(pipeline Pipeline, item *ports.ToBePublishedItem, acknowledgement *ports.Acknowledgement)
+
+	// OnCleaned is invoked after the outbox DB is cleaned, with the number of deleted messages.
+	OnCleaned func(pipeline Pipeline, count int64)
+}
+
+// MergeHooks combines the given hooks into one, which invokes each of them in order.
+func MergeHooks(hooksList ...Hooks) Hooks {
+	var merged Hooks
+
+	for _, hooks := range hooksList {
+		hooks := hooks
+
+		if hooks.OnPoll != nil {
+			previous := merged.OnPoll
+			merged.OnPoll= func(pipeline Pipeline, duration time.Duration) {
+				if previous != nil {
+					previous(pipeline, duration)
+				}
+				hooks.OnPoll(pipeline, duration)
+			}
+		}
+
+		if hooks.OnStats != nil {
+			previous := merged.OnStats
+			merged.OnStats= func(pipeline Pipeline, stats *ports.OutboxStats) {
+				if previous != nil {
+					previous(pipeline, stats)
+				}
+				hooks.OnStats(pipeline, stats)
+			}
+		}
+
+		if hooks.OnFetched != nil {
+			previous := merged.OnFetched
+			merged.OnFetched= func(pipeline Pipeline, item *ports.ToBePublishedItem) {
+				if previous != nil {
+					previous(pipeline, item)
+				}
+				hooks.OnFetched(pipeline, item)
+			}
+		}
+
+		if hooks.OnPublishResult != nil {
+			previous := merged.OnPublishResult
+			merged.OnPublishResult= func(pipeline Pipeline, item *ports.ToBePublishedItem, result *ports.PublishResult, latency time.Duration) {
+				if previous != nil {
+					previous(pipeline, item, result, latency)
+				}
+				hooks.OnPublishResult(pipeline, item, result, latency)
+			}
+		}
+
+		if hooks.OnAcknowledged != nil {
+			previous := merged.OnAcknowledged
+			merged.OnAcknowledged= func(pipeline Pipeline, item *ports.ToBePublishedItem, acknowledgement *ports.Acknowledgement) {
+				if previous != nil {
+					previous(pipeline, item, acknowledgement)
+				}
+				hooks.OnAcknowledged(pipeline, item, acknowledgement)
+			}
+		}
+
+		if hooks.OnCleaned != nil {
+			previous := merged.OnCleaned
+			merged.OnCleaned= func(pipeline Pipeline, count int64) {
+				if previous != nil {
+					previous(pipeline, count)
+				}
+				hooks.OnCleaned(pipeline, count)
+			}
+		}
+	}
+
+	return merged
+}
\ No newline at end of file
@@ -0,0 +1,101 @@
+package usecases
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+)
+
+// Steps prepare the fetched messages for being published. They're shared by Run and Replay, and
+// applied in the order of the fields. Each of them is optional.
+type Steps struct {
+	// Decryptor decrypts the messages encrypted by the producer, before anything else inspects them.
+	// Otherwise, they're published encrypted.
+	Decryptor *encryption.Encryptor
+	// Transforms are applied in order to the messages, before anything else alters them. They can
+	// drop or reject messages.
+	Transforms []ports.Transform
+	// SchemaIds attaches the id of their schema to the messages.
+	SchemaIds *SchemaIds
+	// EventValidation rejects the messages which don't match the type registered for their topic,
+	// and optionally wraps the others in an EventEnvelope.
+	EventValidation *EventValidation
+	// CloudEvents wraps the messages in CloudEvents.
+	CloudEvents *CloudEventsEnvelope
+	// Compressor compresses the messages (which weren't compressed by the producer) right before
+	// they're published.
+	Compressor *compression.Compressor
+	// ClaimCheck offloads the large messages to a blob store, once they're ready to be published.
+	// Messages which fail to be offloaded are retried.
+	ClaimCheck *ClaimCheck
+}
+
+// prepare applies the steps to the item, sourceName being the name of the outbox DB which it was
+// fetched from. It returns the publish result of the message if it mustn't be handed over to the
+// MQ, since it's dropped, rejected or couldn't be offloaded, along with the error which caused it
+// (if any).
+//
+// Messages which are still encrypted (see Decryptor) are published as they are : the steps reading
+// or rewriting them are skipped, except the claim check.
+func prepare(ctx context.Context, steps *Steps, sourceName string, item *ports.ToBePublishedItem, logger *slog.Logger) (*ports.PublishResult, error) {
+	if err := decrypt(ctx, steps.Decryptor, item); err != nil {
+		logger.Warn("Rejected message", "row_id", item.RowId, "topic", item.Topic, "error", err)
+		return &ports.PublishResult{ RowId: item.RowId, IsRejected: true }, err
+	}
+
+	// Without decryptor, the messages encrypted by the producer can't be inspected.
+	if encryption.IsEncrypted(item.Message) {
+		logger.Debug("Skipped inspecting encrypted message", "row_id", item.RowId)
+	} else {
+		// Messages compressed by the producer are decompressed, only if they need to be inspected.
+		if inspectsMessages(steps.Transforms, steps.EventValidation, steps.CloudEvents) {
+			if err := decompress(item); err != nil {
+				logger.Warn("Rejected message", "row_id", item.RowId, "topic", item.Topic, "error", err)
+				return &ports.PublishResult{ RowId: item.RowId, IsRejected: true }, err
+			}
+		}
+
+		isKept, err := applyTransforms(steps.Transforms, item)
+		if err != nil {
+			logger.Warn("Rejected message", "row_id", item.RowId, "topic", item.Topic, "error", err)
+			return &ports.PublishResult{ RowId: item.RowId, IsRejected: true }, err
+		}
+		if !isKept {
+			logger.Debug("Dropped message", "row_id", item.RowId, "topic", item.Topic)
+			return &ports.PublishResult{ RowId: item.RowId, IsPublished: true, IsDropped: true }, nil
+		}
+
+		if steps.SchemaIds != nil {
+			steps.SchemaIds.Attach(item)
+		}
+
+		if steps.EventValidation != nil {
+			if err := steps.EventValidation.Apply(item); err != nil {
+				logger.Warn("Rejected message", "row_id", item.RowId, "topic", item.Topic, "error", err)
+				return &ports.PublishResult{ RowId: item.RowId, IsRejected: true }, err
+			}
+		}
+
+		if steps.CloudEvents != nil {
+			if err := steps.CloudEvents.Wrap(sourceName, item); err != nil {
+				logger.Error("Error wrapping message in a CloudEvent", "row_id", item.RowId, "error", err)
+			}
+		}
+
+		if err := compress(steps.Compressor, item); err != nil {
+			logger.Error("Error compressing message", "row_id", item.RowId, "error", err)
+		}
+	}
+
+	if steps.ClaimCheck != nil {
+		if err := steps.ClaimCheck.Offload(ctx, item); err != nil {
+			logger.Warn("Error offloading message to the blob store", "row_id", item.RowId, "error", err)
+			return &ports.PublishResult{ RowId: item.RowId, IsOffloadFailed: true }, err
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+package usecases
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// RateLimiter bounds the rate at which messages are published to a sink, both in messages and in
+	// bytes per second. It's shared by all the pipelines publishing to that sink.
+	RateLimiter struct {
+		messages *tokenBucket
+		bytes *tokenBucket
+	}
+
+	// tokenBucket refills at rate tokens per second, holding up to a second worth of tokens.
+	tokenBucket struct {
+		rate float64
+
+		mutex sync.Mutex
+		tokens float64
+		updatedAt time.Time
+	}
+)
+
+// NewRateLimiter creates a RateLimiter. A rate of 0 means no limit.
+func NewRateLimiter(messagesPerSecond, bytesPerSecond float64) *RateLimiter {
+	return &RateLimiter{
+		messages: newTokenBucket(messagesPerSecond),
+		bytes: newTokenBucket(bytesPerSecond),
+	}
+}
+
+// Wait blocks until the given number of messages, made of the given number of bytes, can be
+// published. If the context is cancelled in the meantime, its error is returned.
+func(r *RateLimiter) Wait(ctx context.Context, messages, bytes int) error {
+	delay := max(r.messages.take(float64(messages)), r.bytes.take(float64(bytes)))
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop( )
+
+	select {
+		case <- timer.C:
+			return nil
+
+		case <- ctx.Done( ):
+			return ctx.Err( )
+	}
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{ rate: rate, tokens: rate, updatedAt: time.Now( ) }
+}
+
+// take takes n tokens out of the bucket, running into debt if there aren't enough of them (so that
+// a message bigger than the bucket still gets through). It returns how long the caller has to wait
+// for the debt to be repaid.
+func(t *tokenBucket) take(n float64) time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	t.mutex.Lock( )
+	defer t.mutex.Unlock( )
+
+	now := time.Now( )
+	t.tokens= min(t.rate, t.tokens + now.Sub(t.updatedAt).Seconds( ) * t.rate)
+	t.updatedAt= now
+
+	t.tokens -= n
+	if t.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
@@ -0,0 +1,120 @@
+package usecases
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+const (
+	DefaultReplayBatchSize= 100
+
+	// ReplayedHeader is set on every replayed message, so that consumers can tell replays apart.
+	ReplayedHeader= "outboxer-replayed"
+)
+
+type (
+	ReplayArgs struct {
+		// Context stops the replay once it's cancelled.
+		Context context.Context
+
+		OutboxDB ports.OutboxReplayer
+		Filter ports.ReplayFilter
+		BatchSize int
+
+		MQ ports.MQ
+
+		// SourceName is the name of the outbox DB, which the default source of the CloudEvents is
+		// derived from.
+		SourceName string
+		// Steps, when set, are applied to the replayed messages, like the dispatcher does. Rejected
+		// messages are counted as failed.
+		Steps Steps
+
+		Logger *slog.Logger
+	}
+
+	// ReplayResult counts the replayed messages.
+	ReplayResult struct {
+		Published int
+		// Dropped counts the messages dropped by the transforms.
+		Dropped int
+		Failed int
+	}
+)
+
+// Replay re-publishes the published messages matching args.Filter to args.MQ, without altering
+// their publish status. It blocks until all of them have been handed over to the MQ.
+func(u *Usecases) Replay(args ReplayArgs) (*ReplayResult, error) {
+	if args.BatchSize <= 0 {
+		args.BatchSize= DefaultReplayBatchSize
+	}
+
+	var (
+		logger= utils.LoggerOrDefault(args.Logger)
+
+		tobePublishedItemsChan= make(chan *ports.ToBePublishedItem)
+		publishResultsChan= make(chan *ports.PublishResult)
+
+		fetchErrChan= make(chan error, 1)
+	)
+
+	go func( ) {
+		defer close(tobePublishedItemsChan)
+
+		fetchedItemsChan := make(chan *ports.ToBePublishedItem)
+		go func( ) {
+			defer close(fetchedItemsChan)
+
+			fetchErrChan <- args.OutboxDB.GetMessagesForReplay(&ports.GetMessagesForReplayArgs{
+				Context: args.Context,
+				Filter: &args.Filter,
+				BatchSize: args.BatchSize,
+				ToBePublishedItemsChan: fetchedItemsChan,
+			})
+		}( )
+
+		for item := range fetchedItemsChan {
+			if item.Headers == nil {
+				item.Headers= map[string]string{ }
+			}
+			item.Headers[ReplayedHeader]= "true"
+
+			if skippedResult, _ := prepare(args.Context, &args.Steps, args.SourceName, item, logger); skippedResult != nil {
+				publishResultsChan <- skippedResult
+				continue
+			}
+
+			tobePublishedItemsChan <- item
+		}
+	}( )
+
+	go func( ) {
+		defer close(publishResultsChan)
+
+		args.MQ.PublishMessages(&ports.PublishMessagesArgs{
+			ToBePublishedItemsChan: tobePublishedItemsChan,
+			PublishResultsChan: publishResultsChan,
+		})
+	}( )
+
+	result := &ReplayResult{ }
+	for publishResult := range publishResultsChan {
+		switch {
+			case publishResult.IsDropped:
+				result.Dropped++
+
+			case publishResult.IsPublished:
+				result.Published++
+				logger.Debug("Replayed message", "row_id", publishResult.RowId)
+
+			default:
+				result.Failed++
+				logger.Warn("Message wasn't replayed", "row_id", publishResult.RowId)
+		}
+	}
+
+	return result, <- fetchErrChan
+}
@@ -1,51 +1,589 @@
 package usecases
 
 import (
+	"context"
+	"log/slog"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/Archisman-Mridha/outboxer/domain/ports"
 	"github.com/Archisman-Mridha/outboxer/utils"
 )
 
-type RunArgs struct {
-	WaitGroup *errgroup.Group
+const (
+	DefaultPollInterval= 3 * time.Second
 
-	OutboxDB ports.OutboxDB
-	BatchSize int
+	DefaultCleanInterval= time.Minute
+	DefaultStatsInterval= 15 * time.Second
+	DefaultCleanBatchSize= 1000
 
-	MQ ports.MQ
-}
+	tracerName= "github.com/Archisman-Mridha/outboxer"
+)
+
+type (
+	RunArgs struct {
+		// Context controls the lifetime of the pipeline. Once it's cancelled, the outbox DB stops being
+		// polled and the pipeline drains the messages which are already in flight.
+		Context context.Context
+		WaitGroup *errgroup.Group
+
+		Pipeline Pipeline
+
+		OutboxDB ports.OutboxDB
+		BatchSize int
+		PollInterval time.Duration
+		// MaxAttempts is the number of attempts after which a message, which fails to be published, is
+		// dead lettered. 0 means that it's retried forever.
+		MaxAttempts int
+		// Retention is how long the published messages are kept in the outbox DB, to be replayed if
+		// needed, before being cleaned.
+		Retention time.Duration
+		// CleanInterval is how often the outbox DB is cleaned. It's also cleaned once when the pipeline
+		// starts.
+		CleanInterval time.Duration
+		// CleanBatchSize is the number of rows deleted at once when cleaning the outbox DB.
+		CleanBatchSize int
+		// Archive moves the cleaned messages to a history table instead of deleting them.
+		Archive bool
+		// StatsInterval is how often a snapshot of the state of the outbox DB is taken, when the
+		// OnStats hook is set. It's kept apart from polling, since taking it can be costly.
+		StatsInterval time.Duration
+
+		// BatchMode publishes each fetched batch of messages at once, and updates their publish status
+		// at once. MQ must implement ports.BatchMQ and OutboxDB ports.BatchOutboxDB.
+		BatchMode bool
+
+		MQ ports.MQ
+		// Workers are the message queues used by the concurrent publisher workers, typically created
+		// with ports.WorkerMQ. Defaults to MQ alone, meaning a single publisher.
+		Workers []ports.MQ
+		// KeyOrdering routes the messages sharing the same key to the same publisher worker, so that
+		// they're published in order. Otherwise, messages are spread across the workers in turn.
+		KeyOrdering bool
+		// MaxInFlight bounds the number of messages which have been fetched, but not acknowledged yet.
+		// Once it's reached, polling waits for acknowledgements. 0 means no bound. In batch mode, it's
+		// raised to BatchSize if lower.
+		MaxInFlight int
+
+		// RateLimiter, when set, delays publishing the messages so that the rate limits of the sink
+		// aren't exceeded.
+		RateLimiter *RateLimiter
+		// CircuitBreaker, when set, is fed the publish results, and pauses polling the outbox DB while
+		// it's open.
+		CircuitBreaker *CircuitBreaker
+
+		// Steps prepare the fetched messages for being published.
+		Steps Steps
+
+		Hooks Hooks
+
+		// Logger is enriched with the pipeline details. Defaults to the default logger.
+		Logger *slog.Logger
+
+		// TracerProvider creates the spans for fetching, publishing and acknowledging messages. Defaults
+		// to the global tracer provider.
+		TracerProvider trace.TracerProvider
+		// Propagator extracts the trace context of a message from its headers, and injects the context
+		// of the publish span back into them. Defaults to the W3C trace context propagator.
+		Propagator propagation.TextMapPropagator
+	}
+
+	// Pipeline identifies the source (outbox DB) and the sink (MQ) which a pipeline connects.
+	Pipeline struct {
+		Source string
+		Sink string
+	}
+
+	// inFlightItem is a message which has been fetched from the outbox DB, but whose publish status
+	// hasn't been acknowledged yet.
+	inFlightItem struct {
+		item *ports.ToBePublishedItem
+		// handedOverAt is the time at which the message was handed over to the MQ, once it's ready to
+		// be published and the rate limiter let it through. It's the zero time for the messages which
+		// skip the MQ.
+		handedOverAt time.Time
+
+		publishSpan trace.Span
+		acknowledgeSpan trace.Span
+	}
+)
 
 func(u *Usecases) Run(args RunArgs) {
+	if args.PollInterval <= 0 {
+		args.PollInterval= DefaultPollInterval
+	}
+	if args.CleanInterval <= 0 {
+		args.CleanInterval= DefaultCleanInterval
+	}
+	if args.CleanBatchSize <= 0 {
+		args.CleanBatchSize= DefaultCleanBatchSize
+	}
+	if args.StatsInterval <= 0 {
+		args.StatsInterval= DefaultStatsInterval
+	}
+	if len(args.Workers) == 0 {
+		args.Workers= []ports.MQ{ args.MQ }
+	}
+	if args.BatchMode && args.MaxInFlight > 0 && args.MaxInFlight < args.BatchSize {
+		args.MaxInFlight= args.BatchSize
+	}
+	if args.TracerProvider == nil {
+		args.TracerProvider= otel.GetTracerProvider( )
+	}
+	if args.Propagator == nil {
+		args.Propagator= propagation.TraceContext{ }
+	}
+
 	var (
+		logger= utils.LoggerOrDefault(args.Logger).With(
+			"pipeline", args.Pipeline.String( ),
+			"source", args.Pipeline.Source,
+			"sink", args.Pipeline.Sink,
+		)
+
+		tracer= args.TracerProvider.Tracer(tracerName)
+		pipelineAttributes= trace.WithAttributes(
+			attribute.String("outboxer.source", args.Pipeline.Source),
+			attribute.String("outboxer.sink", args.Pipeline.Sink),
+		)
+
+		// In batch mode, the batches travel through the *BatchesChan channels instead.
 		tobePublishedItemsChan= make(chan *ports.ToBePublishedItem)
+		tobePublishedBatchesChan= make(chan []*ports.ToBePublishedItem)
+
 		publishResultsChan= make(chan *ports.PublishResult)
-	)
+		reportedPublishResultsChan= make(chan *ports.PublishResult)
+		publishResultBatchesChan= make(chan []*ports.PublishResult)
+		reportedPublishResultBatchesChan= make(chan []*ports.PublishResult)
+
+		acknowledgementsChan= make(chan *ports.Acknowledgement)
 
-	utils.RunFnPeriodically[*ports.GetMessagesArgs](
-		args.WaitGroup,
-		args.OutboxDB.GetMessages,
-		&ports.GetMessagesArgs{
-			BatchSize: args.BatchSize,
-			ToBePublishedItemsChan: tobePublishedItemsChan,
-		},
-		3 * time.Second,
+		inFlightItems= &sync.Map{ }
+		// inFlightSlots holds a token for each in flight message, when their number is bounded.
+		inFlightSlots chan struct{ }
 	)
+	if args.MaxInFlight > 0 {
+		inFlightSlots= make(chan struct{ }, args.MaxInFlight)
+	}
+
+	// handOver prepares a fetched message for being published : the publish span continues the trace
+	// of the request which inserted the message, so that consumers end up in the same trace. It
+	// returns the span context of that request, if any, and the publish result of the message if it
+	// mustn't be handed over to the MQ, since it's dropped, rejected or couldn't be offloaded.
+	handOver := func(item *ports.ToBePublishedItem) (trace.SpanContext, *ports.PublishResult) {
+		if item.Headers == nil {
+			item.Headers= map[string]string{ }
+		}
+
+		producerContext := args.Propagator.Extract(context.Background( ), propagation.MapCarrier(item.Headers))
+		producerSpanContext := trace.SpanContextFromContext(producerContext)
+
+		logger.Debug("Fetched message", "row_id", item.RowId, "attempt", item.Attempt)
+		if args.Hooks.OnFetched != nil {
+			args.Hooks.OnFetched(args.Pipeline, item)
+		}
+
+		publishContext, publishSpan := tracer.Start(producerContext, "outboxer.publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			pipelineAttributes,
+			trace.WithAttributes(attribute.String("outboxer.row_id", item.RowId)),
+		)
+		args.Propagator.Inject(publishContext, propagation.MapCarrier(item.Headers))
+
+		inFlightItems.Store(item.RowId, &inFlightItem{
+			item: item,
+
+			publishSpan: publishSpan,
+		})
+
+		skippedResult, err := prepare(args.Context, &args.Steps, args.Pipeline.Source, item, logger)
+		if err != nil {
+			publishSpan.RecordError(err)
+		}
+		return producerSpanContext, skippedResult
+	}
+
+	// Poll the outbox DB periodically and hand over the fetched messages to the MQ.
+	args.WaitGroup.Go(func( ) error {
+		defer close(tobePublishedItemsChan)
+		defer close(tobePublishedBatchesChan)
+
+		utils.RunFnPeriodically[int](
+			args.Context,
+			func(batchSize int) {
+				if args.CircuitBreaker != nil {
+					var isAllowed bool
+					if batchSize, isAllowed= args.CircuitBreaker.Allow(batchSize); !isAllowed {
+						logger.Debug("Skipped polling outbox DB, since the circuit breaker of the sink is open")
+						return
+					}
+				}
+
+				fetchedItemsChan := make(chan *ports.ToBePublishedItem)
+
+				startedAt := time.Now( )
+				go func( ) {
+					defer close(fetchedItemsChan)
+
+					args.OutboxDB.GetMessages(&ports.GetMessagesArgs{
+						BatchSize: batchSize,
+						ToBePublishedItemsChan: fetchedItemsChan,
+					})
+				}( )
+
+				var (
+					producerLinks []trace.Link
+					fetchedItems []*ports.ToBePublishedItem
+					skippedResults []*ports.PublishResult
+				)
+				for item := range fetchedItemsChan {
+					if inFlightSlots != nil {
+						inFlightSlots <- struct{ }{ }
+					}
+
+					producerSpanContext, skippedResult := handOver(item)
+					if producerSpanContext.IsValid( ) {
+						producerLinks= append(producerLinks, trace.Link{ SpanContext: producerSpanContext })
+					}
+
+					// Dropped, rejected and failed messages skip the MQ, their publish result being reported
+					// right away.
+					if skippedResult != nil {
+						if args.BatchMode {
+							skippedResults= append(skippedResults, skippedResult)
+						} else {
+							publishResultsChan <- skippedResult
+						}
+						continue
+					}
+
+					if args.BatchMode {
+						fetchedItems= append(fetchedItems, item)
+					} else {
+						tobePublishedItemsChan <- item
+					}
+				}
+				if len(fetchedItems) > 0 {
+					tobePublishedBatchesChan <- fetchedItems
+				}
+				if len(skippedResults) > 0 {
+					publishResultBatchesChan <- skippedResults
+				}
+
+				logger.Debug("Polled outbox DB", "messages", len(producerLinks), "duration", time.Since(startedAt))
+				if args.Hooks.OnPoll != nil {
+					args.Hooks.OnPoll(args.Pipeline, time.Since(startedAt))
+				}
+
+				_, fetchSpan := tracer.Start(args.Context, "outboxer.fetch",
+					trace.WithTimestamp(startedAt),
+					trace.WithLinks(producerLinks...),
+					pipelineAttributes,
+					trace.WithAttributes(attribute.Int("outboxer.batch.message_count", len(producerLinks))),
+				)
+				fetchSpan.End( )
+			},
+			args.BatchSize,
+			args.PollInterval,
+		)
+
+		return nil
+	})
+
+	// markHandedOver starts measuring the time taken by the MQ to publish the message.
+	markHandedOver := func(item *ports.ToBePublishedItem) {
+		if value, isFound := inFlightItems.Load(item.RowId); isFound {
+			value.(*inFlightItem).handedOverAt= time.Now( )
+		}
+	}
+
+	// Spread the messages across the publisher workers.
+	args.WaitGroup.Go(func( ) error {
+		defer close(publishResultsChan)
+		defer close(publishResultBatchesChan)
+
+		router := &workerRouter{ workers: len(args.Workers), keyOrdering: args.KeyOrdering }
+
+		if args.BatchMode {
+			for batch := range tobePublishedBatchesChan {
+				if args.RateLimiter != nil {
+					size := 0
+					for _, item := range batch {
+						size += len(item.Message)
+					}
+
+					// On shutdown, the throttled messages are given back to the outbox DB unpublished.
+					if err := args.RateLimiter.Wait(args.Context, len(batch), size); err != nil {
+						results := make([]*ports.PublishResult, len(batch))
+						for i, item := range batch {
+							results[i]= &ports.PublishResult{ RowId: item.RowId }
+						}
+						publishResultBatchesChan <- results
+						continue
+					}
+				}
+
+				subBatches := make([][]*ports.ToBePublishedItem, len(args.Workers))
+				for _, item := range batch {
+					markHandedOver(item)
+
+					worker := router.route(item)
+					subBatches[worker]= append(subBatches[worker], item)
+				}
+
+				var (
+					workersGroup sync.WaitGroup
+					subBatchResults= make([][]*ports.PublishResult, len(args.Workers))
+				)
+				for worker, subBatch := range subBatches {
+					if len(subBatch) == 0 {
+						continue
+					}
+
+					workersGroup.Add(1)
+					go func(worker int, subBatch []*ports.ToBePublishedItem) {
+						defer workersGroup.Done( )
+						subBatchResults[worker]= args.Workers[worker].(ports.BatchMQ).PublishBatch(subBatch)
+					}(worker, subBatch)
+				}
+				workersGroup.Wait( )
+
+				results := make([]*ports.PublishResult, 0, len(batch))
+				for _, subBatchResult := range subBatchResults {
+					results= append(results, subBatchResult...)
+				}
+				publishResultBatchesChan <- results
+			}
+			return nil
+		}
+
+		var (
+			workersGroup sync.WaitGroup
+			workerChans= make([]chan *ports.ToBePublishedItem, len(args.Workers))
+		)
+		for worker, mq := range args.Workers {
+			workerChans[worker]= make(chan *ports.ToBePublishedItem)
+
+			workersGroup.Add(1)
+			go func(mq ports.MQ, workerChan chan *ports.ToBePublishedItem) {
+				defer workersGroup.Done( )
+
+				mq.PublishMessages(&ports.PublishMessagesArgs{
+					ToBePublishedItemsChan: workerChan,
+					PublishResultsChan: publishResultsChan,
+				})
+			}(mq, workerChans[worker])
+		}
+
+		for item := range tobePublishedItemsChan {
+			if args.RateLimiter != nil {
+				// On shutdown, the throttled messages are given back to the outbox DB unpublished.
+				if err := args.RateLimiter.Wait(args.Context, 1, len(item.Message)); err != nil {
+					publishResultsChan <- &ports.PublishResult{ RowId: item.RowId }
+					continue
+				}
+			}
+			markHandedOver(item)
+			workerChans[router.route(item)] <- item
+		}
+
+		for _, workerChan := range workerChans {
+			close(workerChan)
+		}
+		workersGroup.Wait( )
+
+		return nil
+	})
+
+	// reportPublishResult ends the publish span of the message, and starts the acknowledge span.
+	reportPublishResult := func(result *ports.PublishResult) {
+		value, isFound := inFlightItems.Load(result.RowId)
+		if !isFound {
+			return
+		}
+		inFlightItem := value.(*inFlightItem)
+
+		// Only the messages handed over to the MQ say something about its health : not the dropped,
+		// rejected or throttled ones, nor the ones which couldn't be offloaded to the blob store.
+		if args.CircuitBreaker != nil && !inFlightItem.handedOverAt.IsZero( ) {
+			args.CircuitBreaker.Record(result.IsPublished)
+		}
+
+		switch {
+			case result.IsDropped:
+				inFlightItem.publishSpan.SetAttributes(attribute.Bool("outboxer.dropped", true))
+
+			case result.IsPublished:
+				logger.Debug("Published message", "row_id", result.RowId, "attempt", inFlightItem.item.Attempt)
+
+			case result.IsRejected:
+				inFlightItem.publishSpan.SetStatus(codes.Error, "message was rejected")
+
+			case result.IsOffloadFailed:
+				inFlightItem.publishSpan.SetStatus(codes.Error, "message couldn't be offloaded to the blob store")
+
+			default:
+				logger.Warn("Message wasn't published", "row_id", result.RowId, "attempt", inFlightItem.item.Attempt)
+				inFlightItem.publishSpan.SetStatus(codes.Error, "message wasn't published")
+		}
+		inFlightItem.publishSpan.End( )
+
+		if args.Hooks.OnPublishResult != nil {
+			var latency time.Duration
+			if !inFlightItem.handedOverAt.IsZero( ) {
+				latency= time.Since(inFlightItem.handedOverAt)
+			}
+			args.Hooks.OnPublishResult(args.Pipeline, inFlightItem.item, result, latency)
+		}
+
+		_, inFlightItem.acknowledgeSpan= tracer.Start(args.Context, "outboxer.acknowledge",
+			trace.WithLinks(trace.Link{ SpanContext: inFlightItem.publishSpan.SpanContext( ) }),
+			pipelineAttributes,
+			trace.WithAttributes(
+				attribute.String("outboxer.row_id", result.RowId),
+				attribute.Bool("outboxer.published", result.IsPublished),
+			),
+		)
+	}
+
+	args.WaitGroup.Go(func( ) error {
+		defer close(reportedPublishResultsChan)
+		defer close(reportedPublishResultBatchesChan)
+
+		if args.BatchMode {
+			for results := range publishResultBatchesChan {
+				for _, result := range results {
+					reportPublishResult(result)
+				}
+				reportedPublishResultBatchesChan <- results
+			}
+			return nil
+		}
+
+		for result := range publishResultsChan {
+			reportPublishResult(result)
+			reportedPublishResultsChan <- result
+		}
+
+		return nil
+	})
 
 	args.WaitGroup.Go(func( ) error {
-		args.MQ.PublishMessages(&ports.PublishMessagesArgs{
-			ToBePublishedItemsChan: tobePublishedItemsChan,
-			PublishResultsChan: publishResultsChan,
+		defer close(acknowledgementsChan)
+
+		if args.BatchMode {
+			batchOutboxDB := args.OutboxDB.(ports.BatchOutboxDB)
+			for results := range reportedPublishResultBatchesChan {
+				acknowledgements := batchOutboxDB.UpdatePublishStatusBatch(&ports.UpdatePublishStatusBatchArgs{
+					PublishResults: results,
+					MaxAttempts: args.MaxAttempts,
+				})
+				for _, acknowledgement := range acknowledgements {
+					acknowledgementsChan <- acknowledgement
+				}
+			}
+			return nil
+		}
+
+		args.OutboxDB.UnlockMessagesAndUpdatePublishStatus(&ports.UnlockMessagesAndUpdatePublishStatusArgs{
+			PublishResultsChan: reportedPublishResultsChan,
+			AcknowledgementsChan: acknowledgementsChan,
+			MaxAttempts: args.MaxAttempts,
 		})
 
 		return nil
 	})
 
 	args.WaitGroup.Go(func( ) error {
-		args.OutboxDB.Clean( )
+		for acknowledgement := range acknowledgementsChan {
+			value, isFound := inFlightItems.LoadAndDelete(acknowledgement.RowId)
+			if !isFound {
+				continue
+			}
+			inFlightItem := value.(*inFlightItem)
+
+			if inFlightSlots != nil {
+				<- inFlightSlots
+			}
+
+			if acknowledgement.Err != nil {
+				logger.Error("Error acknowledging message",
+					"row_id", acknowledgement.RowId, "attempt", inFlightItem.item.Attempt, "error", acknowledgement.Err,
+				)
+			}
+
+			if inFlightItem.acknowledgeSpan != nil {
+				if acknowledgement.Err != nil {
+					inFlightItem.acknowledgeSpan.RecordError(acknowledgement.Err)
+					inFlightItem.acknowledgeSpan.SetStatus(codes.Error, acknowledgement.Err.Error( ))
+				}
+				inFlightItem.acknowledgeSpan.End( )
+			}
+
+			if args.Hooks.OnAcknowledged != nil {
+				args.Hooks.OnAcknowledged(args.Pipeline, inFlightItem.item, acknowledgement)
+			}
+		}
 
 		return nil
 	})
+
+	// Take snapshots of the state of the outbox DB periodically.
+	if args.Hooks.OnStats != nil {
+		args.WaitGroup.Go(func( ) error {
+			takeStats := func(struct{ }) {
+				stats, err := args.OutboxDB.GetStats( )
+				if err != nil {
+					logger.Error("Error getting stats of the outbox DB", "error", err)
+					return
+				}
+				args.Hooks.OnStats(args.Pipeline, stats)
+			}
+
+			takeStats(struct{ }{ })
+			utils.RunFnPeriodically(args.Context, takeStats, struct{ }{ }, args.StatsInterval)
+
+			return nil
+		})
+	}
+
+	// Clean the outbox DB periodically.
+	args.WaitGroup.Go(func( ) error {
+		clean := func(cleanArgs *ports.CleanArgs) {
+			startedAt := time.Now( )
+
+			count, err := args.OutboxDB.Clean(cleanArgs)
+			if err != nil {
+				logger.Error("Error cleaning the outbox DB", "deleted_messages", count, "error", err)
+				return
+			}
+			logger.Info("Cleaned the outbox DB", "deleted_messages", count, "duration", time.Since(startedAt))
+
+			if args.Hooks.OnCleaned != nil {
+				args.Hooks.OnCleaned(args.Pipeline, count)
+			}
+		}
+
+		cleanArgs := &ports.CleanArgs{
+			Retention: args.Retention,
+			BatchSize: args.CleanBatchSize,
+			Archive: args.Archive,
+		}
+		clean(cleanArgs)
+		utils.RunFnPeriodically(args.Context, clean, cleanArgs, args.CleanInterval)
+
+		return nil
+	})
+}
+
+// String returns the pipeline in the form <source>-><sink>.
+func(p Pipeline) String( ) string {
+	return p.Source + "->" + p.Sink
 }
\ No newline at end of file
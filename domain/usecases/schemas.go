@@ -0,0 +1,39 @@
+package usecases
+
+import (
+	"strconv"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/events"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+)
+
+// SchemaIds attaches to the messages the id of the latest version of their schema, as the
+// schemas.IdHeader header, so that consumers can tell which version they were produced with.
+type SchemaIds struct {
+	Registry *schemas.Registry
+
+	// Events maps the topics to protobuf messages, whose full names are the subjects of their schemas.
+	// The topics which aren't mapped are subjects themselves (typically of JSON schemas).
+	Events *events.Registry
+}
+
+// Attach sets the schema id header of the item, if its subject has a registered schema.
+func(s *SchemaIds) Attach(item *ports.ToBePublishedItem) {
+	subject := item.Topic
+	if s.Events != nil {
+		if messageType, isFound := s.Events.MessageType(item.Topic); isFound {
+			subject= string(messageType.Descriptor( ).FullName( ))
+		}
+	}
+
+	schema, isFound := s.Registry.Latest(subject)
+	if !isFound {
+		return
+	}
+
+	if item.Headers == nil {
+		item.Headers= map[string]string{ }
+	}
+	item.Headers[schemas.IdHeader]= strconv.Itoa(schema.Id)
+}
@@ -0,0 +1,17 @@
+package usecases
+
+import (
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// applyTransforms applies the transforms in order to the item. It stops at the first one which
+// drops (false is returned) or rejects (an error is returned) the message.
+func applyTransforms(transforms []ports.Transform, item *ports.ToBePublishedItem) (bool, error) {
+	for _, transform := range transforms {
+		isKept, err := transform.Transform(item)
+		if err != nil || !isKept {
+			return false, err
+		}
+	}
+	return true, nil
+}
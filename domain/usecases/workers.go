@@ -0,0 +1,30 @@
+package usecases
+
+import (
+	"hash/fnv"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// workerRouter picks the publisher worker for each message.
+type workerRouter struct {
+	workers int
+	keyOrdering bool
+
+	next int
+}
+
+// route returns the index of the worker which should publish the given message. With key ordering,
+// messages sharing a key always go to the same worker. Messages without a key, or all of them
+// otherwise, are spread across the workers in turn.
+func(w *workerRouter) route(item *ports.ToBePublishedItem) int {
+	if w.keyOrdering && item.Key != "" {
+		hash := fnv.New32a( )
+		hash.Write([]byte(item.Key))
+		return int(hash.Sum32( ) % uint32(w.workers))
+	}
+
+	worker := w.next
+	w.next= (w.next + 1) % w.workers
+	return worker
+}
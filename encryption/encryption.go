@@ -0,0 +1,222 @@
+// Package encryption encrypts the outbox messages with AES-256-GCM, using envelope encryption : each
+// message is encrypted with its own random data key, which is itself encrypted (wrapped) with a key
+// of a KeyProvider, identified by its key id. The wrapped data key and the key id are stored along
+// with the ciphertext, so that the keys can be rotated : new messages are encrypted with the active
+// key, while the older ones can still be decrypted as long as their key is kept.
+//
+// Messages are encrypted by the producer when they're enqueued (see the producer package), so that
+// they're encrypted at rest. The relay either publishes them as they are, for consumers to decrypt
+// them with Decrypt, or decrypts them before publishing them.
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// Algorithm is the algorithm encrypting the messages, and wrapping the data keys of LocalKeys.
+	Algorithm= "AES-256-GCM"
+	// KeySize is the size (in bytes) of the data keys, and of the keys of LocalKeys.
+	KeySize= 32
+
+	// KeyIdHeader is set to the key id of the messages which are published encrypted, so that
+	// consumers can tell them apart.
+	KeyIdHeader= "outboxer-encryption-key-id"
+)
+
+var (
+	ErrNotEncrypted= errors.New("encryption: the data isn't encrypted")
+	ErrInvalidCiphertext= errors.New("encryption: invalid ciphertext")
+	ErrUnknownKey= errors.New("encryption: unknown key id")
+)
+
+// magic prefixes the encrypted messages, followed by the version of the format.
+var magic= []byte("OBXE\x01")
+
+type (
+	// KeyProvider holds the keys wrapping the data keys, like a local key file (see LocalKeys) or a
+	// KMS. The keys never leave a KMS : the data keys are sent to it to be wrapped or unwrapped.
+	KeyProvider interface {
+		// ActiveKeyId returns the id of the key wrapping the data keys of new messages.
+		ActiveKeyId(ctx context.Context) (string, error)
+		// WrapKey encrypts the data key with the given key.
+		WrapKey(ctx context.Context, keyId string, dataKey []byte) ([]byte, error)
+		// UnwrapKey decrypts the data key, which was wrapped with the given key. It returns an error
+		// wrapping ErrUnknownKey, if the key doesn't exist (anymore).
+		UnwrapKey(ctx context.Context, keyId string, wrappedDataKey []byte) ([]byte, error)
+	}
+
+	// Encryptor encrypts and decrypts messages, with the keys of its provider. It's safe for
+	// concurrent use, as long as its provider is.
+	Encryptor struct {
+		Provider KeyProvider
+	}
+
+	// header is the unencrypted part of an encrypted message, which is authenticated along with the
+	// ciphertext.
+	header struct {
+		keyId string
+		wrappedDataKey []byte
+	}
+)
+
+// Encrypt encrypts the plaintext with a new data key, wrapped with the active key.
+func(e *Encryptor) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	keyId, err := e.Provider.ActiveKeyId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	wrappedDataKey, err := e.Provider.WrapKey(ctx, keyId, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping data key with key %s: %w", keyId, err)
+	}
+
+	encodedHeader, err := (&header{ keyId, wrappedDataKey }).encode( )
+	if err != nil {
+		return nil, err
+	}
+	return seal(dataKey, plaintext, encodedHeader)
+}
+
+// Decrypt decrypts the encrypted message, unwrapping its data key with the key it was encrypted
+// with.
+func(e *Encryptor) Decrypt(ctx context.Context, data []byte) ([]byte, error) {
+	header, ciphertext, err := decodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := e.Provider.UnwrapKey(ctx, header.keyId, header.wrappedDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key with key %s: %w", header.keyId, err)
+	}
+	return open(dataKey, ciphertext, data[:len(data) - len(ciphertext)])
+}
+
+// Rewrap encrypts the encrypted message again, with a data key wrapped with the active key, if it was
+// encrypted with another one. Rewrapping the stored messages lets the keys they were encrypted with
+// be retired.
+func(e *Encryptor) Rewrap(ctx context.Context, data []byte) ([]byte, error) {
+	plaintext, err := e.Decrypt(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	header, _, _ := decodeHeader(data)
+	activeKeyId, err := e.Provider.ActiveKeyId(ctx)
+	if err != nil || header.keyId == activeKeyId {
+		return data, err
+	}
+	return e.Encrypt(ctx, plaintext)
+}
+
+// IsEncrypted reports whether the data is an encrypted message.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// KeyId returns the id of the key the encrypted message was encrypted with.
+func KeyId(data []byte) (string, error) {
+	header, _, err := decodeHeader(data)
+	if err != nil {
+		return "", err
+	}
+	return header.keyId, nil
+}
+
+// encode returns the header : the magic bytes, the key id and the wrapped data key, each prefixed by
+// its length.
+func(h *header) encode( ) ([]byte, error) {
+	if len(h.keyId) == 0 || len(h.keyId) > 255 {
+		return nil, fmt.Errorf("encryption: key id %q must be 1 to 255 bytes long", h.keyId)
+	}
+	if len(h.wrappedDataKey) > 65535 {
+		return nil, errors.New("encryption: the wrapped data key is too large")
+	}
+
+	encoded := make([]byte, 0, len(magic) + 1 + len(h.keyId) + 2 + len(h.wrappedDataKey))
+	encoded= append(encoded, magic...)
+	encoded= append(encoded, byte(len(h.keyId)))
+	encoded= append(encoded, h.keyId...)
+	encoded= binary.BigEndian.AppendUint16(encoded, uint16(len(h.wrappedDataKey)))
+	return append(encoded, h.wrappedDataKey...), nil
+}
+
+// decodeHeader returns the header of the encrypted message, and the rest of it.
+func decodeHeader(data []byte) (*header, []byte, error) {
+	if !IsEncrypted(data) {
+		return nil, nil, ErrNotEncrypted
+	}
+	rest := data[len(magic):]
+
+	if len(rest) < 1 || len(rest) < 1 + int(rest[0]) + 2 {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	keyId, rest := string(rest[1:1 + int(rest[0])]), rest[1 + int(rest[0]):]
+
+	wrappedDataKeySize := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2 + wrappedDataKeySize {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	return &header{ keyId, rest[2:2 + wrappedDataKeySize] }, rest[2 + wrappedDataKeySize:], nil
+}
+
+// seal encrypts the plaintext with AES-256-GCM, and returns it prefixed by the additional data and
+// the nonce.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, len(additionalData) + aead.NonceSize( ), len(additionalData) + aead.NonceSize( ) + len(plaintext) + aead.Overhead( ))
+	copy(sealed, additionalData)
+
+	nonce := sealed[len(additionalData):]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(sealed, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the output of seal, without the additional data.
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize( ) + aead.Overhead( ) {
+		return nil, ErrInvalidCiphertext
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize( )], sealed[aead.NonceSize( ):], additionalData)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption: keys must be %d bytes long", KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
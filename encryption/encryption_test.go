@@ -0,0 +1,76 @@
+package encryption
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryption(t *testing.T) {
+	ctx := context.Background( )
+	keyFilePath := filepath.Join(t.TempDir( ), "keys.json")
+
+	firstKeyId, err := RotateKeyFile(keyFilePath)
+	assert.NoError(t, err)
+
+	keys, err := LoadKeyFile(keyFilePath)
+	assert.NoError(t, err)
+	encryptor := &Encryptor{ Provider: keys }
+
+	plaintext := []byte(`{"email":"archi@example.com"}`)
+	encrypted, err := encryptor.Encrypt(ctx, plaintext)
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, string(encrypted), "archi")
+
+	keyId, err := KeyId(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, firstKeyId, keyId)
+
+	decrypted, err := encryptor.Decrypt(ctx, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Tampering with the ciphertext, or with the key id, is detected.
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered) - 1] ^= 1
+	_, err= encryptor.Decrypt(ctx, tampered)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err= encryptor.Decrypt(ctx, plaintext)
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	// After a rotation, new messages are encrypted with the new key, which the other replicas pick up
+	// when they come across it, while the older messages remain readable.
+	time.Sleep(time.Second)
+	secondKeyId, err := RotateKeyFile(keyFilePath)
+	assert.NoError(t, err)
+
+	rotatedKeys, err := LoadKeyFile(keyFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ firstKeyId, secondKeyId }, rotatedKeys.KeyIds( ))
+	rotatedEncryptor := &Encryptor{ Provider: rotatedKeys }
+
+	encryptedWithSecondKey, err := rotatedEncryptor.Encrypt(ctx, plaintext)
+	assert.NoError(t, err)
+	keyId, _= KeyId(encryptedWithSecondKey)
+	assert.Equal(t, secondKeyId, keyId)
+
+	decrypted, err= encryptor.Decrypt(ctx, encryptedWithSecondKey)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	rewrapped, err := rotatedEncryptor.Rewrap(ctx, encrypted)
+	assert.NoError(t, err)
+	keyId, _= KeyId(rewrapped)
+	assert.Equal(t, secondKeyId, keyId)
+	decrypted, err= rotatedEncryptor.Decrypt(ctx, rewrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	_, err= (&Encryptor{ Provider: keys }).Decrypt(ctx, append(append([]byte(nil), magic...), 3, 'x', 'y', 'z', 0, 0))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
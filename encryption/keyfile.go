@@ -0,0 +1,182 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// LocalKeys is a KeyProvider reading its keys from a local JSON key file, like :
+	//
+	//	{
+	//	  "active_key_id": "20240201T000000Z",
+	//	  "keys": {
+	//	    "20240101T000000Z": "<base64 encoded 32 bytes key>",
+	//	    "20240201T000000Z": "<base64 encoded 32 bytes key>"
+	//	  }
+	//	}
+	//
+	// The keys are base64 encoded. The data keys are wrapped with AES-256-GCM. The key file is read again when a message encrypted
+	// with an unknown key is decrypted, or when Reload is called, so that rotating the keys (see
+	// RotateKeyFile) doesn't require restarting the relay. It's safe for concurrent use.
+	LocalKeys struct {
+		path string
+
+		mutex sync.RWMutex
+		keyFile *keyFile
+	}
+
+	keyFile struct {
+		ActiveKeyId string `json:"active_key_id"`
+		Keys map[string][]byte `json:"keys"`
+	}
+)
+
+// LoadKeyFile reads the key file at the given path.
+func LoadKeyFile(path string) (*LocalKeys, error) {
+	localKeys := &LocalKeys{ path: path }
+	if err := localKeys.Reload( ); err != nil {
+		return nil, err
+	}
+	return localKeys, nil
+}
+
+// Reload reads the key file again.
+func(l *LocalKeys) Reload( ) error {
+	file, err := readKeyFile(l.path)
+	if err != nil {
+		return err
+	}
+	if _, isFound := file.Keys[file.ActiveKeyId]; !isFound {
+		return fmt.Errorf("%w %q: the active key of %s", ErrUnknownKey, file.ActiveKeyId, l.path)
+	}
+	for keyId, key := range file.Keys {
+		if len(key) != KeySize {
+			return fmt.Errorf("encryption: key %s of %s must be %d bytes long", keyId, l.path, KeySize)
+		}
+	}
+
+	l.mutex.Lock( )
+	l.keyFile= file
+	l.mutex.Unlock( )
+	return nil
+}
+
+// KeyIds returns the ids of the keys, in order.
+func(l *LocalKeys) KeyIds( ) []string {
+	l.mutex.RLock( )
+	defer l.mutex.RUnlock( )
+
+	keyIds := make([]string, 0, len(l.keyFile.Keys))
+	for keyId := range l.keyFile.Keys {
+		keyIds= append(keyIds, keyId)
+	}
+	sort.Strings(keyIds)
+	return keyIds
+}
+
+func(l *LocalKeys) ActiveKeyId(context.Context) (string, error) {
+	l.mutex.RLock( )
+	defer l.mutex.RUnlock( )
+
+	return l.keyFile.ActiveKeyId, nil
+}
+
+func(l *LocalKeys) WrapKey(ctx context.Context, keyId string, dataKey []byte) ([]byte, error) {
+	key, err := l.key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	// The wrapped data key is bound to the key id, which prefixes it.
+	return seal(key, dataKey, []byte(keyId))
+}
+
+func(l *LocalKeys) UnwrapKey(ctx context.Context, keyId string, wrappedDataKey []byte) ([]byte, error) {
+	key, err := l.key(keyId)
+	if errors.Is(err, ErrUnknownKey) {
+		// The key may have been added since the key file was read.
+		if err := l.Reload( ); err != nil {
+			return nil, err
+		}
+		key, err= l.key(keyId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrappedDataKey) < len(keyId) || string(wrappedDataKey[:len(keyId)]) != keyId {
+		return nil, ErrInvalidCiphertext
+	}
+	return open(key, wrappedDataKey[len(keyId):], []byte(keyId))
+}
+
+func(l *LocalKeys) key(keyId string) ([]byte, error) {
+	l.mutex.RLock( )
+	defer l.mutex.RUnlock( )
+
+	key, isFound := l.keyFile.Keys[keyId]
+	if !isFound {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyId)
+	}
+	return key, nil
+}
+
+// RotateKeyFile adds a new random key to the key file at the given path (which is created if it
+// doesn't exist), and makes it the active key. The previous keys are kept, for the messages they
+// encrypted to remain readable. It returns the id of the new key, which is its creation time.
+func RotateKeyFile(path string) (string, error) {
+	file, err := readKeyFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		file, err= &keyFile{ Keys: map[string][]byte{ } }, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	keyId := time.Now( ).UTC( ).Format("20060102T150405Z")
+	if _, isFound := file.Keys[keyId]; isFound {
+		return "", fmt.Errorf("encryption: key %s already exists", keyId)
+	}
+
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	file.Keys[keyId]= key
+	file.ActiveKeyId= keyId
+
+	encoded, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	// The key file is replaced atomically, so that it's never read half written.
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, append(encoded, '\n'), 0o600); err != nil {
+		return "", err
+	}
+	return keyId, os.Rename(temporaryPath, path)
+}
+
+func readKeyFile(path string) (*keyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file %s: %w", path, err)
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error decoding key file %s: %w", path, err)
+	}
+	if file.Keys == nil {
+		file.Keys= map[string][]byte{ }
+	}
+	return &file, nil
+}
@@ -0,0 +1,63 @@
+package outboxer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Archisman-Mridha/outboxer/cloudevents"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/domain/usecases"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+)
+
+type (
+	// EventValidation configures the validation of the published messages against the protobuf types
+	// registered for their topics (see WithEventValidation).
+	EventValidation= usecases.EventValidation
+
+	// CloudEventsEnvelope configures the CloudEvents envelope of the published messages (see
+	// WithCloudEvents).
+	CloudEventsEnvelope= usecases.CloudEventsEnvelope
+
+	// ClaimCheck configures the offloading of the large messages to a blob store (see WithClaimCheck).
+	ClaimCheck= usecases.ClaimCheck
+)
+
+var ErrCloudEventsBinaryModeNotSupported= errors.New("outboxer: the sink has no CloudEvents protocol binding, the header prefix of the binary content mode must be set")
+
+// resolveCloudEventsEnvelope validates the envelope, and defaults the header prefix of the binary
+// content mode to the one of the protocol binding of the sink.
+func resolveCloudEventsEnvelope(envelope CloudEventsEnvelope, sink ports.MQ) (*CloudEventsEnvelope, error) {
+	switch envelope.Mode {
+		case cloudevents.ModeStructured:
+
+		case cloudevents.ModeBinary:
+			if envelope.HeaderPrefix != "" {
+				break
+			}
+
+			cloudEventsMQ, isCloudEventsMQ := sink.(ports.CloudEventsMQ)
+			if !isCloudEventsMQ {
+				return nil, ErrCloudEventsBinaryModeNotSupported
+			}
+			envelope.HeaderPrefix= cloudEventsMQ.CloudEventsHeaderPrefix( )
+
+		default:
+			return nil, fmt.Errorf("outboxer: unknown CloudEvents content mode %q", envelope.Mode)
+	}
+	return &envelope, nil
+}
+
+// newSchemaIds attaches the ids of the schemas of the registry, if any, to the messages. The protobuf
+// messages registered for event validation are the subjects of the schemas of their topics.
+func newSchemaIds(registry *schemas.Registry, eventValidation *EventValidation) *usecases.SchemaIds {
+	if registry == nil {
+		return nil
+	}
+
+	schemaIds := &usecases.SchemaIds{ Registry: registry }
+	if eventValidation != nil {
+		schemaIds.Events= eventValidation.Registry
+	}
+	return schemaIds
+}
@@ -0,0 +1,302 @@
+package outboxer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/claimcheck"
+	"github.com/Archisman-Mridha/outboxer/cloudevents"
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+	"github.com/Archisman-Mridha/outboxer/events"
+	"github.com/Archisman-Mridha/outboxer/transforms"
+)
+
+// inMemoryAMQP is an MQ with the CloudEvents protocol binding of AMQP.
+type inMemoryAMQP struct {
+	inMemoryMQ
+}
+
+func(i *inMemoryAMQP) CloudEventsHeaderPrefix( ) string { return cloudevents.AMQPHeaderPrefix }
+
+func TestCloudEvents(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	newOutboxDB := func( ) *inMemoryOutboxDB {
+		return &inMemoryOutboxDB{
+			items: []*ports.ToBePublishedItem{
+				{
+					RowId: "1",
+					MessageId: "0190c2d4-9a0e-7b3e-8f4e-3f2a1b0c9d8e",
+					Message: []byte(`{ "user": 42 }`),
+					CreatedAt: createdAt,
+					Topic: "user.registered",
+					Key: "user-42",
+				},
+			},
+		}
+	}
+
+	t.Run("Structured mode", func(t *testing.T) {
+		mq := &inMemoryMQ{ }
+		relayAll(t, newOutboxDB( ), mq, WithCloudEvents(CloudEventsEnvelope{ Mode: cloudevents.ModeStructured, DataContentType: "application/json" }))
+
+		published := publishedItems(mq)
+		if !assert.Len(t, published, 1) {
+			return
+		}
+		assert.Equal(t, cloudevents.StructuredContentType, published[0].ContentType)
+
+		event, err := cloudevents.UnmarshalStructured(published[0].Message)
+		assert.NoError(t, err)
+		assert.Equal(t, "0190c2d4-9a0e-7b3e-8f4e-3f2a1b0c9d8e", event.Id)
+		assert.Equal(t, "/outboxer/in-memory", event.Source)
+		assert.Equal(t, "user.registered", event.Type)
+		assert.Equal(t, "user-42", event.Subject)
+		assert.Equal(t, createdAt, event.Time)
+		assert.Equal(t, "application/json", event.DataContentType)
+		assert.JSONEq(t, `{ "user": 42 }`, string(event.Data))
+		assert.Equal(t, published[0].Headers["traceparent"], event.Extensions["traceparent"])
+	})
+
+	t.Run("Binary mode", func(t *testing.T) {
+		mq := &inMemoryAMQP{ }
+		relayAll(t, newOutboxDB( ), mq, WithCloudEvents(CloudEventsEnvelope{ Mode: cloudevents.ModeBinary, Source: "https://example.com/orders" }))
+
+		published := publishedItems(&mq.inMemoryMQ)
+		if !assert.Len(t, published, 1) {
+			return
+		}
+		assert.Equal(t, `{ "user": 42 }`, string(published[0].Message))
+
+		event, err := cloudevents.FromBinary(cloudevents.AMQPHeaderPrefix, published[0].Headers, published[0].ContentType, published[0].Message)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/orders", event.Source)
+		assert.Equal(t, "user.registered", event.Type)
+		assert.Equal(t, "application/octet-stream", event.DataContentType)
+	})
+
+	t.Run("Binary mode without protocol binding", func(t *testing.T) {
+		_, err := New(
+			WithSource("orders", newOutboxDB( ), 1),
+			WithSink("in-memory", &inMemoryMQ{ }),
+			WithCloudEvents(CloudEventsEnvelope{ Mode: cloudevents.ModeBinary }),
+		)
+		assert.ErrorIs(t, err, ErrCloudEventsBinaryModeNotSupported)
+	})
+}
+
+func TestCompression(t *testing.T) {
+	large := bytes.Repeat([]byte("registered "), 200)
+
+	producerCompressed, err := compression.Encode(compression.EncodingGzip, large)
+	assert.NoError(t, err)
+
+	relay := func(options ...Option) []*ports.ToBePublishedItem {
+		outboxDB := &inMemoryOutboxDB{
+			items: []*ports.ToBePublishedItem{
+				{ RowId: "1", Message: large, Topic: "user.registered" },
+				{ RowId: "2", Message: []byte("small"), Topic: "user.registered" },
+				{ RowId: "3", Message: producerCompressed, ContentEncoding: compression.EncodingGzip, Topic: "user.registered" },
+			},
+		}
+		mq := &inMemoryMQ{ }
+
+		relayAll(t, outboxDB, mq, options...)
+		return publishedByRowId(mq)
+	}
+
+	// Large messages are compressed, while the one compressed by the producer is published as is.
+	published := relay(WithCompression(compression.Compressor{ Encoding: compression.EncodingZstd }))
+	if assert.Len(t, published, 3) {
+		assert.Equal(t, compression.EncodingZstd, published[0].ContentEncoding)
+		assert.Equal(t, "", published[1].ContentEncoding)
+		assert.Equal(t, compression.EncodingGzip, published[2].ContentEncoding)
+		assert.Equal(t, producerCompressed, published[2].Message)
+
+		for _, item := range published {
+			message, err := compression.Decode(item.ContentEncoding, item.Message)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, message)
+		}
+	}
+
+	// Messages compressed by the producer are decompressed when they need to be inspected, and then
+	// compressed again by the relay.
+	published= relay(
+		WithTransforms(&transforms.Route{ RoutingKey: "users" }),
+		WithCompression(compression.Compressor{ Encoding: compression.EncodingSnappy }),
+	)
+	if assert.Len(t, published, 3) {
+		assert.Equal(t, compression.EncodingSnappy, published[2].ContentEncoding)
+
+		message, err := compression.Decode(published[2].ContentEncoding, published[2].Message)
+		assert.NoError(t, err)
+		assert.Equal(t, large, message)
+	}
+
+	_, err= New(
+		WithSource("in-memory", &inMemoryOutboxDB{ }, 10),
+		WithSink("in-memory", &inMemoryMQ{ }),
+		WithCompression(compression.Compressor{ Encoding: "brotli" }),
+	)
+	assert.ErrorIs(t, err, compression.ErrUnsupportedEncoding)
+}
+
+func TestEncryption(t *testing.T) {
+	ctx := context.Background( )
+
+	keyFilePath := filepath.Join(t.TempDir( ), "keys.json")
+	keyId, err := encryption.RotateKeyFile(keyFilePath)
+	assert.NoError(t, err)
+	keys, err := encryption.LoadKeyFile(keyFilePath)
+	assert.NoError(t, err)
+	encryptor := &encryption.Encryptor{ Provider: keys }
+
+	plaintext := []byte(`{"email":"archi@example.com"}`)
+	encrypted, err := encryptor.Encrypt(ctx, plaintext)
+	assert.NoError(t, err)
+
+	relay := func(options ...Option) []*ports.ToBePublishedItem {
+		outboxDB := &inMemoryOutboxDB{
+			items: []*ports.ToBePublishedItem{
+				{ RowId: "1", Message: encrypted, Topic: "user.registered" },
+				{ RowId: "2", Message: []byte("plaintext"), Topic: "user.registered" },
+			},
+		}
+		mq := &inMemoryMQ{ }
+
+		relayAll(t, outboxDB, mq, options...)
+		return publishedByRowId(mq)
+	}
+
+	// By default, encrypted messages are published as they are, for consumers to decrypt them.
+	published := relay( )
+	if assert.Len(t, published, 2) {
+		assert.Equal(t, encrypted, published[0].Message)
+		assert.Equal(t, keyId, published[0].Headers[encryption.KeyIdHeader])
+		assert.NotContains(t, published[1].Headers, encryption.KeyIdHeader)
+
+		decrypted, err := encryptor.Decrypt(ctx, published[0].Message)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	}
+
+	published= relay(WithDecryption(keys))
+	if assert.Len(t, published, 2) {
+		assert.Equal(t, plaintext, published[0].Message)
+		assert.NotContains(t, published[0].Headers, encryption.KeyIdHeader)
+		assert.Equal(t, []byte("plaintext"), published[1].Message)
+	}
+
+	// Without decryption, the steps inspecting the messages skip the encrypted ones, instead of
+	// rejecting them. The plaintext message is still validated (and rejected).
+	published= relay(
+		WithTransforms(&transforms.Redact{ Fields: []string{ "email" } }),
+		WithEventValidation(EventValidation{ Registry: events.NewRegistry( ), RejectUnknownTypes: true }),
+		WithCloudEvents(CloudEventsEnvelope{ Mode: cloudevents.ModeStructured }),
+	)
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, "1", published[0].RowId)
+		assert.Equal(t, encrypted, published[0].Message)
+		assert.Equal(t, keyId, published[0].Headers[encryption.KeyIdHeader])
+	}
+}
+
+// failingBlobStore is a blob store which is down.
+type failingBlobStore struct{ }
+
+func(failingBlobStore) Put(context.Context, string, []byte) error { return errors.New("blob store is down") }
+
+func(failingBlobStore) Get(context.Context, string) ([]byte, error) { return nil, errors.New("blob store is down") }
+
+func TestClaimCheck(t *testing.T) {
+	ctx := context.Background( )
+	large := bytes.Repeat([]byte("x"), 2048)
+
+	relay := func(claimCheck ClaimCheck) []*ports.ToBePublishedItem {
+		outboxDB := &inMemoryOutboxDB{
+			items: []*ports.ToBePublishedItem{
+				{ RowId: "1", MessageId: "0190c2d4-9a0e-7b3e-8f4e-3f2a1b0c9d8e", Message: large, ContentType: "text/plain", CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+				{ RowId: "2", MessageId: "2", Message: []byte("small") },
+			},
+		}
+		mq := &inMemoryMQ{ }
+
+		relayAll(t, outboxDB, mq, WithClaimCheck(claimCheck))
+		return publishedByRowId(mq)
+	}
+
+	store, err := claimcheck.NewFileStore(t.TempDir( ))
+	assert.NoError(t, err)
+
+	published := relay(ClaimCheck{ Store: store, Threshold: 1024 })
+	if assert.Len(t, published, 2) {
+		assert.Equal(t, claimcheck.ContentType, published[0].ContentType)
+		assert.Equal(t, []byte("small"), published[1].Message)
+
+		message, reference, err := (&claimcheck.Resolver{ Store: store }).Resolve(ctx, published[0].ContentType, published[0].Message)
+		assert.NoError(t, err)
+		assert.Equal(t, large, message)
+		assert.Equal(t, "2024/01/02/0190c2d4-9a0e-7b3e-8f4e-3f2a1b0c9d8e", reference.Key)
+		assert.Equal(t, "text/plain", reference.ContentType)
+	}
+
+	// Messages which fail to be offloaded aren't published, to be retried.
+	published= relay(ClaimCheck{ Store: failingBlobStore{ }, Threshold: 1024 })
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, "2", published[0].RowId)
+	}
+}
+
+func TestClaimCheckOffloadFailure(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 2048)
+
+	outboxDB := &inMemoryOutboxDB{
+		items: []*ports.ToBePublishedItem{
+			{ RowId: "1", MessageId: "1", Message: large },
+			{ RowId: "2", MessageId: "2", Message: large },
+			{ RowId: "3", MessageId: "3", Message: []byte("small") },
+		},
+	}
+	mq := &inMemoryMQ{ }
+
+	var (
+		offloadFailed atomic.Int64
+		stateChanges []CircuitBreakerState
+	)
+	relayAll(t, outboxDB, mq,
+		WithClaimCheck(ClaimCheck{ Store: failingBlobStore{ }, Threshold: 1024 }),
+		WithCircuitBreaker(CircuitBreakerOptions{
+			FailureThreshold: 1,
+			OpenTimeout: time.Hour,
+			Probes: 1,
+			OnStateChange: func(from, to CircuitBreakerState) {
+				stateChanges= append(stateChanges, to)
+			},
+		}),
+		WithHooks(Hooks{
+			OnPublishResult: func(_ Pipeline, _ *ports.ToBePublishedItem, result *ports.PublishResult, _ time.Duration) {
+				if result.IsOffloadFailed {
+					offloadFailed.Add(1)
+				}
+			},
+		}),
+	)
+
+	// A broken blob store says nothing about the health of the MQ.
+	assert.Empty(t, stateChanges)
+	assert.Equal(t, int64(2), offloadFailed.Load( ))
+
+	published := publishedByRowId(mq)
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, "3", published[0].RowId)
+	}
+}
@@ -0,0 +1,199 @@
+// Package events maps the event types (the topics of the outbox messages) to the protobuf messages
+// describing their payloads. The relay uses it to reject the payloads which don't match their
+// declared type, and to wrap them in an EventEnvelope. Consumers use it to unwrap them.
+package events
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	protoc_generated "github.com/Archisman-Mridha/outboxer/proto/generated"
+)
+
+const (
+	// EnvelopeVersion is the version of the EventEnvelope format produced by Wrap.
+	EnvelopeVersion= 1
+	// EnvelopeContentType is the content type of the encoded EventEnvelopes.
+	EnvelopeContentType= "application/x-protobuf; messageType=outboxer.v1.EventEnvelope"
+
+	// typeURLPrefix is the prefix of the type URLs, as used by anypb.
+	typeURLPrefix= "type.googleapis.com/"
+)
+
+var (
+	ErrUnknownEventType= errors.New("events: unknown event type")
+	ErrInvalidPayload= errors.New("events: payload doesn't match its event type")
+	ErrUnsupportedEnvelopeVersion= errors.New("events: unsupported envelope version")
+)
+
+// Registry maps the event types to the protobuf messages describing their payloads. It's safe for
+// concurrent use.
+type Registry struct {
+	mutex sync.RWMutex
+
+	// messageTypes is indexed by event type.
+	messageTypes map[string]protoreflect.MessageType
+	// messageTypesByName is indexed by the full name of the messages, for unpacking type URLs.
+	messageTypesByName map[protoreflect.FullName]protoreflect.MessageType
+}
+
+func NewRegistry( ) *Registry {
+	return &Registry{
+		messageTypes: map[string]protoreflect.MessageType{ },
+		messageTypesByName: map[protoreflect.FullName]protoreflect.MessageType{ },
+	}
+}
+
+// Register maps the event type to the type of the given message, replacing any previous mapping.
+func(r *Registry) Register(eventType string, message proto.Message) {
+	messageType := message.ProtoReflect( ).Type( )
+
+	r.mutex.Lock( )
+	defer r.mutex.Unlock( )
+
+	r.messageTypes[eventType]= messageType
+	r.messageTypesByName[messageType.Descriptor( ).FullName( )]= messageType
+}
+
+// RegisterByName maps the event type to the message with the given full name (like
+// outboxer.events.v1.RegistrationStartedEvent), among the messages linked into the binary.
+func(r *Registry) RegisterByName(eventType string, fullName string) error {
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(fullName))
+	if err != nil {
+		return fmt.Errorf("events: message %s: %w", fullName, err)
+	}
+
+	r.Register(eventType, messageType.New( ).Interface( ))
+	return nil
+}
+
+// MessageType returns the type of the messages registered for the event type.
+func(r *Registry) MessageType(eventType string) (protoreflect.MessageType, bool) {
+	r.mutex.RLock( )
+	defer r.mutex.RUnlock( )
+
+	messageType, isFound := r.messageTypes[eventType]
+	return messageType, isFound
+}
+
+// Validate checks that the payload is a valid encoding of the message registered for the event
+// type. Since protobuf decoding is lenient, payloads carrying fields unknown to that message are
+// considered invalid as well : they're most likely of another type.
+func(r *Registry) Validate(eventType string, payload []byte) error {
+	_, err := r.decode(eventType, payload)
+	return err
+}
+
+func(r *Registry) decode(eventType string, payload []byte) (proto.Message, error) {
+	messageType, isFound := r.MessageType(eventType)
+	if !isFound {
+		return nil, fmt.Errorf("%w %q", ErrUnknownEventType, eventType)
+	}
+
+	message := messageType.New( ).Interface( )
+	if err := proto.Unmarshal(payload, message); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrInvalidPayload, messageType.Descriptor( ).FullName( ), err)
+	}
+	if hasUnknownFields(message.ProtoReflect( )) {
+		return nil, fmt.Errorf("%w %s: unknown fields", ErrInvalidPayload, messageType.Descriptor( ).FullName( ))
+	}
+	return message, nil
+}
+
+// hasUnknownFields returns true if the message, or any message nested in it, has unknown fields.
+func hasUnknownFields(message protoreflect.Message) bool {
+	if len(message.GetUnknown( )) > 0 {
+		return true
+	}
+
+	isFound := false
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+			case field.IsMap( ):
+				if field.MapValue( ).Message( ) == nil {
+					return true
+				}
+				value.Map( ).Range(func(_ protoreflect.MapKey, value protoreflect.Value) bool {
+					isFound= hasUnknownFields(value.Message( ))
+					return !isFound
+				})
+
+			case field.Message( ) == nil:
+
+			case field.IsList( ):
+				list := value.List( )
+				for i := 0; i < list.Len( ) && !isFound; i++ {
+					isFound= hasUnknownFields(list.Get(i).Message( ))
+				}
+
+			default:
+				isFound= hasUnknownFields(value.Message( ))
+		}
+		return !isFound
+	})
+	return isFound
+}
+
+// Metadata describes an event, along with its payload.
+type Metadata struct {
+	Id string
+	Type string
+	CreatedAt time.Time
+	Headers map[string]string
+}
+
+// Wrap validates the payload against its event type, and wraps it in an encoded EventEnvelope.
+func(r *Registry) Wrap(metadata Metadata, payload []byte) ([]byte, error) {
+	if err := r.Validate(metadata.Type, payload); err != nil {
+		return nil, err
+	}
+	messageType, _ := r.MessageType(metadata.Type)
+
+	envelope := &protoc_generated.EventEnvelope{
+		Version: EnvelopeVersion,
+		Id: metadata.Id,
+		TypeUrl: typeURLPrefix + string(messageType.Descriptor( ).FullName( )),
+		PublishedAt: timestamppb.Now( ),
+		Headers: metadata.Headers,
+	}
+	envelope.Payload= &anypb.Any{ TypeUrl: envelope.TypeUrl, Value: payload }
+	if !metadata.CreatedAt.IsZero( ) {
+		envelope.CreatedAt= timestamppb.New(metadata.CreatedAt)
+	}
+
+	return proto.Marshal(envelope)
+}
+
+// Unwrap decodes an EventEnvelope, along with its payload, whose type must have been registered.
+func(r *Registry) Unwrap(encoded []byte) (*protoc_generated.EventEnvelope, proto.Message, error) {
+	envelope := &protoc_generated.EventEnvelope{ }
+	if err := proto.Unmarshal(encoded, envelope); err != nil {
+		return nil, nil, fmt.Errorf("events: invalid envelope: %w", err)
+	}
+	if envelope.Version != EnvelopeVersion {
+		return nil, nil, fmt.Errorf("%w %d", ErrUnsupportedEnvelopeVersion, envelope.Version)
+	}
+
+	fullName := envelope.GetPayload( ).MessageName( )
+
+	r.mutex.RLock( )
+	messageType, isFound := r.messageTypesByName[fullName]
+	r.mutex.RUnlock( )
+	if !isFound {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownEventType, envelope.GetPayload( ).GetTypeUrl( ))
+	}
+
+	payload := messageType.New( ).Interface( )
+	if err := envelope.Payload.UnmarshalTo(payload); err != nil {
+		return nil, nil, fmt.Errorf("%w %s: %v", ErrInvalidPayload, fullName, err)
+	}
+	return envelope, payload, nil
+}
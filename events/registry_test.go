@@ -0,0 +1,60 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	protoc_generated "github.com/Archisman-Mridha/outboxer/proto/generated"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry( )
+	registry.Register("user.registered", &protoc_generated.RegistrationStartedEvent{ })
+
+	payload, err := proto.Marshal(&protoc_generated.RegistrationStartedEvent{ Email: "archi@example.com", Username: "archi" })
+	assert.NoError(t, err)
+
+	t.Run("Validation", func(t *testing.T) {
+		assert.NoError(t, registry.Validate("user.registered", payload))
+		assert.NoError(t, registry.Validate("user.registered", nil), "an empty payload is a valid message")
+
+		assert.ErrorIs(t, registry.Validate("user.deleted", payload), ErrUnknownEventType)
+		assert.ErrorIs(t, registry.Validate("user.registered", []byte("not protobuf")), ErrInvalidPayload)
+
+		// A payload of another type.
+		otherPayload, err := proto.Marshal(&protoc_generated.EventEnvelope{ Version: 1, CreatedAt: timestamppb.Now( ) })
+		assert.NoError(t, err)
+		assert.ErrorIs(t, registry.Validate("user.registered", otherPayload), ErrInvalidPayload)
+	})
+
+	t.Run("Envelope", func(t *testing.T) {
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		encoded, err := registry.Wrap(Metadata{
+			Id: "0190c2d4-9a0e-7b3e-8f4e-3f2a1b0c9d8e",
+			Type: "user.registered",
+			CreatedAt: createdAt,
+			Headers: map[string]string{ "traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01" },
+		}, payload)
+		assert.NoError(t, err)
+
+		envelope, message, err := registry.Unwrap(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(EnvelopeVersion), envelope.Version)
+		assert.Equal(t, "0190c2d4-9a0e-7b3e-8f4e-3f2a1b0c9d8e", envelope.Id)
+		assert.Equal(t, "type.googleapis.com/outboxer.events.v1.RegistrationStartedEvent", envelope.TypeUrl)
+		assert.Equal(t, createdAt, envelope.CreatedAt.AsTime( ))
+		assert.NotNil(t, envelope.PublishedAt)
+		assert.Equal(t, "archi", message.(*protoc_generated.RegistrationStartedEvent).Username)
+
+		_, err= registry.Wrap(Metadata{ Type: "user.registered" }, []byte("not protobuf"))
+		assert.ErrorIs(t, err, ErrInvalidPayload)
+
+		_, _, err= NewRegistry( ).Unwrap(encoded)
+		assert.ErrorIs(t, err, ErrUnknownEventType)
+	})
+}
@@ -0,0 +1,86 @@
+package outboxer
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultMaxMissedPolls is the number of poll intervals after which a pipeline, which hasn't
+// completed a poll, is considered stuck.
+const DefaultMaxMissedPolls= 5
+
+// CheckReadiness pings each of the sources and the sink. It returns an error if any of those
+// connections is not alive, or if the circuit breaker of the sink is open.
+func(d *Dispatcher) CheckReadiness( ) error {
+	for _, source := range d.sources {
+		if err := source.outboxDB.Ping( ); err != nil {
+			return fmt.Errorf("source %s is not reachable: %w", source.name, err)
+		}
+	}
+
+	if err := d.mq.Ping( ); err != nil {
+		return fmt.Errorf("sink %s is not reachable: %w", d.sinkName, err)
+	}
+	if state := d.CircuitBreakerState( ); state == CircuitBreakerOpen {
+		return fmt.Errorf("circuit breaker of sink %s is %s", d.sinkName, state)
+	}
+
+	return nil
+}
+
+// CheckLiveness returns an error if the poll loop of any of the pipelines hasn't completed within
+// the last maxMissedPolls poll intervals (see WithMaxMissedPolls). Polling being paused by the
+// circuit breaker of the sink doesn't count as being stuck.
+func(d *Dispatcher) CheckLiveness( ) error {
+	d.lastPollsMutex.Lock( )
+	defer d.lastPollsMutex.Unlock( )
+
+	if d.lastPolls == nil {
+		return ErrNotStarted
+	}
+	if d.CircuitBreakerState( ) != CircuitBreakerClosed {
+		return nil
+	}
+
+	threshold := time.Duration(d.maxMissedPolls) * d.pollInterval
+	for _, source := range d.sources {
+		if sinceLastPoll := time.Since(d.lastPolls[source.name]); sinceLastPoll > threshold {
+			return fmt.Errorf("source %s hasn't been polled for %s", source.name, sinceLastPoll.Round(time.Second))
+		}
+	}
+
+	return nil
+}
+
+// markPolled records that each of the pipelines has just completed a poll.
+func(d *Dispatcher) markPolled( ) {
+	d.lastPollsMutex.Lock( )
+	defer d.lastPollsMutex.Unlock( )
+
+	if d.lastPolls == nil {
+		return
+	}
+	for _, source := range d.sources {
+		d.lastPolls[source.name]= time.Now( )
+	}
+}
+
+// livenessHooks returns the hooks which record when each of the pipelines last completed a poll.
+func(d *Dispatcher) livenessHooks( ) Hooks {
+	d.lastPollsMutex.Lock( )
+	defer d.lastPollsMutex.Unlock( )
+
+	d.lastPolls= make(map[string]time.Time, len(d.sources))
+	for _, source := range d.sources {
+		d.lastPolls[source.name]= time.Now( )
+	}
+
+	return Hooks{
+		OnPoll: func(pipeline Pipeline, duration time.Duration) {
+			d.lastPollsMutex.Lock( )
+			defer d.lastPollsMutex.Unlock( )
+
+			d.lastPolls[pipeline.Source]= time.Now( )
+		},
+	}
+}
\ No newline at end of file
@@ -0,0 +1,101 @@
+package outboxer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+type (
+	// unreachableOutboxDB is an outbox DB which can't be pinged.
+	unreachableOutboxDB struct {
+		inMemoryOutboxDB
+	}
+
+	// unreachableMQ is an MQ which can't be pinged.
+	unreachableMQ struct {
+		inMemoryMQ
+	}
+
+	// stuckOutboxDB is an outbox DB whose polls hang, until it's unblocked.
+	stuckOutboxDB struct {
+		inMemoryOutboxDB
+		unblockChan chan struct{ }
+	}
+)
+
+func(*unreachableOutboxDB) Ping( ) error { return errors.New("connection refused") }
+
+func(*unreachableMQ) Ping( ) error { return errors.New("connection refused") }
+
+func(s *stuckOutboxDB) GetMessages(*ports.GetMessagesArgs) {
+	<- s.unblockChan
+}
+
+func TestCheckReadiness(t *testing.T) {
+	dispatcher, err := New(
+		WithSource("in-memory", &inMemoryOutboxDB{ }, 10),
+		WithSink("in-memory", &inMemoryMQ{ }),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, dispatcher.CheckReadiness( ))
+
+	dispatcher, err= New(
+		WithSource("in-memory", &inMemoryOutboxDB{ }, 10),
+		WithSource("unreachable", &unreachableOutboxDB{ }, 10),
+		WithSink("in-memory", &inMemoryMQ{ }),
+	)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, dispatcher.CheckReadiness( ), "source unreachable is not reachable")
+
+	dispatcher, err= New(
+		WithSource("in-memory", &inMemoryOutboxDB{ }, 10),
+		WithSink("unreachable", &unreachableMQ{ }),
+	)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, dispatcher.CheckReadiness( ), "sink unreachable is not reachable")
+}
+
+func TestCheckLiveness(t *testing.T) {
+	ctx := context.Background( )
+
+	dispatcher, err := New(
+		WithSource("in-memory", &inMemoryOutboxDB{ }, 10),
+		WithSink("in-memory", &inMemoryMQ{ }),
+		WithPollInterval(10 * time.Millisecond),
+		WithMaxMissedPolls(3),
+	)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, dispatcher.CheckLiveness( ), ErrNotStarted)
+
+	// An idle pipeline keeps polling, so it's live.
+	assert.NoError(t, dispatcher.Start(ctx))
+	assert.Never(t, func( ) bool {
+		return dispatcher.CheckLiveness( ) != nil
+	}, 100 * time.Millisecond, 10 * time.Millisecond)
+	assert.NoError(t, dispatcher.Shutdown(ctx))
+
+	// A pipeline whose poll hangs isn't.
+	outboxDB := &stuckOutboxDB{ unblockChan: make(chan struct{ }) }
+	dispatcher, err= New(
+		WithSource("stuck", outboxDB, 10),
+		WithSink("in-memory", &inMemoryMQ{ }),
+		WithPollInterval(10 * time.Millisecond),
+		WithMaxMissedPolls(3),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dispatcher.Start(ctx))
+	assert.Eventually(t, func( ) bool {
+		return dispatcher.CheckLiveness( ) != nil
+	}, time.Second, 10 * time.Millisecond)
+	assert.ErrorContains(t, dispatcher.CheckLiveness( ), "source stuck hasn't been polled")
+
+	close(outboxDB.unblockChan)
+	assert.NoError(t, dispatcher.Shutdown(ctx))
+}
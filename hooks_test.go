@@ -0,0 +1,95 @@
+package outboxer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/transforms"
+)
+
+func TestPublishLatency(t *testing.T) {
+	const preparationTime= 50 * time.Millisecond
+
+	outboxDB := &inMemoryOutboxDB{
+		items: []*ports.ToBePublishedItem{
+			{ RowId: "1", Message: []byte("registered"), Topic: "user.registered" },
+			{ RowId: "2", Message: []byte("internal"), Topic: "user.internal" },
+		},
+	}
+
+	var (
+		mutex sync.Mutex
+		latencies= map[string]time.Duration{ }
+	)
+	relayAll(t, outboxDB, &inMemoryMQ{ },
+		// A slow step, which mustn't be accounted for in the publish latency.
+		WithTransforms(
+			transforms.TransformFunc(func(*ports.ToBePublishedItem) (bool, error) {
+				time.Sleep(preparationTime)
+				return true, nil
+			}),
+			transforms.When(transforms.MustCompile(`topic == "user.internal"`), transforms.Drop( )),
+		),
+		// relayAll registers its own hooks, which are invoked along with these.
+		WithHooks(Hooks{
+			OnPublishResult: func(pipeline Pipeline, item *ports.ToBePublishedItem, result *ports.PublishResult, latency time.Duration) {
+				mutex.Lock( )
+				latencies[result.RowId]= latency
+				mutex.Unlock( )
+			},
+		}),
+	)
+
+	mutex.Lock( )
+	defer mutex.Unlock( )
+
+	// The latency is measured from the moment the message is handed over to the MQ. The dropped
+	// message never is.
+	assert.Less(t, latencies["1"], preparationTime)
+	assert.Equal(t, time.Duration(0), latencies["2"])
+}
+
+func TestStatsInterval(t *testing.T) {
+	var (
+		polls, snapshots atomic.Int64
+		polledChan= make(chan struct{ })
+		polledOnce sync.Once
+	)
+
+	dispatcher, err := New(
+		WithSource("in-memory", &inMemoryOutboxDB{ }, 10),
+		WithSink("in-memory", &inMemoryMQ{ }),
+		WithPollInterval(time.Millisecond),
+		WithStatsInterval(time.Hour),
+		WithHooks(Hooks{
+			OnPoll: func(Pipeline, time.Duration) {
+				if polls.Add(1) >= 20 {
+					polledOnce.Do(func( ) { close(polledChan) })
+				}
+			},
+			OnStats: func(Pipeline, *ports.OutboxStats) {
+				snapshots.Add(1)
+			},
+		}),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dispatcher.Start(context.Background( )))
+	select {
+		case <- polledChan:
+
+		case <- time.After(5 * time.Second):
+			t.Error("Timed out waiting for the outbox DB to be polled")
+	}
+	assert.NoError(t, dispatcher.Shutdown(context.Background( )))
+
+	// The snapshot is taken when the pipeline starts, and then every stats interval, regardless of
+	// the polls.
+	assert.Equal(t, int64(1), snapshots.Load( ))
+}
@@ -0,0 +1,152 @@
+package dbs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	sqlc_generated "github.com/Archisman-Mridha/outboxer/inbox/adapters/dbs/sql/generated"
+	"github.com/Archisman-Mridha/outboxer/inbox/ports"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+// txContextKey is the key of the context value holding the transaction of a message handler.
+type txContextKey struct{ }
+
+type PostgresAdapter struct {
+	connection *sql.DB
+	queries *sqlc_generated.Queries
+
+	logger *slog.Logger
+
+	// ownsConnection is false when the connection was handed over by the caller. In that case, the
+	// caller is responsible for closing it.
+	ownsConnection bool
+}
+
+// NewPostgresAdapter connects to Postgres. If that fails, a *utils.ConnectionError is returned.
+func NewPostgresAdapter(uri string, logger *slog.Logger) (*PostgresAdapter, error) {
+	connection, err := utils.ConnectPostgres(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewPostgresAdapterFromConnection(connection, logger)
+	p.ownsConnection= true
+
+	p.logger.Info("Connected to Postgres")
+
+	return p, nil
+}
+
+// NewPostgresAdapterFromConnection creates a PostgresAdapter on top of an existing connection pool,
+// typically the one the handlers use. A nil logger is replaced by the default logger.
+func NewPostgresAdapterFromConnection(connection *sql.DB, logger *slog.Logger) *PostgresAdapter {
+	return &PostgresAdapter{
+		connection: connection,
+		queries: sqlc_generated.New(connection),
+
+		logger: utils.LoggerOrDefault(logger).With("inbox", "postgres"),
+	}
+}
+
+// TxFromContext returns the transaction which the message, handed over to a handler along with the
+// given context, is processed in. The changes made by the handler through it are committed along
+// with the message being marked as processed, or not at all.
+func TxFromContext(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txContextKey{ }).(*sql.Tx)
+	return tx
+}
+
+func(p *PostgresAdapter) Disconnect( ) {
+	if !p.ownsConnection {
+		return
+	}
+
+	if err := p.connection.Close( ); err != nil {
+		p.logger.Error("Error closing connection to Postgres", "error", err)
+		return
+	}
+	p.logger.Info("Closed connection to Postgres")
+}
+
+func(p *PostgresAdapter) Ping( ) error {
+	return p.connection.Ping( )
+}
+
+func(p *PostgresAdapter) Store(ctx context.Context, message *ports.Message) (bool, error) {
+	headers, err := json.Marshal(message.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	insertedRows, err := p.queries.InsertMessage(ctx, sqlc_generated.InsertMessageParams{
+		MessageID: message.MessageId,
+		Message: message.Message,
+		Topic: sql.NullString{ String: message.Topic, Valid: message.Topic != "" },
+		Headers: headers,
+	})
+	return insertedRows == 1, err
+}
+
+func(p *PostgresAdapter) ProcessNext(args *ports.ProcessNextArgs) (bool, error) {
+	tx, err := p.connection.BeginTx(args.Context, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback( )
+
+	queries := p.queries.WithTx(tx)
+
+	row, err := queries.GetNextPendingMessage(args.Context)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	message := &ports.Message{
+		MessageId: row.MessageID,
+		Message: row.Message,
+		Topic: row.Topic.String,
+		ReceivedAt: row.ReceivedOn,
+		Attempt: int(row.Attempts) + 1,
+	}
+	if err := json.Unmarshal(row.Headers, &message.Headers); err != nil {
+		p.logger.Warn("Error decoding the headers of message", "message_id", row.MessageID, "error", err)
+	}
+
+	// If the handler fails, only its changes are rolled back : the message stays locked until it's
+	// marked as failed.
+	if _, err := tx.ExecContext(args.Context, "SAVEPOINT handler"); err != nil {
+		return true, err
+	}
+	processErr := args.Process(context.WithValue(args.Context, txContextKey{ }, tx), message)
+	if processErr == nil {
+		if err := queries.MarkMessageProcessed(args.Context, row.ID); err != nil {
+			return true, err
+		}
+		return true, tx.Commit( )
+	}
+
+	if _, err := tx.ExecContext(args.Context, "ROLLBACK TO SAVEPOINT handler"); err != nil {
+		return true, err
+	}
+	err= queries.MarkMessageFailed(args.Context, sqlc_generated.MarkMessageFailedParams{
+		LastError: sql.NullString{ String: processErr.Error( ), Valid: true },
+		RetryDelaySeconds: args.RetryDelay(message.Attempt).Seconds( ),
+		MaxAttempts: int32(args.MaxAttempts),
+		ID: row.ID,
+	})
+	if err != nil {
+		return true, err
+	}
+	return true, tx.Commit( )
+}
+
+func(p *PostgresAdapter) Clean(ctx context.Context, processedBefore time.Time) (int64, error) {
+	return p.queries.DeleteProcessedMessages(ctx, processedBefore)
+}
@@ -0,0 +1,28 @@
+-- name: InsertMessage :execrows
+INSERT INTO inbox
+  (message_id, message, topic, headers)
+    VALUES (@message_id, @message, @topic, @headers)
+      ON CONFLICT (message_id) DO NOTHING;
+
+-- name: GetNextPendingMessage :one
+SELECT id, message_id, message, topic, headers, received_on, attempts FROM inbox
+  WHERE processed=FALSE AND dead_lettered=FALSE AND next_attempt_on <= CURRENT_TIMESTAMP
+    ORDER BY id
+      LIMIT 1
+        FOR UPDATE SKIP LOCKED;
+
+-- name: MarkMessageProcessed :exec
+UPDATE inbox
+  SET processed=TRUE, processed_on=CURRENT_TIMESTAMP, attempts=attempts+1, last_error=NULL
+    WHERE id = @id;
+
+-- name: MarkMessageFailed :exec
+UPDATE inbox
+  SET attempts=attempts+1, last_error=@last_error,
+    next_attempt_on=CURRENT_TIMESTAMP + make_interval(secs => @retry_delay_seconds::FLOAT8),
+    dead_lettered=(@max_attempts::INT > 0 AND attempts+1 >= @max_attempts::INT)
+      WHERE id = @id;
+
+-- name: DeleteProcessedMessages :execrows
+DELETE FROM inbox
+  WHERE processed=TRUE AND processed_on < @processed_before;
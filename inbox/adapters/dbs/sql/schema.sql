@@ -0,0 +1,26 @@
+CREATE TABLE inbox (
+  id SERIAL PRIMARY KEY,
+
+  -- Id of the message (the AMQP message id, see the producer package of outboxer). Redeliveries of
+  -- a message are only recorded once.
+  message_id TEXT NOT NULL UNIQUE,
+  message BYTEA NOT NULL,
+  -- Optional topic of the message (the AMQP type), which selects the handler processing it.
+  topic TEXT DEFAULT NULL,
+  headers JSONB NOT NULL DEFAULT '{}',
+  received_on TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  -- Number of times the message has been handed over to its handler.
+  attempts INT NOT NULL DEFAULT 0,
+  -- The message isn't processed again before that time, after failing to be processed.
+  next_attempt_on TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_error TEXT DEFAULT NULL,
+  -- Set once the message fails to be processed for the maximum number of attempts.
+  dead_lettered BOOLEAN NOT NULL DEFAULT FALSE,
+
+  processed BOOLEAN NOT NULL DEFAULT FALSE,
+  processed_on TIMESTAMPTZ DEFAULT NULL
+);
+
+-- Keeps fetching the messages due for processing cheap, since most of the rows are processed.
+CREATE INDEX inbox_pending_idx ON inbox (id) WHERE processed=FALSE AND dead_lettered=FALSE;
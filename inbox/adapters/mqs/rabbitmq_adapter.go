@@ -0,0 +1,166 @@
+package mqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+
+	"github.com/Archisman-Mridha/outboxer/inbox/ports"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+// DefaultPrefetch is the number of deliveries which RabbitMQ sends before waiting for them to be
+// acknowledged.
+const DefaultPrefetch= 32
+
+var ErrDeliveriesClosed= errors.New("rabbitmq closed the deliveries channel")
+
+type RabbitMQAdapter struct {
+	connection *amqp.Connection
+	channel *amqp.Channel
+	queueName string
+	consumerTag string
+
+	logger *slog.Logger
+
+	// ownsConnection is false when the connection was handed over by the caller. In that case, only
+	// the channel opened by the adapter is closed on Disconnect.
+	ownsConnection bool
+}
+
+// NewRabbitMQAdapter connects to RabbitMQ and declares the queue. If that fails, a
+// *utils.ConnectionError is returned.
+func NewRabbitMQAdapter(uri, queueName string, prefetch int, logger *slog.Logger) (*RabbitMQAdapter, error) {
+	connection, channel, err := utils.ConnectRabbitMQ(uri, queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newRabbitMQAdapter(connection, channel, queueName, prefetch, logger)
+	if err != nil {
+		connection.Close( )
+		return nil, err
+	}
+	r.ownsConnection= true
+
+	r.logger.Info("Connected to RabbitMQ")
+
+	return r, nil
+}
+
+// NewRabbitMQAdapterFromConnection creates a RabbitMQAdapter consuming through a new channel, on top
+// of an existing connection.
+func NewRabbitMQAdapterFromConnection(connection *amqp.Connection, queueName string, prefetch int, logger *slog.Logger) (*RabbitMQAdapter, error) {
+	channel, err := connection.Channel( )
+	if err != nil {
+		return nil, err
+	}
+	if _, err := channel.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
+		channel.Close( )
+		return nil, err
+	}
+
+	r, err := newRabbitMQAdapter(connection, channel, queueName, prefetch, logger)
+	if err != nil {
+		channel.Close( )
+		return nil, err
+	}
+	return r, nil
+}
+
+func newRabbitMQAdapter(connection *amqp.Connection, channel *amqp.Channel, queueName string, prefetch int, logger *slog.Logger) (*RabbitMQAdapter, error) {
+	if prefetch <= 0 {
+		prefetch= DefaultPrefetch
+	}
+	if err := channel.Qos(prefetch, 0, false); err != nil {
+		return nil, err
+	}
+
+	return &RabbitMQAdapter{
+		connection: connection,
+		channel: channel,
+		queueName: queueName,
+		consumerTag: "inbox-" + uuid.NewString( ),
+
+		logger: utils.LoggerOrDefault(logger).With("consumer", "rabbitmq", "queue", queueName),
+	}, nil
+}
+
+func(r *RabbitMQAdapter) Disconnect( ) {
+	if err := r.channel.Close( ); err != nil {
+		r.logger.Error("Error closing RabbitMQ channel", "error", err)
+	}
+	if !r.ownsConnection {
+		return
+	}
+
+	if err := r.connection.Close( ); err != nil {
+		r.logger.Error("Error closing connection to RabbitMQ", "error", err)
+		return
+	}
+	r.logger.Info("Closed connection to RabbitMQ")
+}
+
+func(r *RabbitMQAdapter) Ping( ) error {
+	if r.connection.IsClosed( ) {
+		return amqp.ErrClosed
+	}
+	return nil
+}
+
+func(r *RabbitMQAdapter) Consume(ctx context.Context, receive func(ctx context.Context, message *ports.Message) error) error {
+	deliveries, err := r.channel.Consume(r.queueName, r.consumerTag, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("error consuming from queue %s: %w", r.queueName, err)
+	}
+
+	for {
+		select {
+			case <- ctx.Done( ):
+				// Stops the deliveries, waiting for the one being received to be acknowledged.
+				return r.channel.Cancel(r.consumerTag, false)
+
+			case delivery, isOpen := <- deliveries:
+				if !isOpen {
+					return ErrDeliveriesClosed
+				}
+
+				if err := receive(ctx, message(delivery)); err != nil {
+					r.logger.Warn("Error receiving message, requeueing it", "message_id", delivery.MessageId, "error", err)
+
+					if err := delivery.Nack(false, true); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := delivery.Ack(false); err != nil {
+					return err
+				}
+		}
+	}
+}
+
+// message converts a delivery into a ports.Message. Deliveries without a message id get a random
+// one : their redeliveries can't be told apart.
+func message(delivery amqp.Delivery) *ports.Message {
+	messageId := delivery.MessageId
+	if messageId == "" {
+		messageId= uuid.NewString( )
+	}
+
+	headers := make(map[string]string, len(delivery.Headers))
+	for key, value := range delivery.Headers {
+		headers[key]= fmt.Sprint(value)
+	}
+
+	return &ports.Message{
+		MessageId: messageId,
+		Message: delivery.Body,
+		Topic: delivery.Type,
+		Headers: headers,
+	}
+}
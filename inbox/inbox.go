@@ -0,0 +1,280 @@
+// Package inbox implements the Transactional Inbox pattern, the mirror image of outboxer : messages
+// received from a message queue are first recorded in an inbox DB, deduplicated by message id, and
+// only then acknowledged. They're then handed over to the registered handlers, each within a
+// transaction which also marks the message as processed, and retried if the handler fails.
+//
+//	inbox, err := inbox.New(
+//		inbox.WithInboxDB(dbs.NewPostgresAdapterFromConnection(db, logger)),
+//		inbox.WithConsumer(consumer),
+//		inbox.WithHandler("user.registered", func(ctx context.Context, message *ports.Message) error {
+//			_, err := dbs.TxFromContext(ctx).ExecContext(ctx, ...)
+//			return err
+//		}),
+//	)
+//	if err != nil { ... }
+//
+//	inbox.Start(ctx)
+//	defer inbox.Shutdown(shutdownCtx)
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Archisman-Mridha/outboxer/inbox/ports"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+const (
+	DefaultPollInterval= time.Second
+
+	DefaultInitialRetryDelay= time.Second
+	DefaultMaxRetryDelay= 5 * time.Minute
+
+	// cleanInterval is how often the processed messages older than the retention are deleted.
+	cleanInterval= time.Hour
+)
+
+type (
+	// Handler processes a message. The context carries the transaction which the message is
+	// processed in (see dbs.TxFromContext) : the message is only marked as processed if the handler
+	// returns nil.
+	Handler func(ctx context.Context, message *ports.Message) error
+
+	// Inbox receives messages from a message queue (the consumer) into an inbox DB, and processes
+	// them.
+	Inbox struct {
+		inboxDB ports.InboxDB
+		consumer ports.MQConsumer
+		// handlers are registered by topic. The handler registered for the empty topic processes the
+		// messages of the other topics.
+		handlers map[string]Handler
+
+		pollInterval time.Duration
+		maxAttempts int
+		initialRetryDelay time.Duration
+		maxRetryDelay time.Duration
+		retention time.Duration
+
+		logger *slog.Logger
+
+		mutex sync.Mutex
+		isStarted bool
+		cancel context.CancelFunc
+		waitGroup *errgroup.Group
+	}
+)
+
+var (
+	ErrNoInboxDB= errors.New("inbox: an inbox DB is required")
+	ErrNoConsumer= errors.New("inbox: a consumer is required")
+	ErrNoHandlers= errors.New("inbox: at least one handler is required")
+	ErrAlreadyStarted= errors.New("inbox: inbox has already been started")
+	ErrNotStarted= errors.New("inbox: inbox has not been started")
+
+	// ErrNoHandler is returned when processing a message whose topic has no handler. The message is
+	// retried, in case the handler gets registered in the meantime (by a new release).
+	ErrNoHandler= errors.New("inbox: no handler registered for the topic")
+)
+
+// New creates an Inbox from the given options. The Inbox does not take ownership of the adapters
+// passed to it : disconnecting them is left to the caller.
+func New(options ...Option) (*Inbox, error) {
+	i := &Inbox{
+		handlers: map[string]Handler{ },
+
+		pollInterval: DefaultPollInterval,
+		initialRetryDelay: DefaultInitialRetryDelay,
+		maxRetryDelay: DefaultMaxRetryDelay,
+	}
+	for _, option := range options {
+		option(i)
+	}
+
+	if i.inboxDB == nil {
+		return nil, ErrNoInboxDB
+	}
+	if i.consumer == nil {
+		return nil, ErrNoConsumer
+	}
+	if len(i.handlers) == 0 {
+		return nil, ErrNoHandlers
+	}
+	i.logger= utils.LoggerOrDefault(i.logger)
+
+	return i, nil
+}
+
+// Start starts receiving and processing messages, in the background.
+func(i *Inbox) Start(ctx context.Context) error {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	if i.isStarted {
+		return ErrAlreadyStarted
+	}
+
+	ctx, i.cancel= context.WithCancel(ctx)
+	i.waitGroup= &errgroup.Group{ }
+
+	i.waitGroup.Go(func( ) error {
+		return i.receive(ctx)
+	})
+	i.waitGroup.Go(func( ) error {
+		i.process(ctx)
+		return nil
+	})
+	if i.retention > 0 {
+		i.waitGroup.Go(func( ) error {
+			utils.RunFnPeriodically(ctx, i.clean, ctx, cleanInterval)
+			return nil
+		})
+	}
+
+	i.isStarted= true
+
+	return nil
+}
+
+// Shutdown stops receiving messages, and waits for the message being processed, if any. If the
+// given context expires before that, its error is returned.
+func(i *Inbox) Shutdown(ctx context.Context) error {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	if !i.isStarted {
+		return ErrNotStarted
+	}
+
+	i.cancel( )
+
+	stoppedChan := make(chan error, 1)
+	go func( ) {
+		stoppedChan <- i.waitGroup.Wait( )
+	}( )
+
+	select {
+		case err := <- stoppedChan:
+			i.isStarted= false
+			return err
+
+		case <- ctx.Done( ):
+			return ctx.Err( )
+	}
+}
+
+// CheckReadiness pings the inbox DB and the consumer.
+func(i *Inbox) CheckReadiness( ) error {
+	if err := i.inboxDB.Ping( ); err != nil {
+		return fmt.Errorf("inbox DB is not reachable: %w", err)
+	}
+	if err := i.consumer.Ping( ); err != nil {
+		return fmt.Errorf("consumer is not reachable: %w", err)
+	}
+	return nil
+}
+
+// receive records the delivered messages in the inbox DB. A delivery is acknowledged only once it's
+// been recorded (or found to be a duplicate).
+func(i *Inbox) receive(ctx context.Context) error {
+	err := i.consumer.Consume(ctx, func(ctx context.Context, message *ports.Message) error {
+		isStored, err := i.inboxDB.Store(ctx, message)
+		if err != nil {
+			return err
+		}
+
+		if isStored {
+			i.logger.Debug("Received message", "message_id", message.MessageId, "topic", message.Topic)
+		} else {
+			i.logger.Debug("Skipped duplicate message", "message_id", message.MessageId, "topic", message.Topic)
+		}
+		return nil
+	})
+	if err != nil {
+		i.logger.Error("Stopped receiving messages", "error", err)
+	}
+	return err
+}
+
+// process processes the messages which are due, one after the other, until none is left. It then
+// waits for the poll interval before checking again.
+func(i *Inbox) process(ctx context.Context) {
+	args := &ports.ProcessNextArgs{
+		// Shutting down waits for the message being processed, instead of aborting its transaction.
+		Context: context.WithoutCancel(ctx),
+		Process: i.handle,
+		MaxAttempts: i.maxAttempts,
+		RetryDelay: i.retryDelay,
+	}
+
+	for {
+		isFound, err := i.inboxDB.ProcessNext(args)
+		if err != nil {
+			i.logger.Error("Error processing message", "error", err)
+		}
+
+		if isFound && err == nil {
+			select {
+				case <- ctx.Done( ):
+					return
+
+				default:
+					continue
+			}
+		}
+
+		select {
+			case <- ctx.Done( ):
+				return
+
+			case <- time.After(i.pollInterval):
+		}
+	}
+}
+
+// handle invokes the handler registered for the topic of the message.
+func(i *Inbox) handle(ctx context.Context, message *ports.Message) error {
+	handler, isFound := i.handlers[message.Topic]
+	if !isFound {
+		if handler, isFound= i.handlers[""]; !isFound {
+			return fmt.Errorf("%w %q", ErrNoHandler, message.Topic)
+		}
+	}
+
+	startedAt := time.Now( )
+	if err := handler(ctx, message); err != nil {
+		i.logger.Warn("Message wasn't processed",
+			"message_id", message.MessageId, "topic", message.Topic, "attempt", message.Attempt, "error", err,
+		)
+		return err
+	}
+
+	i.logger.Debug("Processed message",
+		"message_id", message.MessageId, "topic", message.Topic, "attempt", message.Attempt, "duration", time.Since(startedAt),
+	)
+	return nil
+}
+
+// retryDelay doubles the delay with each attempt, from the initial retry delay up to the maximum.
+func(i *Inbox) retryDelay(attempts int) time.Duration {
+	delay := i.initialRetryDelay
+	for attempt := 1; attempt < attempts && delay < i.maxRetryDelay; attempt++ {
+		delay *= 2
+	}
+	return min(delay, i.maxRetryDelay)
+}
+
+func(i *Inbox) clean(ctx context.Context) {
+	count, err := i.inboxDB.Clean(ctx, time.Now( ).Add(-i.retention))
+	if err != nil {
+		i.logger.Error("Error cleaning the inbox DB", "error", err)
+		return
+	}
+	i.logger.Info("Cleaned the inbox DB", "deleted_messages", count)
+}
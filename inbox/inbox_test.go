@@ -0,0 +1,136 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/inbox/ports"
+)
+
+type (
+	// inMemoryInboxDB is an inbox DB whose messages are due for processing right away.
+	inMemoryInboxDB struct {
+		mutex sync.Mutex
+		messages []*inMemoryMessage
+	}
+
+	inMemoryMessage struct {
+		message *ports.Message
+		isProcessed bool
+	}
+
+	// inMemoryConsumer delivers the given messages once, recording which ones were acknowledged.
+	inMemoryConsumer struct {
+		deliveries []*ports.Message
+
+		mutex sync.Mutex
+		acknowledged []string
+	}
+)
+
+func(i *inMemoryInboxDB) Disconnect( ) { }
+
+func(i *inMemoryInboxDB) Ping( ) error { return nil }
+
+func(i *inMemoryInboxDB) Store(ctx context.Context, message *ports.Message) (bool, error) {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	for _, stored := range i.messages {
+		if stored.message.MessageId == message.MessageId {
+			return false, nil
+		}
+	}
+	i.messages= append(i.messages, &inMemoryMessage{ message: message })
+	return true, nil
+}
+
+func(i *inMemoryInboxDB) ProcessNext(args *ports.ProcessNextArgs) (bool, error) {
+	i.mutex.Lock( )
+	defer i.mutex.Unlock( )
+
+	for _, stored := range i.messages {
+		if stored.isProcessed {
+			continue
+		}
+
+		stored.message.Attempt++
+		stored.isProcessed= args.Process(args.Context, stored.message) == nil
+		return true, nil
+	}
+	return false, nil
+}
+
+func(i *inMemoryInboxDB) Clean(ctx context.Context, processedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func(i *inMemoryConsumer) Disconnect( ) { }
+
+func(i *inMemoryConsumer) Ping( ) error { return nil }
+
+func(i *inMemoryConsumer) Consume(ctx context.Context, receive func(ctx context.Context, message *ports.Message) error) error {
+	for _, delivery := range i.deliveries {
+		if err := receive(ctx, delivery); err != nil {
+			continue
+		}
+
+		i.mutex.Lock( )
+		i.acknowledged= append(i.acknowledged, delivery.MessageId)
+		i.mutex.Unlock( )
+	}
+
+	<- ctx.Done( )
+	return nil
+}
+
+func TestInbox(t *testing.T) {
+	var (
+		inboxDB= &inMemoryInboxDB{ }
+		consumer= &inMemoryConsumer{
+			deliveries: []*ports.Message{
+				{ MessageId: "1", Topic: "user.registered" },
+				// A redelivery.
+				{ MessageId: "1", Topic: "user.registered" },
+				{ MessageId: "2", Topic: "user.deleted" },
+			},
+		}
+
+		mutex sync.Mutex
+		handled []string
+	)
+	handler := func(ctx context.Context, message *ports.Message) error {
+		mutex.Lock( )
+		defer mutex.Unlock( )
+
+		handled= append(handled, message.MessageId)
+
+		// The first attempt to process message 2 fails.
+		if message.MessageId == "2" && message.Attempt == 1 {
+			return errors.New("transient failure")
+		}
+		return nil
+	}
+
+	inbox, err := New(
+		WithInboxDB(inboxDB),
+		WithConsumer(consumer),
+		WithHandler("user.registered", handler),
+		WithHandler("user.deleted", handler),
+		WithPollInterval(10 * time.Millisecond),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, inbox.Start(context.Background( )))
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, inbox.Shutdown(context.Background( )))
+
+	// Every delivery is acknowledged, but the redelivery isn't processed again.
+	assert.Equal(t, []string{ "1", "1", "2" }, consumer.acknowledged)
+	assert.Equal(t, []string{ "1", "2", "2" }, handled)
+}
@@ -0,0 +1,80 @@
+package inbox
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/Archisman-Mridha/outboxer/inbox/ports"
+)
+
+// Option configures an Inbox.
+type Option func(*Inbox)
+
+// WithInboxDB sets the inbox DB in which the received messages are recorded.
+func WithInboxDB(inboxDB ports.InboxDB) Option {
+	return func(i *Inbox) {
+		i.inboxDB= inboxDB
+	}
+}
+
+// WithConsumer sets the consumer from which messages are received.
+func WithConsumer(consumer ports.MQConsumer) Option {
+	return func(i *Inbox) {
+		i.consumer= consumer
+	}
+}
+
+// WithHandler registers the handler processing the messages of the given topic. The handler
+// registered for the empty topic processes the messages of the topics without a handler.
+func WithHandler(topic string, handler Handler) Option {
+	return func(i *Inbox) {
+		i.handlers[topic]= handler
+	}
+}
+
+// WithPollInterval sets how often the inbox DB is checked for messages due for processing, once
+// there are none left. Defaults to DefaultPollInterval.
+func WithPollInterval(pollInterval time.Duration) Option {
+	return func(i *Inbox) {
+		if pollInterval > 0 {
+			i.pollInterval= pollInterval
+		}
+	}
+}
+
+// WithMaxAttempts sets the number of attempts after which a message, which fails to be processed, is
+// dead lettered. Defaults to 0, meaning that messages are retried forever.
+func WithMaxAttempts(maxAttempts int) Option {
+	return func(i *Inbox) {
+		i.maxAttempts= maxAttempts
+	}
+}
+
+// WithRetryDelay sets the delay before retrying a message which failed to be processed. It doubles
+// with each attempt, from initial up to max. Defaults to DefaultInitialRetryDelay and
+// DefaultMaxRetryDelay.
+func WithRetryDelay(initial, max time.Duration) Option {
+	return func(i *Inbox) {
+		if initial > 0 {
+			i.initialRetryDelay= initial
+		}
+		if max > 0 {
+			i.maxRetryDelay= max
+		}
+	}
+}
+
+// WithRetention sets how long the processed messages are kept, to deduplicate redeliveries, before
+// being deleted. Defaults to 0, meaning that they're kept forever.
+func WithRetention(retention time.Duration) Option {
+	return func(i *Inbox) {
+		i.retention= retention
+	}
+}
+
+// WithLogger sets the logger used by the inbox. Defaults to the default logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(i *Inbox) {
+		i.logger= logger
+	}
+}
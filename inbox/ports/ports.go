@@ -0,0 +1,79 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// InboxDB durably records the messages received from the message queue, before they're processed.
+	InboxDB interface {
+		// Disconnect closes connection to the inbox DB.
+		Disconnect( )
+
+		// Ping checks whether the connection to the inbox DB is alive.
+		Ping( ) error
+
+		// Store records the received message, unless a message with the same id has already been
+		// recorded. It returns false in that case.
+		Store(ctx context.Context, message *Message) (bool, error)
+
+		// ProcessNext locks the oldest message which is due for processing, and invokes args.Process
+		// with it, inside a transaction which also marks the message as processed. If args.Process
+		// fails, the transaction is rolled back and the message is scheduled for a retry (or dead
+		// lettered, after args.MaxAttempts attempts). It returns false if no message is due.
+		ProcessNext(args *ProcessNextArgs) (bool, error)
+
+		// Clean deletes the messages which were processed before the given time. It returns the number
+		// of deleted messages.
+		Clean(ctx context.Context, processedBefore time.Time) (int64, error)
+	}
+
+	// MQConsumer receives messages from the message queue.
+	MQConsumer interface {
+		// Disconnect cleans up connection with the message queue.
+		Disconnect( )
+
+		// Ping checks whether the connection to the message queue is alive.
+		Ping( ) error
+
+		// Consume invokes receive for each delivered message, until the given context is cancelled or
+		// the connection is lost. A message is acknowledged once receive returns nil, and requeued
+		// otherwise.
+		Consume(ctx context.Context, receive func(ctx context.Context, message *Message) error) error
+	}
+)
+
+type (
+	// Message is a message received from the message queue.
+	Message struct {
+		// MessageId identifies the message stably, across redeliveries.
+		MessageId string
+		Message []byte
+
+		// Topic selects the handler processing the message (the AMQP type in case of RabbitMQ).
+		Topic string
+		Headers map[string]string
+
+		// ReceivedAt is the time at which the message was recorded in the inbox DB.
+		ReceivedAt time.Time
+		// Attempt is the number of times the message has been handed over to its handler, including
+		// this one.
+		Attempt int
+	}
+
+	ProcessNextArgs struct {
+		Context context.Context
+
+		// Process is invoked with the message, and a context carrying the transaction which the message
+		// is processed in.
+		Process func(ctx context.Context, message *Message) error
+
+		// MaxAttempts is the number of attempts after which a message, which fails to be processed, is
+		// dead lettered. 0 means that it's retried forever.
+		MaxAttempts int
+		// RetryDelay returns how long to wait before retrying a message, which failed to be processed
+		// for the given number of attempts.
+		RetryDelay func(attempts int) time.Duration
+	}
+)
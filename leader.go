@@ -0,0 +1,105 @@
+package outboxer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/utils"
+)
+
+// DefaultLeaderElectionInterval is the interval at which the leader renews the leader lock, and the
+// standby replicas try to acquire it.
+const DefaultLeaderElectionInterval= 2 * time.Second
+
+var ErrNotLeader= errors.New("outboxer: this replica is not the leader")
+
+// IsLeader returns whether this replica is currently relaying messages. It's always true once the
+// dispatcher has started, if leader election is disabled.
+func(d *Dispatcher) IsLeader( ) bool {
+	if d.leaderLock == nil {
+		d.mutex.Lock( )
+		defer d.mutex.Unlock( )
+
+		return d.isStarted
+	}
+	return d.isLeader.Load( )
+}
+
+// CheckLeadership returns ErrNotLeader if this replica is not currently relaying messages.
+func(d *Dispatcher) CheckLeadership( ) error {
+	if !d.IsLeader( ) {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+// runLeaderElection periodically tries to acquire (or renew) the leader lock, until the given
+// context is cancelled. The pipelines are started when the leadership is acquired, and stopped as
+// soon as it's lost : a replica which can't tell whether it still holds the lock steps down.
+func(d *Dispatcher) runLeaderElection(ctx context.Context, pipelineWorkers [][]ports.MQ, hooks Hooks) error {
+	var (
+		logger= utils.LoggerOrDefault(d.logger)
+
+		// term runs the pipelines, while this replica is the leader.
+		term *errgroup.Group
+		cancelTerm context.CancelFunc
+		termErr error
+	)
+
+	stepDown := func( ) {
+		cancelTerm( )
+		if err := term.Wait( ); err != nil {
+			termErr= err
+		}
+		term= nil
+
+		d.isLeader.Store(false)
+	}
+
+	ticker := time.NewTicker(d.leaderElectionInterval)
+	defer ticker.Stop( )
+
+	for {
+		isLeader, err := d.leaderLock.TryAcquire( )
+		if err != nil {
+			logger.Warn("Error acquiring the leader lock", "error", err)
+		}
+
+		switch {
+			case isLeader && term == nil:
+				logger.Info("Acquired leadership, relaying messages")
+
+				termCtx, cancel := context.WithCancel(ctx)
+				cancelTerm= cancel
+				term= &errgroup.Group{ }
+
+				d.isLeader.Store(true)
+				d.startPipelines(termCtx, term, pipelineWorkers, hooks)
+
+			case !isLeader && term != nil:
+				logger.Warn("Lost leadership, stopped relaying messages")
+				stepDown( )
+
+			case !isLeader:
+				// A standby replica doesn't poll the sources, but is alive nonetheless.
+				d.markPolled( )
+		}
+
+		select {
+			case <- ctx.Done( ):
+				if term != nil {
+					stepDown( )
+				}
+				if err := d.leaderLock.Release( ); err != nil {
+					logger.Warn("Error releasing the leader lock", "error", err)
+				}
+				return termErr
+
+			case <- ticker.C:
+		}
+	}
+}
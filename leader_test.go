@@ -0,0 +1,110 @@
+package outboxer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+type (
+	// inMemoryLease is the state shared by the leader locks of the replicas.
+	inMemoryLease struct {
+		mutex sync.Mutex
+		holder string
+	}
+
+	// inMemoryLeaderLock is the leader lock of a single replica.
+	inMemoryLeaderLock struct {
+		lease *inMemoryLease
+		replica string
+	}
+)
+
+func(i *inMemoryLeaderLock) TryAcquire( ) (bool, error) {
+	i.lease.mutex.Lock( )
+	defer i.lease.mutex.Unlock( )
+
+	if i.lease.holder == "" {
+		i.lease.holder= i.replica
+	}
+	return i.lease.holder == i.replica, nil
+}
+
+func(i *inMemoryLeaderLock) Release( ) error {
+	i.lease.mutex.Lock( )
+	defer i.lease.mutex.Unlock( )
+
+	if i.lease.holder == i.replica {
+		i.lease.holder= ""
+	}
+	return nil
+}
+
+// publishedItems returns the messages published to the given MQ so far.
+func publishedItems(mq *inMemoryMQ) []*ports.ToBePublishedItem {
+	mq.mutex.Lock( )
+	defer mq.mutex.Unlock( )
+
+	return append([]*ports.ToBePublishedItem{ }, mq.published...)
+}
+
+func TestLeaderElection(t *testing.T) {
+	var (
+		lease= &inMemoryLease{ }
+		outboxDB= &inMemoryOutboxDB{ }
+
+		leaderMQ= &inMemoryMQ{ }
+		standbyMQ= &inMemoryMQ{ }
+	)
+
+	newReplica := func(name string, mq ports.MQ) *Dispatcher {
+		dispatcher, err := New(
+			WithSource("in-memory", outboxDB, 10),
+			WithSink("in-memory", mq),
+			WithPollInterval(10 * time.Millisecond),
+			WithLeaderElection(&inMemoryLeaderLock{ lease: lease, replica: name }, 10 * time.Millisecond),
+		)
+		assert.NoError(t, err)
+		return dispatcher
+	}
+	enqueue := func(rowId string) {
+		outboxDB.mutex.Lock( )
+		defer outboxDB.mutex.Unlock( )
+
+		outboxDB.items= append(outboxDB.items, &ports.ToBePublishedItem{ RowId: rowId, Message: []byte(rowId) })
+	}
+
+	leader := newReplica("leader", leaderMQ)
+	assert.NoError(t, leader.Start(context.Background( )))
+	time.Sleep(50 * time.Millisecond)
+
+	standby := newReplica("standby", standbyMQ)
+	assert.NoError(t, standby.Start(context.Background( )))
+	defer standby.Shutdown(context.Background( ))
+
+	enqueue("1")
+	time.Sleep(100 * time.Millisecond)
+
+	// Only the leader relays messages, while the standby replica stays alive.
+	assert.True(t, leader.IsLeader( ))
+	assert.False(t, standby.IsLeader( ))
+	assert.NoError(t, standby.CheckLiveness( ))
+	assert.Len(t, publishedItems(leaderMQ), 1)
+	assert.Empty(t, publishedItems(standbyMQ))
+
+	// The standby replica takes over once the leader is gone.
+	assert.NoError(t, leader.Shutdown(context.Background( )))
+	enqueue("2")
+	time.Sleep(100 * time.Millisecond)
+
+	assert.True(t, standby.IsLeader( ))
+	assert.Len(t, publishedItems(leaderMQ), 1)
+	if published := publishedItems(standbyMQ); assert.Len(t, published, 1) {
+		assert.Equal(t, "2", published[0].RowId)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package outboxer
 
 import (
 	"context"
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
@@ -51,7 +52,10 @@ func TestMessageDispatcher(t *testing.T) {
 	}( )
 
 	// Establish connection with RabbitMQ.
-	var mqConnection, mqChannel = utils.ConnectRabbitMQ(MQ_URI, MQ_QUEUE_NAME)
+	mqConnection, mqChannel, err := utils.ConnectRabbitMQ(MQ_URI, MQ_QUEUE_NAME)
+	if err != nil {
+		t.Fatalf("❌ Error connecting to RabbitMQ: %v", err)
+	}
 	defer func( ) {
 		mqChannel.Close( )
 		mqConnection.Close( )
@@ -72,12 +76,15 @@ func TestMessageDispatcher(t *testing.T) {
 	t.Run("🧪 outboxer should propagate the message from Redis to RabbitMQ successfully", func(t *testing.T) {
 		testFnTemplate(t, "redis", mqChannel,
 			func( ) {
-				client := utils.ConnectRedis(&redis.Options{
+				client, err := utils.ConnectRedis(&redis.Options{
 					Addr: REDIS_URI,
 					Password: REDIS_PASSWORD,
 				})
+				if err != nil {
+					log.Fatalf("❌ Error connecting to Redis: %v", err)
+				}
 
-				_, err := client.XAdd(&redis.XAddArgs{
+				_, err= client.XAdd(&redis.XAddArgs{
 					Stream: "outbox",
 					Values: map[string]interface{}{ "message": message },
 				}).Result( )
@@ -89,10 +96,13 @@ func TestMessageDispatcher(t *testing.T) {
 	})
 
 	t.Run("🧪 outboxer should propagate the message from Postgres to RabbitMQ successfully", func(t *testing.T) {
-		postgresConnection := utils.ConnectPostgres(POSTGRES_URI)
+		postgresConnection, err := utils.ConnectPostgres(POSTGRES_URI)
+		if err != nil {
+			t.Fatalf("❌ Error connecting to Postgres: %v", err)
+		}
 		postgresQuerier := sqlc_generated.New(postgresConnection)
 
-		if err := postgresQuerier.InsertMessage(context.Background( ), message); err != nil {
+		if err := postgresQuerier.InsertMessage(context.Background( ), sqlc_generated.InsertMessageParams{ MessageID: uuid.Must(uuid.NewV7( )), Message: message }); err != nil {
 			t.Errorf("❌ Error inserting message into database: %v", err )
 		}
 
@@ -0,0 +1,279 @@
+package outboxer
+
+import (
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/domain/usecases"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+)
+
+// Option configures a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithSource registers an outbox DB from which messages will be relayed. The name identifies the
+// source in hooks. Each source is polled independently.
+func WithSource(name string, outboxDB ports.OutboxDB, batchSize int) Option {
+	return func(d *Dispatcher) {
+		d.sources= append(d.sources, source{
+			name: name,
+			outboxDB: outboxDB,
+			batchSize: batchSize,
+		})
+	}
+}
+
+// WithSink sets the message queue to which the messages will be published. The name identifies
+// the sink in hooks.
+func WithSink(name string, mq ports.MQ) Option {
+	return func(d *Dispatcher) {
+		d.sinkName= name
+		d.mq= mq
+	}
+}
+
+// WithPollInterval sets how often the sources are polled for unpublished messages.
+func WithPollInterval(pollInterval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.pollInterval= pollInterval
+	}
+}
+
+// WithMaxAttempts sets the number of attempts after which a message, which fails to be published,
+// is dead lettered : it isn't fetched anymore, until it's requeued using the outboxer CLI. By
+// default, messages are retried forever.
+func WithMaxAttempts(maxAttempts int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts= maxAttempts
+	}
+}
+
+// WithRetention sets how long the published messages are kept in the sources, so that they can be
+// replayed (see Replay). By default, they're cleaned by the next cleanup (see WithCleanInterval).
+func WithRetention(retention time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.retention= retention
+	}
+}
+
+// WithCleanInterval sets how often the published messages, older than the retention, are cleaned
+// from the sources. Defaults to a minute.
+func WithCleanInterval(cleanInterval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.cleanInterval= cleanInterval
+	}
+}
+
+// WithStatsInterval sets how often a snapshot of the state of the sources (backlog and locked
+// messages) is taken, for the OnStats hook. Defaults to 15 seconds.
+func WithStatsInterval(statsInterval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.statsInterval= statsInterval
+	}
+}
+
+// WithCleanBatchSize sets the number of rows deleted at once when cleaning the sources, so that
+// large deletions don't lock the outbox DB for long. Defaults to 1000.
+func WithCleanBatchSize(cleanBatchSize int) Option {
+	return func(d *Dispatcher) {
+		d.cleanBatchSize= cleanBatchSize
+	}
+}
+
+// WithArchive makes the cleaned messages be moved to the outbox_history table (partitioned by
+// month) instead of being deleted. It's only supported by Postgres.
+func WithArchive(archive bool) Option {
+	return func(d *Dispatcher) {
+		d.archive= archive
+	}
+}
+
+// WithBatchMode makes each fetched batch of messages be published at once (waiting for all the
+// publisher confirms at the end, in case of RabbitMQ), and their publish status be updated at once
+// (a single UPDATE in case of Postgres, a single XACK in case of Redis), instead of one message at
+// a time. The sink must implement ports.BatchMQ and the sources ports.BatchOutboxDB.
+func WithBatchMode(batchMode bool) Option {
+	return func(d *Dispatcher) {
+		d.batchMode= batchMode
+	}
+}
+
+// WithWorkers sets the number of workers publishing the messages of each source concurrently, so
+// that a slow round trip to the sink doesn't stall the whole pipeline. Defaults to 1.
+func WithWorkers(workers int) Option {
+	return func(d *Dispatcher) {
+		d.workers= workers
+	}
+}
+
+// WithKeyOrdering makes the messages sharing the same key (the aggregate_key column in Postgres,
+// field in Redis) be published by the same worker, in the order in which they were fetched.
+func WithKeyOrdering(keyOrdering bool) Option {
+	return func(d *Dispatcher) {
+		d.keyOrdering= keyOrdering
+	}
+}
+
+// WithMaxInFlight bounds the number of messages of each source which have been fetched, but not
+// acknowledged yet. Once it's reached, polling waits for the in-flight messages to be acknowledged.
+// Defaults to 0, meaning no bound.
+func WithMaxInFlight(maxInFlight int) Option {
+	return func(d *Dispatcher) {
+		d.maxInFlight= maxInFlight
+	}
+}
+
+// WithRateLimit bounds the rate at which messages are published to the sink, in messages and in
+// bytes (of message body) per second, across all the sources. A rate of 0 means no limit.
+func WithRateLimit(messagesPerSecond, bytesPerSecond float64) Option {
+	return func(d *Dispatcher) {
+		if messagesPerSecond <= 0 && bytesPerSecond <= 0 {
+			d.rateLimiter= nil
+			return
+		}
+		d.rateLimiter= usecases.NewRateLimiter(messagesPerSecond, bytesPerSecond)
+	}
+}
+
+// WithCircuitBreaker stops fetching messages from the sources once publishing to the sink fails
+// options.FailureThreshold times in a row. After options.OpenTimeout, a few probe messages are
+// fetched : fetching resumes if they're published, and stops again otherwise. State changes are
+// logged, and Dispatcher.CheckReadiness fails while the circuit breaker is open.
+func WithCircuitBreaker(options CircuitBreakerOptions) Option {
+	return func(d *Dispatcher) {
+		onStateChange := options.OnStateChange
+		options.OnStateChange= func(from, to CircuitBreakerState) {
+			d.onCircuitBreakerStateChange(from, to)
+			if onStateChange != nil {
+				onStateChange(from, to)
+			}
+		}
+		d.circuitBreaker= usecases.NewCircuitBreaker(options)
+	}
+}
+
+// WithTransforms applies the transforms in order to the fetched messages, before anything else
+// alters them (see the transforms package for the built-in ones). Dropped messages are marked as
+// published without being published, and rejected ones are dead lettered right away.
+func WithTransforms(transforms ...ports.Transform) Option {
+	return func(d *Dispatcher) {
+		d.transforms= append(d.transforms, transforms...)
+	}
+}
+
+// WithSchemaRegistry attaches to each message the id of the latest version of its schema, as the
+// outboxer-schema-id header. The subject of the schema is the full name of the protobuf message
+// registered for the topic of the message (see WithEventValidation), or the topic itself.
+func WithSchemaRegistry(registry *schemas.Registry) Option {
+	return func(d *Dispatcher) {
+		d.schemaRegistry= registry
+	}
+}
+
+// WithEventValidation rejects the messages whose payload doesn't match the protobuf type registered
+// for their topic : they're dead lettered right away, without being published. Valid messages can
+// also be wrapped in an EventEnvelope, before the CloudEvents envelope if any.
+func WithEventValidation(validation EventValidation) Option {
+	return func(d *Dispatcher) {
+		d.eventValidation= &validation
+	}
+}
+
+// WithCloudEvents wraps the published messages in CloudEvents (v1.0), populated from the outbox
+// metadata, in either the binary or the structured content mode. In binary mode, the attributes are
+// sent as headers prefixed according to the protocol binding of the sink.
+func WithCloudEvents(envelope CloudEventsEnvelope) Option {
+	return func(d *Dispatcher) {
+		d.cloudEvents= &envelope
+	}
+}
+
+// WithCompression compresses the messages larger than the threshold of the compressor, right
+// before publishing them. The messages already compressed by the producer are published as they
+// are. The encoding is published as the content encoding of the messages, so that consumers can
+// decode them with compression.Decode.
+func WithCompression(compressor compression.Compressor) Option {
+	return func(d *Dispatcher) {
+		d.compressor= &compressor
+	}
+}
+
+// WithDecryption decrypts the messages encrypted by the producer (see the encryption package) with
+// the keys of the provider, before publishing them. Otherwise, encrypted messages are published as
+// they are, with the id of their key as the outboxer-encryption-key-id header, for consumers to
+// decrypt them.
+func WithDecryption(provider encryption.KeyProvider) Option {
+	return func(d *Dispatcher) {
+		d.decryptor= &encryption.Encryptor{ Provider: provider }
+	}
+}
+
+// WithClaimCheck offloads the messages larger than the threshold to the blob store, once they're
+// ready to be published (after being compressed, if they are). A claimcheck.Reference to the message,
+// carrying its checksum, is published instead, for consumers to resolve it with a
+// claimcheck.Resolver. Messages which fail to be offloaded are retried.
+func WithClaimCheck(claimCheck ClaimCheck) Option {
+	return func(d *Dispatcher) {
+		d.claimCheck= &claimCheck
+	}
+}
+
+// WithLeaderElection makes the dispatcher relay messages only while it holds the given lock, so that
+// a single replica relays messages at a time. The lock is renewed (by the leader) or tried (by the
+// standby replicas) every interval, which bounds the time a standby replica takes to notice that
+// the leader died. Defaults to DefaultLeaderElectionInterval, when the interval is 0.
+func WithLeaderElection(lock ports.LeaderLock, interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.leaderLock= lock
+		if interval > 0 {
+			d.leaderElectionInterval= interval
+		}
+	}
+}
+
+// WithMaxMissedPolls sets the number of poll intervals after which a pipeline, which hasn't
+// completed a poll, makes Dispatcher.CheckLiveness fail.
+func WithMaxMissedPolls(maxMissedPolls int) Option {
+	return func(d *Dispatcher) {
+		d.maxMissedPolls= maxMissedPolls
+	}
+}
+
+// WithHooks registers callbacks to be invoked by the dispatcher, for logging and metrics. It can be
+// used multiple times : the hooks are invoked in the order in which they were registered.
+func WithHooks(hooks Hooks) Option {
+	return func(d *Dispatcher) {
+		d.hooks= append(d.hooks, hooks)
+	}
+}
+
+// WithLogger sets the logger used by the dispatcher. Each pipeline enriches it with the pipeline,
+// source and sink fields. Defaults to the default logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(d *Dispatcher) {
+		d.logger= logger
+	}
+}
+
+// WithTracerProvider sets the tracer provider used to create spans for fetching, publishing and
+// acknowledging messages. Defaults to the global tracer provider.
+func WithTracerProvider(tracerProvider trace.TracerProvider) Option {
+	return func(d *Dispatcher) {
+		d.tracerProvider= tracerProvider
+	}
+}
+
+// WithPropagator sets the propagator used to extract the trace context stored along with each
+// message, and to inject the trace context into the published message. Defaults to the W3C trace
+// context propagator.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(d *Dispatcher) {
+		d.propagator= propagator
+	}
+}
\ No newline at end of file
@@ -0,0 +1,321 @@
+// Package outboxer relays messages written to an outbox DB (following the Transactional Outbox
+// pattern) to a message queue.
+//
+// Besides the standalone binary (see cmd/outboxer), the relay can be embedded inside a service, on
+// top of the connections which that service already has :
+//
+//	dispatcher, err := outboxer.New(
+//		outboxer.WithSource("postgres", dbs.NewPostgresAdapterFromConnection(db, logger), 10),
+//		outboxer.WithSink("rabbitmq", mq),
+//	)
+//	if err != nil { ... }
+//
+//	dispatcher.Start(ctx)
+//	defer dispatcher.Shutdown(shutdownCtx)
+package outboxer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/domain/usecases"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+)
+
+type (
+	// Hooks are optional callbacks invoked by the dispatcher, which can be used to plug in logging and
+	// metrics.
+	Hooks= usecases.Hooks
+
+	// Pipeline identifies the source and the sink, which a set of hooks is being invoked for.
+	Pipeline= usecases.Pipeline
+
+	// Dispatcher relays messages from one or more outbox DBs (sources) to a message queue (sink).
+	Dispatcher struct {
+		sources []source
+		sinkName string
+		mq ports.MQ
+
+		pollInterval time.Duration
+		maxAttempts int
+		retention time.Duration
+		cleanInterval time.Duration
+		cleanBatchSize int
+		archive bool
+		statsInterval time.Duration
+		batchMode bool
+
+		workers int
+		keyOrdering bool
+		maxInFlight int
+		rateLimiter *usecases.RateLimiter
+		circuitBreaker *usecases.CircuitBreaker
+
+		transforms []ports.Transform
+		schemaRegistry *schemas.Registry
+		eventValidation *usecases.EventValidation
+		cloudEvents *usecases.CloudEventsEnvelope
+		decryptor *encryption.Encryptor
+		compressor *compression.Compressor
+		claimCheck *usecases.ClaimCheck
+		// workerMQs are the message queues created for the publisher workers, which are disconnected
+		// on shutdown.
+		workerMQs []ports.MQ
+		hooks []Hooks
+
+		logger *slog.Logger
+
+		tracerProvider trace.TracerProvider
+		propagator propagation.TextMapPropagator
+
+		// leaderLock is set when leader election is enabled (see WithLeaderElection).
+		leaderLock ports.LeaderLock
+		leaderElectionInterval time.Duration
+		isLeader atomic.Bool
+
+		maxMissedPolls int
+		lastPollsMutex sync.Mutex
+		lastPolls map[string]time.Time
+
+		mutex sync.Mutex
+		isStarted bool
+		cancel context.CancelFunc
+		waitGroup *errgroup.Group
+	}
+
+	source struct {
+		name string
+		outboxDB ports.OutboxDB
+		batchSize int
+	}
+)
+
+var (
+	ErrNoSources= errors.New("outboxer: at least one source is required")
+	ErrNoSink= errors.New("outboxer: a sink is required")
+	ErrAlreadyStarted= errors.New("outboxer: dispatcher has already been started")
+	ErrNotStarted= errors.New("outboxer: dispatcher has not been started")
+	ErrBatchModeNotSupported= errors.New("outboxer: batch mode is not supported by the sink or one of the sources")
+)
+
+// New creates a Dispatcher from the given options. The Dispatcher does not take ownership of the
+// adapters passed to it : disconnecting them is left to the caller.
+func New(options ...Option) (*Dispatcher, error) {
+	d := &Dispatcher{
+		pollInterval: usecases.DefaultPollInterval,
+		leaderElectionInterval: DefaultLeaderElectionInterval,
+		maxMissedPolls: DefaultMaxMissedPolls,
+	}
+	for _, option := range options {
+		option(d)
+	}
+
+	if len(d.sources) == 0 {
+		return nil, ErrNoSources
+	}
+	if d.mq == nil {
+		return nil, ErrNoSink
+	}
+
+	if d.batchMode {
+		if _, isBatchMQ := d.mq.(ports.BatchMQ); !isBatchMQ {
+			return nil, ErrBatchModeNotSupported
+		}
+		for _, source := range d.sources {
+			if _, isBatchOutboxDB := source.outboxDB.(ports.BatchOutboxDB); !isBatchOutboxDB {
+				return nil, ErrBatchModeNotSupported
+			}
+		}
+	}
+
+	if d.cloudEvents != nil {
+		var err error
+		if d.cloudEvents, err= resolveCloudEventsEnvelope(*d.cloudEvents, d.mq); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.compressor != nil {
+		if _, err := compression.NewCompressor(d.compressor.Encoding, d.compressor.Threshold); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Start starts relaying messages, in the background, for each of the sources. The given context
+// only bounds the lifetime of the dispatcher : cancelling it has the same effect as calling
+// Shutdown, except that it doesn't wait for the in-flight messages to be drained.
+func(d *Dispatcher) Start(ctx context.Context) error {
+	d.mutex.Lock( )
+	defer d.mutex.Unlock( )
+
+	if d.isStarted {
+		return ErrAlreadyStarted
+	}
+
+	pipelineWorkers, err := d.newWorkers( )
+	if err != nil {
+		return err
+	}
+
+	ctx, d.cancel= context.WithCancel(ctx)
+	d.waitGroup= &errgroup.Group{ }
+
+	hooks := usecases.MergeHooks(append([]Hooks{ d.livenessHooks( ) }, d.hooks...)...)
+
+	if d.leaderLock == nil {
+		d.startPipelines(ctx, d.waitGroup, pipelineWorkers, hooks)
+	} else {
+		d.waitGroup.Go(func( ) error {
+			return d.runLeaderElection(ctx, pipelineWorkers, hooks)
+		})
+	}
+
+	d.isStarted= true
+
+	return nil
+}
+
+// startPipelines starts relaying messages, in the background, for each of the sources, until the
+// given context is cancelled.
+func(d *Dispatcher) startPipelines(ctx context.Context, waitGroup *errgroup.Group, pipelineWorkers [][]ports.MQ, hooks Hooks) {
+	usecasesLayer := &usecases.Usecases{ }
+	for i, source := range d.sources {
+		usecasesLayer.Run(usecases.RunArgs{
+			Context: ctx,
+			WaitGroup: waitGroup,
+
+			Pipeline: Pipeline{
+				Source: source.name,
+				Sink: d.sinkName,
+			},
+
+			OutboxDB: source.outboxDB,
+			BatchSize: source.batchSize,
+			PollInterval: d.pollInterval,
+			MaxAttempts: d.maxAttempts,
+			Retention: d.retention,
+			CleanInterval: d.cleanInterval,
+			CleanBatchSize: d.cleanBatchSize,
+			Archive: d.archive,
+			StatsInterval: d.statsInterval,
+
+			BatchMode: d.batchMode,
+
+			MQ: d.mq,
+			Workers: pipelineWorkers[i],
+			KeyOrdering: d.keyOrdering,
+			MaxInFlight: d.maxInFlight,
+
+			RateLimiter: d.rateLimiter,
+			CircuitBreaker: d.circuitBreaker,
+
+			Steps: usecases.Steps{
+				Decryptor: d.decryptor,
+				Transforms: d.transforms,
+				SchemaIds: newSchemaIds(d.schemaRegistry, d.eventValidation),
+				EventValidation: d.eventValidation,
+				CloudEvents: d.cloudEvents,
+				Compressor: d.compressor,
+				ClaimCheck: d.claimCheck,
+			},
+
+			Hooks: hooks,
+
+			Logger: d.logger,
+
+			TracerProvider: d.tracerProvider,
+			Propagator: d.propagator,
+		})
+	}
+}
+
+// Shutdown stops polling the sources and waits for the messages which are already in flight to be
+// published and acknowledged. If the given context expires before that, its error is returned.
+func(d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mutex.Lock( )
+	defer d.mutex.Unlock( )
+
+	if !d.isStarted {
+		return ErrNotStarted
+	}
+
+	d.cancel( )
+
+	drainedChan := make(chan error, 1)
+	go func( ) {
+		drainedChan <- d.waitGroup.Wait( )
+	}( )
+
+	select {
+		case err := <- drainedChan:
+			d.isStarted= false
+			d.disconnectWorkers( )
+			return err
+
+		case <- ctx.Done( ):
+			return ctx.Err( )
+	}
+}
+
+// newWorkers returns the message queues used by the publisher workers of each pipeline. When the
+// sink implements ports.WorkerMQ, each worker gets its own (an AMQP channel, in case of RabbitMQ),
+// so that the pipelines of several sources don't publish through the same one either. Otherwise,
+// the sink is shared by the workers.
+func(d *Dispatcher) newWorkers( ) ([][]ports.MQ, error) {
+	pipelineWorkers := make([][]ports.MQ, len(d.sources))
+	if d.workers <= 1 && len(d.sources) == 1 {
+		return pipelineWorkers, nil
+	}
+
+	workers := d.workers
+	if workers < 1 {
+		workers= 1
+	}
+
+	workerMQ, isWorkerMQ := d.mq.(ports.WorkerMQ)
+	for i := range d.sources {
+		for j := 0; j < workers; j++ {
+			if !isWorkerMQ {
+				pipelineWorkers[i]= append(pipelineWorkers[i], d.mq)
+				continue
+			}
+
+			worker, err := workerMQ.NewWorker( )
+			if err != nil {
+				d.disconnectWorkers( )
+				return nil, fmt.Errorf("outboxer: error creating publisher worker: %w", err)
+			}
+			d.workerMQs= append(d.workerMQs, worker)
+
+			if _, isBatchMQ := worker.(ports.BatchMQ); d.batchMode && !isBatchMQ {
+				d.disconnectWorkers( )
+				return nil, ErrBatchModeNotSupported
+			}
+			pipelineWorkers[i]= append(pipelineWorkers[i], worker)
+		}
+	}
+
+	return pipelineWorkers, nil
+}
+
+func(d *Dispatcher) disconnectWorkers( ) {
+	for _, worker := range d.workerMQs {
+		worker.Disconnect( )
+	}
+	d.workerMQs= nil
+}
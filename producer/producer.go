@@ -0,0 +1,142 @@
+// Package producer enqueues messages into the outbox DB, for outboxer to relay them. Each message is
+// given a stable id (a UUIDv7) when it's enqueued, which consumers can deduplicate messages by (see
+// the dedup package).
+package producer
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+
+	"github.com/Archisman-Mridha/outboxer"
+	"github.com/Archisman-Mridha/outboxer/adapters/dbs"
+	sqlc_generated "github.com/Archisman-Mridha/outboxer/adapters/dbs/sql/generated"
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+)
+
+// Message is a message to be enqueued into the outbox DB.
+type Message struct {
+	Body []byte
+
+	// Topic optionally categorizes the message (published as the AMQP type).
+	Topic string
+	// Key optionally identifies the aggregate which the message is about (see key ordering and
+	// sharding).
+	Key string
+
+	// DeliverAfter optionally delays the message : it isn't published before that time. Key ordering
+	// isn't guaranteed between a scheduled message and the other messages of its key.
+	DeliverAfter time.Time
+
+	// Compressor optionally compresses the body, if it's larger than the threshold of the compressor.
+	// The encoding is stored along with the message, and published as its content encoding.
+	Compressor *compression.Compressor
+	// Encryptor optionally encrypts the body (after compressing it), so that it isn't stored in
+	// plaintext.
+	Encryptor *encryption.Encryptor
+}
+
+// NewMessageId returns a new message id. UUIDv7s are used, so that message ids are ordered by
+// creation time, which keeps the indexes of deduplication stores compact.
+func NewMessageId( ) (uuid.UUID, error) {
+	return uuid.NewV7( )
+}
+
+// EnqueueInPostgres inserts the message into the outbox table, through tx : typically the
+// transaction which also persists the change the message is about. The trace context of ctx is
+// stored along with the message. It returns the id of the message.
+func EnqueueInPostgres(ctx context.Context, tx sqlc_generated.DBTX, message Message) (string, error) {
+	messageId, err := NewMessageId( )
+	if err != nil {
+		return "", err
+	}
+
+	body, contentEncoding, err := message.encode(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	err= sqlc_generated.New(tx).InsertMessage(ctx, sqlc_generated.InsertMessageParams{
+		MessageID: messageId,
+		Message: body,
+		Traceparent: nullString(outboxer.TraceParent(ctx)),
+		Topic: nullString(message.Topic),
+		AggregateKey: nullString(message.Key),
+		ContentEncoding: nullString(contentEncoding),
+		DeliverAfter: sql.NullTime{ Time: message.DeliverAfter, Valid: !message.DeliverAfter.IsZero( ) },
+	})
+	if err != nil {
+		return "", err
+	}
+	return messageId.String( ), nil
+}
+
+// EnqueueInRedis adds the message to the outbox stream, or to the schedule if its delivery time is
+// yet to come. To enqueue it atomically along with other writes, pass the pipeline of
+// redis.Client.TxPipelined : the error is then reported when the pipeline is executed. The trace
+// context of ctx is stored along with the message. It returns the id of the message.
+func EnqueueInRedis(ctx context.Context, client redis.Cmdable, message Message) (string, error) {
+	messageId, err := NewMessageId( )
+	if err != nil {
+		return "", err
+	}
+
+	body, contentEncoding, err := message.encode(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	values := map[string]interface{ }{
+		"message_id": messageId.String( ),
+		"message": body,
+	}
+	if traceParent := outboxer.TraceParent(ctx); traceParent != "" {
+		values["traceparent"]= traceParent
+	}
+	if message.Topic != "" {
+		values["topic"]= message.Topic
+	}
+	if message.Key != "" {
+		values["aggregate_key"]= message.Key
+	}
+	if contentEncoding != "" {
+		values["content_encoding"]= contentEncoding
+	}
+
+	if message.DeliverAfter.After(time.Now( )) {
+		err= dbs.ScheduleRedisMessage(client, messageId.String( ), values, message.DeliverAfter)
+	} else {
+		err= client.XAdd(&redis.XAddArgs{ Stream: dbs.OutboxStreamName, Values: values }).Err( )
+	}
+	if err != nil {
+		return "", err
+	}
+	return messageId.String( ), nil
+}
+
+// encode returns the body to be stored, compressed and encrypted if needed, along with its encoding.
+func(m *Message) encode(ctx context.Context) ([]byte, string, error) {
+	body, contentEncoding := m.Body, ""
+	if m.Compressor != nil {
+		var err error
+		if body, contentEncoding, err= m.Compressor.Compress(body); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if m.Encryptor != nil {
+		var err error
+		if body, err= m.Encryptor.Encrypt(ctx, body); err != nil {
+			return nil, "", err
+		}
+	}
+	return body, contentEncoding, nil
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{ String: value, Valid: value != "" }
+}
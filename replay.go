@@ -0,0 +1,82 @@
+package outboxer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Archisman-Mridha/outboxer/compression"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/domain/usecases"
+	"github.com/Archisman-Mridha/outboxer/encryption"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+)
+
+type (
+	// ReplayFilter selects the published messages to be replayed, by creation time, row id range or
+	// topic.
+	ReplayFilter= ports.ReplayFilter
+
+	// ReplayResult counts the replayed messages.
+	ReplayResult= usecases.ReplayResult
+
+	// ReplayOptions makes the replayed messages go through the same steps as the relayed ones (see
+	// WithTransforms, WithSchemaRegistry, WithEventValidation, WithCloudEvents, WithDecryption,
+	// WithCompression and WithClaimCheck).
+	ReplayOptions struct {
+		// SourceName is the name of the source, which the default source of the CloudEvents is derived
+		// from (like with WithSource).
+		SourceName string
+
+		Transforms []ports.Transform
+		SchemaRegistry *schemas.Registry
+		EventValidation *EventValidation
+		CloudEvents *CloudEventsEnvelope
+		Decryptor *encryption.Encryptor
+		Compressor *compression.Compressor
+		ClaimCheck *ClaimCheck
+	}
+)
+
+// ReplayedHeader is set on every replayed message, so that consumers can tell replays apart.
+const ReplayedHeader= usecases.ReplayedHeader
+
+// Replay re-publishes the messages of the source, which have already been published and are still
+// retained (see WithRetention), to the given sink. The sink can be the one the messages were
+// originally published to, or a different one. The publish status of the messages isn't altered.
+// The options can be nil.
+func Replay(ctx context.Context, source ports.OutboxReplayer, sink ports.MQ, filter ReplayFilter, options *ReplayOptions, logger *slog.Logger) (*ReplayResult, error) {
+	if options == nil {
+		options= &ReplayOptions{ }
+	}
+
+	cloudEvents := options.CloudEvents
+	if cloudEvents != nil {
+		var err error
+		if cloudEvents, err= resolveCloudEventsEnvelope(*cloudEvents, sink); err != nil {
+			return nil, err
+		}
+	}
+
+	usecasesLayer := &usecases.Usecases{ }
+	return usecasesLayer.Replay(usecases.ReplayArgs{
+		Context: ctx,
+
+		OutboxDB: source,
+		Filter: filter,
+
+		MQ: sink,
+
+		SourceName: options.SourceName,
+		Steps: usecases.Steps{
+			Decryptor: options.Decryptor,
+			Transforms: options.Transforms,
+			SchemaIds: newSchemaIds(options.SchemaRegistry, options.EventValidation),
+			EventValidation: options.EventValidation,
+			CloudEvents: cloudEvents,
+			Compressor: options.Compressor,
+			ClaimCheck: options.ClaimCheck,
+		},
+
+		Logger: logger,
+	})
+}
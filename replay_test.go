@@ -0,0 +1,70 @@
+package outboxer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/cloudevents"
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// inMemoryReplayer is an outbox DB whose messages have all been published.
+type inMemoryReplayer struct {
+	items []*ports.ToBePublishedItem
+}
+
+func(i *inMemoryReplayer) GetMessagesForReplay(args *ports.GetMessagesForReplayArgs) error {
+	for _, item := range i.items {
+		if args.Filter.Topic != "" && item.Topic != args.Filter.Topic {
+			continue
+		}
+		args.ToBePublishedItemsChan <- item
+	}
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	source := &inMemoryReplayer{
+		items: []*ports.ToBePublishedItem{
+			{ RowId: "1", Message: []byte("registered"), Topic: "user.registered" },
+			{ RowId: "2", Message: []byte("deleted"), Topic: "user.deleted" },
+			{ RowId: "3", Message: []byte("registered"), Topic: "user.registered" },
+		},
+	}
+	sink := &inMemoryMQ{ }
+
+	result, err := Replay(context.Background( ), source, sink, ReplayFilter{ Topic: "user.registered" }, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &ReplayResult{ Published: 2 }, result)
+
+	if assert.Len(t, sink.published, 2) {
+		assert.Equal(t, "1", sink.published[0].RowId)
+		assert.Equal(t, "3", sink.published[1].RowId)
+		assert.Equal(t, "true", sink.published[0].Headers[ReplayedHeader])
+	}
+}
+
+func TestReplayCloudEventsSource(t *testing.T) {
+	source := &inMemoryReplayer{
+		items: []*ports.ToBePublishedItem{
+			{ RowId: "1", MessageId: "1", Message: []byte("registered"), Topic: "user.registered" },
+		},
+	}
+	sink := &inMemoryMQ{ }
+
+	// Replayed messages are wrapped like the relayed ones, with the source derived from the name of
+	// the source.
+	options := &ReplayOptions{
+		SourceName: "postgres",
+		CloudEvents: &CloudEventsEnvelope{ Mode: cloudevents.ModeBinary, HeaderPrefix: "ce_" },
+	}
+	result, err := Replay(context.Background( ), source, sink, ReplayFilter{ }, options, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &ReplayResult{ Published: 1 }, result)
+
+	if assert.Len(t, sink.published, 1) {
+		assert.Equal(t, "/outboxer/postgres", sink.published[0].Headers["ce_source"])
+	}
+}
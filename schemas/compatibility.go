@@ -0,0 +1,125 @@
+package schemas
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Compatibility is the compatibility enforced between successive versions of a subject.
+type Compatibility string
+
+const (
+	// CompatibilityBackward requires that consumers using the new version can read the messages
+	// produced with the previous one.
+	CompatibilityBackward Compatibility= "backward"
+	// CompatibilityForward requires that consumers using the previous version can read the messages
+	// produced with the new one. Removing fields breaks it.
+	CompatibilityForward Compatibility= "forward"
+	// CompatibilityFull requires both.
+	CompatibilityFull Compatibility= "full"
+	// CompatibilityNone allows any change.
+	CompatibilityNone Compatibility= "none"
+
+	DefaultCompatibility= CompatibilityFull
+)
+
+func ParseCompatibility(value string) (Compatibility, error) {
+	switch compatibility := Compatibility(strings.ToLower(value)); compatibility {
+		case CompatibilityBackward, CompatibilityForward, CompatibilityFull, CompatibilityNone:
+			return compatibility, nil
+
+		default:
+			return "", fmt.Errorf("schemas: unknown compatibility %q", value)
+	}
+}
+
+// Incompatibility is a change breaking the compatibility between two versions of a schema.
+type Incompatibility struct {
+	// Path locates the change, like RegistrationStartedEvent.email.
+	Path string
+	Message string
+}
+
+func(i Incompatibility) String( ) string {
+	if i.Path == "" {
+		return i.Message
+	}
+	return i.Path + ": " + i.Message
+}
+
+// CheckCompatibility reports the changes between the previous and the current version of the
+// schema, which break the given compatibility.
+func CheckCompatibility(format Format, compatibility Compatibility, subject string, previous, current []byte) ([]Incompatibility, error) {
+	var (
+		checkBackward= compatibility == CompatibilityBackward || compatibility == CompatibilityFull
+		checkForward= compatibility == CompatibilityForward || compatibility == CompatibilityFull
+
+		incompatibilities []Incompatibility
+	)
+
+	switch format {
+		case FormatProtobuf:
+			previousMessage, err := loadMessage(subject, previous)
+			if err != nil {
+				return nil, err
+			}
+			currentMessage, err := loadMessage(subject, current)
+			if err != nil {
+				return nil, err
+			}
+
+			path := string(currentMessage.Name( ))
+			if checkBackward {
+				incompatibilities= append(incompatibilities,
+					checkProtobufReads(currentMessage, previousMessage, true, path, map[[2]protoreflect.FullName]bool{ })...,
+				)
+			}
+			if checkForward {
+				incompatibilities= append(incompatibilities,
+					checkProtobufReads(previousMessage, currentMessage, false, path, map[[2]protoreflect.FullName]bool{ })...,
+				)
+				incompatibilities= append(incompatibilities,
+					checkProtobufRemovals(previousMessage, currentMessage, path, map[[2]protoreflect.FullName]bool{ })...,
+				)
+			}
+
+		case FormatJSON:
+			previousSchema, err := parseJSONSchema(previous)
+			if err != nil {
+				return nil, err
+			}
+			currentSchema, err := parseJSONSchema(current)
+			if err != nil {
+				return nil, err
+			}
+
+			if checkBackward {
+				incompatibilities= append(incompatibilities, checkJSONReads(currentSchema, previousSchema, true, "$")...)
+			}
+			if checkForward {
+				incompatibilities= append(incompatibilities, checkJSONReads(previousSchema, currentSchema, false, "$")...)
+			}
+
+		default:
+			return nil, fmt.Errorf("schemas: unknown format %q", format)
+	}
+
+	return deduplicate(incompatibilities), nil
+}
+
+// deduplicate removes the incompatibilities reported in both directions, like type changes.
+func deduplicate(incompatibilities []Incompatibility) []Incompatibility {
+	var (
+		deduplicated []Incompatibility
+		isReported= map[Incompatibility]bool{ }
+	)
+	for _, incompatibility := range incompatibilities {
+		if !isReported[incompatibility] {
+			isReported[incompatibility]= true
+			deduplicated= append(deduplicated, incompatibility)
+		}
+	}
+	return deduplicated
+}
@@ -0,0 +1,31 @@
+package schemas
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CompileProtoFiles parses the given .proto files, relative to the import path, like protoc does.
+// The well-known types (google/protobuf/*.proto) can be imported.
+func CompileProtoFiles(ctx context.Context, importPath string, files ...string) ([]protoreflect.FileDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{ importPath },
+		}),
+	}
+
+	compiledFiles, err := compiler.Compile(ctx, files...)
+	if err != nil {
+		return nil, fmt.Errorf("schemas: error compiling %s: %w", filepath.Join(importPath, "*.proto"), err)
+	}
+
+	fileDescriptors := make([]protoreflect.FileDescriptor, 0, len(compiledFiles))
+	for _, compiledFile := range compiledFiles {
+		fileDescriptors= append(fileDescriptors, compiledFile)
+	}
+	return fileDescriptors, nil
+}
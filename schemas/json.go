@@ -0,0 +1,178 @@
+package schemas
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is the subset of JSON Schema which the compatibility checks understand : types,
+// object properties, required properties, additional properties, array items and enums.
+type jsonSchema struct {
+	Type jsonTypes `json:"type"`
+
+	Properties map[string]*jsonSchema `json:"properties"`
+	Required []string `json:"required"`
+	// AdditionalProperties is either a boolean or a schema. Only false is taken into account.
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+
+	Items *jsonSchema `json:"items"`
+
+	Enum []json.RawMessage `json:"enum"`
+}
+
+// jsonTypes is the type keyword, which is either a type or an array of types.
+type jsonTypes []string
+
+func(t *jsonTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t= jsonTypes{ single }
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+func parseJSONSchema(content []byte) (*jsonSchema, error) {
+	schema := &jsonSchema{ }
+	if err := json.Unmarshal(content, schema); err != nil {
+		return nil, fmt.Errorf("schemas: invalid JSON schema: %w", err)
+	}
+	return schema, nil
+}
+
+func(s *jsonSchema) allowsAdditionalProperties( ) bool {
+	return strings.TrimSpace(string(s.AdditionalProperties)) != "false"
+}
+
+func(s *jsonSchema) isRequired(property string) bool {
+	for _, required := range s.Required {
+		if required == property {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsType returns true if the schema accepts values of the given type (any type when it doesn't
+// restrict them). Integers are numbers.
+func(s *jsonSchema) acceptsType(valueType string) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+	for _, acceptedType := range s.Type {
+		if acceptedType == valueType || acceptedType == "number" && valueType == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkJSONReads reports the incompatibilities preventing the documents valid against the writer
+// schema from being valid against the reader schema. isReaderNew tells which of the schemas is the
+// new version, so that changes are reported in the right direction.
+func checkJSONReads(reader, writer *jsonSchema, isReaderNew bool, path string) []Incompatibility {
+	var incompatibilities []Incompatibility
+	report := func(path string, newMessage, oldMessage string, args ...interface{ }) {
+		message := oldMessage
+		if isReaderNew {
+			message= newMessage
+		}
+		incompatibilities= append(incompatibilities, Incompatibility{ Path: path, Message: fmt.Sprintf(message, args...) })
+	}
+
+	writerTypes := writer.Type
+	if len(writerTypes) == 0 {
+		writerTypes= []string{ "any type" }
+	}
+	for _, writerType := range writerTypes {
+		if !reader.acceptsType(writerType) {
+			old, new := strings.Join(reader.Type, ","), strings.Join(writer.Type, ",")
+			if isReaderNew {
+				old, new= new, old
+			}
+			incompatibilities= append(incompatibilities, Incompatibility{
+				Path: path,
+				Message: fmt.Sprintf("type changed from %s to %s", orAny(old), orAny(new)),
+			})
+			return incompatibilities
+		}
+	}
+
+	properties := make([]string, 0, len(reader.Properties))
+	for property := range reader.Properties {
+		properties= append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range reader.Required {
+		if !writer.isRequired(property) {
+			report(path + "." + property, "property became required", "property isn't required anymore")
+		}
+	}
+
+	for _, property := range properties {
+		writerProperty, isFound := writer.Properties[property]
+		if !isFound {
+			continue
+		}
+		incompatibilities= append(incompatibilities,
+			checkJSONReads(reader.Properties[property], writerProperty, isReaderNew, path + "." + property)...,
+		)
+	}
+
+	if !reader.allowsAdditionalProperties( ) {
+		writerProperties := make([]string, 0, len(writer.Properties))
+		for property := range writer.Properties {
+			writerProperties= append(writerProperties, property)
+		}
+		sort.Strings(writerProperties)
+
+		for _, property := range writerProperties {
+			if _, isFound := reader.Properties[property]; !isFound {
+				report(path + "." + property, "property was removed, while additional properties aren't allowed", "property was added, while additional properties aren't allowed")
+			}
+		}
+	}
+
+	if reader.Items != nil && writer.Items != nil {
+		incompatibilities= append(incompatibilities, checkJSONReads(reader.Items, writer.Items, isReaderNew, path + "[]")...)
+	}
+
+	if len(reader.Enum) > 0 {
+		if len(writer.Enum) == 0 {
+			report(path, "values became restricted to an enum", "values aren't restricted to an enum anymore")
+		}
+
+		for _, writerValue := range writer.Enum {
+			if !containsJSONValue(reader.Enum, writerValue) {
+				report(path, "enum value %s was removed", "enum value %s was added", string(writerValue))
+			}
+		}
+	}
+
+	return incompatibilities
+}
+
+func containsJSONValue(values []json.RawMessage, value json.RawMessage) bool {
+	var decodedValue interface{ }
+	json.Unmarshal(value, &decodedValue)
+
+	for _, candidate := range values {
+		var decodedCandidate interface{ }
+		json.Unmarshal(candidate, &decodedCandidate)
+
+		if fmt.Sprint(decodedCandidate) == fmt.Sprint(decodedValue) {
+			return true
+		}
+	}
+	return false
+}
+
+func orAny(types string) string {
+	if types == "" {
+		return "any type"
+	}
+	return types
+}
@@ -0,0 +1,224 @@
+package schemas
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtobufSchema returns the schema of the message : a FileDescriptorSet, encoded as JSON, holding
+// the file which declares the message along with its dependencies.
+func ProtobufSchema(message protoreflect.MessageDescriptor) ([]byte, error) {
+	var (
+		fileDescriptorSet= &descriptorpb.FileDescriptorSet{ }
+		isAdded= map[string]bool{ }
+
+		add func(file protoreflect.FileDescriptor)
+	)
+	// Dependencies come first, as protoc does.
+	add= func(file protoreflect.FileDescriptor) {
+		if isAdded[file.Path( )] {
+			return
+		}
+		isAdded[file.Path( )]= true
+
+		imports := file.Imports( )
+		for i := 0; i < imports.Len( ); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		fileDescriptorSet.File= append(fileDescriptorSet.File, protodesc.ToFileDescriptorProto(file))
+	}
+	add(message.ParentFile( ))
+
+	return protojson.MarshalOptions{ Multiline: true }.Marshal(fileDescriptorSet)
+}
+
+func parseProtobufSchema(content []byte) (*descriptorpb.FileDescriptorSet, error) {
+	fileDescriptorSet := &descriptorpb.FileDescriptorSet{ }
+	if err := protojson.Unmarshal(content, fileDescriptorSet); err != nil {
+		return nil, fmt.Errorf("schemas: invalid protobuf schema: %w", err)
+	}
+	return fileDescriptorSet, nil
+}
+
+// canonicalProtobufSchema returns the deterministic binary encoding of the schema, since the JSON
+// encoding of protobuf messages is deliberately unstable.
+func canonicalProtobufSchema(content []byte) ([]byte, error) {
+	fileDescriptorSet, err := parseProtobufSchema(content)
+	if err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{ Deterministic: true }.Marshal(fileDescriptorSet)
+}
+
+// loadMessage returns the descriptor of the message, whose full name is the subject, from its schema.
+func loadMessage(subject string, content []byte) (protoreflect.MessageDescriptor, error) {
+	fileDescriptorSet, err := parseProtobufSchema(content)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := protodesc.NewFiles(fileDescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("schemas: invalid protobuf schema: %w", err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(subject))
+	if err != nil {
+		return nil, fmt.Errorf("schemas: message %s: %w", subject, err)
+	}
+	message, isMessage := descriptor.(protoreflect.MessageDescriptor)
+	if !isMessage {
+		return nil, fmt.Errorf("schemas: %s isn't a message", subject)
+	}
+	return message, nil
+}
+
+// checkProtobufReads reports the incompatibilities preventing the reader message from reading what
+// the writer message wrote. Fields are matched by number, as in the wire format. Fields only known
+// by the reader are fine (they get their default value), unless they're required. Fields removed by
+// the writer are reported by checkProtobufRemovals instead. isReaderNew tells which of the messages
+// is the new version, so that changes are reported in the right direction.
+func checkProtobufReads(reader, writer protoreflect.MessageDescriptor, isReaderNew bool, path string, checked map[[2]protoreflect.FullName]bool) []Incompatibility {
+	pair := [2]protoreflect.FullName{ reader.FullName( ), writer.FullName( ) }
+	if checked[pair] {
+		return nil
+	}
+	checked[pair]= true
+
+	var incompatibilities []Incompatibility
+	report := func(field protoreflect.FieldDescriptor, format string, args ...interface{ }) {
+		incompatibilities= append(incompatibilities, Incompatibility{
+			Path: path + "." + string(field.Name( )),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	readerFields := reader.Fields( )
+	for i := 0; i < readerFields.Len( ); i++ {
+		readerField := readerFields.Get(i)
+
+		writerField := writer.Fields( ).ByNumber(readerField.Number( ))
+		if writerField == nil {
+			if readerField.Cardinality( ) == protoreflect.Required {
+				if isReaderNew {
+					report(readerField, "required field %d was added", readerField.Number( ))
+				} else {
+					report(readerField, "required field %d was removed", readerField.Number( ))
+				}
+			}
+			continue
+		}
+
+		oldField, newField := readerField, writerField
+		if isReaderNew {
+			oldField, newField= writerField, readerField
+		}
+
+		if readerField.IsList( ) != writerField.IsList( ) || readerField.IsMap( ) != writerField.IsMap( ) {
+			report(readerField, "field %d changed from %s to %s", readerField.Number( ), cardinality(oldField), cardinality(newField))
+			continue
+		}
+		if !areKindsCompatible(readerField.Kind( ), writerField.Kind( )) {
+			report(readerField, "field %d changed type from %s to %s", readerField.Number( ), oldField.Kind( ), newField.Kind( ))
+			continue
+		}
+
+		switch readerField.Kind( ) {
+			case protoreflect.MessageKind, protoreflect.GroupKind:
+				incompatibilities= append(incompatibilities,
+					checkProtobufReads(readerField.Message( ), writerField.Message( ), isReaderNew, path + "." + string(readerField.Name( )), checked)...,
+				)
+
+			case protoreflect.EnumKind:
+				// Values written, but unknown to the reader.
+				writerValues := writerField.Enum( ).Values( )
+				for j := 0; j < writerValues.Len( ); j++ {
+					if readerField.Enum( ).Values( ).ByNumber(writerValues.Get(j).Number( )) != nil {
+						continue
+					}
+					if isReaderNew {
+						report(readerField, "enum value %s (%d) was removed", writerValues.Get(j).Name( ), writerValues.Get(j).Number( ))
+					} else {
+						report(readerField, "enum value %s (%d) was added", writerValues.Get(j).Name( ), writerValues.Get(j).Number( ))
+					}
+				}
+		}
+	}
+	return incompatibilities
+}
+
+// checkProtobufRemovals reports the fields of the old message which aren't in the new one anymore,
+// unless their number has been reserved : consumers still reading them would silently get default
+// values.
+func checkProtobufRemovals(old, new protoreflect.MessageDescriptor, path string, checked map[[2]protoreflect.FullName]bool) []Incompatibility {
+	pair := [2]protoreflect.FullName{ old.FullName( ), new.FullName( ) }
+	if checked[pair] {
+		return nil
+	}
+	checked[pair]= true
+
+	var incompatibilities []Incompatibility
+
+	oldFields := old.Fields( )
+	for i := 0; i < oldFields.Len( ); i++ {
+		oldField := oldFields.Get(i)
+
+		newField := new.Fields( ).ByNumber(oldField.Number( ))
+		switch {
+			case newField == nil && !new.ReservedRanges( ).Has(oldField.Number( )):
+				incompatibilities= append(incompatibilities, Incompatibility{
+					Path: path + "." + string(oldField.Name( )),
+					Message: fmt.Sprintf("field %d was removed without being reserved", oldField.Number( )),
+				})
+
+			case newField != nil && oldField.Message( ) != nil && newField.Message( ) != nil:
+				incompatibilities= append(incompatibilities,
+					checkProtobufRemovals(oldField.Message( ), newField.Message( ), path + "." + string(oldField.Name( )), checked)...,
+				)
+		}
+	}
+	return incompatibilities
+}
+
+// wireCompatibleKinds groups the kinds which share the same encoding, and can thus be read as one
+// another.
+var wireCompatibleKinds= map[protoreflect.Kind]int{
+	protoreflect.Int32Kind: 1, protoreflect.Uint32Kind: 1, protoreflect.Int64Kind: 1, protoreflect.Uint64Kind: 1,
+	protoreflect.BoolKind: 1, protoreflect.EnumKind: 1,
+
+	protoreflect.Sint32Kind: 2, protoreflect.Sint64Kind: 2,
+
+	protoreflect.Fixed32Kind: 3, protoreflect.Sfixed32Kind: 3,
+
+	protoreflect.Fixed64Kind: 4, protoreflect.Sfixed64Kind: 4,
+
+	protoreflect.StringKind: 5, protoreflect.BytesKind: 5,
+}
+
+func areKindsCompatible(a, b protoreflect.Kind) bool {
+	if a == b {
+		return true
+	}
+
+	groupA, isGroupedA := wireCompatibleKinds[a]
+	groupB, isGroupedB := wireCompatibleKinds[b]
+	return isGroupedA && isGroupedB && groupA == groupB
+}
+
+func cardinality(field protoreflect.FieldDescriptor) string {
+	switch {
+		case field.IsMap( ):
+			return "map"
+
+		case field.IsList( ):
+			return "repeated"
+
+		default:
+			return "singular"
+	}
+}
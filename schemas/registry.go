@@ -0,0 +1,306 @@
+// Package schemas implements a file-backed schema registry, which stores the successive versions of
+// the schemas (protobuf or JSON) of the published messages, and refuses to register a version which
+// isn't compatible with the previous one.
+//
+// A registry is a directory holding an index.json file, which lists the registered schemas, along
+// with a file for each of them : <subject>/<version>.json. The subject of a protobuf schema is the
+// full name of its message, stored as a self-contained FileDescriptorSet. The subject of a JSON
+// schema is free, typically the topic of the messages.
+package schemas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type Format string
+
+const (
+	FormatProtobuf Format= "protobuf"
+	FormatJSON Format= "json"
+)
+
+// IdHeader is the header carrying the id of the schema of a published message.
+const IdHeader= "outboxer-schema-id"
+
+// indexFileName is the name of the file listing the registered schemas.
+const indexFileName= "index.json"
+
+var (
+	ErrIncompatible= errors.New("schemas: incompatible with the previous version")
+	ErrUnknownSubject= errors.New("schemas: unknown subject")
+)
+
+type (
+	// Schema describes a registered version of a schema.
+	Schema struct {
+		// Id identifies the schema across subjects.
+		Id int `json:"id"`
+		Subject string `json:"subject"`
+		// Version starts at 1, for each subject.
+		Version int `json:"version"`
+		Format Format `json:"format"`
+
+		// Fingerprint is a hash of the canonical form of the schema, telling whether it has changed.
+		Fingerprint string `json:"fingerprint"`
+		// Path of the file holding the schema, relative to the registry directory.
+		Path string `json:"path"`
+	}
+
+	// index is the content of the index.json file.
+	index struct {
+		// Compatibility applies to the subjects which don't override it. Defaults to
+		// DefaultCompatibility.
+		Compatibility Compatibility `json:"compatibility,omitempty"`
+		Subjects map[string]Compatibility `json:"subjects,omitempty"`
+
+		Schemas []*Schema `json:"schemas"`
+	}
+
+	// Registry is a file-backed schema registry. It's safe for concurrent use, but not for concurrent
+	// modifications by several processes.
+	Registry struct {
+		mutex sync.RWMutex
+
+		dir string
+		index index
+	}
+)
+
+// Open opens the registry stored in the given directory. The directory doesn't have to exist : it's
+// created when the first schema is registered.
+func Open(dir string) (*Registry, error) {
+	registry := &Registry{ dir: dir }
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFileName))
+	switch {
+		case errors.Is(err, os.ErrNotExist):
+			return registry, nil
+
+		case err != nil:
+			return nil, err
+	}
+
+	if err := json.Unmarshal(data, &registry.index); err != nil {
+		return nil, fmt.Errorf("schemas: invalid index %s: %w", filepath.Join(dir, indexFileName), err)
+	}
+	return registry, nil
+}
+
+// Subjects returns the registered subjects, sorted.
+func(r *Registry) Subjects( ) []string {
+	r.mutex.RLock( )
+	defer r.mutex.RUnlock( )
+
+	subjects := []string{ }
+	for _, schema := range r.index.Schemas {
+		if schema.Version == 1 {
+			subjects= append(subjects, schema.Subject)
+		}
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Versions returns the registered versions of the subject, oldest first.
+func(r *Registry) Versions(subject string) []*Schema {
+	r.mutex.RLock( )
+	defer r.mutex.RUnlock( )
+
+	var versions []*Schema
+	for _, schema := range r.index.Schemas {
+		if schema.Subject == subject {
+			versions= append(versions, schema)
+		}
+	}
+	return versions
+}
+
+// Latest returns the latest version of the subject.
+func(r *Registry) Latest(subject string) (*Schema, bool) {
+	versions := r.Versions(subject)
+	if len(versions) == 0 {
+		return nil, false
+	}
+	return versions[len(versions) - 1], true
+}
+
+// Content returns the content of the schema.
+func(r *Registry) Content(schema *Schema) ([]byte, error) {
+	return os.ReadFile(filepath.Join(r.dir, schema.Path))
+}
+
+// Compatibility returns the compatibility enforced between the versions of the subject.
+func(r *Registry) Compatibility(subject string) Compatibility {
+	r.mutex.RLock( )
+	defer r.mutex.RUnlock( )
+
+	if compatibility, isFound := r.index.Subjects[subject]; isFound {
+		return compatibility
+	}
+	if r.index.Compatibility != "" {
+		return r.index.Compatibility
+	}
+	return DefaultCompatibility
+}
+
+// SetCompatibility sets the compatibility enforced between the versions of the subject, or the
+// default one if subject is empty.
+func(r *Registry) SetCompatibility(subject string, compatibility Compatibility) error {
+	if _, err := ParseCompatibility(string(compatibility)); err != nil {
+		return err
+	}
+
+	r.mutex.Lock( )
+	defer r.mutex.Unlock( )
+
+	if subject == "" {
+		r.index.Compatibility= compatibility
+	} else {
+		if r.index.Subjects == nil {
+			r.index.Subjects= map[string]Compatibility{ }
+		}
+		r.index.Subjects[subject]= compatibility
+	}
+	return r.writeIndex( )
+}
+
+// Check checks the compatibility of the schema with the latest version of the subject, as required
+// by the compatibility of the subject. Schemas of new subjects are always compatible.
+func(r *Registry) Check(subject string, format Format, content []byte) ([]Incompatibility, error) {
+	latest, isFound := r.Latest(subject)
+	if !isFound {
+		return nil, validate(format, subject, content)
+	}
+	if latest.Format != format {
+		return []Incompatibility{{ Message: fmt.Sprintf("format changed from %s to %s", latest.Format, format) }}, nil
+	}
+
+	latestContent, err := r.Content(latest)
+	if err != nil {
+		return nil, err
+	}
+	return CheckCompatibility(format, r.Compatibility(subject), subject, latestContent, content)
+}
+
+// Register registers the schema as the next version of the subject, unless it's identical to the
+// latest one, which is then returned. It fails with ErrIncompatible if the schema isn't compatible
+// with the latest version.
+func(r *Registry) Register(subject string, format Format, content []byte) (*Schema, error) {
+	fingerprint, err := Fingerprint(format, content)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, isFound := r.Latest(subject)
+	if isFound && latest.Format == format && latest.Fingerprint == fingerprint {
+		return latest, nil
+	}
+
+	incompatibilities, err := r.Check(subject, format, content)
+	if err != nil {
+		return nil, err
+	}
+	if len(incompatibilities) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrIncompatible, incompatibilities[0])
+	}
+
+	r.mutex.Lock( )
+	defer r.mutex.Unlock( )
+
+	schema := &Schema{
+		Id: len(r.index.Schemas) + 1,
+		Subject: subject,
+		Version: 1,
+		Format: format,
+		Fingerprint: fingerprint,
+	}
+	if latest != nil {
+		schema.Version= latest.Version + 1
+	}
+	schema.Path= filepath.Join(subject, strconv.Itoa(schema.Version) + ".json")
+
+	path := filepath.Join(r.dir, schema.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return nil, err
+	}
+
+	r.index.Schemas= append(r.index.Schemas, schema)
+	if err := r.writeIndex( ); err != nil {
+		r.index.Schemas= r.index.Schemas[:len(r.index.Schemas) - 1]
+		return nil, err
+	}
+	return schema, nil
+}
+
+// writeIndex atomically replaces the index file.
+func(r *Registry) writeIndex( ) error {
+	data, err := json.MarshalIndent(r.index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	temporaryPath := filepath.Join(r.dir, indexFileName + ".tmp")
+	if err := os.WriteFile(temporaryPath, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, filepath.Join(r.dir, indexFileName))
+}
+
+// Fingerprint hashes the canonical form of the schema, so that formatting changes don't count as new
+// versions.
+func Fingerprint(format Format, content []byte) (string, error) {
+	var (
+		canonical []byte
+		err error
+	)
+	switch format {
+		case FormatProtobuf:
+			canonical, err= canonicalProtobufSchema(content)
+
+		case FormatJSON:
+			var schema interface{ }
+			if err= json.Unmarshal(content, &schema); err == nil {
+				canonical, err= json.Marshal(schema)
+			}
+
+		default:
+			err= fmt.Errorf("schemas: unknown format %q", format)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(canonical)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// validate checks that the schema can be parsed.
+func validate(format Format, subject string, content []byte) error {
+	switch format {
+		case FormatProtobuf:
+			_, err := loadMessage(subject, content)
+			return err
+
+		case FormatJSON:
+			_, err := parseJSONSchema(content)
+			return err
+
+		default:
+			return fmt.Errorf("schemas: unknown format %q", format)
+	}
+}
@@ -0,0 +1,202 @@
+package schemas
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// protobufSchema compiles the given version of events.proto, and returns the schema of the
+// RegistrationStartedEvent message.
+func protobufSchema(t *testing.T, fields string) []byte {
+	dir := t.TempDir( )
+	err := os.WriteFile(filepath.Join(dir, "events.proto"), []byte(`
+		syntax= "proto3";
+		package outboxer.events.v1;
+
+		import "google/protobuf/timestamp.proto";
+
+		message RegistrationStartedEvent {
+			` + fields + `
+		}
+	`), 0o644)
+	assert.NoError(t, err)
+
+	files, err := CompileProtoFiles(context.Background( ), dir, "events.proto")
+	assert.NoError(t, err)
+
+	schema, err := ProtobufSchema(files[0].Messages( ).ByName("RegistrationStartedEvent"))
+	assert.NoError(t, err)
+	return schema
+}
+
+const registrationStartedEvent= "outboxer.events.v1.RegistrationStartedEvent"
+
+func TestProtobufCompatibility(t *testing.T) {
+	previous := protobufSchema(t, `string email= 1; string username= 2;`)
+
+	for _, testCase := range []struct {
+		name string
+		fields string
+		compatibility Compatibility
+		incompatibilities []string
+	}{
+		{
+			name: "Adding a field",
+			fields: `string email= 1; string username= 2; google.protobuf.Timestamp started_at= 3;`,
+			compatibility: CompatibilityFull,
+		},
+		{
+			name: "Removing a field",
+			fields: `string email= 1;`,
+			compatibility: CompatibilityFull,
+			incompatibilities: []string{ "RegistrationStartedEvent.username: field 2 was removed without being reserved" },
+		},
+		{
+			name: "Removing a field, backward",
+			fields: `string email= 1;`,
+			compatibility: CompatibilityBackward,
+		},
+		{
+			name: "Removing a reserved field",
+			fields: `string email= 1; reserved 2;`,
+			compatibility: CompatibilityFull,
+		},
+		{
+			name: "Renaming a field",
+			fields: `string email= 1; string login= 2;`,
+			compatibility: CompatibilityFull,
+		},
+		{
+			name: "Changing a type",
+			fields: `string email= 1; int64 username= 2;`,
+			compatibility: CompatibilityBackward,
+			incompatibilities: []string{ "RegistrationStartedEvent.username: field 2 changed type from string to int64" },
+		},
+		{
+			name: "Changing a type compatibly",
+			fields: `bytes email= 1; string username= 2;`,
+			compatibility: CompatibilityFull,
+		},
+		{
+			name: "Making a field repeated",
+			fields: `repeated string email= 1; string username= 2;`,
+			compatibility: CompatibilityForward,
+			incompatibilities: []string{ "RegistrationStartedEvent.email: field 1 changed from singular to repeated" },
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			incompatibilities, err := CheckCompatibility(FormatProtobuf, testCase.compatibility, registrationStartedEvent,
+				previous, protobufSchema(t, testCase.fields),
+			)
+			assert.NoError(t, err)
+
+			messages := []string{ }
+			for _, incompatibility := range incompatibilities {
+				messages= append(messages, incompatibility.String( ))
+			}
+			assert.ElementsMatch(t, testCase.incompatibilities, messages)
+		})
+	}
+}
+
+func TestJSONCompatibility(t *testing.T) {
+	previous := []byte(`{
+		"type": "object",
+		"properties": { "email": { "type": "string" }, "username": { "type": "string" } },
+		"required": [ "email", "username" ]
+	}`)
+
+	for _, testCase := range []struct {
+		name string
+		schema string
+		compatibility Compatibility
+		incompatibilities []string
+	}{
+		{
+			name: "Adding an optional property",
+			schema: `{ "type": "object", "properties": { "email": { "type": "string" }, "username": { "type": "string" }, "age": { "type": "integer" } }, "required": [ "email", "username" ] }`,
+			compatibility: CompatibilityFull,
+		},
+		{
+			name: "Adding a required property",
+			schema: `{ "type": "object", "properties": { "email": { "type": "string" }, "username": { "type": "string" }, "age": { "type": "integer" } }, "required": [ "email", "username", "age" ] }`,
+			compatibility: CompatibilityFull,
+			incompatibilities: []string{ "$.age: property became required" },
+		},
+		{
+			name: "Removing a required property",
+			schema: `{ "type": "object", "properties": { "email": { "type": "string" } }, "required": [ "email" ] }`,
+			compatibility: CompatibilityFull,
+			incompatibilities: []string{ "$.username: property isn't required anymore" },
+		},
+		{
+			name: "Removing a required property, backward",
+			schema: `{ "type": "object", "properties": { "email": { "type": "string" } }, "required": [ "email" ] }`,
+			compatibility: CompatibilityBackward,
+		},
+		{
+			name: "Changing a type",
+			schema: `{ "type": "object", "properties": { "email": { "type": "string" }, "username": { "type": ["string", "null"] } }, "required": [ "email", "username" ] }`,
+			compatibility: CompatibilityFull,
+			incompatibilities: []string{ "$.username: type changed from string to string,null" },
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			incompatibilities, err := CheckCompatibility(FormatJSON, testCase.compatibility, "user.registered", previous, []byte(testCase.schema))
+			assert.NoError(t, err)
+
+			messages := []string{ }
+			for _, incompatibility := range incompatibilities {
+				messages= append(messages, incompatibility.String( ))
+			}
+			assert.ElementsMatch(t, testCase.incompatibilities, messages)
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir( )
+
+	registry, err := Open(dir)
+	assert.NoError(t, err)
+
+	v1, err := registry.Register(registrationStartedEvent, FormatProtobuf, protobufSchema(t, `string email= 1; string username= 2;`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v1.Id)
+	assert.Equal(t, 1, v1.Version)
+
+	// Registering the same schema again doesn't create a version.
+	again, err := registry.Register(registrationStartedEvent, FormatProtobuf, protobufSchema(t, `string email= 1; string username= 2;`))
+	assert.NoError(t, err)
+	assert.Equal(t, v1, again)
+
+	_, err= registry.Register(registrationStartedEvent, FormatProtobuf, protobufSchema(t, `string email= 1;`))
+	assert.ErrorIs(t, err, ErrIncompatible)
+
+	jsonSchema, err := registry.Register("user.deleted", FormatJSON, []byte(`{ "type": "object" }`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, jsonSchema.Id)
+
+	v2, err := registry.Register(registrationStartedEvent, FormatProtobuf, protobufSchema(t, `string email= 1; reserved 2;`))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v2.Id)
+	assert.Equal(t, 2, v2.Version)
+
+	// The registry is persisted.
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ registrationStartedEvent, "user.deleted" }, reopened.Subjects( ))
+
+	latest, isFound := reopened.Latest(registrationStartedEvent)
+	assert.True(t, isFound)
+	assert.Equal(t, v2, latest)
+
+	// Relaxing the compatibility allows any change.
+	assert.NoError(t, reopened.SetCompatibility(registrationStartedEvent, CompatibilityNone))
+	_, err= reopened.Register(registrationStartedEvent, FormatProtobuf, protobufSchema(t, `int64 email= 1;`))
+	assert.NoError(t, err)
+}
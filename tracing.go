@@ -0,0 +1,18 @@
+package outboxer
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// TraceParent returns the W3C traceparent of the span in the given context, or an empty string if
+// the context doesn't carry a valid span. Store it along with the message in the outbox DB (in the
+// traceparent column for Postgres, or the traceparent field for Redis), so that the relay and the
+// consumers continue the trace of the request which produced the message.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{ }
+	propagation.TraceContext{ }.Inject(ctx, carrier)
+
+	return carrier.Get("traceparent")
+}
\ No newline at end of file
@@ -0,0 +1,166 @@
+package outboxer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+type (
+	// inMemoryOutboxDB is an outbox DB which hands over its messages once.
+	inMemoryOutboxDB struct {
+		mutex sync.Mutex
+		items []*ports.ToBePublishedItem
+	}
+
+	// inMemoryMQ is an MQ which records the messages published to it.
+	inMemoryMQ struct {
+		mutex sync.Mutex
+		published []*ports.ToBePublishedItem
+	}
+)
+
+func(i *inMemoryOutboxDB) Disconnect( ) { }
+
+func(i *inMemoryOutboxDB) Ping( ) error { return nil }
+
+func(i *inMemoryOutboxDB) GetMessages(args *ports.GetMessagesArgs) {
+	i.mutex.Lock( )
+	items := i.items
+	i.items= nil
+	i.mutex.Unlock( )
+
+	for _, item := range items {
+		args.ToBePublishedItemsChan <- item
+	}
+}
+
+func(i *inMemoryOutboxDB) UnlockMessagesAndUpdatePublishStatus(args *ports.UnlockMessagesAndUpdatePublishStatusArgs) {
+	for result := range args.PublishResultsChan {
+		args.AcknowledgementsChan <- &ports.Acknowledgement{ RowId: result.RowId }
+	}
+}
+
+func(i *inMemoryOutboxDB) Clean(*ports.CleanArgs) (int64, error) { return 0, nil }
+
+func(i *inMemoryOutboxDB) GetStats( ) (*ports.OutboxStats, error) { return &ports.OutboxStats{ }, nil }
+
+func(i *inMemoryMQ) Disconnect( ) { }
+
+func(i *inMemoryMQ) Ping( ) error { return nil }
+
+func(i *inMemoryMQ) PublishMessages(args *ports.PublishMessagesArgs) {
+	for item := range args.ToBePublishedItemsChan {
+		i.mutex.Lock( )
+		i.published= append(i.published, item)
+		i.mutex.Unlock( )
+
+		args.PublishResultsChan <- &ports.PublishResult{ RowId: item.RowId, IsPublished: true }
+	}
+}
+
+// relayAll runs a dispatcher relaying the messages of the outbox DB to the sink, and shuts it down
+// once all of them have been acknowledged. The hooks set in the options are invoked along with the
+// one waiting for the acknowledgements.
+func relayAll(t *testing.T, outboxDB *inMemoryOutboxDB, sink ports.MQ, options ...Option) {
+	t.Helper( )
+
+	var acknowledged sync.WaitGroup
+	acknowledged.Add(len(outboxDB.items))
+
+	dispatcher, err := New(append(options,
+		WithSource("in-memory", outboxDB, 10),
+		WithSink("in-memory", sink),
+		WithPollInterval(10 * time.Millisecond),
+		WithHooks(Hooks{
+			OnAcknowledged: func(Pipeline, *ports.ToBePublishedItem, *ports.Acknowledgement) {
+				acknowledged.Done( )
+			},
+		}),
+	)...)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, dispatcher.Start(context.Background( )))
+
+	acknowledgedChan := make(chan struct{ })
+	go func( ) {
+		acknowledged.Wait( )
+		close(acknowledgedChan)
+	}( )
+	select {
+		case <- acknowledgedChan:
+
+		case <- time.After(5 * time.Second):
+			t.Error("Timed out waiting for the messages to be acknowledged")
+	}
+
+	assert.NoError(t, dispatcher.Shutdown(context.Background( )))
+}
+
+// publishedByRowId returns the messages published to the given MQ, sorted by row id.
+func publishedByRowId(mq *inMemoryMQ) []*ports.ToBePublishedItem {
+	published := publishedItems(mq)
+	sort.Slice(published, func(i, j int) bool { return published[i].RowId < published[j].RowId })
+	return published
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter( )
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	// The request which inserts the message into the outbox DB.
+	producerContext, producerSpan := tracerProvider.Tracer("producer").Start(context.Background( ), "register")
+	producerSpan.End( )
+
+	outboxDB := &inMemoryOutboxDB{
+		items: []*ports.ToBePublishedItem{
+			{
+				RowId: "1",
+				Message: []byte("message"),
+				Headers: map[string]string{ "traceparent": TraceParent(producerContext) },
+			},
+		},
+	}
+	mq := &inMemoryMQ{ }
+
+	relayAll(t, outboxDB, mq, WithTracerProvider(tracerProvider))
+
+	// The consumer continues the trace of the producer.
+	assert.Len(t, mq.published, 1)
+	consumerContext := propagation.TraceContext{ }.Extract(context.Background( ), propagation.MapCarrier(mq.published[0].Headers))
+	consumerSpanContext := trace.SpanContextFromContext(consumerContext)
+	assert.Equal(t, producerSpan.SpanContext( ).TraceID( ), consumerSpanContext.TraceID( ))
+
+	spans := map[string]tracetest.SpanStub{ }
+	for _, span := range exporter.GetSpans( ) {
+		if span.Name == "outboxer.fetch" && len(span.Links) == 0 {
+			continue
+		}
+		spans[span.Name]= span
+	}
+
+	publishSpan, isFound := spans["outboxer.publish"]
+	assert.True(t, isFound)
+	assert.Equal(t, producerSpan.SpanContext( ).SpanID( ), publishSpan.Parent.SpanID( ))
+	assert.Equal(t, publishSpan.SpanContext.SpanID( ), consumerSpanContext.SpanID( ))
+
+	fetchSpan, isFound := spans["outboxer.fetch"]
+	assert.True(t, isFound)
+	assert.Equal(t, producerSpan.SpanContext( ).SpanID( ), fetchSpan.Links[0].SpanContext.SpanID( ))
+
+	acknowledgeSpan, isFound := spans["outboxer.acknowledge"]
+	assert.True(t, isFound)
+	assert.Equal(t, publishSpan.SpanContext.SpanID( ), acknowledgeSpan.Links[0].SpanContext.SpanID( ))
+}
\ No newline at end of file
@@ -0,0 +1,535 @@
+package transforms
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// Expression is a predicate on the metadata of a message, like :
+//
+//	topic == "user.registered" && headers["x-internal"] != "true"
+//	topic =~ "^user\\." || key in ["tenant-1", "tenant-2"]
+//	attempt > 3 && !(content_type == "application/json")
+//
+// The variables are topic, key, message_id, row_id, content_type, routing_key, attempt (a number),
+// size (the size of the message in bytes) and headers (indexed by name, missing headers being
+// empty). The operators are ==, !=, <, <=, >, >=, =~ and !~ (regular expression matching), in (list
+// membership), &&, || and !. A string used as a condition is true when it isn't empty.
+type Expression struct {
+	source string
+	evaluate evaluator
+}
+
+type (
+	// evaluator evaluates a node of an expression, to a string, a float64, a bool or a list.
+	evaluator func(item *ports.ToBePublishedItem) (interface{ }, error)
+
+	token struct {
+		kind tokenKind
+		text string
+		// position is the offset of the token in the expression, for error messages.
+		position int
+	}
+	tokenKind int
+
+	parser struct {
+		tokens []token
+		next int
+	}
+)
+
+const (
+	tokenEnd tokenKind= iota
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+// Compile parses the expression.
+func Compile(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+
+	p := &parser{ tokens: tokens }
+	evaluate, err := p.parseOr( )
+	if err == nil && p.peek( ).kind != tokenEnd {
+		err= fmt.Errorf("unexpected %q at %d", p.peek( ).text, p.peek( ).position)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+
+	return &Expression{ source: source, evaluate: evaluate }, nil
+}
+
+// MustCompile is like Compile, but panics if the expression is invalid.
+func MustCompile(source string) *Expression {
+	expression, err := Compile(source)
+	if err != nil {
+		panic(err)
+	}
+	return expression
+}
+
+// Matches evaluates the expression against the message.
+func(e *Expression) Matches(item *ports.ToBePublishedItem) (bool, error) {
+	value, err := e.evaluate(item)
+	if err != nil {
+		return false, fmt.Errorf("error evaluating %q: %w", e.source, err)
+	}
+	return truthy(value), nil
+}
+
+func(e *Expression) String( ) string {
+	return e.source
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for position := 0; position < len(source); {
+		character := rune(source[position])
+		switch {
+			case unicode.IsSpace(character):
+				position++
+
+			case character == '"' || character == '\'':
+				end := position + 1
+				for end < len(source) && rune(source[end]) != character {
+					if source[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(source) {
+					return nil, fmt.Errorf("unterminated string at %d", position)
+				}
+
+				literal := source[position:end + 1]
+				if character == '\'' {
+					literal= `"` + strings.ReplaceAll(strings.ReplaceAll(literal[1:len(literal) - 1], `\'`, `'`), `"`, `\"`) + `"`
+				}
+				text, err := strconv.Unquote(literal)
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at %d: %w", position, err)
+				}
+				tokens= append(tokens, token{ tokenString, text, position })
+				position= end + 1
+
+			case unicode.IsDigit(character):
+				end := position
+				for end < len(source) && (unicode.IsDigit(rune(source[end])) || source[end] == '.') {
+					end++
+				}
+				tokens= append(tokens, token{ tokenNumber, source[position:end], position })
+				position= end
+
+			case unicode.IsLetter(character) || character == '_':
+				end := position
+				for end < len(source) && (unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end])) || source[end] == '_') {
+					end++
+				}
+				tokens= append(tokens, token{ tokenIdentifier, source[position:end], position })
+				position= end
+
+			default:
+				operator := ""
+				for _, candidate := range []string{ "==", "!=", "=~", "!~", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", "," } {
+					if strings.HasPrefix(source[position:], candidate) {
+						operator= candidate
+						break
+					}
+				}
+				if operator == "" {
+					return nil, fmt.Errorf("unexpected character %q at %d", character, position)
+				}
+				tokens= append(tokens, token{ tokenOperator, operator, position })
+				position += len(operator)
+		}
+	}
+	return append(tokens, token{ tokenEnd, "end of expression", len(source) }), nil
+}
+
+func(p *parser) peek( ) token {
+	return p.tokens[p.next]
+}
+
+// accept consumes the next token if it's the given operator or keyword.
+func(p *parser) accept(text string) bool {
+	next := p.peek( )
+	if (next.kind == tokenOperator || next.kind == tokenIdentifier) && next.text == text {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func(p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q at %d, got %q", text, p.peek( ).position, p.peek( ).text)
+	}
+	return nil
+}
+
+func(p *parser) parseOr( ) (evaluator, error) {
+	left, err := p.parseAnd( )
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.parseAnd( )
+		if err != nil {
+			return nil, err
+		}
+
+		left= func(left, right evaluator) evaluator {
+			return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+				value, err := left(item)
+				if err != nil || truthy(value) {
+					return true, err
+				}
+				value, err= right(item)
+				return truthy(value), err
+			}
+		}(left, right)
+	}
+	return left, nil
+}
+
+func(p *parser) parseAnd( ) (evaluator, error) {
+	left, err := p.parseUnary( )
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.parseUnary( )
+		if err != nil {
+			return nil, err
+		}
+
+		left= func(left, right evaluator) evaluator {
+			return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+				value, err := left(item)
+				if err != nil || !truthy(value) {
+					return false, err
+				}
+				value, err= right(item)
+				return truthy(value), err
+			}
+		}(left, right)
+	}
+	return left, nil
+}
+
+func(p *parser) parseUnary( ) (evaluator, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary( )
+		if err != nil {
+			return nil, err
+		}
+
+		return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+			value, err := operand(item)
+			return !truthy(value), err
+		}, nil
+	}
+	return p.parseComparison( )
+}
+
+func(p *parser) parseComparison( ) (evaluator, error) {
+	left, err := p.parseOperand( )
+	if err != nil {
+		return nil, err
+	}
+
+	operator := p.peek( ).text
+	switch {
+		case p.peek( ).kind == tokenOperator:
+			switch operator {
+				case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+
+				default:
+					return left, nil
+			}
+
+		case p.peek( ).kind == tokenIdentifier && operator == "in":
+
+		default:
+			return left, nil
+	}
+	p.next++
+
+	// Regular expressions are compiled once, when they're literals.
+	if operator == "=~" || operator == "!~" {
+		if p.peek( ).kind == tokenString {
+			pattern, err := regexp.Compile(p.peek( ).text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression at %d: %w", p.peek( ).position, err)
+			}
+			p.next++
+
+			return matchEvaluator(left, func(*ports.ToBePublishedItem) (*regexp.Regexp, error) { return pattern, nil }, operator == "=~"), nil
+		}
+
+		right, err := p.parseOperand( )
+		if err != nil {
+			return nil, err
+		}
+		return matchEvaluator(left, func(item *ports.ToBePublishedItem) (*regexp.Regexp, error) {
+			value, err := right(item)
+			if err != nil {
+				return nil, err
+			}
+			return regexp.Compile(toString(value))
+		}, operator == "=~"), nil
+	}
+
+	right, err := p.parseOperand( )
+	if err != nil {
+		return nil, err
+	}
+
+	return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+		leftValue, err := left(item)
+		if err != nil {
+			return nil, err
+		}
+		rightValue, err := right(item)
+		if err != nil {
+			return nil, err
+		}
+
+		switch operator {
+			case "==":
+				return equals(leftValue, rightValue), nil
+
+			case "!=":
+				return !equals(leftValue, rightValue), nil
+
+			case "in":
+				list, isList := rightValue.([]interface{ })
+				if !isList {
+					return nil, fmt.Errorf("the right operand of in must be a list")
+				}
+				for _, element := range list {
+					if equals(leftValue, element) {
+						return true, nil
+					}
+				}
+				return false, nil
+
+			default:
+				leftNumber, err := toNumber(leftValue)
+				if err != nil {
+					return nil, err
+				}
+				rightNumber, err := toNumber(rightValue)
+				if err != nil {
+					return nil, err
+				}
+
+				switch operator {
+					case "<":
+						return leftNumber < rightNumber, nil
+
+					case "<=":
+						return leftNumber <= rightNumber, nil
+
+					case ">":
+						return leftNumber > rightNumber, nil
+
+					default:
+						return leftNumber >= rightNumber, nil
+				}
+		}
+	}, nil
+}
+
+func matchEvaluator(operand evaluator, pattern func(*ports.ToBePublishedItem) (*regexp.Regexp, error), isMatch bool) evaluator {
+	return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+		value, err := operand(item)
+		if err != nil {
+			return nil, err
+		}
+		compiledPattern, err := pattern(item)
+		if err != nil {
+			return nil, err
+		}
+		return compiledPattern.MatchString(toString(value)) == isMatch, nil
+	}
+}
+
+func(p *parser) parseOperand( ) (evaluator, error) {
+	next := p.peek( )
+	p.next++
+
+	switch next.kind {
+		case tokenString:
+			return constant(next.text), nil
+
+		case tokenNumber:
+			number, err := strconv.ParseFloat(next.text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", next.text, next.position)
+			}
+			return constant(number), nil
+
+		case tokenIdentifier:
+			return p.parseIdentifier(next)
+
+		case tokenOperator:
+			switch next.text {
+				case "(":
+					operand, err := p.parseOr( )
+					if err != nil {
+						return nil, err
+					}
+					return operand, p.expect(")")
+
+				case "[":
+					var elements []evaluator
+					for !p.accept("]") {
+						if len(elements) > 0 {
+							if err := p.expect(","); err != nil {
+								return nil, err
+							}
+						}
+
+						element, err := p.parseOperand( )
+						if err != nil {
+							return nil, err
+						}
+						elements= append(elements, element)
+					}
+
+					return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+						list := make([]interface{ }, 0, len(elements))
+						for _, element := range elements {
+							value, err := element(item)
+							if err != nil {
+								return nil, err
+							}
+							list= append(list, value)
+						}
+						return list, nil
+					}, nil
+			}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", next.text, next.position)
+}
+
+func(p *parser) parseIdentifier(identifier token) (evaluator, error) {
+	switch identifier.text {
+		case "true":
+			return constant(true), nil
+
+		case "false":
+			return constant(false), nil
+
+		case "headers":
+			if err := p.expect("["); err != nil {
+				return nil, err
+			}
+			name, err := p.parseOperand( )
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+
+			return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+				value, err := name(item)
+				if err != nil {
+					return nil, err
+				}
+				return item.Headers[toString(value)], nil
+			}, nil
+	}
+
+	variable, isFound := variables[identifier.text]
+	if !isFound {
+		return nil, fmt.Errorf("unknown variable %q at %d", identifier.text, identifier.position)
+	}
+	return func(item *ports.ToBePublishedItem) (interface{ }, error) {
+		return variable(item), nil
+	}, nil
+}
+
+// variables are the metadata of the messages which expressions can refer to.
+var variables= map[string]func(item *ports.ToBePublishedItem) interface{ }{
+	"topic": func(item *ports.ToBePublishedItem) interface{ } { return item.Topic },
+	"key": func(item *ports.ToBePublishedItem) interface{ } { return item.Key },
+	"message_id": func(item *ports.ToBePublishedItem) interface{ } { return item.MessageId },
+	"row_id": func(item *ports.ToBePublishedItem) interface{ } { return item.RowId },
+	"content_type": func(item *ports.ToBePublishedItem) interface{ } { return item.ContentType },
+	"routing_key": func(item *ports.ToBePublishedItem) interface{ } { return item.RoutingKey },
+	"attempt": func(item *ports.ToBePublishedItem) interface{ } { return float64(item.Attempt) },
+	"size": func(item *ports.ToBePublishedItem) interface{ } { return float64(len(item.Message)) },
+}
+
+func constant(value interface{ }) evaluator {
+	return func(*ports.ToBePublishedItem) (interface{ }, error) { return value, nil }
+}
+
+func truthy(value interface{ }) bool {
+	switch value := value.(type) {
+		case bool:
+			return value
+
+		case string:
+			return value != ""
+
+		case float64:
+			return value != 0
+
+		case []interface{ }:
+			return len(value) > 0
+
+		default:
+			return false
+	}
+}
+
+// equals compares the values, converting numbers to strings when compared to strings (like headers).
+func equals(a, b interface{ }) bool {
+	_, isNumberA := a.(float64)
+	_, isNumberB := b.(float64)
+	if isNumberA != isNumberB {
+		return toString(a) == toString(b)
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func toString(value interface{ }) string {
+	if number, isNumber := value.(float64); isNumber {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func toNumber(value interface{ }) (float64, error) {
+	switch value := value.(type) {
+		case float64:
+			return value, nil
+
+		case string:
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%q isn't a number", value)
+			}
+			return number, nil
+
+		default:
+			return 0, fmt.Errorf("%v isn't a number", value)
+	}
+}
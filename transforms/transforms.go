@@ -0,0 +1,254 @@
+// Package transforms provides the built-in transforms, which alter the outbox messages between the
+// outbox DB and the message queue : filtering, routing, mapping headers and redacting fields. Each
+// of them can be restricted to the messages matching an Expression. Custom transforms implement
+// ports.Transform.
+package transforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/events"
+)
+
+// DefaultReplacement is the value replacing the redacted fields, unless configured otherwise.
+const DefaultReplacement= "[REDACTED]"
+
+var ErrNotJSON= errors.New("transforms: the message isn't a JSON object")
+
+type (
+	// TransformFunc adapts a function to the ports.Transform interface.
+	TransformFunc func(item *ports.ToBePublishedItem) (bool, error)
+
+	// conditional applies the transform only to the messages matching the expression.
+	conditional struct {
+		when *Expression
+		transform ports.Transform
+	}
+
+	// Route changes the destination of the messages. The routing key and the topic are templates,
+	// which can refer to ${topic}, ${key}, ${message_id}, ${routing_key} and ${header.<name>}.
+	Route struct {
+		RoutingKey string
+		Topic string
+	}
+
+	// MapHeaders renames, then removes, then sets headers. The values of the set headers are
+	// templates, like in Route.
+	MapHeaders struct {
+		Set map[string]string
+		// Rename maps the old names to the new ones.
+		Rename map[string]string
+		Remove []string
+	}
+
+	// Redact replaces the values of the given fields, which are dotted paths (like "user.email"). The
+	// messages are JSON objects, unless their topic is an event type of the registry : they're then
+	// decoded as the corresponding protobuf message, whose redacted string fields are replaced and
+	// other ones are cleared.
+	Redact struct {
+		Fields []string
+		// Replacement defaults to DefaultReplacement.
+		Replacement string
+		Registry *events.Registry
+	}
+)
+
+func(f TransformFunc) Transform(item *ports.ToBePublishedItem) (bool, error) {
+	return f(item)
+}
+
+// When restricts the transform to the messages matching the expression. The other ones are left as
+// they are.
+func When(expression *Expression, transform ports.Transform) ports.Transform {
+	return &conditional{ when: expression, transform: transform }
+}
+
+func(c *conditional) Transform(item *ports.ToBePublishedItem) (bool, error) {
+	isMatching, err := c.when.Matches(item)
+	if err != nil || !isMatching {
+		return true, err
+	}
+	return c.transform.Transform(item)
+}
+
+// Drop drops all the messages : it's meant to be used with When, to filter them.
+func Drop( ) ports.Transform {
+	return TransformFunc(func(*ports.ToBePublishedItem) (bool, error) {
+		return false, nil
+	})
+}
+
+func(r *Route) Transform(item *ports.ToBePublishedItem) (bool, error) {
+	routingKey, topic := expand(r.RoutingKey, item), expand(r.Topic, item)
+	if r.RoutingKey != "" {
+		item.RoutingKey= routingKey
+	}
+	if r.Topic != "" {
+		item.Topic= topic
+	}
+	return true, nil
+}
+
+func(m *MapHeaders) Transform(item *ports.ToBePublishedItem) (bool, error) {
+	headers := make(map[string]string, len(item.Headers) + len(m.Set))
+	for name, value := range item.Headers {
+		headers[name]= value
+	}
+
+	for oldName, newName := range m.Rename {
+		if value, isFound := item.Headers[oldName]; isFound {
+			delete(headers, oldName)
+			headers[newName]= value
+		}
+	}
+	for _, name := range m.Remove {
+		delete(headers, name)
+	}
+	// The templates refer to the original headers.
+	for name, value := range m.Set {
+		headers[name]= expand(value, item)
+	}
+
+	item.Headers= headers
+	return true, nil
+}
+
+func(r *Redact) Transform(item *ports.ToBePublishedItem) (bool, error) {
+	replacement := r.Replacement
+	if replacement == "" {
+		replacement= DefaultReplacement
+	}
+
+	if r.Registry != nil {
+		if messageType, isFound := r.Registry.MessageType(item.Topic); isFound {
+			message := messageType.New( )
+			if err := proto.Unmarshal(item.Message, message.Interface( )); err != nil {
+				return false, fmt.Errorf("%w: %v", events.ErrInvalidPayload, err)
+			}
+			for _, field := range r.Fields {
+				redactProtobufField(message, strings.Split(field, "."), replacement)
+			}
+
+			redacted, err := proto.MarshalOptions{ Deterministic: true }.Marshal(message.Interface( ))
+			if err != nil {
+				return false, err
+			}
+			item.Message= redacted
+			return true, nil
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(item.Message))
+	// Numbers are preserved as they are.
+	decoder.UseNumber( )
+
+	var object map[string]interface{ }
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return false, ErrNotJSON
+	}
+	for _, field := range r.Fields {
+		redactJSONField(object, strings.Split(field, "."), replacement)
+	}
+
+	redacted, err := json.Marshal(object)
+	if err != nil {
+		return false, err
+	}
+	item.Message= redacted
+	return true, nil
+}
+
+// redactJSONField replaces the field at the given path, if present. The arrays along the path are
+// traversed, so that the field of each of their elements is redacted.
+func redactJSONField(value interface{ }, path []string, replacement string) {
+	switch value := value.(type) {
+		case map[string]interface{ }:
+			child, isFound := value[path[0]]
+			if !isFound {
+				return
+			}
+			if len(path) == 1 {
+				value[path[0]]= replacement
+				return
+			}
+			redactJSONField(child, path[1:], replacement)
+
+		case []interface{ }:
+			for _, element := range value {
+				redactJSONField(element, path, replacement)
+			}
+	}
+}
+
+// redactProtobufField replaces (string fields) or clears the field at the given path, if set.
+// Repeated messages along the path are traversed, like arrays in redactJSONField.
+func redactProtobufField(message protoreflect.Message, path []string, replacement string) {
+	field := message.Descriptor( ).Fields( ).ByName(protoreflect.Name(path[0]))
+	if field == nil || !message.Has(field) {
+		return
+	}
+
+	if len(path) == 1 {
+		switch {
+			case field.Kind( ) == protoreflect.StringKind && field.Cardinality( ) != protoreflect.Repeated:
+				message.Set(field, protoreflect.ValueOfString(replacement))
+
+			case field.Kind( ) == protoreflect.StringKind && field.IsList( ):
+				list := message.Mutable(field).List( )
+				for i := 0; i < list.Len( ); i++ {
+					list.Set(i, protoreflect.ValueOfString(replacement))
+				}
+
+			default:
+				message.Clear(field)
+		}
+		return
+	}
+
+	if field.Message( ) == nil || field.IsMap( ) {
+		return
+	}
+	if field.IsList( ) {
+		list := message.Mutable(field).List( )
+		for i := 0; i < list.Len( ); i++ {
+			redactProtobufField(list.Get(i).Message( ), path[1:], replacement)
+		}
+		return
+	}
+	redactProtobufField(message.Mutable(field).Message( ), path[1:], replacement)
+}
+
+// expand replaces the ${...} references of the template by the metadata of the message.
+func expand(template string, item *ports.ToBePublishedItem) string {
+	return os.Expand(template, func(name string) string {
+		if header, isHeader := strings.CutPrefix(name, "header."); isHeader {
+			return item.Headers[header]
+		}
+
+		switch name {
+			case "topic":
+				return item.Topic
+
+			case "key":
+				return item.Key
+
+			case "message_id":
+				return item.MessageId
+
+			case "routing_key":
+				return item.RoutingKey
+
+			default:
+				return ""
+		}
+	})
+}
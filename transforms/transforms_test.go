@@ -0,0 +1,115 @@
+package transforms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/events"
+	protoc_generated "github.com/Archisman-Mridha/outboxer/proto/generated"
+)
+
+func TestExpression(t *testing.T) {
+	item := &ports.ToBePublishedItem{
+		RowId: "7",
+		Message: []byte("hello"),
+		Topic: "user.registered",
+		Key: "tenant-1",
+		Attempt: 2,
+		Headers: map[string]string{ "x-internal": "true", "x-priority": "5" },
+	}
+
+	testCases := []struct {
+		expression string
+		isMatching bool
+	}{
+		{ `topic == "user.registered"`, true },
+		{ `topic != 'user.registered'`, false },
+		{ `topic =~ "^user\\." && key in ["tenant-1", "tenant-2"]`, true },
+		{ `topic !~ "^user\\."`, false },
+		{ `headers["x-internal"] == "true" && !(attempt > 3)`, true },
+		{ `headers["x-priority"] >= 5 && size == 5`, true },
+		{ `headers["x-missing"] || row_id == 8`, false },
+		{ `headers["x-missing"] || row_id == 7`, true },
+		{ `headers["x-internal"]`, true },
+		{ `false || (true && content_type == "")`, true },
+	}
+	for _, testCase := range testCases {
+		expression, err := Compile(testCase.expression)
+		if !assert.NoError(t, err, testCase.expression) {
+			continue
+		}
+
+		isMatching, err := expression.Matches(item)
+		assert.NoError(t, err, testCase.expression)
+		assert.Equal(t, testCase.isMatching, isMatching, testCase.expression)
+	}
+
+	for _, invalidExpression := range []string{ `topic ==`, `unknown == "a"`, `topic == "a`, `(topic == "a"`, `topic =~ "("`, `topic # "a"` } {
+		_, err := Compile(invalidExpression)
+		assert.Error(t, err, invalidExpression)
+	}
+
+	// Comparing a string which isn't a number fails at evaluation time.
+	_, err := MustCompile(`topic > 1`).Matches(item)
+	assert.Error(t, err)
+}
+
+func TestTransforms(t *testing.T) {
+	item := &ports.ToBePublishedItem{
+		Message: []byte(`{"email":"archi@example.com","address":{"city":"Kolkata"},"phones":[{"number":"123"}],"age":25}`),
+		Topic: "user.registered",
+		Key: "archi",
+		Headers: map[string]string{ "tenant": "acme", "x-internal": "true", "traceparent": "00-1" },
+	}
+
+	isKept, err := (&Route{ RoutingKey: "users.${header.tenant}", Topic: "${topic}.v2" }).Transform(item)
+	assert.True(t, isKept)
+	assert.NoError(t, err)
+	assert.Equal(t, "users.acme", item.RoutingKey)
+	assert.Equal(t, "user.registered.v2", item.Topic)
+
+	_, err= (&MapHeaders{
+		Set: map[string]string{ "partition-key": "${key}" },
+		Rename: map[string]string{ "tenant": "x-tenant" },
+		Remove: []string{ "x-internal" },
+	}).Transform(item)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{ "x-tenant": "acme", "traceparent": "00-1", "partition-key": "archi" }, item.Headers)
+
+	_, err= (&Redact{ Fields: []string{ "email", "address.city", "phones.number", "missing.field" } }).Transform(item)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"email":"[REDACTED]","address":{"city":"[REDACTED]"},"phones":[{"number":"[REDACTED]"}],"age":25}`, string(item.Message))
+
+	_, err= (&Redact{ Fields: []string{ "email" } }).Transform(&ports.ToBePublishedItem{ Message: []byte("not JSON") })
+	assert.ErrorIs(t, err, ErrNotJSON)
+
+	// Drop only applies to the messages matching the predicate.
+	dropInternal := When(MustCompile(`headers["x-internal"] == "true"`), Drop( ))
+	isKept, err= dropInternal.Transform(item)
+	assert.True(t, isKept)
+	assert.NoError(t, err)
+
+	isKept, err= dropInternal.Transform(&ports.ToBePublishedItem{ Headers: map[string]string{ "x-internal": "true" } })
+	assert.False(t, isKept)
+	assert.NoError(t, err)
+}
+
+func TestRedactProtobuf(t *testing.T) {
+	registry := events.NewRegistry( )
+	registry.Register("user.registered", &protoc_generated.RegistrationStartedEvent{ })
+
+	payload, err := proto.Marshal(&protoc_generated.RegistrationStartedEvent{ Email: "archi@example.com", Username: "archi" })
+	assert.NoError(t, err)
+
+	item := &ports.ToBePublishedItem{ Message: payload, Topic: "user.registered" }
+	_, err= (&Redact{ Fields: []string{ "email" }, Replacement: "***", Registry: registry }).Transform(item)
+	assert.NoError(t, err)
+
+	var message protoc_generated.RegistrationStartedEvent
+	assert.NoError(t, proto.Unmarshal(item.Message, &message))
+	assert.Equal(t, "***", message.Email)
+	assert.Equal(t, "archi", message.Username)
+}
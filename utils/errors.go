@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrAuth means that the dependency rejected the credentials.
+	ErrAuth= errors.New("authentication failed")
+	// ErrUnreachable means that the dependency couldn't be reached, or is not ready yet to accept
+	// connections. Connecting again later might succeed.
+	ErrUnreachable= errors.New("unreachable")
+	// ErrMisconfigured means that the connection details are invalid (malformed URI, non-existing
+	// database, etc.).
+	ErrMisconfigured= errors.New("misconfigured")
+)
+
+// ConnectionError is returned when connecting to a dependency (Postgres, Redis or RabbitMQ) fails.
+// Use errors.Is with ErrAuth, ErrUnreachable or ErrMisconfigured to find out why.
+type ConnectionError struct {
+	Dependency string
+	Kind error
+	Err error
+}
+
+func(c *ConnectionError) Error( ) string {
+	return fmt.Sprintf("error connecting to %s (%v): %v", c.Dependency, c.Kind, c.Err)
+}
+
+func(c *ConnectionError) Unwrap( ) []error {
+	return []error{ c.Kind, c.Err }
+}
+
+// classifyPostgresError finds out why connecting to Postgres failed. Errors which don't come from
+// Postgres itself (refused connections, DNS failures, etc.) are considered transient.
+func classifyPostgresError(err error) *ConnectionError {
+	connectionError := &ConnectionError{ Dependency: "Postgres", Kind: ErrUnreachable, Err: err }
+
+	var postgresError *pq.Error
+	if errors.As(err, &postgresError) {
+		switch {
+			// Class 28 - Invalid Authorization Specification
+			case postgresError.Code.Class( ) == "28":
+				connectionError.Kind= ErrAuth
+
+			// The database is starting up or shutting down.
+			case postgresError.Code == "57P03":
+
+			default:
+				connectionError.Kind= ErrMisconfigured
+		}
+	}
+
+	return connectionError
+}
+
+// classifyRedisError finds out why connecting to Redis failed. Errors which don't come from Redis
+// itself (refused connections, DNS failures, etc.) are considered transient.
+func classifyRedisError(err error) *ConnectionError {
+	connectionError := &ConnectionError{ Dependency: "Redis", Kind: ErrUnreachable, Err: err }
+
+	message := err.Error( )
+	switch {
+		case strings.HasPrefix(message, "NOAUTH"), strings.HasPrefix(message, "WRONGPASS"),
+			strings.Contains(message, "invalid password"), strings.Contains(message, "AUTH"):
+			connectionError.Kind= ErrAuth
+
+		case strings.Contains(message, "DB index"):
+			connectionError.Kind= ErrMisconfigured
+
+		// The dataset is still being loaded into memory.
+		case strings.HasPrefix(message, "LOADING"):
+	}
+
+	return connectionError
+}
+
+// classifyRabbitMQError finds out why connecting to RabbitMQ failed. Errors which don't come from
+// RabbitMQ itself (refused connections, DNS failures, etc.) are considered transient.
+func classifyRabbitMQError(err error) *ConnectionError {
+	connectionError := &ConnectionError{ Dependency: "RabbitMQ", Kind: ErrUnreachable, Err: err }
+
+	var amqpError *amqp.Error
+	if errors.As(err, &amqpError) {
+		switch amqpError.Code {
+			case amqp.AccessRefused:
+				connectionError.Kind= ErrAuth
+
+			case amqp.NotAllowed, amqp.NotFound, amqp.PreconditionFailed:
+				connectionError.Kind= ErrMisconfigured
+		}
+	}
+
+	return connectionError
+}
\ No newline at end of file
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionErrorClassification(t *testing.T) {
+	assert.ErrorIs(t, classifyPostgresError(&pq.Error{ Code: "28P01" }), ErrAuth)
+	assert.ErrorIs(t, classifyPostgresError(&pq.Error{ Code: "3D000" }), ErrMisconfigured)
+	assert.ErrorIs(t, classifyPostgresError(&pq.Error{ Code: "57P03" }), ErrUnreachable)
+
+	assert.ErrorIs(t, classifyRedisError(errors.New("WRONGPASS invalid username-password pair")), ErrAuth)
+	assert.ErrorIs(t, classifyRedisError(errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")), ErrUnreachable)
+
+	assert.ErrorIs(t, classifyRabbitMQError(amqp.ErrCredentials), ErrAuth)
+	assert.ErrorIs(t, classifyRabbitMQError(errors.New("dial tcp: lookup rabbitmq: no such host")), ErrUnreachable)
+
+	_, _, err := ConnectRabbitMQ("http://localhost:5672", "queue")
+	assert.ErrorIs(t, err, ErrMisconfigured)
+}
+
+func TestConnectWithRetries(t *testing.T) {
+	retryOptions := RetryOptions{
+		Timeout: time.Second,
+		InitialBackoff: time.Millisecond,
+	}
+
+	// Transient errors are retried.
+	attempts := 0
+	result, err := ConnectWithRetries(context.Background( ), retryOptions, nil, func( ) (string, error) {
+		if attempts++; attempts < 3 {
+			return "", &ConnectionError{ Dependency: "Postgres", Kind: ErrUnreachable }
+		}
+		return "connection", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "connection", result)
+	assert.Equal(t, 3, attempts)
+
+	// Other errors are returned right away.
+	attempts= 0
+	_, err= ConnectWithRetries(context.Background( ), retryOptions, nil, func( ) (string, error) {
+		attempts++
+		return "", &ConnectionError{ Dependency: "Postgres", Kind: ErrAuth }
+	})
+	assert.ErrorIs(t, err, ErrAuth)
+	assert.Equal(t, 1, attempts)
+}
\ No newline at end of file
@@ -1,88 +1,159 @@
 package utils
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/lib/pq"
 	"github.com/streadway/amqp"
-	"golang.org/x/sync/errgroup"
 )
 
 // GetEnv tries to find the env with the given name in the underlying OS environment. If the env is
-// not found, then it panics. If found, then the value of the env is returned.
-func GetEnv(envName string) string {
+// not found, then an error is returned. If found, then the value of the env is returned.
+func GetEnv(envName string) (string, error) {
 	envValue, isEnvFound := os.LookupEnv(envName)
 	if !isEnvFound {
-		log.Panicf("❌ Env %s not found", envName)
+		return "", fmt.Errorf("env %s not found", envName)
 	}
 
-	return envValue
+	return envValue, nil
 }
 
-// RunFnPeriodically runs a given funcion (in a separate go-routine) periodically with the given
-// time period. It also takes the 'done' channel as an input. Before exitting the program, close the
-// done channel to cleanup resources.
-func RunFnPeriodically[T interface{}](waitGroup *errgroup.Group, fn func(T), fnArgs T, period time.Duration) {
-	waitGroup.Go(func( ) error {
-		ticker := time.NewTicker(period)
-		defer ticker.Stop( )
+// RunFnPeriodically runs a given funcion periodically with the given time period. It blocks until
+// the given context is cancelled, so run it in a separate go-routine. Cancel the context before
+// exitting the program, to cleanup resources.
+func RunFnPeriodically[T interface{}](ctx context.Context, fn func(T), fnArgs T, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop( )
 
-		for range ticker.C {
-			fn(fnArgs)
+	for {
+		select {
+			case <- ctx.Done( ):
+				return
+
+			case <- ticker.C:
+				fn(fnArgs)
 		}
+	}
+}
 
-		return nil
-	})
+// LoggerOrDefault returns the given logger, or the default logger if the given one is nil.
+func LoggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default( )
+	}
+	return logger
 }
 
-func ConnectPostgres(uri string) *sql.DB {
+// ConnectPostgres opens a connection pool to Postgres, and pings it. If that fails, a
+// *ConnectionError is returned.
+func ConnectPostgres(uri string) (*sql.DB, error) {
+	if strings.HasPrefix(uri, "postgres://") || strings.HasPrefix(uri, "postgresql://") {
+		if _, err := pq.ParseURL(uri); err != nil {
+			return nil, &ConnectionError{ Dependency: "Postgres", Kind: ErrMisconfigured, Err: err }
+		}
+	}
+
 	connection, err := sql.Open("postgres", uri)
 	if err != nil {
-		log.Fatalf("❌ Error connecting to the database : %v", err)
+		return nil, &ConnectionError{ Dependency: "Postgres", Kind: ErrMisconfigured, Err: err }
 	}
 	if err := connection.Ping( ); err != nil {
-		log.Fatalf("❌ Error pinging the database : %v", err)
+		connection.Close( )
+		return nil, classifyPostgresError(err)
 	}
 
-	log.Println("✅ Connected to Postgres")
-
-	return connection
+	return connection, nil
 }
 
-func ConnectRedis(options *redis.Options) (client *redis.Client) {
-	client = redis.NewClient(options)
+// ConnectRedis creates a Redis client, and pings Redis. If that fails, a *ConnectionError is
+// returned.
+func ConnectRedis(options *redis.Options) (*redis.Client, error) {
+	client := redis.NewClient(options)
 
 	if _, err := client.Ping( ).Result( ); err != nil {
-		log.Fatalf("❌ Error connecting to Redis: %v", err)
-	}
-	if _, err := client.XGroupCreateMkStream("outbox", "outboxer", "0").Result( ); err != nil {
-		log.Printf("❌ Error creating consumer group for the outbox Redis stream: %v", err)
+		client.Close( )
+		return nil, classifyRedisError(err)
 	}
 
-	log.Println("✅ Connected to Redis")
-
-	return
+	return client, nil
 }
 
-func ConnectRabbitMQ(uri, queueName string) (*amqp.Connection, *amqp.Channel) {
+// ConnectRabbitMQ connects to RabbitMQ, opens a channel and declares the queue with the given name.
+// If that fails, a *ConnectionError is returned.
+func ConnectRabbitMQ(uri, queueName string) (*amqp.Connection, *amqp.Channel, error) {
+	if _, err := amqp.ParseURI(uri); err != nil {
+		return nil, nil, &ConnectionError{ Dependency: "RabbitMQ", Kind: ErrMisconfigured, Err: err }
+	}
+
 	connection, err := amqp.Dial(uri)
 	if err != nil {
-		log.Panicf("❌ Error connecting to RabbitMQ: %v", err)
+		return nil, nil, classifyRabbitMQError(err)
 	}
 	channel, err := connection.Channel( )
 	if err != nil {
-		log.Panicf("❌ Error creating channel in RabbitMQ")
+		connection.Close( )
+		return nil, nil, classifyRabbitMQError(err)
 	}
 
-	_, err = channel.QueueDeclare(queueName, true, false, false, false, nil)
-	if err != nil {
-		log.Printf("❌ Error declaring queue %s in RabbitMQ: %v", queueName, err)
+	if _, err := channel.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
+		connection.Close( )
+		return nil, nil, classifyRabbitMQError(err)
 	}
 
-	log.Println("✅ Connected to RabbitMQ")
+	return connection, channel, nil
+}
+
+// RetryOptions configures how long and how often connecting to a dependency is retried.
+type RetryOptions struct {
+	// Timeout is the total time after which retrying is given up. Zero means a single attempt.
+	Timeout time.Duration
 
-	return connection, channel
+	// InitialBackoff is the time waited after the first failed attempt. It's doubled after each
+	// attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff time.Duration
 }
+
+// ConnectWithRetries invokes connect until it succeeds, the error isn't transient (see
+// ErrUnreachable), or the timeout expires. It lets outboxer start before its dependencies do.
+func ConnectWithRetries[T interface{ }](ctx context.Context, options RetryOptions, logger *slog.Logger, connect func( ) (T, error)) (T, error) {
+	if options.InitialBackoff <= 0 {
+		options.InitialBackoff= 500 * time.Millisecond
+	}
+	if options.MaxBackoff < options.InitialBackoff {
+		options.MaxBackoff= options.InitialBackoff
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel( )
+
+	backoff := options.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := connect( )
+		if err == nil || !errors.Is(err, ErrUnreachable) {
+			return result, err
+		}
+
+		LoggerOrDefault(logger).Warn("Dependency is unreachable, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+
+		select {
+			case <- ctx.Done( ):
+				return result, err
+
+			case <- time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > options.MaxBackoff {
+			backoff= options.MaxBackoff
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,154 @@
+package outboxer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+	"github.com/Archisman-Mridha/outboxer/events"
+	protoc_generated "github.com/Archisman-Mridha/outboxer/proto/generated"
+	"github.com/Archisman-Mridha/outboxer/schemas"
+	"github.com/Archisman-Mridha/outboxer/transforms"
+)
+
+func TestEventValidation(t *testing.T) {
+	registry := events.NewRegistry( )
+	registry.Register("user.registered", &protoc_generated.RegistrationStartedEvent{ })
+
+	payload, err := proto.Marshal(&protoc_generated.RegistrationStartedEvent{ Username: "archi" })
+	assert.NoError(t, err)
+
+	outboxDB := &inMemoryOutboxDB{
+		items: []*ports.ToBePublishedItem{
+			{ RowId: "1", MessageId: "1", Message: payload, Topic: "user.registered" },
+			{ RowId: "2", MessageId: "2", Message: []byte("not protobuf"), Topic: "user.registered" },
+			{ RowId: "3", MessageId: "3", Message: []byte("unknown"), Topic: "user.deleted" },
+		},
+	}
+	mq := &inMemoryMQ{ }
+
+	var (
+		mutex sync.Mutex
+		rejectedRowIds []string
+	)
+	relayAll(t, outboxDB, mq,
+		WithEventValidation(EventValidation{ Registry: registry, RejectUnknownTypes: true, Envelope: true }),
+		WithHooks(Hooks{
+			OnPublishResult: func(pipeline Pipeline, item *ports.ToBePublishedItem, result *ports.PublishResult, latency time.Duration) {
+				if result.IsRejected {
+					mutex.Lock( )
+					rejectedRowIds= append(rejectedRowIds, result.RowId)
+					mutex.Unlock( )
+				}
+			},
+		}),
+	)
+
+	mutex.Lock( )
+	assert.ElementsMatch(t, []string{ "2", "3" }, rejectedRowIds)
+	mutex.Unlock( )
+
+	// Only the valid message is published, wrapped in an EventEnvelope.
+	published := publishedItems(mq)
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, events.EnvelopeContentType, published[0].ContentType)
+
+		envelope, message, err := registry.Unwrap(published[0].Message)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", envelope.Id)
+		assert.Equal(t, "archi", message.(*protoc_generated.RegistrationStartedEvent).Username)
+	}
+}
+
+func TestSchemaIds(t *testing.T) {
+	schemaRegistry, err := schemas.Open(t.TempDir( ))
+	assert.NoError(t, err)
+
+	protobufSchema, err := schemas.ProtobufSchema((&protoc_generated.RegistrationStartedEvent{ }).ProtoReflect( ).Descriptor( ))
+	assert.NoError(t, err)
+	_, err= schemaRegistry.Register("outboxer.events.v1.RegistrationStartedEvent", schemas.FormatProtobuf, protobufSchema)
+	assert.NoError(t, err)
+	_, err= schemaRegistry.Register("user.deleted", schemas.FormatJSON, []byte(`{ "type": "object" }`))
+	assert.NoError(t, err)
+
+	eventRegistry := events.NewRegistry( )
+	eventRegistry.Register("user.registered", &protoc_generated.RegistrationStartedEvent{ })
+
+	outboxDB := &inMemoryOutboxDB{
+		items: []*ports.ToBePublishedItem{
+			{ RowId: "1", Topic: "user.registered" },
+			{ RowId: "2", Topic: "user.deleted" },
+			{ RowId: "3", Topic: "user.updated" },
+		},
+	}
+	mq := &inMemoryMQ{ }
+
+	relayAll(t, outboxDB, mq,
+		WithSchemaRegistry(schemaRegistry),
+		WithEventValidation(EventValidation{ Registry: eventRegistry }),
+	)
+
+	schemaIds := map[string]string{ }
+	for _, item := range publishedItems(mq) {
+		schemaIds[item.RowId]= item.Headers[schemas.IdHeader]
+	}
+	assert.Equal(t, map[string]string{ "1": "1", "2": "2", "3": "" }, schemaIds)
+}
+
+func TestTransforms(t *testing.T) {
+	outboxDB := &inMemoryOutboxDB{
+		items: []*ports.ToBePublishedItem{
+			{ RowId: "1", MessageId: "1", Message: []byte("registered"), Topic: "user.registered" },
+			{ RowId: "2", MessageId: "2", Message: []byte("internal"), Topic: "user.registered", Headers: map[string]string{ "x-internal": "true" } },
+			{ RowId: "3", MessageId: "3", Message: []byte("deleted"), Topic: "user.deleted" },
+		},
+	}
+	mq := &inMemoryMQ{ }
+
+	var (
+		mutex sync.Mutex
+		droppedRowIds, rejectedRowIds []string
+	)
+	relayAll(t, outboxDB, mq,
+		WithTransforms(
+			transforms.When(transforms.MustCompile(`headers["x-internal"] == "true"`), transforms.Drop( )),
+			transforms.TransformFunc(func(item *ports.ToBePublishedItem) (bool, error) {
+				if item.Topic == "user.deleted" {
+					return false, errors.New("deletions aren't published")
+				}
+				return true, nil
+			}),
+			&transforms.Route{ RoutingKey: "${topic}" },
+		),
+		WithHooks(Hooks{
+			OnPublishResult: func(pipeline Pipeline, item *ports.ToBePublishedItem, result *ports.PublishResult, latency time.Duration) {
+				mutex.Lock( )
+				defer mutex.Unlock( )
+
+				switch {
+					case result.IsDropped:
+						droppedRowIds= append(droppedRowIds, result.RowId)
+
+					case result.IsRejected:
+						rejectedRowIds= append(rejectedRowIds, result.RowId)
+				}
+			},
+		}),
+	)
+
+	mutex.Lock( )
+	assert.Equal(t, []string{ "2" }, droppedRowIds)
+	assert.Equal(t, []string{ "3" }, rejectedRowIds)
+	mutex.Unlock( )
+
+	published := publishedItems(mq)
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, "1", published[0].RowId)
+		assert.Equal(t, "user.registered", published[0].RoutingKey)
+	}
+}
@@ -0,0 +1,156 @@
+package outboxer
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Archisman-Mridha/outboxer/domain/ports"
+)
+
+// slowMQ is an in-memory MQ taking a random time to publish each message.
+type slowMQ struct {
+	inMemoryMQ
+}
+
+func(s *slowMQ) PublishMessages(args *ports.PublishMessagesArgs) {
+	for item := range args.ToBePublishedItemsChan {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+
+		s.mutex.Lock( )
+		s.published= append(s.published, item)
+		s.mutex.Unlock( )
+
+		args.PublishResultsChan <- &ports.PublishResult{ RowId: item.RowId, IsPublished: true }
+	}
+}
+
+func TestWorkersWithKeyOrdering(t *testing.T) {
+	const (
+		messages= 200
+		maxInFlight= 20
+	)
+
+	outboxDB := &inMemoryOutboxDB{ }
+	for i := 0; i < messages; i++ {
+		outboxDB.items= append(outboxDB.items, &ports.ToBePublishedItem{
+			RowId: strconv.Itoa(i),
+			Key: "user-" + strconv.Itoa(i % 3),
+		})
+	}
+	mq := &slowMQ{ }
+
+	var (
+		inFlight, maxObservedInFlight atomic.Int64
+		acknowledged sync.WaitGroup
+	)
+	acknowledged.Add(messages)
+
+	dispatcher, err := New(
+		WithSource("in-memory", outboxDB, messages),
+		WithSink("in-memory", mq),
+		WithPollInterval(10 * time.Millisecond),
+		WithWorkers(4),
+		WithKeyOrdering(true),
+		WithMaxInFlight(maxInFlight),
+		WithHooks(Hooks{
+			OnFetched: func(Pipeline, *ports.ToBePublishedItem) {
+				current := inFlight.Add(1)
+				for {
+					observed := maxObservedInFlight.Load( )
+					if current <= observed || maxObservedInFlight.CompareAndSwap(observed, current) {
+						break
+					}
+				}
+			},
+			OnAcknowledged: func(Pipeline, *ports.ToBePublishedItem, *ports.Acknowledgement) {
+				inFlight.Add(-1)
+				acknowledged.Done( )
+			},
+		}),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dispatcher.Start(context.Background( )))
+	acknowledged.Wait( )
+	assert.NoError(t, dispatcher.Shutdown(context.Background( )))
+
+	assert.LessOrEqual(t, maxObservedInFlight.Load( ), int64(maxInFlight))
+
+	// The messages sharing a key are published in the order in which they were fetched.
+	assert.Len(t, mq.published, messages)
+	lastRowIds := map[string]int{ }
+	for _, item := range mq.published {
+		rowId, _ := strconv.Atoi(item.RowId)
+		if lastRowId, isFound := lastRowIds[item.Key]; isFound {
+			assert.Greater(t, rowId, lastRowId, "messages with key %s were reordered", item.Key)
+		}
+		lastRowIds[item.Key]= rowId
+	}
+}
+
+// exclusiveMQ is a message queue, creating a new one per worker, which counts the times it was used
+// by several publishers at once.
+type exclusiveMQ struct {
+	remoteMQ
+	isPublishing atomic.Bool
+	overlaps *atomic.Int64
+}
+
+func(e *exclusiveMQ) NewWorker( ) (ports.MQ, error) {
+	return &exclusiveMQ{ overlaps: e.overlaps }, nil
+}
+
+func(e *exclusiveMQ) PublishBatch(items []*ports.ToBePublishedItem) []*ports.PublishResult {
+	if !e.isPublishing.CompareAndSwap(false, true) {
+		e.overlaps.Add(1)
+		return e.remoteMQ.PublishBatch(items)
+	}
+	defer e.isPublishing.Store(false)
+
+	return e.remoteMQ.PublishBatch(items)
+}
+
+// Each pipeline publishes through its own worker, even with a single worker per pipeline.
+func TestWorkerPerPipeline(t *testing.T) {
+	const messages= 500
+
+	mq := &exclusiveMQ{ overlaps: &atomic.Int64{ } }
+
+	var acknowledged atomic.Int64
+	doneChan := make(chan struct{ })
+	var doneOnce sync.Once
+
+	dispatcher, err := New(
+		WithSource("first", &remoteOutboxDB{ }, 10),
+		WithSource("second", &remoteOutboxDB{ }, 10),
+		WithSink("exclusive", mq),
+		WithPollInterval(time.Millisecond),
+		WithBatchMode(true),
+		WithHooks(Hooks{
+			OnAcknowledged: func(Pipeline, *ports.ToBePublishedItem, *ports.Acknowledgement) {
+				if acknowledged.Add(1) >= messages {
+					doneOnce.Do(func( ) { close(doneChan) })
+				}
+			},
+		}),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dispatcher.Start(context.Background( )))
+	select {
+		case <- doneChan:
+
+		case <- time.After(5 * time.Second):
+			t.Error("Timed out waiting for the messages to be acknowledged")
+	}
+	assert.NoError(t, dispatcher.Shutdown(context.Background( )))
+
+	assert.Zero(t, mq.overlaps.Load( ))
+}